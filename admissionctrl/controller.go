@@ -4,99 +4,540 @@ package admissionctrl
 // https://github.com/hashicorp/nomad/blob/v1.5.0-beta.1/nomad/job_endpoint_hooks.go
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
+const tracerName = "github.com/mxab/nacp/admissionctrl"
+
 type AdmissionController interface {
 	Name() string
 }
 
 type JobMutator interface {
 	AdmissionController
-	Mutate(*api.Job) (out *api.Job, warnings []error, err error)
+	Mutate(context.Context, *api.Job) (out *api.Job, warnings []error, err error)
 }
 
 type JobValidator interface {
 	AdmissionController
-	Validate(*api.Job) (warnings []error, err error)
+	Validate(context.Context, *api.Job) (warnings []error, err error)
+}
+
+// NamespaceScoped is implemented by admission controllers that only apply to
+// jobs of a single namespace. Controllers not implementing it, or returning an
+// empty namespace, apply to all namespaces.
+type NamespaceScoped interface {
+	Namespace() string
+}
+
+// TimeLimited is implemented by admission controllers that must finish within
+// a timeout. They are cancelled and reported as failed once it is exceeded.
+type TimeLimited interface {
+	Timeout() time.Duration
+}
+
+// Advisory is implemented by validators whose errors are reported as
+// warnings instead of rejecting the job.
+type Advisory interface {
+	WarnOnly() bool
+}
+
+// PostValidation is implemented by mutators that run after the validators,
+// so they only change jobs that passed validation.
+type PostValidation interface {
+	AfterValidation() bool
+}
+
+// Closer is implemented by admission controllers holding resources, like the
+// refresh of remote policies, which are released once they are replaced.
+type Closer interface {
+	Close()
+}
+
+// CloseController closes the controller if it, or the controller wrapped by the settings, is a Closer.
+func CloseController(controller AdmissionController) {
+	switch c := controller.(type) {
+	case *configuredMutator:
+		controller = c.JobMutator
+	case *configuredValidator:
+		controller = c.JobValidator
+	}
+	if closer, ok := controller.(Closer); ok {
+		closer.Close()
+	}
+}
+
+// controllerSettings are applied by the JobHandler to a wrapped controller.
+type controllerSettings struct {
+	namespace       string
+	timeout         time.Duration
+	warnOnly        bool
+	afterValidation bool
+}
+
+func (s controllerSettings) Namespace() string {
+	return s.namespace
+}
+
+func (s controllerSettings) Timeout() time.Duration {
+	return s.timeout
+}
+
+func (s controllerSettings) WarnOnly() bool {
+	return s.warnOnly
+}
+
+func (s controllerSettings) AfterValidation() bool {
+	return s.afterValidation
+}
+
+type configuredMutator struct {
+	JobMutator
+	controllerSettings
+}
+
+type configuredValidator struct {
+	JobValidator
+	controllerSettings
+}
+
+// configureMutator returns a copy of the settings wrapper of the mutator, or a new one.
+func configureMutator(mutator JobMutator) *configuredMutator {
+	if c, ok := mutator.(*configuredMutator); ok {
+		configured := *c
+		return &configured
+	}
+	return &configuredMutator{JobMutator: mutator}
+}
+
+func configureValidator(validator JobValidator) *configuredValidator {
+	if c, ok := validator.(*configuredValidator); ok {
+		configured := *c
+		return &configured
+	}
+	return &configuredValidator{JobValidator: validator}
+}
+
+// ScopeMutator restricts the mutator to jobs of the given namespace.
+// An empty namespace leaves the mutator unscoped.
+func ScopeMutator(mutator JobMutator, namespace string) JobMutator {
+	if namespace == "" {
+		return mutator
+	}
+	configured := configureMutator(mutator)
+	configured.namespace = namespace
+	return configured
+}
+
+// ScopeValidator restricts the validator to jobs of the given namespace.
+// An empty namespace leaves the validator unscoped.
+func ScopeValidator(validator JobValidator, namespace string) JobValidator {
+	if namespace == "" {
+		return validator
+	}
+	configured := configureValidator(validator)
+	configured.namespace = namespace
+	return configured
+}
+
+// LimitMutator cancels the mutator if it doesn't finish within the timeout.
+// A zero timeout leaves the mutator unlimited.
+func LimitMutator(mutator JobMutator, timeout time.Duration) JobMutator {
+	if timeout <= 0 {
+		return mutator
+	}
+	configured := configureMutator(mutator)
+	configured.timeout = timeout
+	return configured
+}
+
+// LimitValidator cancels the validator if it doesn't finish within the timeout.
+// A zero timeout leaves the validator unlimited.
+func LimitValidator(validator JobValidator, timeout time.Duration) JobValidator {
+	if timeout <= 0 {
+		return validator
+	}
+	configured := configureValidator(validator)
+	configured.timeout = timeout
+	return configured
+}
+
+// WarnOnlyValidator reports the errors of the validator as warnings, so it
+// can be observed before it starts rejecting jobs.
+func WarnOnlyValidator(validator JobValidator) JobValidator {
+	configured := configureValidator(validator)
+	configured.warnOnly = true
+	return configured
+}
+
+// PostValidationMutator runs the mutator after the validators instead of before them.
+func PostValidationMutator(mutator JobMutator) JobMutator {
+	configured := configureMutator(mutator)
+	configured.afterValidation = true
+	return configured
+}
+
+func appliesTo(controller AdmissionController, namespace string) bool {
+	scoped, ok := controller.(NamespaceScoped)
+	if !ok || scoped.Namespace() == "" {
+		return true
+	}
+	return scoped.Namespace() == namespace
+}
+
+func isPostValidation(mutator JobMutator) bool {
+	post, ok := mutator.(PostValidation)
+	return ok && post.AfterValidation()
+}
+
+func isWarnOnly(controller AdmissionController) bool {
+	advisory, ok := controller.(Advisory)
+	return ok && advisory.WarnOnly()
+}
+
+func timeoutOf(controller AdmissionController) time.Duration {
+	limited, ok := controller.(TimeLimited)
+	if !ok {
+		return 0
+	}
+	return limited.Timeout()
+}
+
+// runLimited runs fn in its own goroutine and stops waiting for it once the
+// timeout of the controller is exceeded or ctx is done, cancelling the context passed to fn.
+// The result of fn is discarded then, while fn may still be running.
+func runLimited[T any](ctx context.Context, controller AdmissionController, fn func(context.Context) T) (T, error) {
+	timeout := timeoutOf(controller)
+	if timeout <= 0 {
+		return fn(ctx), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan T, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case result := <-done:
+		return result, nil
+	case <-ctx.Done():
+		var zero T
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return zero, fmt.Errorf("timed out after %s", timeout)
+		}
+		return zero, ctx.Err()
+	}
 }
 
 type JobHandler struct {
 	mutators   []JobMutator
 	validators []JobValidator
 	logger     hclog.Logger
+
+	profiles          map[string]*Profile
+	namespaceProfiles map[string]string
+	defaultProfile    string
+
+	validatorConcurrency int
+
+	skipJobIDPrefixes []string
+	skipNamespaces    map[string]bool
+}
+
+// WithSkippedJobs exempts jobs whose id starts with one of the prefixes,
+// or which are submitted to one of the namespaces, from admission control.
+func WithSkippedJobs(jobIDPrefixes []string, namespaces []string) JobHandlerOption {
+	return func(j *JobHandler) {
+		j.skipJobIDPrefixes = jobIDPrefixes
+		j.skipNamespaces = make(map[string]bool, len(namespaces))
+		for _, namespace := range namespaces {
+			j.skipNamespaces[namespace] = true
+		}
+	}
+}
+
+// skipReason explains why the job is exempt from admission control, "" if it isn't.
+func (j *JobHandler) skipReason(req *Request, job *api.Job) string {
+	if j.skipNamespaces[req.Namespace] {
+		return fmt.Sprintf("namespace %s is skipped", req.Namespace)
+	}
+	if job.ID != nil {
+		for _, prefix := range j.skipJobIDPrefixes {
+			if strings.HasPrefix(*job.ID, prefix) {
+				return fmt.Sprintf("job id prefix %s is skipped", prefix)
+			}
+		}
+	}
+	return ""
 }
 
-func NewJobHandler(mutators []JobMutator, validators []JobValidator, logger hclog.Logger) *JobHandler {
-	return &JobHandler{
+// WithValidatorConcurrency limits how many validators of a job run at the same time,
+// 1 runs them one after another. Defaults to GOMAXPROCS.
+func WithValidatorConcurrency(n int) JobHandlerOption {
+	return func(j *JobHandler) {
+		j.validatorConcurrency = n
+	}
+}
+
+func NewJobHandler(mutators []JobMutator, validators []JobValidator, logger hclog.Logger, opts ...JobHandlerOption) *JobHandler {
+	j := &JobHandler{
 		mutators:   mutators,
 		validators: validators,
 		logger:     logger,
 	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	if j.validatorConcurrency <= 0 {
+		j.validatorConcurrency = runtime.GOMAXPROCS(0)
+	}
+	return j
 }
 
-func (j *JobHandler) ApplyAdmissionControllers(job *api.Job) (out *api.Job, warnings []error, err error) {
-	// Mutators run first before validators, so validators view the final rendered job.
-	// So, mutators must handle invalid jobs.
-	out, warnings, err = j.AdmissionMutators(job)
+// ApplyAdmissionControllers runs the mutators and validators that apply to
+// the namespace of the Request in ctx. The pre validation mutators run first,
+// then the validators on their result and at last the post validation mutators.
+func (j *JobHandler) ApplyAdmissionControllers(ctx context.Context, job *api.Job) (out *api.Job, warnings []error, err error) {
+	out, warnings, validationErr, err := j.MutateAndValidate(ctx, job)
 	if err != nil {
 		return nil, nil, err
 	}
+	if validationErr != nil {
+		return nil, nil, validationErr
+	}
+	return out, warnings, nil
+}
 
-	validateWarnings, err := j.AdmissionValidators(job)
+// MutateAndValidate applies the controllers like ApplyAdmissionControllers, but returns
+// the validation errors apart from the errors of the mutators, for callers reporting them.
+// The post validation mutators only run if the job passed validation.
+func (j *JobHandler) MutateAndValidate(ctx context.Context, job *api.Job) (out *api.Job, warnings []error, validationErr error, err error) {
+	// validators view the job rendered by the pre validation mutators,
+	// so these must handle invalid jobs
+	out, warnings, err = j.PreValidationMutators(ctx, job)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+
+	validateWarnings, validationErr := j.AdmissionValidators(ctx, out)
 	warnings = append(warnings, validateWarnings...)
+	if validationErr != nil {
+		return out, warnings, validationErr, nil
+	}
 
-	return out, warnings, nil
+	out, postWarnings, err := j.PostValidationMutators(ctx, out)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out, append(warnings, postWarnings...), nil, nil
+}
+
+type mutateResult struct {
+	job      *api.Job
+	warnings []error
+	err      error
 }
 
-// admissionMutator returns an updated job as well as warnings or an error.
-func (j *JobHandler) AdmissionMutators(job *api.Job) (_ *api.Job, warnings []error, err error) {
+type validateResult struct {
+	warnings []error
+	err      error
+}
+
+// AdmissionMutators returns an updated job as well as warnings or an error.
+// Mutators are applied in order, each one receiving the output of the previous one.
+// The post validation mutators run after the others, like with ApplyAdmissionControllers.
+func (j *JobHandler) AdmissionMutators(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	job, warnings, err := j.PreValidationMutators(ctx, job)
+	if err != nil {
+		return nil, nil, err
+	}
+	job, postWarnings, err := j.PostValidationMutators(ctx, job)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, append(warnings, postWarnings...), nil
+}
+
+// PreValidationMutators applies the mutators running before the validators, see AdmissionMutators.
+func (j *JobHandler) PreValidationMutators(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	return j.applyMutators(ctx, job, false)
+}
+
+// PostValidationMutators applies the mutators running after the validators, see PostValidationMutator.
+func (j *JobHandler) PostValidationMutators(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	return j.applyMutators(ctx, job, true)
+}
+
+// applyMutators applies the mutators of the phase.
+func (j *JobHandler) applyMutators(ctx context.Context, job *api.Job, afterValidation bool) (_ *api.Job, warnings []error, err error) {
+	logger := Logger(ctx, j.logger)
 	var w []error
-	j.logger.Debug("applying job mutators", "mutators", len(j.mutators), "job", job.ID)
-	for _, mutator := range j.mutators {
-		j.logger.Debug("applying job mutator", "mutator", mutator.Name(), "job", job.ID)
-		job, w, err = mutator.Mutate(job)
-		j.logger.Trace("job mutate results", "mutator", mutator.Name(), "warnings", w, "error", err)
+	req := RequestFromContext(ctx)
+	if reason := j.skipReason(req, job); reason != "" {
+		logger.Debug("skipping job mutators", "job", job.ID, "reason", reason)
+		return job, nil, nil
+	}
+	namespace := req.Namespace
+	var mutators []JobMutator
+	for _, mutator := range j.mutatorsFor(req) {
+		if isPostValidation(mutator) == afterValidation {
+			mutators = append(mutators, mutator)
+		}
+	}
+	if len(mutators) == 0 {
+		return job, nil, nil
+	}
+	logger.Debug("applying job mutators", "mutators", len(mutators), "job", job.ID, "namespace", namespace, "profile", req.Profile, "after_validation", afterValidation)
+	for _, mutator := range mutators {
+		if !appliesTo(mutator, namespace) {
+			logger.Trace("skipping job mutator for namespace", "mutator", mutator.Name(), "namespace", namespace)
+			continue
+		}
+		logger.Debug("applying job mutator", "mutator", mutator.Name(), "job", job.ID)
+		mutatorCtx, span := startControllerSpan(ctx, "mutator", mutator)
+		input := job
+		if timeoutOf(mutator) > 0 {
+			// a timed out mutator keeps running in the background, so it gets its own copy
+			input = copyJob(job)
+		}
+		result, limitErr := runLimited(mutatorCtx, mutator, func(ctx context.Context) mutateResult {
+			out, w, err := mutator.Mutate(ctx, input)
+			return mutateResult{out, w, err}
+		})
+		job, w, err = result.job, result.warnings, result.err
+		if limitErr != nil {
+			err = limitErr
+		}
+		endControllerSpan(span, err)
+		logger.Trace("job mutate results", "mutator", mutator.Name(), "warnings", w, "error", err)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error in job mutator %s: %v", mutator.Name(), err)
+			kind := ErrControllerFailure
+			if errors.Is(err, ErrPolicyDenied) {
+				kind = ErrPolicyDenied
+			}
+			return nil, nil, fmt.Errorf("error in job mutator %s: %w", mutator.Name(), classify(mutator.Name(), err, kind, true))
 		}
+		req.Mutators = append(req.Mutators, mutator.Name())
 		warnings = append(warnings, w...)
 	}
 	return job, warnings, err
 }
 
 // AdmissionValidators returns a slice of validation warnings and a multierror
-// of validation failures.
-func (j *JobHandler) AdmissionValidators(origJob *api.Job) ([]error, error) {
+// of validation failures. Validators run concurrently, their warnings and errors
+// are reported in the order of the validators.
+func (j *JobHandler) AdmissionValidators(ctx context.Context, origJob *api.Job) ([]error, error) {
+	logger := Logger(ctx, j.logger)
+	req := RequestFromContext(ctx)
+	if reason := j.skipReason(req, origJob); reason != "" {
+		logger.Debug("skipping job validators", "job", origJob.ID, "reason", reason)
+		return nil, nil
+	}
+	namespace := req.Namespace
+	validators := j.validatorsFor(req)
 	// ensure job is not mutated
-	j.logger.Debug("applying job validators", "validators", len(j.validators), "job", origJob.ID)
+	logger.Debug("applying job validators", "validators", len(validators), "job", origJob.ID, "namespace", namespace, "profile", req.Profile)
 	job := copyJob(origJob)
 
+	applicable := make([]JobValidator, 0, len(validators))
+	for _, validator := range validators {
+		if !appliesTo(validator, namespace) {
+			logger.Trace("skipping job validator for namespace", "validator", validator.Name(), "namespace", namespace)
+			continue
+		}
+		applicable = append(applicable, validator)
+	}
+
+	results := make([]validateResult, len(applicable))
+	group := &errgroup.Group{}
+	group.SetLimit(j.validatorConcurrency)
+	for i, validator := range applicable {
+		i, validator := i, validator
+		group.Go(func() error {
+			// validators share the job copy, they must not modify it
+			results[i] = j.validate(ctx, validator, job)
+			return nil
+		})
+	}
+	_ = group.Wait()
+
 	var warnings []error
 	var errs error
-
-	for _, validator := range j.validators {
-		j.logger.Debug("applying job validator", "validator", validator.Name(), "job", job.ID)
-		w, err := validator.Validate(job)
-		j.logger.Trace("job validate results", "validator", validator.Name(), "warnings", w, "error", err)
-		if err != nil {
-			errs = multierror.Append(errs, err)
+	for _, result := range results {
+		if result.err != nil {
+			errs = multierror.Append(errs, result.err)
 		}
-		warnings = append(warnings, w...)
+		warnings = append(warnings, result.warnings...)
 	}
 
 	return warnings, errs
 
 }
 
+func (j *JobHandler) validate(ctx context.Context, validator JobValidator, job *api.Job) validateResult {
+	logger := Logger(ctx, j.logger)
+	logger.Debug("applying job validator", "validator", validator.Name(), "job", job.ID)
+	validatorCtx, span := startControllerSpan(ctx, "validator", validator)
+	result, limitErr := runLimited(validatorCtx, validator, func(ctx context.Context) validateResult {
+		w, err := validator.Validate(ctx, job)
+		return validateResult{w, err}
+	})
+	w, err := result.warnings, result.err
+	if limitErr != nil {
+		logger.Warn("Job validator cancelled", "validator", validator.Name(), "error", limitErr)
+		err = ControllerFailure(fmt.Errorf("error in job validator %s: %w", validator.Name(), limitErr))
+	}
+	endControllerSpan(span, err)
+	logger.Trace("job validate results", "validator", validator.Name(), "warnings", w, "error", err)
+	if err != nil && isWarnOnly(validator) {
+		logger.Info("Job validator in warn mode would reject job", "validator", validator.Name(), "job", job.ID, "error", err)
+		w = append(w, downgrade(err)...)
+		err = nil
+	}
+	return validateResult{w, classify(validator.Name(), err, ErrPolicyDenied, false)}
+}
+
+// downgrade turns the errors of a validator into warnings.
+func downgrade(err error) []error {
+	if merr, ok := err.(*multierror.Error); ok {
+		return merr.WrappedErrors()
+	}
+	return []error{err}
+}
+
+// startControllerSpan starts a span for a single admission controller.
+// It is a no-op unless a global tracer provider is configured.
+func startControllerSpan(ctx context.Context, kind string, controller AdmissionController) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, kind+" "+controller.Name(), trace.WithAttributes(
+		attribute.String("nacp.controller.kind", kind),
+		attribute.String("nacp.controller.name", controller.Name()),
+	))
+}
+
+func endControllerSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 func copyJob(job *api.Job) *api.Job {
 	jobCopy := &api.Job{}
 	data, err := json.Marshal(job)
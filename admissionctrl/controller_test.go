@@ -1,12 +1,26 @@
 package admissionctrl
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
 	"github.com/mxab/nacp/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestJobHandler_ApplyAdmissionControllers(t *testing.T) {
@@ -50,7 +64,7 @@ func TestJobHandler_ApplyAdmissionControllers(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			j := NewJobHandler([]JobMutator{tt.fields.mutator}, []JobValidator{tt.fields.validator}, hclog.NewNullLogger())
-			_, warnings, err := j.ApplyAdmissionControllers(tt.args.job)
+			_, warnings, err := j.ApplyAdmissionControllers(context.Background(), tt.args.job)
 			assert.Empty(t, warnings, "No Warnings")
 
 			if (err != nil) != tt.wantErr {
@@ -70,3 +84,484 @@ func TestJobHandler_ApplyAdmissionControllers(t *testing.T) {
 		})
 	}
 }
+
+func TestJobHandler_NamespaceScopedControllers(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		namespace string
+		wantMeta  map[string]string
+		wantWarns int
+	}{
+		{
+			name:      "scoped controllers apply in their namespace",
+			namespace: "team-a",
+			wantMeta:  map[string]string{"hello": "world"},
+			wantWarns: 1,
+		},
+		{
+			name:      "scoped controllers are skipped in other namespaces",
+			namespace: "team-b",
+			wantMeta:  nil,
+			wantWarns: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("some warning")}, nil)
+
+			j := NewJobHandler(
+				[]JobMutator{ScopeMutator(&testutil.HelloMutator{}, "team-a")},
+				[]JobValidator{ScopeValidator(validator, "team-a")},
+				hclog.NewNullLogger(),
+			)
+			ctx := WithRequest(context.Background(), &Request{Namespace: tt.namespace})
+			job, warnings, err := j.ApplyAdmissionControllers(ctx, &api.Job{})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+			assert.Len(t, warnings, tt.wantWarns)
+		})
+	}
+}
+
+func TestJobHandler_SkippedJobs(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		namespace string
+		jobID     string
+		wantMeta  map[string]string
+		wantWarns int
+	}{
+		{
+			name:      "other jobs are admitted",
+			namespace: "team-a",
+			jobID:     "web",
+			wantMeta:  map[string]string{"hello": "world"},
+			wantWarns: 1,
+		},
+		{
+			name:      "skipped namespace",
+			namespace: "platform",
+			jobID:     "web",
+		},
+		{
+			name:      "skipped job id prefix",
+			namespace: "team-a",
+			jobID:     "infra-traefik",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("some warning")}, nil)
+
+			j := NewJobHandler(
+				[]JobMutator{&testutil.HelloMutator{}},
+				[]JobValidator{validator},
+				hclog.NewNullLogger(),
+				WithSkippedJobs([]string{"infra-"}, []string{"platform"}),
+			)
+			ctx := WithRequest(context.Background(), &Request{Namespace: tt.namespace})
+			job, warnings, err := j.ApplyAdmissionControllers(ctx, &api.Job{ID: &tt.jobID})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+			assert.Len(t, warnings, tt.wantWarns)
+		})
+	}
+}
+
+func TestScopeWithoutNamespaceIsUnscoped(t *testing.T) {
+	mutator := &testutil.HelloMutator{}
+	validator := new(testutil.MockValidator)
+
+	assert.Same(t, mutator, ScopeMutator(mutator, ""))
+	assert.Same(t, validator, ScopeValidator(validator, ""))
+}
+
+func TestJobHandler_ControllerSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(&api.Job{}, []error{}, nil)
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("rejected"))
+
+	j := NewJobHandler(
+		[]JobMutator{mutator},
+		[]JobValidator{validator},
+		hclog.NewNullLogger(),
+	)
+	_, _, err := j.ApplyAdmissionControllers(context.Background(), &api.Job{})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "mutator mock-mutator", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("nacp.controller.name", "mock-mutator"))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "validator mock-validator", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), attribute.String("nacp.controller.kind", "validator"))
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+type funcValidator struct {
+	name     string
+	validate func(ctx context.Context, job *api.Job) ([]error, error)
+}
+
+func (v *funcValidator) Name() string {
+	return v.name
+}
+
+func (v *funcValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	return v.validate(ctx, job)
+}
+
+func TestJobHandler_ControllerTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cancelled := make(chan struct{})
+
+	stuck := &funcValidator{name: "stuck", validate: func(ctx context.Context, job *api.Job) ([]error, error) {
+		<-ctx.Done()
+		close(cancelled)
+		// ignores the cancellation like a stuck webhook
+		<-release
+		return nil, nil
+	}}
+	fast := func(name string) JobValidator {
+		return &funcValidator{name: name, validate: func(ctx context.Context, job *api.Job) ([]error, error) {
+			return []error{fmt.Errorf("%s done", name)}, nil
+		}}
+	}
+	j := NewJobHandler(nil, []JobValidator{
+		fast("first"),
+		LimitValidator(stuck, 50*time.Millisecond),
+		LimitValidator(fast("second"), time.Second),
+	}, hclog.NewNullLogger())
+
+	start := time.Now()
+	warnings, err := j.AdmissionValidators(context.Background(), &api.Job{})
+
+	assert.Less(t, time.Since(start), time.Second, "the stuck validator doesn't hold up the others")
+	assert.Equal(t, []error{fmt.Errorf("first done"), fmt.Errorf("second done")}, warnings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error in job validator stuck: timed out after 50ms")
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the context of the stuck validator was not cancelled")
+	}
+}
+
+func TestJobHandler_MutatorTimeout(t *testing.T) {
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).WaitUntil(time.After(time.Minute)).Return(&api.Job{}, []error{}, nil)
+
+	j := NewJobHandler([]JobMutator{LimitMutator(mutator, 50*time.Millisecond)}, nil, hclog.NewNullLogger())
+	_, _, err := j.AdmissionMutators(context.Background(), &api.Job{})
+
+	require.Error(t, err)
+	assert.Equal(t, "error in job mutator mock-mutator: timed out after 50ms", err.Error())
+}
+
+func TestJobHandler_TimedOutMutatorGetsACopy(t *testing.T) {
+	finished := make(chan struct{})
+	slow := &funcMutator{name: "slow", mutate: func(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+		<-ctx.Done()
+		// ignores the cancellation and modifies the job afterwards
+		job.Meta = map[string]string{"late": "true"}
+		close(finished)
+		return job, nil, nil
+	}}
+	job := &api.Job{ID: pointer.Of("example")}
+
+	j := NewJobHandler([]JobMutator{LimitMutator(slow, 50*time.Millisecond)}, nil, hclog.NewNullLogger())
+	_, _, err := j.AdmissionMutators(context.Background(), job)
+	require.Error(t, err)
+
+	<-finished
+	assert.Nil(t, job.Meta, "the job of the request is not modified")
+}
+
+func TestJobHandler_LimitedMutatorResultIsUsed(t *testing.T) {
+	setMeta := &funcMutator{name: "meta", mutate: func(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+		job.Meta = map[string]string{"set": "true"}
+		return job, nil, nil
+	}}
+
+	j := NewJobHandler([]JobMutator{LimitMutator(setMeta, time.Second)}, nil, hclog.NewNullLogger())
+	out, _, err := j.AdmissionMutators(context.Background(), &api.Job{ID: pointer.Of("example")})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"set": "true"}, out.Meta)
+}
+
+func TestControllerSettingsCompose(t *testing.T) {
+	validator := LimitValidator(ScopeValidator(new(testutil.MockValidator), "team-a"), time.Second)
+
+	assert.Equal(t, "team-a", validator.(NamespaceScoped).Namespace())
+	assert.Equal(t, time.Second, validator.(TimeLimited).Timeout())
+	assert.True(t, appliesTo(LimitValidator(new(testutil.MockValidator), time.Second), "any"), "limited only controllers stay unscoped")
+}
+
+type closingValidator struct {
+	funcValidator
+	closed int
+}
+
+func (v *closingValidator) Close() {
+	v.closed++
+}
+
+func TestCloseController(t *testing.T) {
+	validator := &closingValidator{funcValidator: funcValidator{name: "closing"}}
+
+	CloseController(validator)
+	CloseController(WarnOnlyValidator(ScopeValidator(validator, "team-a")))
+	CloseController(new(testutil.MockValidator))
+
+	assert.Equal(t, 2, validator.closed, "wrapped controllers should be closed too")
+}
+
+func TestJobHandler_WarnOnlyValidators(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{fmt.Errorf("deprecated")}, multierror.Append(fmt.Errorf("no owner"), fmt.Errorf("no cost center")))
+
+	tests := []struct {
+		name         string
+		validator    JobValidator
+		wantWarnings []error
+		wantErr      bool
+	}{
+		{
+			name:         "enforced",
+			validator:    rejecting,
+			wantWarnings: []error{fmt.Errorf("deprecated")},
+			wantErr:      true,
+		},
+		{
+			name:         "warn only",
+			validator:    WarnOnlyValidator(rejecting),
+			wantWarnings: []error{fmt.Errorf("deprecated"), fmt.Errorf("no owner"), fmt.Errorf("no cost center")},
+		},
+		{
+			name:         "warn only keeps other settings",
+			validator:    WarnOnlyValidator(ScopeValidator(rejecting, "default")),
+			wantWarnings: []error{fmt.Errorf("deprecated"), fmt.Errorf("no owner"), fmt.Errorf("no cost center")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJobHandler(nil, []JobValidator{tt.validator}, hclog.NewNullLogger())
+			ctx := WithRequest(context.Background(), &Request{Namespace: "default"})
+			warnings, err := j.AdmissionValidators(ctx, &api.Job{})
+			assert.Equal(t, tt.wantWarnings, warnings)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// sleepingValidator warns with its name after the delay.
+type sleepingValidator struct {
+	name  string
+	delay time.Duration
+	start func()
+	done  func()
+}
+
+func (v *sleepingValidator) Name() string {
+	return v.name
+}
+
+func (v *sleepingValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	if v.start != nil {
+		v.start()
+		defer v.done()
+	}
+	time.Sleep(v.delay)
+	if strings.HasPrefix(v.name, "reject") {
+		return nil, fmt.Errorf("%s rejected", v.name)
+	}
+	return []error{fmt.Errorf("%s done", v.name)}, nil
+}
+
+func TestJobHandler_ConcurrentValidatorsKeepOrder(t *testing.T) {
+	j := NewJobHandler(nil, []JobValidator{
+		&sleepingValidator{name: "slow", delay: 50 * time.Millisecond},
+		&sleepingValidator{name: "reject-slow", delay: 30 * time.Millisecond},
+		&sleepingValidator{name: "fast"},
+		&sleepingValidator{name: "reject-fast"},
+	}, hclog.NewNullLogger(), WithValidatorConcurrency(4))
+
+	warnings, err := j.AdmissionValidators(context.Background(), &api.Job{})
+
+	assert.Equal(t, []error{fmt.Errorf("slow done"), fmt.Errorf("fast done")}, warnings)
+	require.Error(t, err)
+	assert.Equal(t, []error{
+		&ControllerError{Controller: "reject-slow", Kind: ErrPolicyDenied, Err: fmt.Errorf("reject-slow rejected")},
+		&ControllerError{Controller: "reject-fast", Kind: ErrPolicyDenied, Err: fmt.Errorf("reject-fast rejected")},
+	}, err.(*multierror.Error).Errors)
+}
+
+func TestJobHandler_ValidatorConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{name: "sequential", concurrency: 1},
+		{name: "limited", concurrency: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			start := func() {
+				mu.Lock()
+				defer mu.Unlock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+			}
+			done := func() {
+				mu.Lock()
+				defer mu.Unlock()
+				running--
+			}
+			var validators []JobValidator
+			for i := 0; i < 10; i++ {
+				validators = append(validators, &sleepingValidator{name: fmt.Sprintf("v%d", i), delay: 10 * time.Millisecond, start: start, done: done})
+			}
+			j := NewJobHandler(nil, validators, hclog.NewNullLogger(), WithValidatorConcurrency(tt.concurrency))
+
+			warnings, err := j.AdmissionValidators(context.Background(), &api.Job{})
+			require.NoError(t, err)
+			assert.Len(t, warnings, 10)
+			assert.Equal(t, tt.concurrency, maxRunning)
+		})
+	}
+}
+
+func BenchmarkAdmissionValidators(b *testing.B) {
+	var validators []JobValidator
+	for i := 0; i < 10; i++ {
+		validators = append(validators, &sleepingValidator{name: fmt.Sprintf("v%d", i), delay: time.Millisecond})
+	}
+	for _, concurrency := range []int{1, 10} {
+		b.Run(fmt.Sprintf("concurrency %d", concurrency), func(b *testing.B) {
+			j := NewJobHandler(nil, validators, hclog.NewNullLogger(), WithValidatorConcurrency(concurrency))
+			for i := 0; i < b.N; i++ {
+				if _, err := j.AdmissionValidators(context.Background(), &api.Job{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+type funcMutator struct {
+	name   string
+	mutate func(ctx context.Context, job *api.Job) (*api.Job, []error, error)
+}
+
+func (m *funcMutator) Name() string {
+	return m.name
+}
+
+func (m *funcMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	return m.mutate(ctx, job)
+}
+
+func TestJobHandler_MutatorPhases(t *testing.T) {
+	setMeta := func(name string) JobMutator {
+		return &funcMutator{name: name, mutate: func(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+			out := *job
+			out.Meta = map[string]string{}
+			for k, v := range job.Meta {
+				out.Meta[k] = v
+			}
+			out.Meta[name] = fmt.Sprint(len(job.Meta))
+			return &out, nil, nil
+		}}
+	}
+	var validated map[string]string
+	validator := &funcValidator{name: "seen", validate: func(ctx context.Context, job *api.Job) ([]error, error) {
+		validated = job.Meta
+		if job.Meta["reject"] != "" {
+			return nil, fmt.Errorf("rejected")
+		}
+		return nil, nil
+	}}
+
+	tests := []struct {
+		name          string
+		meta          map[string]string
+		wantValidated map[string]string
+		wantMeta      map[string]string
+		wantMutators  []string
+		wantErr       bool
+	}{
+		{
+			name:          "pre mutators run before and post mutators after the validators",
+			wantValidated: map[string]string{"normalize": "0"},
+			wantMeta:      map[string]string{"normalize": "0", "defaults": "1"},
+			wantMutators:  []string{"normalize", "defaults"},
+		},
+		{
+			name:          "post mutators don't run on rejected jobs",
+			meta:          map[string]string{"reject": "yes"},
+			wantValidated: map[string]string{"reject": "yes", "normalize": "1"},
+			wantMutators:  []string{"normalize"},
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the post mutator is defined first but runs last
+			j := NewJobHandler([]JobMutator{PostValidationMutator(setMeta("defaults")), setMeta("normalize")}, []JobValidator{validator}, hclog.NewNullLogger())
+			req := &Request{}
+
+			out, _, err := j.ApplyAdmissionControllers(WithRequest(context.Background(), req), &api.Job{Meta: tt.meta})
+
+			assert.Equal(t, tt.wantValidated, validated)
+			assert.Equal(t, tt.wantMutators, req.Mutators)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMeta, out.Meta)
+		})
+	}
+}
+
+func TestJobHandler_AdmissionMutatorsRunsAllPhases(t *testing.T) {
+	mutator := func(name string) JobMutator {
+		return &funcMutator{name: name, mutate: func(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+			return job, nil, nil
+		}}
+	}
+	j := NewJobHandler([]JobMutator{PostValidationMutator(mutator("post")), mutator("pre")}, nil, hclog.NewNullLogger())
+	req := &Request{}
+
+	_, _, err := j.AdmissionMutators(WithRequest(context.Background(), req), &api.Job{})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pre", "post"}, req.Mutators)
+}
@@ -0,0 +1,75 @@
+package admissionctrl
+
+import (
+	"errors"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Kinds of admission controller errors, see ControllerError.
+var (
+	// ErrPolicyDenied is a rejection of the job by a policy.
+	ErrPolicyDenied = errors.New("denied by policy")
+	// ErrControllerFailure is a failure to evaluate the job, like a crashed policy or an unreachable webhook.
+	ErrControllerFailure = errors.New("admission controller failed")
+)
+
+// ControllerError is an error of an admission controller, with errors.Is
+// matching its Kind. The JobHandler classifies all controller errors:
+// errors of validators are policy denials and errors of mutators are failures,
+// unless the controller marked them with PolicyDenied or ControllerFailure.
+type ControllerError struct {
+	// Controller is the name of the admission controller, set by the JobHandler.
+	Controller string
+	// Kind is ErrPolicyDenied or ErrControllerFailure.
+	Kind error
+	Err  error
+}
+
+func (e *ControllerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ControllerError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ControllerError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// PolicyDenied marks err as a rejection of the job.
+func PolicyDenied(err error) error {
+	return classify("", err, ErrPolicyDenied, true)
+}
+
+// ControllerFailure marks err as a failure to evaluate the job.
+func ControllerFailure(err error) error {
+	return classify("", err, ErrControllerFailure, true)
+}
+
+// classify wraps err, or each error of a multierror, in a ControllerError of the controller.
+// Errors already classified keep their kind, unless force is set.
+func classify(controller string, err error, kind error, force bool) error {
+	if err == nil {
+		return nil
+	}
+	if merr, ok := err.(*multierror.Error); ok {
+		classified := &multierror.Error{ErrorFormat: merr.ErrorFormat}
+		for _, e := range merr.Errors {
+			classified.Errors = append(classified.Errors, classify(controller, e, kind, force))
+		}
+		return classified
+	}
+	var marked *ControllerError
+	if errors.As(err, &marked) && !force {
+		kind = marked.Kind
+	}
+	if e, ok := err.(*ControllerError); ok {
+		if e.Controller != "" {
+			controller = e.Controller
+		}
+		err = e.Err
+	}
+	return &ControllerError{Controller: controller, Kind: kind, Err: err}
+}
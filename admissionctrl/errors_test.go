@@ -0,0 +1,96 @@
+package admissionctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		force bool
+		want  error
+	}{
+		{
+			name: "plain error",
+			err:  errors.New("no owner"),
+			want: &ControllerError{Controller: "owner", Kind: ErrPolicyDenied, Err: errors.New("no owner")},
+		},
+		{
+			name: "marked error keeps its kind",
+			err:  ControllerFailure(errors.New("crashed")),
+			want: &ControllerError{Controller: "owner", Kind: ErrControllerFailure, Err: errors.New("crashed")},
+		},
+		{
+			name:  "forced kind",
+			err:   ControllerFailure(errors.New("crashed")),
+			force: true,
+			want:  &ControllerError{Controller: "owner", Kind: ErrPolicyDenied, Err: errors.New("crashed")},
+		},
+		{
+			name: "multierror",
+			err:  multierror.Append(errors.New("no owner"), ControllerFailure(errors.New("crashed"))),
+			want: multierror.Append(
+				&ControllerError{Controller: "owner", Kind: ErrPolicyDenied, Err: errors.New("no owner")},
+				&ControllerError{Controller: "owner", Kind: ErrControllerFailure, Err: errors.New("crashed")},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify("owner", tt.err, ErrPolicyDenied, tt.force)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.err.Error(), got.Error(), "the message is kept")
+		})
+	}
+	assert.Nil(t, classify("owner", nil, ErrPolicyDenied, false))
+}
+
+func TestJobHandler_ErrorKinds(t *testing.T) {
+	failingMutator := new(testutil.MockMutator)
+	failingMutator.On("Mutate", mock.Anything).Return((*api.Job)(nil), []error{}, errors.New("connection refused"))
+	denyingMutator := new(testutil.MockMutator)
+	denyingMutator.On("Mutate", mock.Anything).Return((*api.Job)(nil), []error{}, PolicyDenied(errors.New("no owner")))
+	denyingValidator := new(testutil.MockValidator)
+	denyingValidator.On("Validate", mock.Anything).Return([]error{}, errors.New("no owner"))
+	failingValidator := new(testutil.MockValidator)
+	failingValidator.On("Validate", mock.Anything).Return([]error{}, ControllerFailure(errors.New("policy crashed")))
+
+	tests := []struct {
+		name       string
+		mutators   []JobMutator
+		validators []JobValidator
+		wantKind   error
+	}{
+		{name: "failing mutator", mutators: []JobMutator{failingMutator}, wantKind: ErrControllerFailure},
+		{name: "denying mutator", mutators: []JobMutator{denyingMutator}, wantKind: ErrPolicyDenied},
+		{name: "denying validator", validators: []JobValidator{denyingValidator}, wantKind: ErrPolicyDenied},
+		{name: "failing validator", validators: []JobValidator{failingValidator}, wantKind: ErrControllerFailure},
+		{name: "timed out validator", validators: []JobValidator{LimitValidator(&sleepingValidator{name: "slow", delay: time.Second}, 10*time.Millisecond)}, wantKind: ErrControllerFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJobHandler(tt.mutators, tt.validators, hclog.NewNullLogger())
+			_, _, err := j.ApplyAdmissionControllers(context.Background(), &api.Job{})
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.wantKind)
+
+			var controllerErr *ControllerError
+			require.ErrorAs(t, err, &controllerErr)
+			assert.NotEmpty(t, controllerErr.Controller)
+			assert.NotContains(t, fmt.Sprint(err), "denied by policy")
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleMessage is an error or warning returned by a rule, annotated with the
+// name of the rule it originates from.
+type RuleMessage struct {
+	Msg  string
+	Rule string
+	// File and Query are the policy file and query of the rule, if it reports them.
+	File  string
+	Query string
+}
+
+// Error annotates the message with its rule as "msg (rule)", or as
+// "msg (rule=name file=... query="...")" if the file or query is set.
+func (m *RuleMessage) Error() string {
+	if m.File == "" && m.Query == "" {
+		return fmt.Sprintf("%s (%s)", m.Msg, m.Rule)
+	}
+	provenance := []string{"rule=" + m.Rule}
+	if m.File != "" {
+		provenance = append(provenance, "file="+m.File)
+	}
+	if m.Query != "" {
+		provenance = append(provenance, fmt.Sprintf("query=%q", m.Query))
+	}
+	return fmt.Sprintf("%s (%s)", m.Msg, strings.Join(provenance, " "))
+}
@@ -0,0 +1,28 @@
+package admissionctrl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleMessageError(t *testing.T) {
+	tests := []struct {
+		name    string
+		message RuleMessage
+		want    string
+	}{
+		{name: "rule", message: RuleMessage{Msg: "Job has no owner", Rule: "owner"}, want: "Job has no owner (owner)"},
+		{
+			name:    "file and query",
+			message: RuleMessage{Msg: "Job has no owner", Rule: "owner", File: "policies/owner.rego", Query: "errors = data.owner.errors"},
+			want:    `Job has no owner (rule=owner file=policies/owner.rego query="errors = data.owner.errors")`,
+		},
+		{name: "only file", message: RuleMessage{Msg: "Job has no owner", Rule: "owner", File: "policies/owner.rego"}, want: "Job has no owner (rule=owner file=policies/owner.rego)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.message.Error())
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// DatacenterDefaultsMutator sets the datacenters of jobs which don't specify any.
+type DatacenterDefaultsMutator struct {
+	name        string
+	logger      hclog.Logger
+	datacenters []string
+}
+
+func (m *DatacenterDefaultsMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	if len(job.Datacenters) > 0 || len(m.datacenters) == 0 {
+		return job, nil, nil
+	}
+	logger.Debug("Setting default datacenters", "rule", m.name, "datacenters", m.datacenters, "job", job.ID)
+	job.Datacenters = append([]string{}, m.datacenters...)
+
+	warning := &admissionctrl.RuleMessage{
+		Msg:  fmt.Sprintf("No datacenters specified, using %s", strings.Join(m.datacenters, ", ")),
+		Rule: m.name,
+	}
+	return job, []error{warning}, nil
+}
+
+func (m *DatacenterDefaultsMutator) Name() string {
+	return m.name
+}
+
+// NewDatacenterDefaultsMutator creates a mutator setting datacenters on jobs without any.
+func NewDatacenterDefaultsMutator(name string, datacenters []string, logger hclog.Logger) *DatacenterDefaultsMutator {
+	return &DatacenterDefaultsMutator{
+		name:        name,
+		logger:      logger,
+		datacenters: datacenters,
+	}
+}
@@ -0,0 +1,47 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatacenterDefaultsMutator(t *testing.T) {
+	tests := []struct {
+		name            string
+		job             *api.Job
+		wantDatacenters []string
+		wantWarnings    []error
+	}{
+		{
+			name:            "sets datacenters on job without datacenters",
+			job:             &api.Job{},
+			wantDatacenters: []string{"dc1", "dc2"},
+			wantWarnings: []error{&admissionctrl.RuleMessage{
+				Msg:  "No datacenters specified, using dc1, dc2",
+				Rule: "dcs",
+			}},
+		},
+		{
+			name:            "keeps explicit datacenters",
+			job:             &api.Job{Datacenters: []string{"edge"}},
+			wantDatacenters: []string{"edge"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDatacenterDefaultsMutator("dcs", []string{"dc1", "dc2"}, hclog.NewNullLogger())
+
+			job, warnings, err := m.Mutate(context.Background(), tt.job)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWarnings, warnings)
+			assert.Equal(t, tt.wantDatacenters, job.Datacenters)
+		})
+	}
+}
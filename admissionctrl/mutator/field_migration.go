@@ -0,0 +1,241 @@
+package mutator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// MigrationRule moves a deprecated field of the job to its replacement.
+// Paths are dot separated field names of the job as sent to the Nomad API,
+// "*" matches every element of a list, e.g. "TaskGroups.*.Tasks.*.Resources.Networks".
+// An empty To drops the deprecated field.
+type MigrationRule struct {
+	From    string
+	To      string
+	Message string
+}
+
+type migrationRule struct {
+	from    []string
+	to      []string
+	message string
+}
+
+// FieldMigrationMutator migrates deprecated fields of jobs to their replacements.
+type FieldMigrationMutator struct {
+	name   string
+	logger hclog.Logger
+	rules  []migrationRule
+}
+
+func (m *FieldMigrationMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []error
+	for _, rule := range m.rules {
+		walkFields(doc, rule.from, nil, "", func(parent map[string]interface{}, key string, indexes []int, path string) {
+			if rule.to == nil {
+				delete(parent, key)
+				warnings = append(warnings, m.warning(job, rule, fmt.Sprintf("%s is deprecated and was removed", path)))
+				return
+			}
+			target, targetKey, ok := fieldParent(doc, rule.to, indexes)
+			if !ok {
+				return
+			}
+			to := strings.Join(rule.to, ".")
+			if !isEmptyField(target[targetKey]) {
+				warnings = append(warnings, m.warning(job, rule, fmt.Sprintf("%s is deprecated but was not migrated as %s is already set", path, to)))
+				return
+			}
+			target[targetKey] = parent[key]
+			delete(parent, key)
+			warnings = append(warnings, m.warning(job, rule, fmt.Sprintf("%s is deprecated and was migrated to %s", path, to)))
+		})
+	}
+	if len(warnings) == 0 {
+		return job, nil, nil
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrated := &api.Job{}
+	if err := json.Unmarshal(data, migrated); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate job fields: %w", err)
+	}
+	logger.Debug("Migrated deprecated job fields", "rule", m.name, "job", job.ID, "migrations", len(warnings))
+	return migrated, warnings, nil
+}
+
+func (m *FieldMigrationMutator) warning(job *api.Job, rule migrationRule, msg string) error {
+	if rule.message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, rule.message)
+	}
+	id := ""
+	if job.ID != nil {
+		id = *job.ID
+	}
+	return &admissionctrl.RuleMessage{
+		Msg:  fmt.Sprintf("Job %s: %s", id, msg),
+		Rule: m.name,
+	}
+}
+
+// walkFields calls visit for every non-empty field matching the path.
+// indexes are the list positions matched by the wildcards, path describes the field
+// with list elements named by their Name field if they have one.
+func walkFields(node map[string]interface{}, segments []string, indexes []int, path string, visit func(parent map[string]interface{}, key string, indexes []int, path string)) {
+	key := segments[0]
+	value, ok := node[key]
+	if !ok || isEmptyField(value) {
+		return
+	}
+	path = joinFieldPath(path, key)
+	rest := segments[1:]
+	if len(rest) == 0 {
+		visit(node, key, indexes, path)
+		return
+	}
+	if rest[0] != "*" {
+		if child, ok := value.(map[string]interface{}); ok {
+			walkFields(child, rest, indexes, path, visit)
+		}
+		return
+	}
+	list, ok := value.([]interface{})
+	if !ok || len(rest) == 1 {
+		return
+	}
+	for i, element := range list {
+		child, ok := element.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		walkFields(child, rest[1:], append(append([]int{}, indexes...), i), path+elementName(child, i), visit)
+	}
+}
+
+// fieldParent returns the object holding the last field of the path, creating
+// missing objects on the way. Wildcards select the list elements by indexes.
+func fieldParent(doc map[string]interface{}, segments []string, indexes []int) (map[string]interface{}, string, bool) {
+	node := doc
+	for i := 0; i < len(segments)-1; i++ {
+		key := segments[i]
+		if segments[i+1] == "*" {
+			list, ok := node[key].([]interface{})
+			if !ok || len(indexes) == 0 || indexes[0] >= len(list) {
+				return nil, "", false
+			}
+			child, ok := list[indexes[0]].(map[string]interface{})
+			if !ok {
+				return nil, "", false
+			}
+			node, indexes = child, indexes[1:]
+			i++
+			continue
+		}
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			node[key] = child
+		}
+		node = child
+	}
+	return node, segments[len(segments)-1], true
+}
+
+func isEmptyField(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func joinFieldPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func elementName(element map[string]interface{}, index int) string {
+	if name, ok := element["Name"].(string); ok && name != "" {
+		return fmt.Sprintf("[%s]", name)
+	}
+	return fmt.Sprintf("[%d]", index)
+}
+
+func (m *FieldMigrationMutator) Name() string {
+	return m.name
+}
+
+// NewFieldMigrationMutator creates a mutator applying the migration rules in order.
+// The wildcards of a rule's To path must select the same lists as the leading wildcards of its From path.
+func NewFieldMigrationMutator(name string, rules []MigrationRule, logger hclog.Logger) (*FieldMigrationMutator, error) {
+	m := &FieldMigrationMutator{
+		name:   name,
+		logger: logger,
+	}
+	for _, r := range rules {
+		rule := migrationRule{message: r.Message}
+		if r.From == "" {
+			return nil, fmt.Errorf("migration rule of %s requires a from path", name)
+		}
+		rule.from = strings.Split(r.From, ".")
+		if r.To != "" {
+			rule.to = strings.Split(r.To, ".")
+		}
+		if err := validateMigrationPaths(rule.from, rule.to); err != nil {
+			return nil, fmt.Errorf("invalid migration rule %s -> %s: %w", r.From, r.To, err)
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+func validateMigrationPaths(from []string, to []string) error {
+	for _, path := range [][]string{from, to} {
+		for i, segment := range path {
+			if segment == "" {
+				return fmt.Errorf("empty field name")
+			}
+			if segment == "*" && (i == 0 || i == len(path)-1) {
+				return fmt.Errorf("a wildcard must be between two field names")
+			}
+		}
+	}
+	last := -1
+	for i, segment := range to {
+		if segment == "*" {
+			last = i
+		}
+	}
+	if last == -1 {
+		return nil
+	}
+	if last >= len(from)-1 || strings.Join(to[:last+1], ".") != strings.Join(from[:last+1], ".") {
+		return fmt.Errorf("the wildcards of to must select the same lists as in from")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jobWithTaskNetwork(groupNetworks []*api.NetworkResource) *api.Job {
+	return &api.Job{
+		ID: pointer.Of("web"),
+		TaskGroups: []*api.TaskGroup{{
+			Name:     pointer.Of("frontend"),
+			Networks: groupNetworks,
+			Tasks: []*api.Task{{
+				Name: "server",
+				Resources: &api.Resources{
+					CPU:      pointer.Of(100),
+					IOPS:     pointer.Of(10),
+					Networks: []*api.NetworkResource{{Mode: "bridge"}},
+				},
+			}},
+		}},
+	}
+}
+
+func TestFieldMigrationMutator(t *testing.T) {
+	rules := []MigrationRule{
+		{
+			From:    "TaskGroups.*.Tasks.*.Resources.Networks",
+			To:      "TaskGroups.*.Networks",
+			Message: "use a group network block",
+		},
+		{
+			From: "TaskGroups.*.Tasks.*.Resources.IOPS",
+		},
+	}
+	tests := []struct {
+		name              string
+		job               *api.Job
+		wantGroupNetworks []*api.NetworkResource
+		wantTaskNetworks  []*api.NetworkResource
+		wantWarnings      []error
+	}{
+		{
+			name:              "deprecated fields are migrated",
+			job:               jobWithTaskNetwork(nil),
+			wantGroupNetworks: []*api.NetworkResource{{Mode: "bridge"}},
+			wantWarnings: []error{
+				&admissionctrl.RuleMessage{
+					Msg:  "Job web: TaskGroups[frontend].Tasks[server].Resources.Networks is deprecated and was migrated to TaskGroups.*.Networks: use a group network block",
+					Rule: "nomad_upgrade",
+				},
+				&admissionctrl.RuleMessage{
+					Msg:  "Job web: TaskGroups[frontend].Tasks[server].Resources.IOPS is deprecated and was removed",
+					Rule: "nomad_upgrade",
+				},
+			},
+		},
+		{
+			name:              "replacement is not overwritten",
+			job:               jobWithTaskNetwork([]*api.NetworkResource{{Mode: "host"}}),
+			wantGroupNetworks: []*api.NetworkResource{{Mode: "host"}},
+			wantTaskNetworks:  []*api.NetworkResource{{Mode: "bridge"}},
+			wantWarnings: []error{
+				&admissionctrl.RuleMessage{
+					Msg:  "Job web: TaskGroups[frontend].Tasks[server].Resources.Networks is deprecated but was not migrated as TaskGroups.*.Networks is already set: use a group network block",
+					Rule: "nomad_upgrade",
+				},
+				&admissionctrl.RuleMessage{
+					Msg:  "Job web: TaskGroups[frontend].Tasks[server].Resources.IOPS is deprecated and was removed",
+					Rule: "nomad_upgrade",
+				},
+			},
+		},
+		{
+			name: "job without deprecated fields",
+			job: &api.Job{
+				ID:         pointer.Of("web"),
+				TaskGroups: []*api.TaskGroup{{Name: pointer.Of("frontend"), Tasks: []*api.Task{{Name: "server"}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewFieldMigrationMutator("nomad_upgrade", rules, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			out, warnings, err := m.Mutate(context.Background(), tt.job)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWarnings, warnings)
+			group := out.TaskGroups[0]
+			assert.Equal(t, tt.wantGroupNetworks, group.Networks)
+			if len(tt.wantWarnings) > 0 {
+				assert.Equal(t, tt.wantTaskNetworks, group.Tasks[0].Resources.Networks)
+				assert.Nil(t, group.Tasks[0].Resources.IOPS)
+				assert.Equal(t, pointer.Of(100), group.Tasks[0].Resources.CPU, "other fields are kept")
+			} else {
+				assert.Same(t, tt.job, out)
+			}
+		})
+	}
+}
+
+func TestFieldMigrationMutatorInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    MigrationRule
+		wantErr string
+	}{
+		{name: "missing from", rule: MigrationRule{To: "Meta"}, wantErr: "requires a from path"},
+		{name: "empty field", rule: MigrationRule{From: "TaskGroups..Name"}, wantErr: "empty field name"},
+		{name: "trailing wildcard", rule: MigrationRule{From: "TaskGroups.*"}, wantErr: "between two field names"},
+		{name: "different lists", rule: MigrationRule{From: "TaskGroups.*.Tasks.*.Meta", To: "Constraints.*.Meta"}, wantErr: "same lists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFieldMigrationMutator("nomad_upgrade", []MigrationRule{tt.rule}, hclog.NewNullLogger())
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
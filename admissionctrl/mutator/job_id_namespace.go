@@ -0,0 +1,68 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// JobIDNamespaceMutator sets the namespace of jobs without one from the prefix of their id.
+// Jobs submitted with the namespace query parameter are left alone.
+type JobIDNamespaceMutator struct {
+	name     string
+	logger   hclog.Logger
+	prefixes map[string]string
+}
+
+func (m *JobIDNamespaceMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	req := admissionctrl.RequestFromContext(ctx)
+	if req.ExplicitNamespace || (job.Namespace != nil && *job.Namespace != "") {
+		return job, nil, nil
+	}
+	if job.ID == nil {
+		return job, nil, nil
+	}
+	prefix, namespace, ok := m.match(*job.ID)
+	if !ok {
+		return job, nil, nil
+	}
+	logger.Debug("Routing job to namespace by id prefix", "rule", m.name, "job", *job.ID, "prefix", prefix, "namespace", namespace)
+	job.Namespace = &namespace
+	// let the following controllers see the routed namespace
+	req.Namespace = namespace
+	req.ExplicitNamespace = true
+
+	warning := &admissionctrl.RuleMessage{
+		Msg:  fmt.Sprintf("Job %s has no namespace, routed to namespace %s by its id prefix %s", *job.ID, namespace, prefix),
+		Rule: m.name,
+	}
+	return job, []error{warning}, nil
+}
+
+// match returns the namespace of the longest prefix matching the id.
+func (m *JobIDNamespaceMutator) match(id string) (prefix string, namespace string, ok bool) {
+	for p, ns := range m.prefixes {
+		if strings.HasPrefix(id, p) && len(p) > len(prefix) {
+			prefix, namespace, ok = p, ns, true
+		}
+	}
+	return prefix, namespace, ok
+}
+
+func (m *JobIDNamespaceMutator) Name() string {
+	return m.name
+}
+
+// NewJobIDNamespaceMutator creates a mutator routing jobs by the prefixes of their ids to namespaces.
+func NewJobIDNamespaceMutator(name string, prefixes map[string]string, logger hclog.Logger) *JobIDNamespaceMutator {
+	return &JobIDNamespaceMutator{
+		name:     name,
+		logger:   logger,
+		prefixes: prefixes,
+	}
+}
@@ -0,0 +1,84 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobIDNamespaceMutator(t *testing.T) {
+	prefixes := map[string]string{
+		"billing-":     "billing",
+		"billing-eu-":  "billing-eu",
+		"platform-ops": "ops",
+	}
+	tests := []struct {
+		name string
+		job  *api.Job
+		// queryNamespace is the namespace query parameter of the request
+		queryNamespace string
+		wantNamespace  *string
+		wantWarnings   []error
+	}{
+		{
+			name:          "prefixed job id is routed",
+			job:           &api.Job{ID: pointer.Of("billing-api")},
+			wantNamespace: pointer.Of("billing"),
+			wantWarnings: []error{&admissionctrl.RuleMessage{
+				Msg:  "Job billing-api has no namespace, routed to namespace billing by its id prefix billing-",
+				Rule: "routing",
+			}},
+		},
+		{
+			name:          "longest prefix wins",
+			job:           &api.Job{ID: pointer.Of("billing-eu-api"), Namespace: pointer.Of("")},
+			wantNamespace: pointer.Of("billing-eu"),
+			wantWarnings: []error{&admissionctrl.RuleMessage{
+				Msg:  "Job billing-eu-api has no namespace, routed to namespace billing-eu by its id prefix billing-eu-",
+				Rule: "routing",
+			}},
+		},
+		{
+			name:          "explicit namespace is left alone",
+			job:           &api.Job{ID: pointer.Of("billing-api"), Namespace: pointer.Of("default")},
+			wantNamespace: pointer.Of("default"),
+		},
+		{
+			name:           "namespace query parameter is left alone",
+			job:            &api.Job{ID: pointer.Of("billing-api")},
+			queryNamespace: "team-a",
+		},
+		{
+			name: "unknown prefix",
+			job:  &api.Job{ID: pointer.Of("web")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewJobIDNamespaceMutator("routing", prefixes, hclog.NewNullLogger())
+			req := &admissionctrl.Request{Namespace: "default"}
+			if tt.queryNamespace != "" {
+				req = &admissionctrl.Request{Namespace: tt.queryNamespace, ExplicitNamespace: true}
+			}
+
+			out, warnings, err := m.Mutate(admissionctrl.WithRequest(context.Background(), req), tt.job)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNamespace, out.Namespace)
+			assert.Equal(t, tt.wantWarnings, warnings)
+			if tt.wantWarnings != nil {
+				assert.Equal(t, *tt.wantNamespace, req.Namespace, "following controllers see the routed namespace")
+			} else if tt.queryNamespace != "" {
+				assert.Equal(t, tt.queryNamespace, req.Namespace)
+			} else {
+				assert.Equal(t, "default", req.Namespace)
+			}
+		})
+	}
+}
@@ -1,15 +1,16 @@
 package mutator
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 )
 
 type JsonPatchWebhookMutator struct {
@@ -17,6 +18,7 @@ type JsonPatchWebhookMutator struct {
 	logger   hclog.Logger
 	endpoint *url.URL
 	method   string
+	client   *webhook.Client
 }
 type jsonPatchWebhookResponse struct {
 	Patch    []interface{} `json:"patch"`
@@ -24,7 +26,7 @@ type jsonPatchWebhookResponse struct {
 	Errors   []string      `json:"errors"`
 }
 
-func NewJsonPatchWebhookMutator(name string, endpoint string, method string, logger hclog.Logger) (*JsonPatchWebhookMutator, error) {
+func NewJsonPatchWebhookMutator(name string, endpoint string, method string, logger hclog.Logger, opts ...webhook.ClientOption) (*JsonPatchWebhookMutator, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -34,22 +36,22 @@ func NewJsonPatchWebhookMutator(name string, endpoint string, method string, log
 		logger:   logger,
 		endpoint: u,
 		method:   method,
+		client:   webhook.NewClient(append([]webhook.ClientOption{webhook.WithLogger(logger)}, opts...)...),
 	}, nil
 }
-func (j *JsonPatchWebhookMutator) Mutate(job *api.Job) (*api.Job, []error, error) {
+func (j *JsonPatchWebhookMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, j.logger)
 
 	jobJson, err := json.Marshal(job)
 	if err != nil {
 		return nil, nil, err
 	}
-	httpClient := &http.Client{}
-
-	req, err := http.NewRequest(j.method, j.endpoint.String(), bytes.NewBuffer(jobJson))
+	res, err := j.client.Do(ctx, j.method, j.endpoint.String(), jobJson)
 	if err != nil {
 		return nil, nil, err
 	}
-	res, err := httpClient.Do(req)
-	if err != nil {
+	defer res.Body.Close()
+	if err := webhook.CheckResponse(res); err != nil {
 		return nil, nil, err
 	}
 
@@ -61,7 +63,7 @@ func (j *JsonPatchWebhookMutator) Mutate(job *api.Job) (*api.Job, []error, error
 
 	var warnings []error
 	if len(patchResponse.Warnings) > 0 {
-		j.logger.Debug("Got errors from rule", "rule", j.name, "warnings", patchResponse.Warnings, "job", job.ID)
+		logger.Debug("Got errors from rule", "rule", j.name, "warnings", patchResponse.Warnings, "job", job.ID)
 		for _, warning := range patchResponse.Warnings {
 			warnings = append(warnings, fmt.Errorf(warning))
 		}
@@ -75,7 +77,7 @@ func (j *JsonPatchWebhookMutator) Mutate(job *api.Job) (*api.Job, []error, error
 	if err != nil {
 		return nil, nil, err
 	}
-	j.logger.Debug("Got patch fom rule", "rule", j.name, "patch", string(patchJson), "job", job.ID)
+	logger.Debug("Got patch fom rule", "rule", j.name, "patch", string(patchJson), "job", job.ID)
 	patchedJobJson, err := patch.Apply(jobJson)
 
 	if err != nil {
@@ -1,6 +1,7 @@
 package mutator
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -95,7 +98,7 @@ func TestJsonPatchMutator(t *testing.T) {
 			mutator, err := NewJsonPatchWebhookMutator(tc.name, webhookServer.URL+tc.endpointPath, tc.method, hclog.NewNullLogger())
 			require.NoError(t, err)
 
-			job, warnings, err := mutator.Mutate(tc.job)
+			job, warnings, err := mutator.Mutate(context.Background(), tc.job)
 
 			require.True(t, webhookCalled)
 			assert.Equal(t, tc.wantErr, err)
@@ -105,3 +108,42 @@ func TestJsonPatchMutator(t *testing.T) {
 		})
 	}
 }
+
+// webhookErrorCases are the responses webhook mutators must fail on instead of decoding them.
+var webhookErrorCases = []struct {
+	name         string
+	status       int
+	wantAttempts int
+}{
+	{name: "500 after retries", status: http.StatusInternalServerError, wantAttempts: 2},
+	{name: "4xx", status: http.StatusBadRequest, wantAttempts: 1},
+}
+
+// errorWebhook answers every request with the status and a json error body, counting the attempts.
+func errorWebhook(t *testing.T, status int, attempts *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*attempts++
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":"down"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJsonPatchMutatorFailsOnErrorResponses(t *testing.T) {
+	for _, tt := range webhookErrorCases {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := errorWebhook(t, tt.status, &attempts)
+			mutator, err := NewJsonPatchWebhookMutator("patch", server.URL, "POST", hclog.NewNullLogger(), webhook.WithRetry(webhook.RetryPolicy{MaxAttempts: 2}))
+			require.NoError(t, err)
+
+			job, _, err := mutator.Mutate(context.Background(), &api.Job{ID: pointer.Of("example")})
+
+			assert.EqualError(t, err, fmt.Sprintf("webhook responded with %d %s", tt.status, http.StatusText(tt.status)))
+			assert.Nil(t, job)
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
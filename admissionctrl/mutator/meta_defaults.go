@@ -0,0 +1,50 @@
+package mutator
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// MetaDefaultsMutator merges a set of default meta values into the job.
+type MetaDefaultsMutator struct {
+	name     string
+	logger   hclog.Logger
+	defaults map[string]string
+	force    bool
+}
+
+func (m *MetaDefaultsMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	if len(m.defaults) == 0 {
+		return job, nil, nil
+	}
+	if job.Meta == nil {
+		job.Meta = make(map[string]string, len(m.defaults))
+	}
+	for key, value := range m.defaults {
+		if _, exists := job.Meta[key]; exists && !m.force {
+			logger.Trace("Keeping existing meta value", "rule", m.name, "key", key, "job", job.ID)
+			continue
+		}
+		job.Meta[key] = value
+	}
+	return job, nil, nil
+}
+
+func (m *MetaDefaultsMutator) Name() string {
+	return m.name
+}
+
+// NewMetaDefaultsMutator creates a mutator adding the defaults to the job meta.
+// Existing values are only overwritten if force is set.
+func NewMetaDefaultsMutator(name string, defaults map[string]string, force bool, logger hclog.Logger) *MetaDefaultsMutator {
+	return &MetaDefaultsMutator{
+		name:     name,
+		logger:   logger,
+		defaults: defaults,
+		force:    force,
+	}
+}
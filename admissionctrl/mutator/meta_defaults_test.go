@@ -0,0 +1,58 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaDefaultsMutator(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults map[string]string
+		force    bool
+		job      *api.Job
+		wantMeta map[string]string
+	}{
+		{
+			name:     "adds defaults to job without meta",
+			defaults: map[string]string{"submitted_by": "nacp"},
+			job:      &api.Job{},
+			wantMeta: map[string]string{"submitted_by": "nacp"},
+		},
+		{
+			name:     "keeps existing values",
+			defaults: map[string]string{"submitted_by": "nacp", "team": "platform"},
+			job:      &api.Job{Meta: map[string]string{"submitted_by": "alice"}},
+			wantMeta: map[string]string{"submitted_by": "alice", "team": "platform"},
+		},
+		{
+			name:     "overwrites existing values with force",
+			defaults: map[string]string{"submitted_by": "nacp"},
+			force:    true,
+			job:      &api.Job{Meta: map[string]string{"submitted_by": "alice", "team": "platform"}},
+			wantMeta: map[string]string{"submitted_by": "nacp", "team": "platform"},
+		},
+		{
+			name:     "no defaults leaves job untouched",
+			defaults: map[string]string{},
+			job:      &api.Job{},
+			wantMeta: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetaDefaultsMutator("meta_defaults", tt.defaults, tt.force, hclog.NewNullLogger())
+
+			job, warnings, err := m.Mutate(context.Background(), tt.job)
+
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+		})
+	}
+}
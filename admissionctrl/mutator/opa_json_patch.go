@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
 	"github.com/mxab/nacp/admissionctrl/opa"
 )
 
@@ -18,35 +19,48 @@ type OpaJsonPatchMutator struct {
 	name   string
 }
 
-func (j *OpaJsonPatchMutator) Mutate(job *api.Job) (*api.Job, []error, error) {
+func (j *OpaJsonPatchMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, j.logger)
 	allWarnings := make([]error, 0)
-	ctx := context.TODO()
 
 	results, err := j.query.Query(ctx, job)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	errors := results.GetErrors()
-
-	if len(errors) > 0 {
-		j.logger.Debug("Got errors from rule", "rule", j.Name(), "errors", errors, "job", job.ID)
-		allErrors := multierror.Append(nil)
-		for _, warn := range errors {
-			allErrors = multierror.Append(allErrors, fmt.Errorf("%s (%s)", warn, j.Name()))
+	var allErrors *multierror.Error
+	file, query := j.query.Provenance()
+	for _, m := range results.GetMessages() {
+		msg := &admissionctrl.RuleMessage{Msg: m.String(), Rule: j.Name(), File: file, Query: query}
+		if m.Level == opa.LevelError {
+			allErrors = multierror.Append(allErrors, msg)
+		} else {
+			allWarnings = append(allWarnings, msg)
 		}
-		return nil, nil, allErrors
 	}
-
-	warnings := results.GetWarnings()
-
-	if len(warnings) > 0 {
-		j.logger.Debug("Got warnings from rule", "rule", j.Name(), "warnings", warnings, "job", job.ID)
-		for _, warn := range warnings {
-			allWarnings = append(allWarnings, fmt.Errorf("%s (%s)", warn, j.Name()))
+	if allErrors != nil {
+		logger.Debug("Got errors from rule", "rule", j.Name(), "errors", allErrors.Errors, "job", job.ID)
+		return nil, nil, admissionctrl.PolicyDenied(allErrors)
+	}
+	if len(allWarnings) > 0 {
+		logger.Debug("Got warnings from rule", "rule", j.Name(), "warnings", allWarnings, "job", job.ID)
+	}
+	if replacement, ok := results.GetJob(); ok {
+		if results.HasPatch() {
+			return nil, nil, fmt.Errorf("rule %s returned both a patch and a job, only one is allowed", j.Name())
 		}
+		job, err = j.replace(logger, job, replacement)
+		if err != nil {
+			return nil, nil, err
+		}
+		return job, allWarnings, nil
 	}
 	patchData := results.GetPatch()
+	if len(patchData) == 0 {
+		// no round trip through json, it would drop the fields api.Job doesn't know
+		logger.Debug("Got no patch from rule", "rule", j.Name(), "job", job.ID)
+		return job, allWarnings, nil
+	}
 	patchJSON, err := json.Marshal(patchData)
 	if err != nil {
 		return nil, nil, err
@@ -56,7 +70,7 @@ func (j *OpaJsonPatchMutator) Mutate(job *api.Job) (*api.Job, []error, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	j.logger.Debug("Got patch fom rule", "rule", j.Name(), "patch", string(patchJSON), "job", job.ID)
+	logger.Debug("Got patch fom rule", "rule", j.Name(), "patch", string(patchJSON), "job", job.ID)
 	jobJson, err := json.Marshal(job)
 	if err != nil {
 		return nil, nil, err
@@ -75,15 +89,42 @@ func (j *OpaJsonPatchMutator) Mutate(job *api.Job) (*api.Job, []error, error) {
 
 	return job, allWarnings, nil
 }
+
+// replace returns the replacement job, logging its changes to the job.
+func (j *OpaJsonPatchMutator) replace(logger hclog.Logger, job *api.Job, replacement map[string]interface{}) (*api.Job, error) {
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	replacementJSON, err := json.Marshal(replacement)
+	if err != nil {
+		return nil, err
+	}
+	var replaced api.Job
+	if err := json.Unmarshal(replacementJSON, &replaced); err != nil {
+		return nil, fmt.Errorf("rule %s returned an invalid job: %w", j.Name(), err)
+	}
+	if diff, err := jsonpatch.CreateMergePatch(jobJSON, replacementJSON); err == nil {
+		logger.Debug("Got job from rule", "rule", j.Name(), "diff", string(diff), "job", job.ID)
+	}
+	return &replaced, nil
+}
+
 func (j *OpaJsonPatchMutator) Name() string {
 	return j.name
 }
 
-func NewOpaJsonPatchMutator(name, filename, query string, logger hclog.Logger) (*OpaJsonPatchMutator, error) {
+// Close stops refreshing the remote module of the mutator.
+func (j *OpaJsonPatchMutator) Close() {
+	j.query.Close()
+}
+
+func NewOpaJsonPatchMutator(name, filename, query string, logger hclog.Logger, opts ...opa.QueryOption) (*OpaJsonPatchMutator, error) {
 
 	ctx := context.TODO()
 	// read the policy file
-	preparedQuery, err := opa.CreateQuery(filename, query, ctx)
+	opts = append([]opa.QueryOption{opa.WithLogger(logger)}, opts...)
+	preparedQuery, err := opa.CreateQuery(filename, query, ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,13 @@
 package mutator
 
 import (
-	"fmt"
+	"context"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
 	"github.com/mxab/nacp/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -51,7 +53,7 @@ func TestJSONPatcher_Mutate(t *testing.T) {
 				job: &api.Job{},
 			},
 			wantOut:      &api.Job{},
-			wantWarnings: []error{fmt.Errorf("This is a warning message (%s)", "testopavalidator")},
+			wantWarnings: []error{&admissionctrl.RuleMessage{Msg: "This is a warning message", Rule: "testopavalidator"}},
 			wantErr:      false,
 		},
 		{
@@ -71,7 +73,7 @@ func TestJSONPatcher_Mutate(t *testing.T) {
 					"hello": "world",
 				},
 			},
-			wantWarnings: []error{fmt.Errorf("This is a warning message (%s)", "testopavalidator")},
+			wantWarnings: []error{&admissionctrl.RuleMessage{Msg: "This is a warning message", Rule: "testopavalidator"}},
 			wantErr:      false,
 		},
 		{
@@ -90,7 +92,7 @@ func TestJSONPatcher_Mutate(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotOut, gotWarnings, err := tt.j.Mutate(tt.args.job)
+			gotOut, gotWarnings, err := tt.j.Mutate(context.Background(), tt.args.job)
 			require.Equal(t, tt.wantErr, err != nil, "JSONPatcher.Mutate() error = %v, wantErr %v", err, tt.wantErr)
 
 			assert.Equal(t, tt.wantWarnings, gotWarnings, "JSONPatcher.Mutate() gotWarnings = %v, want %v", gotWarnings, tt.wantWarnings)
@@ -106,3 +108,105 @@ func newMutator(t *testing.T, filename, query string) *OpaJsonPatchMutator {
 	require.NoError(t, err)
 	return m
 }
+
+func TestOpaJsonPatchMutatorsAreChained(t *testing.T) {
+	first := newMutator(t, testutil.Filepath(t, "opa/mutators/opajsonpatchtesting.rego"), "patch = data.opajsonpatchtesting.patch")
+	second := newMutator(t, testutil.Filepath(t, "opa/mutators/chained.rego"), "patch = data.chained.patch")
+
+	handler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{first, second}, nil, hclog.NewNullLogger())
+	out, _, err := handler.AdmissionMutators(context.Background(), &api.Job{})
+	require.NoError(t, err)
+
+	// the second mutator only patches when it sees the meta key added by the first
+	assert.Equal(t, map[string]string{
+		"hello":    "world",
+		"greeting": "hello world",
+	}, out.Meta)
+}
+
+func TestOpaJsonPatchMutatorStructuredMessages(t *testing.T) {
+	m := newMutator(t, testutil.Filepath(t, "opa/mutators/structured_messages.rego"), `
+		patch = data.structured_mutator.patch
+		errors = data.structured_mutator.errors
+		warnings = data.structured_mutator.warnings`)
+
+	namespace := "default"
+	out, warnings, err := m.Mutate(context.Background(), &api.Job{Namespace: &namespace})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"patched": "true"}, out.Meta)
+	assert.Equal(t, []error{&admissionctrl.RuleMessage{Msg: "META001: Meta was replaced", Rule: "testopavalidator"}}, warnings, "info messages are suppressed")
+
+	_, _, err = m.Mutate(context.Background(), &api.Job{})
+	assert.EqualError(t, err, "1 error occurred:\n\t* NS001: Job without namespace (testopavalidator)\n\n")
+}
+
+func TestOpaJsonPatchMutatorKeepsJobWithoutPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		query    string
+	}{
+		{name: "empty patch", filename: "opa/mutators/hello_world_meta.rego", query: "patch = data.hello_world_meta.patch"},
+		{name: "no patch", filename: "opa/mutators/opajsonpatchtesting.rego", query: "warnings = data.opajsonpatchtesting.warnings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMutator(t, testutil.Filepath(t, tt.filename), tt.query)
+			job := &api.Job{ID: pointer.Of("example"), Meta: map[string]string{"hello": "world"}}
+
+			out, _, err := m.Mutate(context.Background(), job)
+
+			require.NoError(t, err)
+			assert.Same(t, job, out)
+		})
+	}
+}
+
+func TestOpaJsonPatchMutatorReplacesJob(t *testing.T) {
+	job := func(meta map[string]string, count int) *api.Job {
+		return &api.Job{
+			ID:         pointer.Of("example"),
+			Meta:       meta,
+			TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(count)}},
+		}
+	}
+	tests := []struct {
+		name    string
+		query   string
+		job     *api.Job
+		wantOut *api.Job
+		wantErr string
+	}{
+		{
+			name:    "replaces the job",
+			query:   "job = data.replace_job.job",
+			job:     job(map[string]string{"owner": "me"}, 1),
+			wantOut: job(map[string]string{"owner": "me", "team": "platform"}, 2),
+		},
+		{
+			name:    "keeps fields the rule doesn't change",
+			query:   "job = data.replace_job.job",
+			job:     job(map[string]string{"team": "platform"}, 3),
+			wantOut: job(map[string]string{"team": "platform"}, 3),
+		},
+		{
+			name:    "patch and job",
+			query:   "job = data.replace_job.job\npatch = data.replace_job.patch",
+			job:     job(map[string]string{}, 1),
+			wantErr: "rule testopavalidator returned both a patch and a job, only one is allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMutator(t, testutil.Filepath(t, "opa/mutators/replace_job.rego"), tt.query)
+
+			out, _, err := m.Mutate(context.Background(), tt.job)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOut, out)
+		})
+	}
+}
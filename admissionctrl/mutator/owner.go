@@ -0,0 +1,65 @@
+package mutator
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const DefaultOwnerMetaKey = "nacp.owner"
+
+// OwnerMutator stamps the owner derived from the request token into the job meta.
+// User supplied values are always overridden, so it should run as the last mutator.
+type OwnerMutator struct {
+	name    string
+	logger  hclog.Logger
+	metaKey string
+}
+
+func (m *OwnerMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	owner := ""
+	if token := admissionctrl.RequestFromContext(ctx).Token; token != nil {
+		owner = token.Name
+		if owner == "" {
+			owner = token.AccessorID
+		}
+	}
+
+	if owner == "" {
+		// without a resolved identity there is no trustworthy owner
+		if _, exists := job.Meta[m.metaKey]; exists {
+			logger.Debug("Removing user supplied owner", "rule", m.name, "job", job.ID)
+			delete(job.Meta, m.metaKey)
+		}
+		return job, nil, nil
+	}
+
+	if job.Meta == nil {
+		job.Meta = make(map[string]string)
+	}
+	if supplied, exists := job.Meta[m.metaKey]; exists && supplied != owner {
+		logger.Debug("Overriding user supplied owner", "rule", m.name, "supplied", supplied, "owner", owner, "job", job.ID)
+	}
+	job.Meta[m.metaKey] = owner
+	return job, nil, nil
+}
+
+func (m *OwnerMutator) Name() string {
+	return m.name
+}
+
+// NewOwnerMutator creates a mutator setting metaKey, or DefaultOwnerMetaKey if empty,
+// to the name or accessor id of the request token.
+func NewOwnerMutator(name string, metaKey string, logger hclog.Logger) *OwnerMutator {
+	if metaKey == "" {
+		metaKey = DefaultOwnerMetaKey
+	}
+	return &OwnerMutator{
+		name:    name,
+		logger:  logger,
+		metaKey: metaKey,
+	}
+}
@@ -0,0 +1,57 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnerMutator(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    *api.ACLToken
+		job      *api.Job
+		wantMeta map[string]string
+	}{
+		{
+			name:     "sets owner from token name",
+			token:    &api.ACLToken{AccessorID: "a1b2", Name: "alice"},
+			job:      &api.Job{},
+			wantMeta: map[string]string{"nacp.owner": "alice"},
+		},
+		{
+			name:     "falls back to accessor id",
+			token:    &api.ACLToken{AccessorID: "a1b2"},
+			job:      &api.Job{},
+			wantMeta: map[string]string{"nacp.owner": "a1b2"},
+		},
+		{
+			name:     "overrides user supplied owner",
+			token:    &api.ACLToken{AccessorID: "a1b2", Name: "alice"},
+			job:      &api.Job{Meta: map[string]string{"nacp.owner": "mallory", "team": "a"}},
+			wantMeta: map[string]string{"nacp.owner": "alice", "team": "a"},
+		},
+		{
+			name:     "removes user supplied owner without identity",
+			job:      &api.Job{Meta: map[string]string{"nacp.owner": "mallory"}},
+			wantMeta: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewOwnerMutator("owner", "", hclog.NewNullLogger())
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Token: tt.token})
+
+			job, warnings, err := m.Mutate(ctx, tt.job)
+
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// ResourceDefaults are set on tasks and jobs which don't specify them, nil values are not set.
+type ResourceDefaults struct {
+	CPU         *int
+	MemoryMB    *int
+	MemoryMaxMB *int
+	// Constraints are added to jobs without a constraint on the same attribute.
+	Constraints []*api.Constraint
+}
+
+// ResourceDefaultsMutator sets default resources of tasks and adds required constraints to jobs.
+// Explicitly set values are never overwritten.
+type ResourceDefaultsMutator struct {
+	name     string
+	logger   hclog.Logger
+	defaults ResourceDefaults
+}
+
+func (m *ResourceDefaultsMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	var warnings []error
+	warn := func(format string, a ...interface{}) {
+		warnings = append(warnings, &admissionctrl.RuleMessage{Msg: fmt.Sprintf(format, a...), Rule: m.name})
+	}
+	for _, group := range job.TaskGroups {
+		for _, task := range group.Tasks {
+			resources := task.Resources
+			if resources == nil {
+				resources = &api.Resources{}
+			}
+			set := false
+			// cores and cpu are exclusive
+			if m.defaults.CPU != nil && resources.CPU == nil && resources.Cores == nil {
+				resources.CPU = pointer.Of(*m.defaults.CPU)
+				set = true
+				warn("Task %s has no cpu, using %d MHz", task.Name, *m.defaults.CPU)
+			}
+			if m.defaults.MemoryMB != nil && resources.MemoryMB == nil {
+				resources.MemoryMB = pointer.Of(*m.defaults.MemoryMB)
+				set = true
+				warn("Task %s has no memory, using %d MB", task.Name, *m.defaults.MemoryMB)
+			}
+			if m.defaults.MemoryMaxMB != nil && resources.MemoryMaxMB == nil {
+				resources.MemoryMaxMB = pointer.Of(*m.defaults.MemoryMaxMB)
+				set = true
+				warn("Task %s has no memory_max, using %d MB", task.Name, *m.defaults.MemoryMaxMB)
+			}
+			if set {
+				task.Resources = resources
+			}
+		}
+	}
+	for _, constraint := range m.defaults.Constraints {
+		if hasConstraint(job, constraint.LTarget) {
+			logger.Trace("Keeping existing constraint", "rule", m.name, "attribute", constraint.LTarget, "job", job.ID)
+			continue
+		}
+		job.Constraints = append(job.Constraints, &api.Constraint{
+			LTarget: constraint.LTarget,
+			RTarget: constraint.RTarget,
+			Operand: constraint.Operand,
+		})
+		warn("Job has no constraint on %s, requiring %s %s", constraint.LTarget, constraint.Operand, constraint.RTarget)
+	}
+	if len(warnings) > 0 {
+		logger.Debug("Set resource defaults", "rule", m.name, "job", job.ID, "defaults", len(warnings))
+	}
+	return job, warnings, nil
+}
+
+// hasConstraint reports if the job, one of its groups or tasks constrains the attribute.
+func hasConstraint(job *api.Job, attribute string) bool {
+	constrains := func(constraints []*api.Constraint) bool {
+		for _, c := range constraints {
+			if c != nil && c.LTarget == attribute {
+				return true
+			}
+		}
+		return false
+	}
+	if constrains(job.Constraints) {
+		return true
+	}
+	for _, group := range job.TaskGroups {
+		if constrains(group.Constraints) {
+			return true
+		}
+		for _, task := range group.Tasks {
+			if constrains(task.Constraints) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *ResourceDefaultsMutator) Name() string {
+	return m.name
+}
+
+// NewResourceDefaultsMutator creates a mutator setting the defaults on jobs and tasks without them.
+func NewResourceDefaultsMutator(name string, defaults ResourceDefaults, logger hclog.Logger) (*ResourceDefaultsMutator, error) {
+	for _, d := range []struct {
+		name  string
+		value *int
+	}{
+		{"cpu", defaults.CPU},
+		{"memory", defaults.MemoryMB},
+		{"memory_max", defaults.MemoryMaxMB},
+	} {
+		if d.value != nil && *d.value <= 0 {
+			return nil, fmt.Errorf("resource defaults: %s must be positive", d.name)
+		}
+	}
+	// copied to not change the constraints of the caller
+	constraints := make([]*api.Constraint, 0, len(defaults.Constraints))
+	for _, c := range defaults.Constraints {
+		if c.LTarget == "" {
+			return nil, fmt.Errorf("resource defaults: constraint requires an attribute")
+		}
+		constraint := *c
+		if constraint.Operand == "" {
+			constraint.Operand = "="
+		}
+		constraints = append(constraints, &constraint)
+	}
+	defaults.Constraints = constraints
+	return &ResourceDefaultsMutator{
+		name:     name,
+		logger:   logger,
+		defaults: defaults,
+	}, nil
+}
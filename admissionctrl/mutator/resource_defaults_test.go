@@ -0,0 +1,115 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceDefaultsMutator(t *testing.T) {
+	kernel := &api.Constraint{LTarget: "${attr.kernel.version}", Operand: "version", RTarget: ">= 5.10"}
+	jobWithTasks := func(tasks ...*api.Task) *api.Job {
+		return &api.Job{TaskGroups: []*api.TaskGroup{{Name: pointer.Of("group"), Tasks: tasks}}}
+	}
+	tests := []struct {
+		name            string
+		defaults        ResourceDefaults
+		job             *api.Job
+		wantResources   []*api.Resources
+		wantConstraints []*api.Constraint
+		wantWarnings    []string
+	}{
+		{
+			name:          "sets resources of tasks without resources",
+			defaults:      ResourceDefaults{CPU: pointer.Of(100), MemoryMB: pointer.Of(256)},
+			job:           jobWithTasks(&api.Task{Name: "web"}),
+			wantResources: []*api.Resources{{CPU: pointer.Of(100), MemoryMB: pointer.Of(256)}},
+			wantWarnings:  []string{"Task web has no cpu, using 100 MHz (defaults)", "Task web has no memory, using 256 MB (defaults)"},
+		},
+		{
+			name:     "keeps explicit values of partial resources",
+			defaults: ResourceDefaults{CPU: pointer.Of(100), MemoryMB: pointer.Of(256), MemoryMaxMB: pointer.Of(512)},
+			job: jobWithTasks(
+				&api.Task{Name: "web", Resources: &api.Resources{MemoryMB: pointer.Of(1024)}},
+				&api.Task{Name: "worker", Resources: &api.Resources{CPU: pointer.Of(500), MemoryMaxMB: pointer.Of(2048)}},
+			),
+			wantResources: []*api.Resources{
+				{CPU: pointer.Of(100), MemoryMB: pointer.Of(1024), MemoryMaxMB: pointer.Of(512)},
+				{CPU: pointer.Of(500), MemoryMB: pointer.Of(256), MemoryMaxMB: pointer.Of(2048)},
+			},
+			wantWarnings: []string{
+				"Task web has no cpu, using 100 MHz (defaults)",
+				"Task web has no memory_max, using 512 MB (defaults)",
+				"Task worker has no memory, using 256 MB (defaults)",
+			},
+		},
+		{
+			name:          "no cpu for tasks reserving cores",
+			defaults:      ResourceDefaults{CPU: pointer.Of(100)},
+			job:           jobWithTasks(&api.Task{Name: "web", Resources: &api.Resources{Cores: pointer.Of(2)}}),
+			wantResources: []*api.Resources{{Cores: pointer.Of(2)}},
+		},
+		{
+			name:            "adds missing constraint",
+			defaults:        ResourceDefaults{Constraints: []*api.Constraint{kernel}},
+			job:             jobWithTasks(&api.Task{Name: "web"}),
+			wantResources:   []*api.Resources{nil},
+			wantConstraints: []*api.Constraint{kernel},
+			wantWarnings:    []string{"Job has no constraint on ${attr.kernel.version}, requiring version >= 5.10 (defaults)"},
+		},
+		{
+			name:     "keeps constraint of task on the same attribute",
+			defaults: ResourceDefaults{Constraints: []*api.Constraint{kernel}},
+			job: jobWithTasks(&api.Task{Name: "web", Constraints: []*api.Constraint{
+				{LTarget: "${attr.kernel.version}", Operand: "version", RTarget: ">= 6.1"},
+			}}),
+			wantResources: []*api.Resources{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewResourceDefaultsMutator("defaults", tt.defaults, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			job, warnings, err := m.Mutate(context.Background(), tt.job)
+
+			require.NoError(t, err)
+			var resources []*api.Resources
+			for _, task := range job.TaskGroups[0].Tasks {
+				resources = append(resources, task.Resources)
+			}
+			assert.Equal(t, tt.wantResources, resources)
+			assert.Equal(t, tt.wantConstraints, job.Constraints)
+			var messages []string
+			for _, w := range warnings {
+				messages = append(messages, w.Error())
+			}
+			assert.Equal(t, tt.wantWarnings, messages)
+		})
+	}
+}
+
+func TestNewResourceDefaultsMutatorKeepsConstraintsOfCaller(t *testing.T) {
+	constraint := &api.Constraint{LTarget: "${attr.kernel.name}", RTarget: "linux"}
+	m, err := NewResourceDefaultsMutator("defaults", ResourceDefaults{Constraints: []*api.Constraint{constraint}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	job, _, err := m.Mutate(context.Background(), &api.Job{})
+
+	require.NoError(t, err)
+	assert.Equal(t, []*api.Constraint{{LTarget: "${attr.kernel.name}", Operand: "=", RTarget: "linux"}}, job.Constraints)
+	assert.Equal(t, "", constraint.Operand, "the constraint of the caller must not be changed")
+}
+
+func TestNewResourceDefaultsMutatorRejectsInvalidDefaults(t *testing.T) {
+	_, err := NewResourceDefaultsMutator("defaults", ResourceDefaults{MemoryMB: pointer.Of(0)}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "memory must be positive")
+
+	_, err = NewResourceDefaultsMutator("defaults", ResourceDefaults{Constraints: []*api.Constraint{{RTarget: "linux"}}}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "constraint requires an attribute")
+}
@@ -0,0 +1,108 @@
+package mutator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// StripFieldsMutator removes fields from jobs that must not be set by clients, like tokens.
+type StripFieldsMutator struct {
+	name    string
+	logger  hclog.Logger
+	paths   []string
+	patches []jsonpatch.Patch
+}
+
+func (m *StripFieldsMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	logger := admissionctrl.Logger(ctx, m.logger)
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := ""
+	if job.ID != nil {
+		id = *job.ID
+	}
+	var warnings []error
+	for i, patch := range m.patches {
+		patched, err := patch.Apply(data)
+		if errors.Is(err, jsonpatch.ErrMissing) || errors.Is(err, jsonpatch.ErrInvalidIndex) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to strip %s: %w", m.paths[i], err)
+		}
+		// unset fields are null, removing them doesn't change the job
+		if patched, err = roundTripJob(patched); err != nil {
+			return nil, nil, err
+		}
+		if bytes.Equal(patched, data) {
+			continue
+		}
+		data = patched
+		logger.Debug("Stripped job field", "rule", m.name, "job", job.ID, "path", m.paths[i])
+		warnings = append(warnings, &admissionctrl.RuleMessage{
+			Msg:  fmt.Sprintf("Job %s: %s must not be set and was removed", id, m.paths[i]),
+			Rule: m.name,
+		})
+	}
+	if len(warnings) == 0 {
+		return job, nil, nil
+	}
+	stripped := &api.Job{}
+	if err := json.Unmarshal(data, stripped); err != nil {
+		return nil, nil, err
+	}
+	return stripped, warnings, nil
+}
+
+// roundTripJob decodes and encodes the job, restoring removed fields as their zero value.
+func roundTripJob(data []byte) ([]byte, error) {
+	job := &api.Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return json.Marshal(job)
+}
+
+func (m *StripFieldsMutator) Name() string {
+	return m.name
+}
+
+// NewStripFieldsMutator creates a mutator removing the fields at the JSON pointer paths,
+// like "/VaultToken" or "/Meta/owner", from jobs. Paths that don't exist in a job are ignored.
+func NewStripFieldsMutator(name string, paths []string, logger hclog.Logger) (*StripFieldsMutator, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("at least one path is required")
+	}
+	patches := make([]jsonpatch.Patch, 0, len(paths))
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %q must be a JSON pointer starting with /", path)
+		}
+		op, err := json.Marshal([]map[string]string{{"op": "remove", "path": path}})
+		if err != nil {
+			return nil, err
+		}
+		patch, err := jsonpatch.DecodePatch(op)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", path, err)
+		}
+		patches = append(patches, patch)
+	}
+	return &StripFieldsMutator{
+		name:    name,
+		logger:  logger,
+		paths:   paths,
+		patches: patches,
+	}, nil
+}
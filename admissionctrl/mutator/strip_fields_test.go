@@ -0,0 +1,95 @@
+package mutator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripFieldsMutator(t *testing.T) {
+	paths := []string{"/ConsulToken", "/VaultToken", "/Meta/nacp.owner", "/TaskGroups/0/Meta/secret"}
+	tests := []struct {
+		name         string
+		job          *api.Job
+		wantJob      *api.Job
+		wantWarnings []string
+	}{
+		{
+			name: "strips the set fields",
+			job: &api.Job{
+				ID:          pointer.Of("example"),
+				ConsulToken: pointer.Of("consul-secret"),
+				VaultToken:  pointer.Of("vault-secret"),
+				Meta:        map[string]string{"nacp.owner": "mallory", "team": "platform"},
+				TaskGroups:  []*api.TaskGroup{{Name: pointer.Of("web"), Meta: map[string]string{"secret": "hunter2"}}},
+			},
+			wantJob: &api.Job{
+				ID:         pointer.Of("example"),
+				Meta:       map[string]string{"team": "platform"},
+				TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Meta: map[string]string{}}},
+			},
+			wantWarnings: []string{
+				"Job example: /ConsulToken must not be set and was removed (strip)",
+				"Job example: /VaultToken must not be set and was removed (strip)",
+				"Job example: /Meta/nacp.owner must not be set and was removed (strip)",
+				"Job example: /TaskGroups/0/Meta/secret must not be set and was removed (strip)",
+			},
+		},
+		{
+			name: "missing paths are ignored",
+			job: &api.Job{
+				ID:          pointer.Of("example"),
+				ConsulToken: pointer.Of("consul-secret"),
+				Meta:        map[string]string{"team": "platform"},
+			},
+			wantJob: &api.Job{
+				ID:   pointer.Of("example"),
+				Meta: map[string]string{"team": "platform"},
+			},
+			wantWarnings: []string{"Job example: /ConsulToken must not be set and was removed (strip)"},
+		},
+		{
+			name:    "job without the fields is untouched",
+			job:     &api.Job{ID: pointer.Of("example")},
+			wantJob: &api.Job{ID: pointer.Of("example")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewStripFieldsMutator("strip", paths, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			job, warnings, err := m.Mutate(context.Background(), tt.job)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantJob, job)
+			var msgs []string
+			for _, w := range warnings {
+				msgs = append(msgs, w.Error())
+			}
+			assert.Equal(t, tt.wantWarnings, msgs)
+		})
+	}
+}
+
+func TestStripFieldsMutatorKeepsUntouchedJob(t *testing.T) {
+	m, err := NewStripFieldsMutator("strip", []string{"/VaultToken"}, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	job := &api.Job{ID: pointer.Of("example")}
+	mutated, _, err := m.Mutate(context.Background(), job)
+	require.NoError(t, err)
+	assert.Same(t, job, mutated)
+}
+
+func TestNewStripFieldsMutatorRejectsInvalidPaths(t *testing.T) {
+	_, err := NewStripFieldsMutator("strip", nil, hclog.NewNullLogger())
+	assert.Error(t, err)
+
+	_, err = NewStripFieldsMutator("strip", []string{"VaultToken"}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "must be a JSON pointer")
+}
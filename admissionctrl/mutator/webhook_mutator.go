@@ -1,37 +1,37 @@
 package mutator
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"net/http"
 	"net/url"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 )
 
 type WebhookMutator struct {
 	name     string
 	endpoint *url.URL
 	method   string
+	client   *webhook.Client
 }
 
-func (w *WebhookMutator) Mutate(job *api.Job) (out *api.Job, warnings []error, err error) {
+func (w *WebhookMutator) Mutate(ctx context.Context, job *api.Job) (out *api.Job, warnings []error, err error) {
 
 	data, err := json.Marshal(job)
 	if err != nil {
 		return nil, nil, err
 	}
-	buffer := bytes.NewBuffer(data)
-
-	req, err := http.NewRequest(w.method, w.endpoint.String(), buffer)
+	client := w.client
+	if client == nil {
+		client = webhook.DefaultClient
+	}
+	resp, err := client.Do(ctx, w.method, w.endpoint.String(), data)
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	defer resp.Body.Close()
+	if err := webhook.CheckResponse(resp); err != nil {
 		return nil, nil, err
 	}
 
@@ -46,11 +46,15 @@ func (w *WebhookMutator) Name() string {
 	return w.name
 }
 
-func NewWebhookMutator(name string, endpoint *url.URL, method string) *WebhookMutator {
+func NewWebhookMutator(name string, endpoint *url.URL, method string, opts ...webhook.ClientOption) *WebhookMutator {
 
-	return &WebhookMutator{
+	m := &WebhookMutator{
 		name:     name,
 		endpoint: endpoint,
 		method:   method,
 	}
+	if len(opts) > 0 {
+		m.client = webhook.NewClient(opts...)
+	}
+	return m
 }
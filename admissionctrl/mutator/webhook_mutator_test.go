@@ -1,6 +1,7 @@
 package mutator
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"testing"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -74,7 +77,7 @@ func TestWebhookMutator_Mutate(t *testing.T) {
 				endpoint: endpoint,
 				method:   tt.fields.method,
 			}
-			gotOut, gotWarnings, err := w.Mutate(tt.args.job)
+			gotOut, gotWarnings, err := w.Mutate(context.Background(), tt.args.job)
 			assert.True(t, endpointCalled, "Ensure endpoint was called")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WebhookMutator.Mutate() error = %v, wantErr %v", err, tt.wantErr)
@@ -130,3 +133,20 @@ func mustParse(t *testing.T, s string) *url.URL {
 	}
 	return u
 }
+
+func TestWebhookMutatorFailsOnErrorResponses(t *testing.T) {
+	for _, tt := range webhookErrorCases {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := errorWebhook(t, tt.status, &attempts)
+			endpoint, _ := url.Parse(server.URL)
+			mutator := NewWebhookMutator("hook", endpoint, "POST", webhook.WithRetry(webhook.RetryPolicy{MaxAttempts: 2}))
+
+			job, _, err := mutator.Mutate(context.Background(), &api.Job{ID: pointer.Of("example")})
+
+			assert.EqualError(t, err, fmt.Sprintf("webhook responded with %d %s", tt.status, http.StatusText(tt.status)))
+			assert.Nil(t, job, "the submitted job must not be replaced")
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
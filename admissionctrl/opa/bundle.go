@@ -0,0 +1,121 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/loader"
+)
+
+// Defaults of the bundle verification.
+const (
+	defaultBundleAlgorithm = "RS256"
+	defaultBundleKeyID     = "nacp"
+)
+
+// BundleVerification verifies the signatures of bundles, signed with `opa sign`.
+type BundleVerification struct {
+	// KeyID names the key, defaults to "nacp".
+	KeyID string
+	// PublicKey is the PEM encoded public key, or the secret for HMAC algorithms.
+	PublicKey string
+	// Algorithm defaults to RS256.
+	Algorithm string
+	// Scope must match the scope of the signatures, if set.
+	Scope string
+	// Exclude are glob patterns of bundle files not covered by the signatures.
+	Exclude []string
+}
+
+// WithBundleVerification requires bundles to be signed with the key. Unsigned
+// bundles or bundles failing the verification are not loaded.
+func WithBundleVerification(verification BundleVerification) QueryOption {
+	return func(o *queryOptions) {
+		o.bundleVerification = &verification
+	}
+}
+
+func (v *BundleVerification) config() *bundle.VerificationConfig {
+	algorithm := v.Algorithm
+	if algorithm == "" {
+		algorithm = defaultBundleAlgorithm
+	}
+	keyID := v.KeyID
+	if keyID == "" {
+		keyID = defaultBundleKeyID
+	}
+	keys := map[string]*bundle.KeyConfig{
+		keyID: {Key: v.PublicKey, Algorithm: algorithm, Scope: v.Scope},
+	}
+	// bundles without signatures are only refused with a key id
+	return bundle.NewVerificationConfig(keys, keyID, v.Scope, v.Exclude)
+}
+
+// loadBundle reads the bundle directory or tarball of the bundle path, downloading
+// remote tarballs, and verifies its signatures if required.
+func (o *queryOptions) loadBundle(ctx context.Context) error {
+	if o.bundlePath == "" {
+		return nil
+	}
+	var verification *bundle.VerificationConfig
+	if o.bundleVerification != nil {
+		verification = o.bundleVerification.config()
+	}
+	if !isRemote(o.bundlePath) {
+		b, err := loader.NewFileLoader().
+			WithProcessAnnotation(true).
+			WithBundleVerificationConfig(verification).
+			AsBundle(o.bundlePath)
+		if err != nil {
+			return err
+		}
+		o.bundle = b
+		return nil
+	}
+	remote, version, err := o.fetchBundle(ctx)
+	if err != nil {
+		return err
+	}
+	data := remote.module
+	if version != nil {
+		data = version.module
+	}
+	b, err := bundle.NewCustomReader(bundle.NewTarballLoaderWithBaseURL(bytes.NewReader([]byte(data)), o.bundlePath)).
+		WithProcessAnnotations(true).
+		WithBundleVerificationConfig(verification).
+		Read()
+	if err != nil {
+		return fmt.Errorf("bundle %s: %w", o.bundlePath, err)
+	}
+	// only verified bundles replace the cached version
+	if version != nil {
+		if err := remote.apply(version); err != nil {
+			o.logger.Warn("Failed to cache remote bundle", "url", o.bundlePath, "error", err)
+		}
+	}
+	o.bundle = &b
+	return nil
+}
+
+// fetchBundle downloads the remote bundle tarball, it returns no version if the cached one is current
+// or can't be fetched. The cached version is verified like a downloaded one.
+func (o *queryOptions) fetchBundle(ctx context.Context) (*remoteModule, *remoteVersion, error) {
+	if err := os.MkdirAll(o.cacheDir, 0700); err != nil {
+		return nil, nil, err
+	}
+	remote := newRemoteModule(o.bundlePath, remoteCacheFile(o.cacheDir, o.bundlePath, ".tar.gz"), false)
+	if err := remote.loadCache(); err != nil && !os.IsNotExist(err) {
+		o.logger.Warn("Ignoring unreadable bundle cache", "url", o.bundlePath, "error", err)
+	}
+	version, err := remote.fetch(ctx)
+	if err != nil {
+		if remote.module == "" {
+			return nil, nil, fmt.Errorf("failed to fetch %s: %w", o.bundlePath, err)
+		}
+		o.logger.Warn("Failed to fetch remote bundle, using cached version", "url", o.bundlePath, "error", err)
+	}
+	return remote, version, nil
+}
@@ -0,0 +1,144 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bundlePolicy = `package signed
+
+errors[msg] {
+    not input.Meta[data.signed.meta_key]
+    msg := sprintf("Job must have %s meta", [data.signed.meta_key])
+}
+`
+
+// testBundleKey returns a PEM encoded RSA key pair.
+func testBundleKey(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+}
+
+// testBundle returns the tarball of a bundle with the policy, signed with the private key if set.
+func testBundle(t *testing.T, privateKey string, policy string) []byte {
+	t.Helper()
+	b := bundle.Bundle{
+		Data: map[string]interface{}{"signed": map[string]interface{}{"meta_key": "owner"}},
+		Modules: []bundle.ModuleFile{
+			{URL: "/signed/policy.rego", Path: "/signed/policy.rego", Raw: []byte(bundlePolicy)},
+		},
+	}
+	if privateKey != "" {
+		require.NoError(t, b.GenerateSignature(bundle.NewSigningConfig(privateKey, "RS256", ""), "", false))
+	}
+	b.Modules[0].Raw = []byte(policy)
+
+	var buf bytes.Buffer
+	require.NoError(t, bundle.NewWriter(&buf).Write(b))
+	return buf.Bytes()
+}
+
+func writeTestBundle(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestBundleVerification(t *testing.T) {
+	privateKey, publicKey := testBundleKey(t)
+	_, otherPublicKey := testBundleKey(t)
+	tampered := bundlePolicy + `
+errors[msg] {
+    msg := "injected"
+}
+`
+	tests := []struct {
+		name      string
+		bundle    []byte
+		publicKey string
+		wantErr   string
+	}{
+		{name: "signed", bundle: testBundle(t, privateKey, bundlePolicy), publicKey: publicKey},
+		{name: "unsigned", bundle: testBundle(t, "", bundlePolicy), publicKey: publicKey, wantErr: "bundle missing .signatures.json file"},
+		{name: "tampered", bundle: testBundle(t, privateKey, tampered), publicKey: publicKey, wantErr: "digest mismatch"},
+		{name: "other key", bundle: testBundle(t, privateKey, bundlePolicy), publicKey: otherPublicKey, wantErr: "failed to verify message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := CreateQueryFromBundle(writeTestBundle(t, tt.bundle), "errors = data.signed.errors", context.Background(),
+				WithBundleVerification(BundleVerification{PublicKey: tt.publicKey}))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, query)
+				return
+			}
+			require.NoError(t, err)
+			result, err := query.Query(context.Background(), &api.Job{ID: pointer.Of("example")})
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{"Job must have owner meta"}, result.GetErrors())
+		})
+	}
+}
+
+func TestBundleTarballWithoutVerification(t *testing.T) {
+	query, err := CreateQueryFromBundle(writeTestBundle(t, testBundle(t, "", bundlePolicy)), "errors = data.signed.errors", context.Background())
+	require.NoError(t, err)
+
+	result, err := query.Query(context.Background(), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Job must have owner meta"}, result.GetErrors())
+}
+
+func TestRemoteBundleVerification(t *testing.T) {
+	privateKey, publicKey := testBundleKey(t)
+	served := testBundle(t, privateKey, bundlePolicy)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(served)
+	}))
+	defer server.Close()
+	cacheDir := t.TempDir()
+	opts := []QueryOption{
+		WithRemoteCache(cacheDir, 0),
+		WithBundleVerification(BundleVerification{PublicKey: publicKey}),
+	}
+
+	query, err := CreateQueryFromBundle(server.URL+"/bundle.tar.gz", "errors = data.signed.errors", context.Background(), opts...)
+	require.NoError(t, err)
+	result, err := query.Query(context.Background(), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Job must have owner meta"}, result.GetErrors())
+
+	// a tampered bundle is refused, even though a verified version is cached
+	served = testBundle(t, privateKey, bundlePolicy+"\n# tampered\n")
+	_, err = CreateQueryFromBundle(server.URL+"/bundle.tar.gz", "errors = data.signed.errors", context.Background(), opts...)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	// and does not replace the cached version
+	server.Close()
+	query, err = CreateQueryFromBundle(server.URL+"/bundle.tar.gz", "errors = data.signed.errors", context.Background(), opts...)
+	require.NoError(t, err)
+	result, err = query.Query(context.Background(), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Job must have owner meta"}, result.GetErrors())
+}
@@ -0,0 +1,97 @@
+package opa
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// CompileError reports every error found compiling a policy.
+type CompileError struct {
+	Errors []*ast.Error
+}
+
+func (e *CompileError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, formatAstError(err))
+	}
+	return "failed to compile policy: " + strings.Join(messages, "; ")
+}
+
+// formatAstError formats the error as file:line:column: code: message.
+func formatAstError(err *ast.Error) string {
+	if err.Location == nil {
+		return fmt.Sprintf("%s: %s", err.Code, err.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", err.Location.File, err.Location.Row, err.Location.Col, err.Code, err.Message)
+}
+
+// compileError turns the rego errors of err into a CompileError, dropping
+// repetitions of the same error on a line.
+// Other errors are returned as is.
+func compileError(err error) error {
+	var astErrs []*ast.Error
+	var regoErrs rego.Errors
+	var errs ast.Errors
+	switch {
+	case errors.As(err, &regoErrs):
+		for _, e := range regoErrs {
+			var astErr *ast.Error
+			if errors.As(e, &astErr) {
+				astErrs = append(astErrs, astErr)
+			}
+		}
+	case errors.As(err, &errs):
+		astErrs = errs
+	}
+	if len(astErrs) == 0 {
+		return err
+	}
+	seen := map[string]bool{}
+	compileErr := &CompileError{}
+	for _, e := range astErrs {
+		key := e.Code + e.Message
+		if e.Location != nil {
+			key = fmt.Sprintf("%s:%d:%s", e.Location.File, e.Location.Row, key)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		compileErr.Errors = append(compileErr.Errors, e)
+	}
+	return compileErr
+}
+
+// defaultRules are queried if no query is configured.
+var defaultRules = []string{"errors", "warnings", "patch", "job"}
+
+// defaultQuery queries the default rules the module defines in its package,
+// e.g. "errors = data.costcenter_meta.errors".
+func defaultQuery(filename string, module string) (string, error) {
+	if filename == "" {
+		return "", errors.New("a query is required for bundles without a filename")
+	}
+	parsed, err := ast.ParseModule(filename, module)
+	if err != nil {
+		return "", compileError(err)
+	}
+	defined := map[string]bool{}
+	for _, rule := range parsed.Rules {
+		defined[rule.Head.Name.String()] = true
+	}
+	var queries []string
+	for _, rule := range defaultRules {
+		if defined[rule] {
+			queries = append(queries, fmt.Sprintf("%s = %s.%s", rule, parsed.Package.Path, rule))
+		}
+	}
+	if len(queries) == 0 {
+		return "", fmt.Errorf("%s defines none of the rules %s, a query is required", filename, strings.Join(defaultRules, ", "))
+	}
+	return strings.Join(queries, "\n"), nil
+}
@@ -0,0 +1,92 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileError(t *testing.T) {
+	tt := []struct {
+		name    string
+		module  string
+		query   string
+		wantErr string
+		// wantErrors is the number of distinct errors
+		wantErrors int
+	}{
+		{
+			name:       "syntax error",
+			module:     "package broken\n\nerrors[msg] {\n  msg := \n}\n",
+			query:      "errors = data.broken.errors",
+			wantErr:    "broken.rego:5:1: rego_parse_error: unexpected } token",
+			wantErrors: 1,
+		},
+		{
+			name:       "unsafe variable",
+			module:     "package broken\n\nerrors[msg] {\n  msg == \"x\"\n}\n",
+			query:      "errors = data.broken.errors",
+			wantErr:    "broken.rego:4:3: rego_unsafe_var_error: var msg is unsafe",
+			wantErrors: 1,
+		},
+		{
+			name:       "query",
+			module:     "package broken\n\nerrors[\"x\"]\n",
+			query:      "errors = data.broken.errors[",
+			wantErr:    "rego_parse_error",
+			wantErrors: 1,
+		},
+		{
+			name:       "duplicates",
+			module:     "package broken\n\nerrors contains msg if {\n  msg := \"x\"\n}\n",
+			query:      "errors = data.broken.errors",
+			wantErr:    "broken.rego:3:1: rego_parse_error: var cannot be used for rule name",
+			wantErrors: 1,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "broken.rego")
+			require.NoError(t, os.WriteFile(filename, []byte(tc.module), 0600))
+
+			_, err := CreateQuery(filename, tc.query, context.Background())
+
+			var compileErr *CompileError
+			require.ErrorAs(t, err, &compileErr)
+			assert.ErrorContains(t, err, tc.wantErr)
+			assert.Len(t, compileErr.Errors, tc.wantErrors)
+		})
+	}
+}
+
+func TestDefaultQuery(t *testing.T) {
+	ctx := context.Background()
+
+	query, err := CreateQuery(testutil.Filepath(t, "opa/test.rego"), "", ctx)
+	require.NoError(t, err)
+	result, err := query.Query(ctx, &api.Job{})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"This is a error message"}, result.GetErrors())
+	assert.Equal(t, []interface{}{"This is a warning message"}, result.GetWarnings())
+	assert.NotEmpty(t, result.GetPatch())
+
+	// rules the module doesn't define are not queried
+	query, err = CreateQuery(testutil.Filepath(t, "opa/mutators/hello_world_meta.rego"), "", ctx)
+	require.NoError(t, err)
+	result, err = query.Query(ctx, &api.Job{})
+	require.NoError(t, err)
+	assert.Len(t, result.GetPatch(), 2)
+	assert.Empty(t, result.GetErrors())
+
+	_, err = CreateQuery(writeModule(t, "package none\n\nallow = true\n"), "", ctx)
+	assert.ErrorContains(t, err, "defines none of the rules errors, warnings, patch, job, a query is required")
+
+	_, err = CreateQueryFromBundle(testutil.Filepath(t, "opa/bundle"), "", ctx)
+	assert.ErrorContains(t, err, "a query is required for bundles without a filename")
+}
@@ -0,0 +1,66 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// WithDataFile loads the JSON object in filename as data document of the
+// query, so policies can reference data like allowed images without hardcoding it.
+// The file is read once when the query is created.
+func WithDataFile(filename string) QueryOption {
+	return func(o *queryOptions) {
+		o.dataFile = filename
+	}
+}
+
+// loadData reads the data file, if configured.
+func (o *queryOptions) loadData() error {
+	if o.dataFile == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(o.dataFile)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("data file %s must contain a JSON object: %w", o.dataFile, err)
+	}
+	o.data = data
+	return nil
+}
+
+// prepareWithData prepares the query with the data of the data file in its store.
+// Bundles claim the whole data document when they are activated, so the data
+// is written afterwards, replacing bundle data under the same keys.
+func (o *queryOptions) prepareWithData(ctx context.Context, options []func(*rego.Rego)) (rego.PreparedEvalQuery, error) {
+	store := inmem.New()
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, err
+	}
+	options = append(options, rego.Store(store), rego.Transaction(txn))
+	prepared, err := rego.New(options...).PrepareForEval(ctx)
+	if err == nil {
+		for key, value := range o.data {
+			if err = store.Write(ctx, txn, storage.AddOp, storage.Path{key}, value); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		store.Abort(ctx, txn)
+		return rego.PreparedEvalQuery{}, err
+	}
+	if err := store.Commit(ctx, txn); err != nil {
+		return rego.PreparedEvalQuery{}, err
+	}
+	return prepared, nil
+}
@@ -0,0 +1,71 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jobWithImage(image string) *api.Job {
+	return &api.Job{
+		ID: pointer.Of("example"),
+		TaskGroups: []*api.TaskGroup{{
+			Name:  pointer.Of("web"),
+			Tasks: []*api.Task{{Name: "server", Driver: "docker", Config: map[string]interface{}{"image": image}}},
+		}},
+	}
+}
+
+func TestDataFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  []interface{}
+	}{
+		{name: "allowed image", image: "nginx:1.25", want: nil},
+		{name: "other image", image: "nginx:latest", want: []interface{}{"Image nginx:latest of task server is not allowed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := CreateQuery("../../testdata/opa/validators/allowed_images.rego", "errors = data.allowed_images.errors", context.Background(),
+				WithDataFile("../../testdata/opa/data/images.json"))
+			require.NoError(t, err)
+
+			result, err := q.Query(context.Background(), jobWithImage(tt.image))
+			require.NoError(t, err)
+			errors := result.GetErrors()
+			if tt.want == nil {
+				assert.Empty(t, errors)
+			} else {
+				assert.Equal(t, tt.want, errors)
+			}
+		})
+	}
+}
+
+func TestInvalidDataFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`["not", "an", "object"]`), 0600))
+
+	_, err := CreateQuery("../../testdata/opa/validators/allowed_images.rego", "errors = data.allowed_images.errors", context.Background(), WithDataFile(filename))
+	assert.ErrorContains(t, err, "must contain a JSON object")
+
+	_, err = CreateQuery("../../testdata/opa/validators/allowed_images.rego", "errors = data.allowed_images.errors", context.Background(), WithDataFile(filepath.Join(t.TempDir(), "missing.json")))
+	assert.Error(t, err)
+}
+
+func TestDataFileWithBundle(t *testing.T) {
+	q, err := CreateQuery("../../testdata/opa/validators/allowed_images.rego", "errors = data.allowed_images.errors", context.Background(),
+		WithBundle("../../testdata/opa/bundle"), WithDataFile("../../testdata/opa/data/images.json"))
+	require.NoError(t, err)
+
+	result, err := q.Query(context.Background(), jobWithImage("redis:6"))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Image redis:6 of task server is not allowed"}, result.GetErrors())
+}
@@ -0,0 +1,145 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// RequestInput selects the request metadata added to the input under input.nacp.request.
+type RequestInput struct {
+	Method    bool
+	Path      bool
+	Operation bool
+	Region    bool
+	Namespace bool
+	ClientIP  bool
+}
+
+func (r RequestInput) enabled() bool {
+	return r.Method || r.Path || r.Operation || r.Region || r.Namespace || r.ClientIP
+}
+
+// WithRequestInput adds the selected request metadata to the query input.
+func WithRequestInput(fields RequestInput) QueryOption {
+	return func(o *queryOptions) {
+		o.requestInput = fields
+	}
+}
+
+// WithCurrentJobInput adds the registered version of the job as input.current_job,
+// null for new jobs.
+func WithCurrentJobInput() QueryOption {
+	return func(o *queryOptions) {
+		o.currentJobInput = true
+	}
+}
+
+// Values of input.operation.
+const (
+	InputOperationRegister = "register"
+	InputOperationPlan     = "plan"
+	InputOperationValidate = "validate"
+	InputOperationRevert   = "revert"
+)
+
+// inputOperation maps the request operation to input.operation,
+// creating and updating a job are both a register.
+func inputOperation(operation string) string {
+	switch operation {
+	case admissionctrl.OperationCreate, admissionctrl.OperationUpdate:
+		return InputOperationRegister
+	case admissionctrl.OperationPlan:
+		return InputOperationPlan
+	case admissionctrl.OperationValidate:
+		return InputOperationValidate
+	case admissionctrl.OperationRevert:
+		return InputOperationRevert
+	}
+	return ""
+}
+
+// buildInput returns the job as input, extended by the operation, the region and the enabled request metadata.
+func (q *OpaQuery) buildInput(ctx context.Context, job *api.Job) (interface{}, error) {
+	req := admissionctrl.RequestFromContext(ctx)
+	operation := inputOperation(req.Operation)
+	if operation == "" && req.Region == "" && !q.requestInput.enabled() && !q.currentJobInput && !q.normalizedInput {
+		return job, nil
+	}
+	input, err := jobInput(job)
+	if err != nil {
+		return nil, err
+	}
+	if operation != "" {
+		input["operation"] = operation
+	}
+	if req.Region != "" {
+		input["region"] = req.Region
+	}
+	if q.requestInput.enabled() {
+		input["nacp"] = map[string]interface{}{
+			"request": q.requestInput.metadata(req),
+		}
+	}
+	if q.normalizedInput {
+		// a separate copy, the input must not contain itself
+		if input["job"], err = jobInput(job); err != nil {
+			return nil, err
+		}
+		input["normalized"] = normalize(job)
+	}
+	if q.currentJobInput {
+		current, err := req.CurrentJob(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the current job: %w", err)
+		}
+		input["current_job"] = nil
+		if current != nil {
+			if input["current_job"], err = jobInput(current); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return input, nil
+}
+
+// jobInput converts the job to the generic input of OPA.
+func jobInput(job *api.Job) (map[string]interface{}, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	input := map[string]interface{}{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+func (r RequestInput) metadata(req *admissionctrl.Request) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if r.Method {
+		metadata["method"] = req.Method
+	}
+	if r.Path {
+		metadata["path"] = req.Path
+	}
+	if r.Operation {
+		metadata["is_create"] = req.Operation == admissionctrl.OperationCreate
+		metadata["is_update"] = req.Operation == admissionctrl.OperationUpdate
+		metadata["is_revert"] = req.Operation == admissionctrl.OperationRevert
+	}
+	if r.Region {
+		metadata["region"] = req.Region
+	}
+	if r.Namespace {
+		metadata["namespace"] = req.Namespace
+	}
+	if r.ClientIP {
+		metadata["client_ip"] = req.ClientIP
+	}
+	return metadata
+}
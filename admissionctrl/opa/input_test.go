@@ -0,0 +1,223 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestInput(t *testing.T) {
+	tests := []struct {
+		name         string
+		operation    string
+		input        RequestInput
+		wantErrors   []interface{}
+		wantWarnings []interface{}
+	}{
+		{
+			name:       "create",
+			operation:  admissionctrl.OperationCreate,
+			input:      RequestInput{Operation: true},
+			wantErrors: []interface{}{"New jobs must have an owner"},
+		},
+		{
+			name:         "update",
+			operation:    admissionctrl.OperationUpdate,
+			input:        RequestInput{Operation: true},
+			wantWarnings: []interface{}{"Updating job example"},
+		},
+		{
+			name:      "operation not included",
+			operation: admissionctrl.OperationCreate,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := CreateQuery(testutil.Filepath(t, "opa/validators/create_only.rego"), `
+				errors = data.create_only.errors
+				warnings = data.create_only.warnings
+			`, context.Background(), WithRequestInput(tt.input))
+			require.NoError(t, err)
+
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Operation: tt.operation})
+			result, err := query.Query(ctx, &api.Job{ID: pointer.Of("example")})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, tt.wantErrors, result.GetErrors())
+			assert.ElementsMatch(t, tt.wantWarnings, result.GetWarnings())
+		})
+	}
+}
+
+func TestRequestInputOnlyContainsEnabledFields(t *testing.T) {
+	query := &OpaQuery{requestInput: RequestInput{Method: true, ClientIP: true}}
+	ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{
+		Method:   "PUT",
+		Path:     "/v1/jobs",
+		ClientIP: "10.0.0.1",
+		Region:   "global",
+	})
+
+	input, err := query.buildInput(ctx, &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+
+	m := input.(map[string]interface{})
+	assert.Equal(t, "example", m["ID"])
+	assert.Equal(t, map[string]interface{}{
+		"request": map[string]interface{}{
+			"method":    "PUT",
+			"client_ip": "10.0.0.1",
+		},
+	}, m["nacp"])
+}
+
+func TestRequestInputDisabledPassesJob(t *testing.T) {
+	job := &api.Job{}
+	input, err := (&OpaQuery{}).buildInput(context.Background(), job)
+	require.NoError(t, err)
+	assert.Same(t, job, input)
+}
+
+func TestOperationInput(t *testing.T) {
+	tests := []struct {
+		name         string
+		operation    string
+		wantErrors   []interface{}
+		wantWarnings []interface{}
+	}{
+		{
+			name:       "create is a register",
+			operation:  admissionctrl.OperationCreate,
+			wantErrors: []interface{}{"Job must have an owner"},
+		},
+		{
+			name:       "update is a register",
+			operation:  admissionctrl.OperationUpdate,
+			wantErrors: []interface{}{"Job must have an owner"},
+		},
+		{
+			name:         "plan only warns",
+			operation:    admissionctrl.OperationPlan,
+			wantWarnings: []interface{}{"Job must have an owner, it will be rejected on submission"},
+		},
+		{
+			name:      "validate",
+			operation: admissionctrl.OperationValidate,
+		},
+		{
+			name: "no operation",
+		},
+	}
+	query, err := CreateQuery(testutil.Filepath(t, "opa/validators/plan_warn.rego"), `
+		errors = data.plan_warn.errors
+		warnings = data.plan_warn.warnings
+	`, context.Background())
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Operation: tt.operation})
+			result, err := query.Query(ctx, &api.Job{ID: pointer.Of("example")})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, tt.wantErrors, result.GetErrors())
+			assert.ElementsMatch(t, tt.wantWarnings, result.GetWarnings())
+		})
+	}
+}
+
+func TestInputOperation(t *testing.T) {
+	tests := []struct {
+		operation string
+		want      string
+	}{
+		{operation: admissionctrl.OperationCreate, want: InputOperationRegister},
+		{operation: admissionctrl.OperationUpdate, want: InputOperationRegister},
+		{operation: admissionctrl.OperationPlan, want: InputOperationPlan},
+		{operation: admissionctrl.OperationValidate, want: InputOperationValidate},
+		{operation: admissionctrl.OperationRevert, want: InputOperationRevert},
+		{operation: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			assert.Equal(t, tt.want, inputOperation(tt.operation))
+		})
+	}
+}
+
+func TestCurrentJobInput(t *testing.T) {
+	group := func(count int) []*api.TaskGroup {
+		return []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(count)}}
+	}
+	tests := []struct {
+		name       string
+		current    *api.Job
+		count      int
+		wantErrors []interface{}
+	}{
+		{
+			name:       "count decreased by more than half",
+			current:    &api.Job{ID: pointer.Of("example"), TaskGroups: group(10)},
+			count:      4,
+			wantErrors: []interface{}{"Group web must not decrease its count by more than 50% (10 to 4)"},
+		},
+		{
+			name:    "count decreased by half",
+			current: &api.Job{ID: pointer.Of("example"), TaskGroups: group(10)},
+			count:   5,
+		},
+		{
+			name:  "new job",
+			count: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := CreateQuery(testutil.Filepath(t, "opa/validators/count_decrease.rego"), "errors = data.count_decrease.errors", context.Background(), WithCurrentJobInput())
+			require.NoError(t, err)
+
+			req := &admissionctrl.Request{}
+			req.SetCurrentJobLookup(func(ctx context.Context) (*api.Job, error) {
+				return tt.current, nil
+			})
+			result, err := query.Query(admissionctrl.WithRequest(context.Background(), req), &api.Job{ID: pointer.Of("example"), TaskGroups: group(tt.count)})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, tt.wantErrors, result.GetErrors())
+		})
+	}
+}
+
+func TestCurrentJobInputIsNullForNewJobs(t *testing.T) {
+	query := &OpaQuery{currentJobInput: true}
+	input, err := query.buildInput(context.Background(), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+
+	current, ok := input.(map[string]interface{})["current_job"]
+	assert.True(t, ok)
+	assert.Nil(t, current)
+}
+
+func TestRegionInput(t *testing.T) {
+	query, err := CreateQuery(testutil.Filepath(t, "opa/validators/region.rego"), "errors = data.region.errors", context.Background())
+	require.NoError(t, err)
+
+	for region, wantErrors := range map[string][]interface{}{
+		"eu":     {"Jobs in the eu region must set the gdpr meta"},
+		"global": nil,
+		"":       nil,
+	} {
+		t.Run("region "+region, func(t *testing.T) {
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Region: region})
+			result, err := query.Query(ctx, &api.Job{ID: pointer.Of("example")})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, wantErrors, result.GetErrors())
+		})
+	}
+}
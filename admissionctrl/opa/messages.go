@@ -0,0 +1,123 @@
+package opa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Levels of policy messages, in increasing severity.
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelSeverity = map[string]int{
+	LevelInfo:  0,
+	LevelWarn:  1,
+	LevelError: 2,
+}
+
+// Message is a warning or error of a policy. Policies return plain strings
+// or objects like {"msg": "...", "level": "warn", "code": "..."}.
+type Message struct {
+	Msg   string
+	Level string
+	Code  string
+}
+
+func (m Message) String() string {
+	if m.Code != "" {
+		return fmt.Sprintf("%s: %s", m.Code, m.Msg)
+	}
+	return m.Msg
+}
+
+// WithProvenance records the policy file and query of the query, for controllers to
+// report where their messages originate from, see Provenance.
+func WithProvenance() QueryOption {
+	return func(o *queryOptions) {
+		o.provenance = true
+	}
+}
+
+// Provenance returns the policy file, or the bundle without one, and the query on a single line.
+// Both are empty unless the query was created WithProvenance.
+func (q *OpaQuery) Provenance() (file string, query string) {
+	return q.file, q.queryText
+}
+
+// setProvenance records the policy file and query of the query if enabled.
+func (o *queryOptions) setProvenance(q *OpaQuery, filename string, query string) {
+	if !o.provenance {
+		return
+	}
+	q.file = filename
+	if q.file == "" {
+		q.file = o.bundlePath
+	}
+	q.queryText = strings.Join(strings.Fields(query), " ")
+}
+
+// WithMinLevel drops policy messages below the level, e.g. "warn" drops "info" messages.
+func WithMinLevel(level string) QueryOption {
+	return func(o *queryOptions) {
+		o.minLevel = normalizeLevel(level, LevelWarn)
+	}
+}
+
+func normalizeLevel(level string, defaultLevel string) string {
+	level = strings.ToLower(level)
+	if level == "warning" {
+		level = LevelWarn
+	}
+	if _, ok := levelSeverity[level]; !ok {
+		return defaultLevel
+	}
+	return level
+}
+
+// parseMessage reads a plain string or a message object, messages without a known level get defaultLevel.
+func parseMessage(value interface{}, defaultLevel string) Message {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return Message{Msg: fmt.Sprint(value), Level: defaultLevel}
+	}
+	m := Message{Level: defaultLevel}
+	msg, ok := object["msg"]
+	if !ok {
+		// not a message object, keep it readable
+		return Message{Msg: fmt.Sprint(value), Level: defaultLevel}
+	}
+	m.Msg = fmt.Sprint(msg)
+	if level, ok := object["level"].(string); ok {
+		m.Level = normalizeLevel(level, defaultLevel)
+	}
+	if code, ok := object["code"]; ok && code != nil {
+		m.Code = fmt.Sprint(code)
+	}
+	return m
+}
+
+// GetMessages returns the warnings and errors of the result at or above the minimum level.
+// Their level defaults to warn for warnings and error for errors, and may be changed by the
+// message objects, so a warning can be raised to an error and an error lowered to a warning.
+func (result *OpaQueryResult) GetMessages() []Message {
+	var messages []Message
+	for _, binding := range []struct {
+		values []interface{}
+		level  string
+	}{
+		{result.GetErrors(), LevelError},
+		{result.GetWarnings(), LevelWarn},
+	} {
+		for _, value := range binding.values {
+			m := parseMessage(value, binding.level)
+			if levelSeverity[m.Level] < levelSeverity[result.minLevel] {
+				continue
+			}
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,108 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const structuredMessagesModule = `package structured
+
+import future.keywords
+
+warnings contains "plain warning"
+warnings contains {"msg": "structured warning", "level": "warning", "code": "W001"}
+warnings contains {"msg": "just so you know", "level": "info"}
+warnings contains {"msg": "raised to an error", "level": "error", "code": "E002"}
+errors contains "plain error"
+errors contains {"msg": "lowered to a warning", "level": "warn"}
+errors contains {"unrelated": "object"}
+`
+
+func TestGetMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []QueryOption
+		expected []Message
+	}{
+		{
+			name: "info messages are dropped by default",
+			expected: []Message{
+				{Msg: "plain error", Level: LevelError},
+				{Msg: "lowered to a warning", Level: LevelWarn},
+				{Msg: `map[unrelated:object]`, Level: LevelError},
+				{Msg: "plain warning", Level: LevelWarn},
+				{Msg: "raised to an error", Level: LevelError, Code: "E002"},
+				{Msg: "structured warning", Level: LevelWarn, Code: "W001"},
+			},
+		},
+		{
+			name: "info level keeps all messages",
+			opts: []QueryOption{WithMinLevel(LevelInfo)},
+			expected: []Message{
+				{Msg: "plain error", Level: LevelError},
+				{Msg: "lowered to a warning", Level: LevelWarn},
+				{Msg: `map[unrelated:object]`, Level: LevelError},
+				{Msg: "plain warning", Level: LevelWarn},
+				{Msg: "just so you know", Level: LevelInfo},
+				{Msg: "raised to an error", Level: LevelError, Code: "E002"},
+				{Msg: "structured warning", Level: LevelWarn, Code: "W001"},
+			},
+		},
+		{
+			name: "error level keeps errors only",
+			opts: []QueryOption{WithMinLevel(LevelError)},
+			expected: []Message{
+				{Msg: "plain error", Level: LevelError},
+				{Msg: `map[unrelated:object]`, Level: LevelError},
+				{Msg: "raised to an error", Level: LevelError, Code: "E002"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeModule(t, structuredMessagesModule)
+			q, err := CreateQuery(filename, "errors = data.structured.errors; warnings = data.structured.warnings", context.Background(), tt.opts...)
+			require.NoError(t, err)
+			result, err := q.Query(context.Background(), &api.Job{})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, tt.expected, result.GetMessages())
+		})
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	assert.Equal(t, "W001: structured warning", Message{Msg: "structured warning", Code: "W001"}.String())
+	assert.Equal(t, "plain warning", Message{Msg: "plain warning"}.String())
+}
+
+func TestProvenance(t *testing.T) {
+	filename := testutil.Filepath(t, "opa/errors.rego")
+	query := `
+		errors = data.dummy.errors
+		warnings = data.dummy.warnings
+	`
+
+	q, err := CreateQuery(filename, query, context.Background())
+	require.NoError(t, err)
+	file, text := q.Provenance()
+	assert.Empty(t, file, "provenance is only recorded if enabled")
+	assert.Empty(t, text)
+
+	q, err = CreateQuery(filename, query, context.Background(), WithProvenance())
+	require.NoError(t, err)
+	file, text = q.Provenance()
+	assert.Equal(t, filename, file)
+	assert.Equal(t, "errors = data.dummy.errors warnings = data.dummy.warnings", text)
+
+	bundlePath := writeTestBundle(t, testBundle(t, "", bundlePolicy))
+	q, err = CreateQueryFromBundle(bundlePath, "errors = data.signed.errors", context.Background(), WithProvenance())
+	require.NoError(t, err)
+	file, _ = q.Provenance()
+	assert.Equal(t, bundlePath, file, "rules without a file report their bundle")
+}
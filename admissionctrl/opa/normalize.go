@@ -0,0 +1,134 @@
+package opa
+
+import (
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// WithNormalizedInput adds the raw job as input.job and a driver independent
+// view of its tasks as input.normalized.
+func WithNormalizedInput() QueryOption {
+	return func(o *queryOptions) {
+		o.normalizedInput = true
+	}
+}
+
+// driverConfigKeys are the keys of the normalized fields in the config of each driver.
+type driverConfigKeys struct {
+	image, command, args, privileged string
+}
+
+var driverConfigs = map[string]driverConfigKeys{
+	"docker":            {image: "image", command: "command", args: "args", privileged: "privileged"},
+	"podman":            {image: "image", command: "command", args: "args", privileged: "privileged"},
+	"containerd-driver": {image: "image", command: "command", args: "args", privileged: "privileged"},
+	"exec":              {command: "command", args: "args"},
+	"raw_exec":          {command: "command", args: "args"},
+	"java":              {args: "args"},
+	"qemu":              {image: "image_path", args: "args"},
+}
+
+// NormalizedInput is the driver independent view of a job.
+type NormalizedInput struct {
+	Tasks []NormalizedTask `json:"tasks"`
+}
+
+// NormalizedTask holds the fields policies commonly check, whatever the shape of the driver config.
+type NormalizedTask struct {
+	Group      string               `json:"group"`
+	Name       string               `json:"name"`
+	Driver     string               `json:"driver"`
+	Image      string               `json:"image"`
+	Command    string               `json:"command"`
+	Args       []string             `json:"args"`
+	Privileged bool                 `json:"privileged"`
+	Env        map[string]string    `json:"env"`
+	Templates  []NormalizedTemplate `json:"templates"`
+}
+
+// NormalizedTemplate is a template of a task, Data is the inline template.
+type NormalizedTemplate struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Data        string `json:"data"`
+}
+
+// normalize returns the normalized view of the job. Fields unknown for a driver stay empty.
+func normalize(job *api.Job) NormalizedInput {
+	normalized := NormalizedInput{Tasks: []NormalizedTask{}}
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			normalized.Tasks = append(normalized.Tasks, normalizeTask(stringValue(tg.Name), task))
+		}
+	}
+	return normalized
+}
+
+func normalizeTask(group string, task *api.Task) NormalizedTask {
+	keys := driverConfigs[task.Driver]
+	normalized := NormalizedTask{
+		Group:      group,
+		Name:       task.Name,
+		Driver:     task.Driver,
+		Image:      strings.TrimPrefix(configString(task.Config, keys.image), "docker://"),
+		Command:    configString(task.Config, keys.command),
+		Args:       configStrings(task.Config, keys.args),
+		Privileged: configBool(task.Config, keys.privileged),
+		Env:        map[string]string{},
+		Templates:  []NormalizedTemplate{},
+	}
+	for k, v := range task.Env {
+		normalized.Env[k] = v
+	}
+	for _, tmpl := range task.Templates {
+		normalized.Templates = append(normalized.Templates, NormalizedTemplate{
+			Source:      stringValue(tmpl.SourcePath),
+			Destination: stringValue(tmpl.DestPath),
+			Data:        stringValue(tmpl.EmbeddedTmpl),
+		})
+	}
+	return normalized
+}
+
+func configString(config map[string]interface{}, key string) string {
+	if key == "" {
+		return ""
+	}
+	s, _ := config[key].(string)
+	return s
+}
+
+func configBool(config map[string]interface{}, key string) bool {
+	if key == "" {
+		return false
+	}
+	b, _ := config[key].(bool)
+	return b
+}
+
+// configStrings returns the list of strings of the key, as set in Go or decoded from JSON.
+func configStrings(config map[string]interface{}, key string) []string {
+	values := []string{}
+	if key == "" {
+		return values
+	}
+	switch list := config[key].(type) {
+	case []string:
+		values = append(values, list...)
+	case []interface{}:
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,101 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	job := &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+		{Name: pointer.Of("web"), Tasks: []*api.Task{
+			{
+				Name:   "nginx",
+				Driver: "docker",
+				Config: map[string]interface{}{"image": "nginx:1.25", "args": []interface{}{"-g", "daemon off;"}, "privileged": true},
+				Env:    map[string]string{"PORT": "8080"},
+				Templates: []*api.Template{
+					{EmbeddedTmpl: pointer.Of("{{ key \"config\" }}"), DestPath: pointer.Of("local/nginx.conf")},
+				},
+			},
+			{Name: "proxy", Driver: "podman", Config: map[string]interface{}{"image": "docker://quay.io/envoy:1.28", "command": "envoy"}},
+		}},
+		{Name: pointer.Of("batch"), Tasks: []*api.Task{
+			{Name: "app", Driver: "exec", Config: map[string]interface{}{"command": "/bin/app", "args": []string{"--once"}}},
+			{Name: "vm", Driver: "qemu", Config: map[string]interface{}{"image_path": "local/vm.img"}},
+			{Name: "custom", Driver: "custom", Config: map[string]interface{}{"image": "ignored"}},
+		}},
+	}}
+
+	assert.Equal(t, NormalizedInput{Tasks: []NormalizedTask{
+		{
+			Group: "web", Name: "nginx", Driver: "docker", Image: "nginx:1.25",
+			Args: []string{"-g", "daemon off;"}, Privileged: true,
+			Env:       map[string]string{"PORT": "8080"},
+			Templates: []NormalizedTemplate{{Destination: "local/nginx.conf", Data: "{{ key \"config\" }}"}},
+		},
+		{Group: "web", Name: "proxy", Driver: "podman", Image: "quay.io/envoy:1.28", Command: "envoy", Args: []string{}, Env: map[string]string{}, Templates: []NormalizedTemplate{}},
+		{Group: "batch", Name: "app", Driver: "exec", Command: "/bin/app", Args: []string{"--once"}, Env: map[string]string{}, Templates: []NormalizedTemplate{}},
+		{Group: "batch", Name: "vm", Driver: "qemu", Image: "local/vm.img", Args: []string{}, Env: map[string]string{}, Templates: []NormalizedTemplate{}},
+		{Group: "batch", Name: "custom", Driver: "custom", Args: []string{}, Env: map[string]string{}, Templates: []NormalizedTemplate{}},
+	}}, normalize(job))
+}
+
+func TestNormalizedInput(t *testing.T) {
+	query, err := CreateQuery(testutil.Filepath(t, "opa/validators/normalized.rego"), `
+		errors = data.normalized.errors
+		warnings = data.normalized.warnings
+	`, context.Background(), WithNormalizedInput())
+	require.NoError(t, err)
+
+	job := &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+		{Name: pointer.Of("web"), Tasks: []*api.Task{
+			{
+				Name:   "nginx",
+				Driver: "docker",
+				Config: map[string]interface{}{"image": "registry.example.com/nginx:1.25", "privileged": true},
+				Env:    map[string]string{"DB_PASSWORD": "hunter2"},
+				Templates: []*api.Template{
+					{EmbeddedTmpl: pointer.Of("aws_access_key_id = AKIAEXAMPLE"), DestPath: pointer.Of("secrets/aws")},
+				},
+			},
+			{Name: "proxy", Driver: "podman", Config: map[string]interface{}{"image": "docker://quay.io/envoy:1.28"}},
+		}},
+	}}
+	result, err := query.Query(context.Background(), job)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{
+		"Task web/proxy uses image quay.io/envoy:1.28 from an external registry",
+		"Task web/nginx must not hardcode DB_PASSWORD in its env",
+		"Task nginx must not embed an AWS access key in secrets/aws",
+	}, result.GetErrors())
+	assert.ElementsMatch(t, []interface{}{"Task web/nginx runs privileged"}, result.GetWarnings())
+}
+
+func TestNormalizedInputKeepsJob(t *testing.T) {
+	query := &OpaQuery{normalizedInput: true}
+	job := &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+		{Name: pointer.Of("web"), Tasks: []*api.Task{{
+			Name:      "nginx",
+			Env:       map[string]string{"PORT": "8080"},
+			Templates: []*api.Template{{DestPath: pointer.Of("local/nginx.conf")}},
+		}}},
+	}}
+	input, err := query.buildInput(context.Background(), job)
+	require.NoError(t, err)
+
+	m := input.(map[string]interface{})
+	assert.Equal(t, "example", m["ID"], "the job stays the root of the input")
+	raw := m["job"].(map[string]interface{})
+	task := raw["TaskGroups"].([]interface{})[0].(map[string]interface{})["Tasks"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"PORT": "8080"}, task["Env"])
+	assert.Equal(t, "local/nginx.conf", task["Templates"].([]interface{})[0].(map[string]interface{})["DestPath"])
+	assert.NotContains(t, raw, "job")
+	assert.Equal(t, normalize(job), m["normalized"])
+}
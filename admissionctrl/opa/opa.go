@@ -2,50 +2,218 @@ package opa
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/rego"
 )
 
 type OpaQuery struct {
+	mu    sync.RWMutex
 	query *rego.PreparedEvalQuery
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	requestInput    RequestInput
+	currentJobInput bool
+	normalizedInput bool
+	minLevel        string
+	// file and queryText are the provenance of the messages, if enabled.
+	file      string
+	queryText string
 }
 type OpaQueryResult struct {
 	resultSet *rego.ResultSet
+	minLevel  string
 }
 
-func CreateQuery(filename string, query string, ctx context.Context) (*OpaQuery, error) {
+type queryOptions struct {
+	cacheDir        string
+	refreshInterval time.Duration
+	logger          hclog.Logger
+	requestInput    RequestInput
+	currentJobInput bool
+	normalizedInput bool
+	bundlePath      string
+	bundle          *bundle.Bundle
+	// bundleVerification requires the bundle to be signed.
+	bundleVerification *BundleVerification
+	checksum           string
+	verificationKey    ed25519.PublicKey
+	minLevel           string
+	dataFile           string
+	data               map[string]interface{}
+	provenance         bool
+}
 
-	module, err := os.ReadFile(filename)
-	if err != nil {
+type QueryOption func(*queryOptions)
+
+// WithRemoteCache configures where modules fetched from http(s) urls are
+// cached and how often they are refreshed. A zero interval disables refreshing.
+func WithRemoteCache(cacheDir string, refreshInterval time.Duration) QueryOption {
+	return func(o *queryOptions) {
+		if cacheDir != "" {
+			o.cacheDir = cacheDir
+		}
+		o.refreshInterval = refreshInterval
+	}
+}
+
+// WithLogger sets the logger used for background work like refreshing remote modules.
+func WithLogger(logger hclog.Logger) QueryOption {
+	return func(o *queryOptions) {
+		o.logger = logger
+	}
+}
+
+// WithBundle loads the rego modules and data documents of the bundle directory or tarball
+// next to the module, so policies can import shared packages and reference static data.
+// The bundle path may be a http(s) url of a tarball, it is downloaded when the query is created.
+func WithBundle(bundlePath string) QueryOption {
+	return func(o *queryOptions) {
+		o.bundlePath = bundlePath
+	}
+}
+
+// CreateQueryFromBundle prepares the query against the bundle directory only.
+func CreateQueryFromBundle(bundlePath string, query string, ctx context.Context, opts ...QueryOption) (*OpaQuery, error) {
+	return CreateQuery("", query, ctx, append(opts, WithBundle(bundlePath))...)
+}
+
+// CreateQuery prepares the query against the rego module in filename.
+// The filename may also be a http(s) url, in which case the module is
+// downloaded, cached on disk and refreshed periodically.
+// With WithBundle the filename is optional.
+// An empty query queries the errors, warnings and patch rules of the module's package.
+func CreateQuery(filename string, query string, ctx context.Context, opts ...QueryOption) (*OpaQuery, error) {
+
+	o := &queryOptions{
+		cacheDir:        filepath.Join(os.TempDir(), "nacp-policies"),
+		refreshInterval: 5 * time.Minute,
+		logger:          hclog.NewNullLogger(),
+		minLevel:        LevelWarn,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if filename == "" && o.bundlePath == "" {
+		return nil, errors.New("either a filename or a bundle path is required")
+	}
+	if err := o.loadData(); err != nil {
+		return nil, err
+	}
+	if err := o.loadBundle(ctx); err != nil {
 		return nil, err
 	}
 
-	preparedQuery, err := rego.New(
-		rego.Query(query),
-		rego.Module(filename, string(module)),
-	).PrepareForEval(ctx)
+	if isRemote(filename) {
+		q, err := createRemoteQuery(ctx, filename, query, o)
+		if err != nil {
+			return nil, err
+		}
+		o.setProvenance(q, filename, query)
+		return q, nil
+	}
+
+	var module []byte
+	if filename != "" {
+		var err error
+		module, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var signature []byte
+		if o.verifiesSignature() {
+			signature, err = os.ReadFile(filename + signatureSuffix)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if err := o.verifyModule(filename, module, signature); err != nil {
+			return nil, err
+		}
+	}
 
+	preparedQuery, err := prepareQuery(ctx, filename, string(module), query, o)
 	if err != nil {
 		return nil, err
 	}
 
-	return &OpaQuery{
-		query: &preparedQuery,
-	}, nil
+	q := &OpaQuery{
+		query:           preparedQuery,
+		requestInput:    o.requestInput,
+		currentJobInput: o.currentJobInput,
+		normalizedInput: o.normalizedInput,
+		minLevel:        o.minLevel,
+	}
+	o.setProvenance(q, filename, query)
+	return q, nil
+}
+
+func prepareQuery(ctx context.Context, filename string, module string, query string, o *queryOptions) (*rego.PreparedEvalQuery, error) {
+	if query == "" {
+		var err error
+		if query, err = defaultQuery(filename, module); err != nil {
+			return nil, err
+		}
+	}
+	options := []func(*rego.Rego){rego.Query(query)}
+	if filename != "" {
+		options = append(options, rego.Module(filename, module))
+	}
+	if o.bundle != nil {
+		options = append(options, rego.ParsedBundle(o.bundlePath, o.bundle))
+	}
+	var preparedQuery rego.PreparedEvalQuery
+	var err error
+	if o.data != nil {
+		preparedQuery, err = o.prepareWithData(ctx, options)
+	} else {
+		preparedQuery, err = rego.New(options...).PrepareForEval(ctx)
+	}
+
+	if err != nil {
+		return nil, compileError(err)
+	}
+	return &preparedQuery, nil
+}
+
+// Close stops refreshing a remote module.
+func (q *OpaQuery) Close() {
+	if q.stop == nil {
+		return
+	}
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
 }
 
 func (q *OpaQuery) Query(ctx context.Context, input *api.Job) (*OpaQueryResult, error) {
-	resultSet, err := q.query.Eval(ctx, rego.EvalInput(input))
+	q.mu.RLock()
+	query := q.query
+	q.mu.RUnlock()
+
+	evalInput, err := q.buildInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	resultSet, err := query.Eval(ctx, rego.EvalInput(evalInput))
 	if err != nil {
 		return nil, err
 	}
 	if len(resultSet) == 0 {
 		return nil, errors.New("no result set returned, maybe the query is wrong?")
 	}
-	return &OpaQueryResult{&resultSet}, nil
+	return &OpaQueryResult{resultSet: &resultSet, minLevel: q.minLevel}, nil
 }
 
 func (result *OpaQueryResult) GetWarnings() []interface{} {
@@ -67,6 +235,21 @@ func (result *OpaQueryResult) GetErrors() []interface{} {
 	}
 	return errors
 }
+
+// HasPatch reports whether the query binds a patch.
+func (result *OpaQueryResult) HasPatch() bool {
+	rs := *result.resultSet
+	_, ok := rs[0].Bindings["patch"]
+	return ok
+}
+
+// GetJob returns the replacement job the query binds as job, false if there is none or it is null.
+func (result *OpaQueryResult) GetJob() (map[string]interface{}, bool) {
+	rs := *result.resultSet
+	job, ok := rs[0].Bindings["job"].(map[string]interface{})
+	return job, ok
+}
+
 func (result *OpaQueryResult) GetPatch() []interface{} {
 
 	rs := *result.resultSet
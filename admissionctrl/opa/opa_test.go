@@ -85,3 +85,60 @@ func TestReturnsEmptyIfNotExisting(t *testing.T) {
 	assert.Equal(t, []interface{}{}, patch, "Patch is correct")
 
 }
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	bundle := testutil.Filepath(t, "opa/bundle")
+
+	tests := []struct {
+		name     string
+		owner    string
+		wantErrs []interface{}
+	}{
+		{
+			name:     "missing owner",
+			wantErrs: []interface{}{"Job has no owner"},
+		},
+		{
+			name:     "owner from shared data",
+			owner:    "billing",
+			wantErrs: []interface{}{},
+		},
+		{
+			name:     "unknown owner",
+			owner:    "marketing",
+			wantErrs: []interface{}{"Owner marketing is not a known team"},
+		},
+	}
+	query, err := CreateQueryFromBundle(bundle, "errors = data.bundle.owner.errors", ctx)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &api.Job{}
+			if tt.owner != "" {
+				job.Meta = map[string]string{"owner": tt.owner}
+			}
+			result, err := query.Query(ctx, job)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantErrs, result.GetErrors())
+		})
+	}
+}
+
+func TestModuleWithBundle(t *testing.T) {
+	ctx := context.Background()
+
+	query, err := CreateQuery(testutil.Filepath(t, "opa/bundle_policy.rego"), "warnings = data.bundle_policy.warnings", ctx,
+		WithBundle(testutil.Filepath(t, "opa/bundle")))
+	require.NoError(t, err)
+
+	result, err := query.Query(ctx, &api.Job{Meta: map[string]string{"owner": "platform"}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Job is owned by the platform team"}, result.GetWarnings())
+}
+
+func TestCreateQueryRequiresModuleOrBundle(t *testing.T) {
+	_, err := CreateQuery("", "errors = data.opatest.errors", context.Background())
+	assert.Error(t, err)
+}
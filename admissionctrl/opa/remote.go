@@ -0,0 +1,273 @@
+package opa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl/webhook"
+)
+
+// maxRemoteSize limits the downloaded modules, bundles and signatures.
+const maxRemoteSize = webhook.DefaultMaxResponseSize
+
+// remoteModule is a rego module fetched over http(s) and cached on disk.
+type remoteModule struct {
+	url       string
+	cacheFile string
+	client    *http.Client
+	// signed fetches and caches the module's detached signature as well.
+	signed bool
+
+	etag         string
+	lastModified string
+	module       string
+	signature    string
+}
+
+// remoteVersion is a downloaded version of a remote module, which only replaces
+// the current version and the cache once it is verified and compiles.
+type remoteVersion struct {
+	module       string
+	signature    string
+	etag         string
+	lastModified string
+}
+
+type remoteModuleCacheMeta struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+func isRemote(filename string) bool {
+	return strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://")
+}
+
+// remoteCacheFile is the file in the cache dir caching the url.
+func remoteCacheFile(cacheDir string, url string, extension string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+extension)
+}
+
+func newRemoteModule(url string, cacheFile string, signed bool) *remoteModule {
+	return &remoteModule{
+		url:       url,
+		cacheFile: cacheFile,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		signed:    signed,
+	}
+}
+
+// loadCache reads a previously fetched version of the module from disk.
+func (m *remoteModule) loadCache() error {
+	module, err := os.ReadFile(m.cacheFile)
+	if err != nil {
+		return err
+	}
+	meta := &remoteModuleCacheMeta{}
+	if data, err := os.ReadFile(m.cacheFile + ".json"); err == nil {
+		if err := json.Unmarshal(data, meta); err != nil {
+			return err
+		}
+	}
+	if m.signed {
+		signature, err := os.ReadFile(m.cacheFile + signatureSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		m.signature = string(signature)
+	}
+	m.module = string(module)
+	m.etag = meta.ETag
+	m.lastModified = meta.LastModified
+	return nil
+}
+
+func (m *remoteModule) writeCache() error {
+	if err := os.WriteFile(m.cacheFile, []byte(m.module), 0600); err != nil {
+		return err
+	}
+	if m.signed {
+		if err := os.WriteFile(m.cacheFile+signatureSuffix, []byte(m.signature), 0600); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&remoteModuleCacheMeta{ETag: m.etag, LastModified: m.lastModified})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.cacheFile+".json", data, 0600)
+}
+
+// apply makes the version the current one and caches it.
+func (m *remoteModule) apply(v *remoteVersion) error {
+	m.module = v.module
+	m.signature = v.signature
+	m.etag = v.etag
+	m.lastModified = v.lastModified
+	if err := m.writeCache(); err != nil {
+		return fmt.Errorf("failed to cache %s: %w", m.url, err)
+	}
+	return nil
+}
+
+// fetch downloads the module unless it is unchanged since the last fetch, then it returns nil.
+// The downloaded version must be applied to become the current one.
+func (m *remoteModule) fetch(ctx context.Context) (*remoteVersion, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.module != "" {
+		if m.etag != "" {
+			req.Header.Set("If-None-Match", m.etag)
+		}
+		if m.lastModified != "" {
+			req.Header.Set("If-Modified-Since", m.lastModified)
+		}
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, m.url)
+	}
+
+	module, err := io.ReadAll(http.MaxBytesReader(nil, resp.Body, maxRemoteSize))
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if m.signed {
+		signature, err = m.fetchSignature(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &remoteVersion{
+		module:       string(module),
+		signature:    string(signature),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// fetchSignature downloads the detached signature published next to the module.
+func (m *remoteModule) fetchSignature(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+signatureSuffix, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, m.url+signatureSuffix)
+	}
+	return io.ReadAll(http.MaxBytesReader(nil, resp.Body, maxRemoteSize))
+}
+
+func createRemoteQuery(ctx context.Context, url string, query string, o *queryOptions) (*OpaQuery, error) {
+	if err := os.MkdirAll(o.cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	module := newRemoteModule(url, remoteCacheFile(o.cacheDir, url, ".rego"), o.verifiesSignature())
+	if err := module.loadCache(); err != nil && !os.IsNotExist(err) {
+		o.logger.Warn("Ignoring unreadable policy cache", "url", url, "error", err)
+	}
+
+	version, err := module.fetch(ctx)
+	if err != nil {
+		if module.module == "" {
+			return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+		}
+		o.logger.Warn("Failed to fetch remote policy, using cached version", "url", url, "error", err)
+	}
+	current := version
+	if current == nil {
+		current = &remoteVersion{module: module.module, signature: module.signature}
+	}
+
+	if err := o.verifyModule(url, []byte(current.module), []byte(current.signature)); err != nil {
+		return nil, err
+	}
+	prepared, err := prepareQuery(ctx, url, current.module, query, o)
+	if err != nil {
+		return nil, err
+	}
+	if version != nil {
+		if err := module.apply(version); err != nil {
+			o.logger.Warn("Failed to cache remote policy", "url", url, "error", err)
+		}
+	}
+	q := &OpaQuery{
+		query:           prepared,
+		stop:            make(chan struct{}),
+		requestInput:    o.requestInput,
+		currentJobInput: o.currentJobInput,
+		normalizedInput: o.normalizedInput,
+		minLevel:        o.minLevel,
+	}
+	if o.refreshInterval > 0 {
+		go q.refresh(module, query, o)
+	}
+	return q, nil
+}
+
+// refresh periodically fetches the module and swaps the prepared query
+// if it changed. Failures keep the current version active.
+func (q *OpaQuery) refresh(module *remoteModule, query string, o *queryOptions) {
+	ticker := time.NewTicker(o.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx := context.Background()
+		version, err := module.fetch(ctx)
+		if err != nil {
+			o.logger.Warn("Failed to refresh remote policy, keeping current version", "url", module.url, "error", err)
+			continue
+		}
+		if version == nil {
+			continue
+		}
+		// rejected versions are neither cached nor remembered by their etag, so they are fetched again
+		if err := o.verifyModule(module.url, []byte(version.module), []byte(version.signature)); err != nil {
+			o.logger.Warn("Refusing unverified remote policy, keeping current version", "url", module.url, "error", err)
+			continue
+		}
+		prepared, err := prepareQuery(ctx, module.url, version.module, query, o)
+		if err != nil {
+			o.logger.Warn("Failed to compile refreshed remote policy, keeping current version", "url", module.url, "error", err)
+			continue
+		}
+		if err := module.apply(version); err != nil {
+			o.logger.Warn("Failed to cache refreshed remote policy", "url", module.url, "error", err)
+		}
+		q.mu.Lock()
+		q.query = prepared
+		q.mu.Unlock()
+		o.logger.Info("Refreshed remote policy", "url", module.url)
+	}
+}
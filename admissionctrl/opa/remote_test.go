@@ -0,0 +1,161 @@
+package opa
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const remoteModuleV1 = `package remote
+
+errors[msg] {
+	msg := "v1"
+}
+`
+const remoteModuleV2 = `package remote
+
+errors[msg] {
+	msg := "v2"
+}
+`
+
+type policyServer struct {
+	mu          sync.Mutex
+	module      string
+	etag        string
+	notModified int
+}
+
+func (p *policyServer) set(module, etag string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.module = module
+	p.etag = etag
+}
+
+func (p *policyServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.Header.Get("If-None-Match") == p.etag {
+		p.notModified++
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rw.Header().Set("ETag", p.etag)
+	rw.Write([]byte(p.module))
+}
+
+func queryErrors(t *testing.T, q *OpaQuery) []interface{} {
+	t.Helper()
+	result, err := q.Query(context.Background(), &api.Job{})
+	require.NoError(t, err)
+	return result.GetErrors()
+}
+
+func TestRemoteModuleIsCached(t *testing.T) {
+	policies := &policyServer{}
+	policies.set(remoteModuleV1, `"v1"`)
+	server := httptest.NewServer(policies)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	q, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	// the cached version is revalidated with its etag
+	q, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+	assert.Equal(t, 1, policies.notModified)
+
+	// the cached version is used if the server is gone
+	server.Close()
+	q, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+}
+
+func TestRemoteModuleFailsWithoutCache(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", context.Background(), WithRemoteCache(t.TempDir(), 0))
+	assert.Error(t, err)
+}
+
+func TestRemoteModuleSizeIsLimited(t *testing.T) {
+	policies := &policyServer{}
+	policies.set(remoteModuleV1+"#"+strings.Repeat("x", int(maxRemoteSize)), `"v1"`)
+	server := httptest.NewServer(policies)
+	defer server.Close()
+
+	_, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", context.Background(), WithRemoteCache(t.TempDir(), 0))
+	assert.ErrorContains(t, err, "request body too large")
+}
+
+func TestRemoteModuleIsRefreshed(t *testing.T) {
+	policies := &policyServer{}
+	policies.set(remoteModuleV1, `"v1"`)
+	server := httptest.NewServer(policies)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+
+	q, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", context.Background(), WithRemoteCache(cacheDir, 10*time.Millisecond))
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	policies.set(remoteModuleV2, `"v2"`)
+	assert.Eventually(t, func() bool {
+		result, err := q.Query(context.Background(), &api.Job{})
+		return err == nil && assert.ObjectsAreEqual([]interface{}{"v2"}, result.GetErrors())
+	}, time.Second, 10*time.Millisecond)
+
+	// a broken update keeps the current version active
+	policies.set("not rego", `"broken"`)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []interface{}{"v2"}, queryErrors(t, q))
+
+	// and is not cached
+	server.Close()
+	q, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", context.Background(), WithRemoteCache(cacheDir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v2"}, queryErrors(t, q))
+}
+
+const remoteCurrentJobModule = `package remote
+
+errors[msg] {
+	msg := sprintf("registered %s", [input.current_job.ID])
+}
+`
+
+func TestRemoteModuleCurrentJobInput(t *testing.T) {
+	policies := &policyServer{}
+	policies.set(remoteCurrentJobModule, `"v1"`)
+	server := httptest.NewServer(policies)
+	defer server.Close()
+
+	q, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", context.Background(), WithRemoteCache(t.TempDir(), 0), WithCurrentJobInput())
+	require.NoError(t, err)
+
+	req := &admissionctrl.Request{}
+	req.SetCurrentJobLookup(func(ctx context.Context) (*api.Job, error) {
+		return &api.Job{ID: pointer.Of("example")}, nil
+	})
+	result, err := q.Query(admissionctrl.WithRequest(context.Background(), req), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"registered example"}, result.GetErrors())
+}
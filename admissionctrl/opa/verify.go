@@ -0,0 +1,81 @@
+package opa
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// signatureSuffix is appended to a module's filename or url to locate its detached signature.
+const signatureSuffix = ".sig"
+
+// WithChecksum pins the module to its hex encoded sha256 checksum,
+// optionally prefixed with "sha256:". Modules that don't match are not compiled.
+func WithChecksum(checksum string) QueryOption {
+	return func(o *queryOptions) {
+		o.checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	}
+}
+
+// WithVerificationKey requires a base64 encoded ed25519 signature of the
+// module next to it, at the module's filename or url with a ".sig" suffix.
+func WithVerificationKey(key ed25519.PublicKey) QueryOption {
+	return func(o *queryOptions) {
+		o.verificationKey = key
+	}
+}
+
+func (o *queryOptions) verifiesSignature() bool {
+	return o.verificationKey != nil
+}
+
+// verifyModule checks the module against the configured checksum and verification key.
+func (o *queryOptions) verifyModule(filename string, module []byte, signature []byte) error {
+	if o.checksum != "" {
+		sum := sha256.Sum256(module)
+		if actual := hex.EncodeToString(sum[:]); actual != o.checksum {
+			return fmt.Errorf("checksum mismatch for %s: expected sha256:%s, got sha256:%s", filename, o.checksum, actual)
+		}
+	}
+	if o.verificationKey != nil {
+		if len(signature) == 0 {
+			return fmt.Errorf("missing signature for %s", filename)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("malformed signature for %s: %w", filename, err)
+		}
+		if !ed25519.Verify(o.verificationKey, module, decoded) {
+			return fmt.Errorf("invalid signature for %s", filename)
+		}
+	}
+	return nil
+}
+
+// LoadVerificationKey reads a PEM encoded ed25519 public key.
+func LoadVerificationKey(filename string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("only ed25519 public keys are supported")
+	}
+	return publicKey, nil
+}
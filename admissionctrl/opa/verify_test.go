@@ -0,0 +1,173 @@
+package opa
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeModule(t *testing.T, module string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "remote.rego")
+	require.NoError(t, os.WriteFile(filename, []byte(module), 0600))
+	return filename
+}
+
+func sign(key ed25519.PrivateKey, module string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(module)))
+}
+
+func TestChecksumVerification(t *testing.T) {
+	sum := sha256.Sum256([]byte(remoteModuleV1))
+	checksum := hex.EncodeToString(sum[:])
+
+	tt := []struct {
+		name     string
+		checksum string
+		wantErr  string
+	}{
+		{name: "matching", checksum: checksum},
+		{name: "matching with prefix", checksum: "sha256:" + checksum},
+		{name: "mismatching", checksum: "sha256:" + hex.EncodeToString(make([]byte, 32)), wantErr: "checksum mismatch"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := writeModule(t, remoteModuleV1)
+			q, err := CreateQuery(filename, "errors = data.remote.errors", context.Background(), WithChecksum(tc.checksum))
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+		})
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name      string
+		module    string
+		signature string
+		wantErr   string
+	}{
+		{name: "valid signature", module: remoteModuleV1, signature: sign(privateKey, remoteModuleV1)},
+		{name: "tampered module", module: remoteModuleV2, signature: sign(privateKey, remoteModuleV1), wantErr: "invalid signature"},
+		{name: "missing signature", module: remoteModuleV1, wantErr: "missing signature"},
+		{name: "malformed signature", module: remoteModuleV1, signature: "not base64!", wantErr: "malformed signature"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := writeModule(t, tc.module)
+			if tc.signature != "" {
+				require.NoError(t, os.WriteFile(filename+".sig", []byte(tc.signature+"\n"), 0600))
+			}
+			q, err := CreateQuery(filename, "errors = data.remote.errors", context.Background(), WithVerificationKey(publicKey))
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, queryErrors(t, q))
+		})
+	}
+}
+
+func TestRemoteSignatureVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signature := sign(privateKey, remoteModuleV1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/remote.rego", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(remoteModuleV1))
+	})
+	mux.HandleFunc("/remote.rego.sig", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(signature))
+	})
+	server := httptest.NewServer(mux)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	q, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0), WithVerificationKey(publicKey))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	// the cached signature is verified if the server is gone
+	server.Close()
+	q, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0), WithVerificationKey(publicKey))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0), WithVerificationKey(otherKey))
+	assert.ErrorContains(t, err, "invalid signature")
+}
+
+func TestLoadVerificationKey(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "policies.pub")
+	require.NoError(t, os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	loaded, err := LoadVerificationKey(filename)
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, loaded)
+
+	require.NoError(t, os.WriteFile(filename, []byte("not a key"), 0600))
+	_, err = LoadVerificationKey(filename)
+	assert.ErrorContains(t, err, "no PEM data")
+}
+
+func TestRemoteSignatureRefreshKeepsVerifiedVersion(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	policies := &policyServer{}
+	policies.set(remoteModuleV1, `"v1"`)
+	signature := sign(privateKey, remoteModuleV1)
+	mux := http.NewServeMux()
+	mux.Handle("/remote.rego", policies)
+	mux.HandleFunc("/remote.rego.sig", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(signature))
+	})
+	server := httptest.NewServer(mux)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	q, err := CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 10*time.Millisecond), WithVerificationKey(publicKey))
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	// a tampered update is neither activated nor cached
+	policies.set(remoteModuleV2, `"v2"`)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+
+	server.Close()
+	q, err = CreateQuery(server.URL+"/remote.rego", "errors = data.remote.errors", ctx, WithRemoteCache(cacheDir, 0), WithVerificationKey(publicKey))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"v1"}, queryErrors(t, q))
+}
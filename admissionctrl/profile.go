@@ -0,0 +1,51 @@
+package admissionctrl
+
+// Profile is a named set of admission controllers handling the jobs of the namespaces mapped to it.
+type Profile struct {
+	Name       string
+	Mutators   []JobMutator
+	Validators []JobValidator
+}
+
+// JobHandlerOption configures optional behaviour of the JobHandler.
+type JobHandlerOption func(*JobHandler)
+
+// WithProfiles hands the jobs of a namespace to the controllers of its profile instead of the
+// controllers of the handler. namespaces maps namespaces to profile names, jobs of other namespaces
+// use the profile named defaultProfile, or the controllers of the handler if it is empty.
+func WithProfiles(profiles []*Profile, namespaces map[string]string, defaultProfile string) JobHandlerOption {
+	return func(j *JobHandler) {
+		j.profiles = map[string]*Profile{}
+		for _, p := range profiles {
+			j.profiles[p.Name] = p
+		}
+		j.namespaceProfiles = namespaces
+		j.defaultProfile = defaultProfile
+	}
+}
+
+// profile returns the profile of the namespace, nil if there is none.
+func (j *JobHandler) profile(namespace string) *Profile {
+	if name, ok := j.namespaceProfiles[namespace]; ok {
+		return j.profiles[name]
+	}
+	return j.profiles[j.defaultProfile]
+}
+
+// mutatorsFor returns the mutators handling jobs of the request namespace.
+func (j *JobHandler) mutatorsFor(req *Request) []JobMutator {
+	if p := j.profile(req.Namespace); p != nil {
+		req.Profile = p.Name
+		return p.Mutators
+	}
+	return j.mutators
+}
+
+// validatorsFor returns the validators handling jobs of the request namespace.
+func (j *JobHandler) validatorsFor(req *Request) []JobValidator {
+	if p := j.profile(req.Namespace); p != nil {
+		req.Profile = p.Name
+		return p.Validators
+	}
+	return j.validators
+}
@@ -0,0 +1,88 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func warningValidator(name string) *testutil.MockValidator {
+	validator := new(testutil.MockValidator)
+	validator.On("Name").Return(name)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("%s warning", name)}, nil)
+	return validator
+}
+
+func TestJobHandler_Profiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		defaultProfile string
+		wantProfile    string
+		wantMutators   []string
+		wantWarnings   []error
+	}{
+		{
+			name:         "mapped namespace uses its profile",
+			namespace:    "prod",
+			wantProfile:  "strict",
+			wantMutators: []string{"strict_hello"},
+			wantWarnings: []error{fmt.Errorf("strict warning")},
+		},
+		{
+			name:           "other mapped namespace",
+			namespace:      "dev",
+			defaultProfile: "strict",
+			wantProfile:    "lenient",
+			wantWarnings:   []error{fmt.Errorf("lenient warning")},
+		},
+		{
+			name:           "unmapped namespace uses the default profile",
+			namespace:      "team-a",
+			defaultProfile: "lenient",
+			wantProfile:    "lenient",
+			wantWarnings:   []error{fmt.Errorf("lenient warning")},
+		},
+		{
+			name:         "unmapped namespace without default profile uses the handler controllers",
+			namespace:    "team-a",
+			wantMutators: []string{"hello"},
+			wantWarnings: []error{fmt.Errorf("base warning")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := []*Profile{
+				{
+					Name:       "strict",
+					Mutators:   []JobMutator{&testutil.HelloMutator{MutatorName: "strict_hello"}},
+					Validators: []JobValidator{warningValidator("strict")},
+				},
+				{
+					Name:       "lenient",
+					Validators: []JobValidator{warningValidator("lenient")},
+				},
+			}
+			j := NewJobHandler(
+				[]JobMutator{&testutil.HelloMutator{MutatorName: "hello"}},
+				[]JobValidator{warningValidator("base")},
+				hclog.NewNullLogger(),
+				WithProfiles(profiles, map[string]string{"prod": "strict", "dev": "lenient"}, tt.defaultProfile),
+			)
+			req := &Request{Namespace: tt.namespace}
+			_, warnings, err := j.ApplyAdmissionControllers(WithRequest(context.Background(), req), &api.Job{})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWarnings, warnings)
+			assert.Equal(t, tt.wantMutators, req.Mutators)
+			assert.Equal(t, tt.wantProfile, req.Profile)
+		})
+	}
+}
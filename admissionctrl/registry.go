@@ -0,0 +1,71 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+)
+
+// MutatorFactory creates the mutator of a mutator block.
+// The whole config is passed on for settings shared by all controllers.
+type MutatorFactory func(c *config.Config, m config.Mutator, logger hclog.Logger) (JobMutator, error)
+
+// ValidatorFactory creates the validator of a validator block.
+// The whole config is passed on for settings shared by all controllers.
+type ValidatorFactory func(c *config.Config, v config.Validator, logger hclog.Logger) (JobValidator, error)
+
+var (
+	factoriesMu        sync.RWMutex
+	mutatorFactories   = map[string]MutatorFactory{}
+	validatorFactories = map[string]ValidatorFactory{}
+)
+
+// RegisterMutatorFactory makes a mutator type available in the config, mutators of the type
+// require the named block unless it is "", custom types are configured with options.
+// It is meant to be called from init functions and panics if the type is already registered.
+func RegisterMutatorFactory(typeName string, requiredBlock string, factory MutatorFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic(fmt.Sprintf("mutator factory for %s is nil", typeName))
+	}
+	if _, ok := mutatorFactories[typeName]; ok {
+		panic(fmt.Sprintf("mutator type %s is already registered", typeName))
+	}
+	mutatorFactories[typeName] = factory
+	config.RegisterMutatorType(typeName, requiredBlock)
+}
+
+// RegisterValidatorFactory makes a validator type available in the config, validators of the type
+// require the named block unless it is "", custom types are configured with options.
+// It is meant to be called from init functions and panics if the type is already registered.
+func RegisterValidatorFactory(typeName string, requiredBlock string, factory ValidatorFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic(fmt.Sprintf("validator factory for %s is nil", typeName))
+	}
+	if _, ok := validatorFactories[typeName]; ok {
+		panic(fmt.Sprintf("validator type %s is already registered", typeName))
+	}
+	validatorFactories[typeName] = factory
+	config.RegisterValidatorType(typeName, requiredBlock)
+}
+
+// LookupMutatorFactory returns the factory registered for the mutator type.
+func LookupMutatorFactory(typeName string) (MutatorFactory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := mutatorFactories[typeName]
+	return factory, ok
+}
+
+// LookupValidatorFactory returns the factory registered for the validator type.
+func LookupValidatorFactory(typeName string) (ValidatorFactory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := validatorFactories[typeName]
+	return factory, ok
+}
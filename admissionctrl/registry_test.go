@@ -0,0 +1,80 @@
+package admissionctrl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type registryTestMutator struct {
+	name string
+}
+
+func (m *registryTestMutator) Mutate(ctx context.Context, job *api.Job) (*api.Job, []error, error) {
+	return job, nil, nil
+}
+
+func (m *registryTestMutator) Name() string {
+	return m.name
+}
+
+type registryTestValidator struct {
+	name string
+}
+
+func (v *registryTestValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	return nil, nil
+}
+
+func (v *registryTestValidator) Name() string {
+	return v.name
+}
+
+func TestRegisterMutatorFactory(t *testing.T) {
+	RegisterMutatorFactory("registry_test_mutator", "", func(c *config.Config, m config.Mutator, logger hclog.Logger) (JobMutator, error) {
+		return &registryTestMutator{name: m.Name + "/" + m.Options["suffix"]}, nil
+	})
+
+	factory, ok := LookupMutatorFactory("registry_test_mutator")
+	require.True(t, ok)
+	mutator, err := factory(&config.Config{}, config.Mutator{Name: "custom", Options: map[string]string{"suffix": "v1"}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "custom/v1", mutator.Name())
+
+	_, ok = LookupMutatorFactory("not_registered")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() {
+		RegisterMutatorFactory("registry_test_mutator", "", func(c *config.Config, m config.Mutator, logger hclog.Logger) (JobMutator, error) {
+			return nil, nil
+		})
+	}, "types can't be registered twice")
+	assert.Panics(t, func() { RegisterMutatorFactory("registry_test_nil_mutator", "", nil) })
+}
+
+func TestRegisterValidatorFactory(t *testing.T) {
+	RegisterValidatorFactory("registry_test_validator", "", func(c *config.Config, v config.Validator, logger hclog.Logger) (JobValidator, error) {
+		return &registryTestValidator{name: v.Name}, nil
+	})
+
+	factory, ok := LookupValidatorFactory("registry_test_validator")
+	require.True(t, ok)
+	validator, err := factory(&config.Config{}, config.Validator{Name: "custom"}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "custom", validator.Name())
+
+	_, ok = LookupValidatorFactory("not_registered")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() {
+		RegisterValidatorFactory("registry_test_validator", "", func(c *config.Config, v config.Validator, logger hclog.Logger) (JobValidator, error) {
+			return nil, nil
+		})
+	}, "types can't be registered twice")
+	assert.Panics(t, func() { RegisterValidatorFactory("registry_test_nil_validator", "", nil) })
+}
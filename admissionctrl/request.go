@@ -0,0 +1,126 @@
+package admissionctrl
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+)
+
+type contextKeyRequest struct{}
+type contextKeyRequestID struct{}
+
+var (
+	ctxRequest   = contextKeyRequest{}
+	ctxRequestID = contextKeyRequestID{}
+)
+
+// RequestIDHeader carries the request id to clients and webhooks.
+const RequestIDHeader = "X-Nacp-Request-Id"
+
+// Operations a job can be submitted with.
+const (
+	OperationCreate   = "create"
+	OperationUpdate   = "update"
+	OperationPlan     = "plan"
+	OperationValidate = "validate"
+	OperationRevert   = "revert"
+)
+
+// Request describes the Nomad API request a job was submitted with.
+type Request struct {
+	// Namespace is the effective namespace of the job.
+	Namespace string
+	// ExplicitNamespace reports if the namespace query parameter or the job set the namespace,
+	// Namespace is the default namespace otherwise.
+	ExplicitNamespace bool
+	// Token is the ACL token the request was authenticated with.
+	// It is nil if token resolution is disabled or the token could not be resolved.
+	Token *api.ACLToken
+
+	// Method and Path of the HTTP request.
+	Method string
+	Path   string
+	// Operation is one of the Operation constants.
+	Operation string
+	// Region is the region query parameter, the X-Nomad-Region header or the region of the job, in that order.
+	Region string
+	// ClientIP is the address of the client sending the request.
+	ClientIP string
+
+	// Profile is the name of the profile handling the job, recorded by the JobHandler.
+	Profile string
+
+	// Mutators are the names of the mutators applied to the job so far,
+	// recorded by the JobHandler.
+	Mutators []string
+
+	currentJob *currentJob
+}
+
+// CurrentJobLookup returns the registered version of the submitted job, nil if it is new.
+type CurrentJobLookup func(ctx context.Context) (*api.Job, error)
+
+type currentJob struct {
+	lookup CurrentJobLookup
+	mu     sync.Mutex
+	done   bool
+	job    *api.Job
+}
+
+// SetCurrentJobLookup sets how CurrentJob looks up the registered version of the job.
+func (r *Request) SetCurrentJobLookup(lookup CurrentJobLookup) {
+	r.currentJob = &currentJob{lookup: lookup}
+}
+
+// CurrentJob returns the registered version of the submitted job, nil if it is new
+// or there is no lookup. It is looked up once per request, failed lookups are retried.
+func (r *Request) CurrentJob(ctx context.Context) (*api.Job, error) {
+	if r.currentJob == nil {
+		return nil, nil
+	}
+	c := r.currentJob
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		job, err := c.lookup(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.job, c.done = job, true
+	}
+	return c.job, nil
+}
+
+// WithRequest returns a context carrying the request for the admission controllers.
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, ctxRequest, req)
+}
+
+// RequestFromContext returns the request of the context, or an empty request if there is none.
+func RequestFromContext(ctx context.Context) *Request {
+	if req, ok := ctx.Value(ctxRequest).(*Request); ok && req != nil {
+		return req
+	}
+	return &Request{}
+}
+
+// WithRequestID returns a context carrying the id correlating the logs of a request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxRequestID, id)
+}
+
+// RequestIDFromContext returns the request id of the context, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxRequestID).(string)
+	return id
+}
+
+// Logger returns the logger with the request id of the context, if there is one.
+func Logger(ctx context.Context, logger hclog.Logger) hclog.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
@@ -0,0 +1,132 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// imageKeys are the task config keys holding the image per driver.
+var imageKeys = map[string]string{
+	"docker":            "image",
+	"podman":            "image",
+	"containerd-driver": "image",
+}
+
+// imageTransport is the transport podman accepts in front of registry images.
+const imageTransport = "docker://"
+
+// AllowedImagesValidator rejects container tasks whose image is not from an allowed registry.
+type AllowedImagesValidator struct {
+	name     string
+	logger   hclog.Logger
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+func (v *AllowedImagesValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			key, ok := imageKeys[task.Driver]
+			if !ok {
+				continue
+			}
+			image, _ := task.Config[key].(string)
+			if v.isAllowed(image) {
+				continue
+			}
+			logger.Debug("Image not allowed", "rule", v.name, "job", job.ID, "task", task.Name, "driver", task.Driver, "image", image)
+			errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+				Msg:  fmt.Sprintf("Task %s/%s uses image %q which is not from an allowed registry", stringValue(tg.Name), task.Name, image),
+				Rule: v.name,
+			})
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func (v *AllowedImagesValidator) isAllowed(image string) bool {
+	if image == "" {
+		return false
+	}
+	image = normalizeImage(image)
+	for _, prefix := range v.prefixes {
+		if hasImagePrefix(image, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range v.patterns {
+		if pattern.MatchString(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasImagePrefix reports if the image starts with the prefix at a registry or path boundary,
+// so "registry.example.com" doesn't allow "registry.example.com.evil.io/app".
+// Prefixes naming a repository also allow its tags and digests.
+func hasImagePrefix(image string, prefix string) bool {
+	if !strings.HasPrefix(image, prefix) {
+		return false
+	}
+	if len(image) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	switch image[len(prefix)] {
+	case '/':
+		return true
+	case ':', '@':
+		// after a registry host a colon is a port, so only repositories have tags
+		return strings.Contains(prefix, "/")
+	}
+	return false
+}
+
+// normalizeImage prefixes images without a registry with docker.io, like the drivers pull them,
+// so "nginx:1.25" becomes "docker.io/library/nginx:1.25".
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, imageTransport)
+	registry, _, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		return image
+	}
+	if !found {
+		image = "library/" + image
+	}
+	return "docker.io/" + image
+}
+
+func (v *AllowedImagesValidator) Name() string {
+	return v.name
+}
+
+// NewAllowedImagesValidator creates a validator allowing the images starting with one of the prefixes
+// or entirely matching one of the patterns. Tasks of drivers other than docker, podman and containerd are not checked.
+func NewAllowedImagesValidator(name string, prefixes []string, patterns []string, logger hclog.Logger) (*AllowedImagesValidator, error) {
+	if len(prefixes) == 0 && len(patterns) == 0 {
+		return nil, fmt.Errorf("at least one registry or pattern is required")
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid image pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return &AllowedImagesValidator{
+		name:     name,
+		logger:   logger,
+		prefixes: prefixes,
+		patterns: compiled,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedImagesValidator(t *testing.T) {
+	task := func(name, driver, image string) *api.Task {
+		return &api.Task{Name: name, Driver: driver, Config: map[string]interface{}{"image": image}}
+	}
+	tests := []struct {
+		name    string
+		job     *api.Job
+		wantErr []string
+	}{
+		{
+			name: "allowed images in every group",
+			job: &api.Job{TaskGroups: []*api.TaskGroup{
+				{Name: pointer.Of("web"), Tasks: []*api.Task{task("nginx", "docker", "registry.example.com/nginx:1.25")}},
+				{Name: pointer.Of("cache"), Tasks: []*api.Task{
+					task("redis", "podman", "docker://registry.example.com/redis:7"),
+					task("agent", "containerd-driver", "ghcr.io/acme/agent:v1"),
+				}},
+			}},
+		},
+		{
+			name: "violations are reported per task",
+			job: &api.Job{TaskGroups: []*api.TaskGroup{
+				{Name: pointer.Of("web"), Tasks: []*api.Task{
+					task("nginx", "docker", "nginx:1.25"),
+					task("sidecar", "docker", "registry.example.com/envoy:1.28"),
+				}},
+				{Name: pointer.Of("cache"), Tasks: []*api.Task{
+					task("redis", "podman", "docker://quay.io/redis:7"),
+					task("agent", "containerd-driver", "ghcr.io/other/agent:v1"),
+				}},
+			}},
+			wantErr: []string{
+				`Task web/nginx uses image "nginx:1.25" which is not from an allowed registry (images)`,
+				`Task cache/redis uses image "docker://quay.io/redis:7" which is not from an allowed registry (images)`,
+				`Task cache/agent uses image "ghcr.io/other/agent:v1" which is not from an allowed registry (images)`,
+			},
+		},
+		{
+			name: "missing image",
+			job: &api.Job{TaskGroups: []*api.TaskGroup{
+				{Name: pointer.Of("web"), Tasks: []*api.Task{{Name: "nginx", Driver: "docker", Config: map[string]interface{}{}}}},
+			}},
+			wantErr: []string{`Task web/nginx uses image "" which is not from an allowed registry (images)`},
+		},
+		{
+			name: "other drivers are not checked",
+			job: &api.Job{TaskGroups: []*api.TaskGroup{
+				{Name: pointer.Of("batch"), Tasks: []*api.Task{{Name: "app", Driver: "exec", Config: map[string]interface{}{"command": "/bin/app"}}}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewAllowedImagesValidator("images", []string{"registry.example.com/"}, []string{`ghcr\.io/acme/.+`}, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.wantErr, errorMessages(t, err))
+		})
+	}
+}
+
+// errorMessages returns the messages of the errors collected in the multierror of a validator.
+func errorMessages(t *testing.T, err error) []string {
+	t.Helper()
+	merr, ok := err.(*multierror.Error)
+	require.True(t, ok, "expected a multierror, got %v", err)
+	var msgs []string
+	for _, e := range merr.Errors {
+		msgs = append(msgs, e.Error())
+	}
+	return msgs
+}
+
+func TestAllowedImagesBoundaries(t *testing.T) {
+	v, err := NewAllowedImagesValidator("images", []string{"registry.example.com", "docker.io/library/nginx"}, []string{`ghcr\.io/org/.+`}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	tests := map[string]bool{
+		"registry.example.com/app:v1":      true,
+		"registry.example.com.evil.io/x":   false,
+		"registry.example.com:5000/app:v1": false,
+		"nginx:1.25":                       true,
+		"nginx@sha256:abc":                 true,
+		"nginx-evil:1.25":                  false,
+		"ghcr.io/org/x":                    true,
+		"evil.io/ghcr.io/org/x":            false,
+		"ghcr.io/org/x.evil.io/y":          true,
+	}
+	for image, want := range tests {
+		assert.Equal(t, want, v.isAllowed(image), image)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := map[string]string{
+		"nginx:1.25":                       "docker.io/library/nginx:1.25",
+		"grafana/grafana:10":               "docker.io/grafana/grafana:10",
+		"docker://nginx":                   "docker.io/library/nginx",
+		"localhost/app:dev":                "localhost/app:dev",
+		"registry.example.com:5000/app:v1": "registry.example.com:5000/app:v1",
+	}
+	for image, want := range tests {
+		assert.Equal(t, want, normalizeImage(image), image)
+	}
+}
+
+func TestNewAllowedImagesValidatorRequiresRegistries(t *testing.T) {
+	_, err := NewAllowedImagesValidator("images", nil, nil, hclog.NewNullLogger())
+	assert.Error(t, err)
+
+	_, err = NewAllowedImagesValidator("images", nil, []string{"("}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "invalid image pattern")
+}
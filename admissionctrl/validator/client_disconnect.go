@@ -0,0 +1,97 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// ClientDisconnectPolicy defines which jobs must set max_client_disconnect on their groups and its bounds.
+type ClientDisconnectPolicy struct {
+	// JobTypes the policy applies to, all types if empty.
+	JobTypes []string
+	Min      time.Duration
+	// Max is ignored if zero.
+	Max time.Duration
+	// WarnOnly reports missing settings as warnings instead of rejecting the job.
+	WarnOnly bool
+}
+
+// ClientDisconnectValidator requires task groups to survive client disconnects for a bounded time.
+type ClientDisconnectValidator struct {
+	name   string
+	logger hclog.Logger
+	policy ClientDisconnectPolicy
+}
+
+func (v *ClientDisconnectValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	if !v.appliesTo(job) {
+		return nil, nil
+	}
+	var warnings []error
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		group := stringValue(tg.Name)
+		if tg.MaxClientDisconnect == nil {
+			logger.Debug("Group without max_client_disconnect", "rule", v.name, "job", job.ID, "group", group)
+			msg := &admissionctrl.RuleMessage{
+				Msg:  fmt.Sprintf("Group %s must set max_client_disconnect", group),
+				Rule: v.name,
+			}
+			if v.policy.WarnOnly {
+				warnings = append(warnings, msg)
+			} else {
+				errs = multierror.Append(errs, msg)
+			}
+			continue
+		}
+		disconnect := *tg.MaxClientDisconnect
+		if disconnect < v.policy.Min {
+			errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+				Msg:  fmt.Sprintf("Group %s sets max_client_disconnect to %s, minimum is %s", group, disconnect, v.policy.Min),
+				Rule: v.name,
+			})
+		}
+		if v.policy.Max > 0 && disconnect > v.policy.Max {
+			errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+				Msg:  fmt.Sprintf("Group %s sets max_client_disconnect to %s, maximum is %s", group, disconnect, v.policy.Max),
+				Rule: v.name,
+			})
+		}
+	}
+	return warnings, errs.ErrorOrNil()
+}
+
+func (v *ClientDisconnectValidator) appliesTo(job *api.Job) bool {
+	if len(v.policy.JobTypes) == 0 {
+		return true
+	}
+	// Nomad defaults to service jobs
+	jobType := api.JobTypeService
+	if job.Type != nil && *job.Type != "" {
+		jobType = *job.Type
+	}
+	return contains(v.policy.JobTypes, jobType)
+}
+
+func (v *ClientDisconnectValidator) Name() string {
+	return v.name
+}
+
+// NewClientDisconnectValidator creates a validator enforcing max_client_disconnect on task groups.
+func NewClientDisconnectValidator(name string, policy ClientDisconnectPolicy, logger hclog.Logger) (*ClientDisconnectValidator, error) {
+	if policy.Max > 0 && policy.Min > policy.Max {
+		return nil, fmt.Errorf("minimum client disconnect %s exceeds the maximum %s", policy.Min, policy.Max)
+	}
+	return &ClientDisconnectValidator{
+		name:   name,
+		logger: logger,
+		policy: policy,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDisconnectValidator(t *testing.T) {
+	jobWithDisconnect := func(jobType string, disconnect *time.Duration) *api.Job {
+		job := &api.Job{TaskGroups: []*api.TaskGroup{{Name: pointer.Of("edge"), MaxClientDisconnect: disconnect}}}
+		if jobType != "" {
+			job.Type = pointer.Of(jobType)
+		}
+		return job
+	}
+	tests := []struct {
+		name         string
+		policy       ClientDisconnectPolicy
+		job          *api.Job
+		wantWarnings []error
+		wantErr      []string
+	}{
+		{
+			name:   "group with max_client_disconnect",
+			policy: ClientDisconnectPolicy{Min: time.Hour, Max: 24 * time.Hour},
+			job:    jobWithDisconnect("service", pointer.Of(2*time.Hour)),
+		},
+		{
+			name:    "group without max_client_disconnect",
+			policy:  ClientDisconnectPolicy{},
+			job:     jobWithDisconnect("service", nil),
+			wantErr: []string{"Group edge must set max_client_disconnect (disconnect)"},
+		},
+		{
+			name:   "group without max_client_disconnect only warns",
+			policy: ClientDisconnectPolicy{WarnOnly: true},
+			job:    jobWithDisconnect("service", nil),
+			wantWarnings: []error{&admissionctrl.RuleMessage{
+				Msg:  "Group edge must set max_client_disconnect",
+				Rule: "disconnect",
+			}},
+		},
+		{
+			name:    "below minimum",
+			policy:  ClientDisconnectPolicy{Min: time.Hour},
+			job:     jobWithDisconnect("service", pointer.Of(time.Minute)),
+			wantErr: []string{"Group edge sets max_client_disconnect to 1m0s, minimum is 1h0m0s (disconnect)"},
+		},
+		{
+			name:    "above maximum",
+			policy:  ClientDisconnectPolicy{Max: time.Hour},
+			job:     jobWithDisconnect("service", pointer.Of(48*time.Hour)),
+			wantErr: []string{"Group edge sets max_client_disconnect to 48h0m0s, maximum is 1h0m0s (disconnect)"},
+		},
+		{
+			name:   "other job types are not checked",
+			policy: ClientDisconnectPolicy{JobTypes: []string{"service"}},
+			job:    jobWithDisconnect("batch", nil),
+		},
+		{
+			name:    "job without type is a service",
+			policy:  ClientDisconnectPolicy{JobTypes: []string{"service"}},
+			job:     jobWithDisconnect("", nil),
+			wantErr: []string{"Group edge must set max_client_disconnect (disconnect)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewClientDisconnectValidator("disconnect", tt.policy, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Equal(t, tt.wantWarnings, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestNewClientDisconnectValidatorRejectsInvalidBounds(t *testing.T) {
+	_, err := NewClientDisconnectValidator("disconnect", ClientDisconnectPolicy{Min: time.Hour, Max: time.Minute}, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
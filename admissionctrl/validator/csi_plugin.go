@@ -0,0 +1,108 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// CSIPluginAllowlist selects the identities allowed to deploy CSI plugin tasks.
+type CSIPluginAllowlist struct {
+	// Tokens are token names or accessor ids.
+	Tokens []string
+	// Policies allow every token having one of them.
+	Policies []string
+	// Management allows management tokens.
+	Management bool
+	// PluginIDs restricts the plugins allowed identities may deploy, empty allows all.
+	PluginIDs []string
+}
+
+// CSIPluginValidator rejects CSI plugin tasks submitted by identities not on the allowlist.
+// It relies on the request token, so identity resolution has to be enabled.
+type CSIPluginValidator struct {
+	name      string
+	logger    hclog.Logger
+	allowlist CSIPluginAllowlist
+}
+
+func (v *CSIPluginValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	token := admissionctrl.RequestFromContext(ctx).Token
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			if task.CSIPluginConfig == nil {
+				continue
+			}
+			if msg := v.check(token, task.CSIPluginConfig); msg != "" {
+				logger.Debug("CSI plugin task rejected", "rule", v.name, "job", job.ID, "group", tg.Name, "task", task.Name, "reason", msg)
+				errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+					Msg:  fmt.Sprintf("Task %s/%s is a CSI plugin: %s", stringValue(tg.Name), task.Name, msg),
+					Rule: v.name,
+				})
+			}
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func (v *CSIPluginValidator) check(token *api.ACLToken, plugin *api.TaskCSIPluginConfig) string {
+	if token == nil {
+		return "deploying CSI plugins requires a known identity"
+	}
+	if !v.isAllowed(token) {
+		return fmt.Sprintf("identity %s is not allowed to deploy CSI plugins", identityName(token))
+	}
+	if len(v.allowlist.PluginIDs) > 0 && !contains(v.allowlist.PluginIDs, plugin.ID) {
+		return fmt.Sprintf("plugin %s is not allowed", plugin.ID)
+	}
+	return ""
+}
+
+func (v *CSIPluginValidator) isAllowed(token *api.ACLToken) bool {
+	if v.allowlist.Management && token.Type == "management" {
+		return true
+	}
+	if contains(v.allowlist.Tokens, token.Name) || contains(v.allowlist.Tokens, token.AccessorID) {
+		return true
+	}
+	for _, policy := range token.Policies {
+		if contains(v.allowlist.Policies, policy) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *CSIPluginValidator) Name() string {
+	return v.name
+}
+
+func NewCSIPluginValidator(name string, allowlist CSIPluginAllowlist, logger hclog.Logger) *CSIPluginValidator {
+	return &CSIPluginValidator{
+		name:      name,
+		logger:    logger,
+		allowlist: allowlist,
+	}
+}
+
+func identityName(token *api.ACLToken) string {
+	if token.Name != "" {
+		return token.Name
+	}
+	return token.AccessorID
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value && value != "" {
+			return true
+		}
+	}
+	return false
+}
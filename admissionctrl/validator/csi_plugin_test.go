@@ -0,0 +1,103 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSIPluginValidator(t *testing.T) {
+	csiJob := &api.Job{
+		TaskGroups: []*api.TaskGroup{{
+			Name: pointer.Of("nodes"),
+			Tasks: []*api.Task{{
+				Name:            "plugin",
+				CSIPluginConfig: &api.TaskCSIPluginConfig{ID: "aws-ebs", Type: api.CSIPluginTypeNode},
+			}},
+		}},
+	}
+	plainJob := &api.Job{
+		TaskGroups: []*api.TaskGroup{{
+			Name:  pointer.Of("web"),
+			Tasks: []*api.Task{{Name: "server"}},
+		}},
+	}
+	allowlist := CSIPluginAllowlist{
+		Tokens:     []string{"storage-team"},
+		Policies:   []string{"csi-admin"},
+		Management: true,
+	}
+	tests := []struct {
+		name      string
+		allowlist CSIPluginAllowlist
+		job       *api.Job
+		token     *api.ACLToken
+		wantErr   string
+	}{
+		{
+			name:      "allowed token name",
+			allowlist: allowlist,
+			job:       csiJob,
+			token:     &api.ACLToken{Name: "storage-team", Type: "client"},
+		},
+		{
+			name:      "allowed policy",
+			allowlist: allowlist,
+			job:       csiJob,
+			token:     &api.ACLToken{Name: "ci", Type: "client", Policies: []string{"deploy", "csi-admin"}},
+		},
+		{
+			name:      "allowed management token",
+			allowlist: allowlist,
+			job:       csiJob,
+			token:     &api.ACLToken{Name: "root", Type: "management"},
+		},
+		{
+			name:      "disallowed identity",
+			allowlist: allowlist,
+			job:       csiJob,
+			token:     &api.ACLToken{Name: "app-team", Type: "client", Policies: []string{"deploy"}},
+			wantErr:   "Task nodes/plugin is a CSI plugin: identity app-team is not allowed to deploy CSI plugins (csi)",
+		},
+		{
+			name:      "unknown identity",
+			allowlist: allowlist,
+			job:       csiJob,
+			wantErr:   "Task nodes/plugin is a CSI plugin: deploying CSI plugins requires a known identity (csi)",
+		},
+		{
+			name:      "plugin not allowed",
+			allowlist: CSIPluginAllowlist{Tokens: []string{"storage-team"}, PluginIDs: []string{"gcp-pd"}},
+			job:       csiJob,
+			token:     &api.ACLToken{Name: "storage-team", Type: "client"},
+			wantErr:   "Task nodes/plugin is a CSI plugin: plugin aws-ebs is not allowed (csi)",
+		},
+		{
+			name:      "non CSI job from unknown identity",
+			allowlist: allowlist,
+			job:       plainJob,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewCSIPluginValidator("csi", tt.allowlist, hclog.NewNullLogger())
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Token: tt.token})
+
+			warnings, err := v.Validate(ctx, tt.job)
+
+			assert.Empty(t, warnings)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// DriverConfigRule restricts the top level keys of a driver's task config.
+// Denied keys are always rejected, if Allow is set all other keys are rejected as well.
+type DriverConfigRule struct {
+	Allow []string
+	Deny  []string
+}
+
+func (r DriverConfigRule) isAllowed(key string) bool {
+	if contains(r.Deny, key) {
+		return false
+	}
+	return len(r.Allow) == 0 || contains(r.Allow, key)
+}
+
+// DriverConfigPolicyValidator rejects task configs using keys not allowed for their driver.
+type DriverConfigPolicyValidator struct {
+	name    string
+	logger  hclog.Logger
+	drivers map[string]DriverConfigRule
+}
+
+func (v *DriverConfigPolicyValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			rule, ok := v.drivers[task.Driver]
+			if !ok {
+				continue
+			}
+			keys := make([]string, 0, len(task.Config))
+			for key := range task.Config {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if rule.isAllowed(key) {
+					continue
+				}
+				logger.Debug("Driver config key not allowed", "rule", v.name, "job", job.ID, "task", task.Name, "driver", task.Driver, "key", key)
+				errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+					Msg:  fmt.Sprintf("Task %s/%s uses %s config %s which is not allowed", stringValue(tg.Name), task.Name, task.Driver, key),
+					Rule: v.name,
+				})
+			}
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func (v *DriverConfigPolicyValidator) Name() string {
+	return v.name
+}
+
+// NewDriverConfigPolicyValidator creates a validator restricting the task config keys per driver.
+// Tasks of drivers without a rule are not checked.
+func NewDriverConfigPolicyValidator(name string, drivers map[string]DriverConfigRule, logger hclog.Logger) (*DriverConfigPolicyValidator, error) {
+	if len(drivers) == 0 {
+		return nil, fmt.Errorf("at least one driver rule is required")
+	}
+	for driver, rule := range drivers {
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			return nil, fmt.Errorf("driver rule %s requires allow or deny keys", driver)
+		}
+	}
+	return &DriverConfigPolicyValidator{
+		name:    name,
+		logger:  logger,
+		drivers: drivers,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverConfigPolicyValidator(t *testing.T) {
+	jobWithTask := func(driver string, config map[string]interface{}) *api.Job {
+		return &api.Job{TaskGroups: []*api.TaskGroup{{
+			Name:  pointer.Of("group"),
+			Tasks: []*api.Task{{Name: "task", Driver: driver, Config: config}},
+		}}}
+	}
+	drivers := map[string]DriverConfigRule{
+		"docker": {Deny: []string{"privileged", "cap_add", "devices"}},
+		"exec":   {Allow: []string{"command", "args"}},
+	}
+	tests := []struct {
+		name    string
+		job     *api.Job
+		wantErr []string
+	}{
+		{
+			name: "clean docker task",
+			job:  jobWithTask("docker", map[string]interface{}{"image": "nginx:1.25", "ports": []string{"http"}}),
+		},
+		{
+			name: "docker task using cap_add",
+			job:  jobWithTask("docker", map[string]interface{}{"image": "nginx:1.25", "cap_add": []string{"net_admin"}}),
+			wantErr: []string{
+				"Task group/task uses docker config cap_add which is not allowed (driver_config)",
+			},
+		},
+		{
+			name: "denied keys are reported in order",
+			job:  jobWithTask("docker", map[string]interface{}{"privileged": true, "devices": []interface{}{}}),
+			wantErr: []string{
+				"Task group/task uses docker config devices which is not allowed (driver_config)",
+				"Task group/task uses docker config privileged which is not allowed (driver_config)",
+			},
+		},
+		{
+			name:    "exec task with a key outside the allow list",
+			job:     jobWithTask("exec", map[string]interface{}{"command": "/bin/app", "pid_mode": "host"}),
+			wantErr: []string{"Task group/task uses exec config pid_mode which is not allowed (driver_config)"},
+		},
+		{
+			name: "driver without rule",
+			job:  jobWithTask("raw_exec", map[string]interface{}{"command": "/bin/app", "privileged": true}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewDriverConfigPolicyValidator("driver_config", drivers, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			merr, ok := err.(*multierror.Error)
+			require.True(t, ok, "expected a multierror, got %v", err)
+			var msgs []string
+			for _, e := range merr.Errors {
+				msgs = append(msgs, e.Error())
+			}
+			assert.Equal(t, tt.wantErr, msgs)
+		})
+	}
+}
+
+func TestNewDriverConfigPolicyValidatorRequiresRules(t *testing.T) {
+	_, err := NewDriverConfigPolicyValidator("driver_config", nil, hclog.NewNullLogger())
+	assert.Error(t, err)
+
+	_, err = NewDriverConfigPolicyValidator("driver_config", map[string]DriverConfigRule{"docker": {}}, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,103 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// JSONSchemaValidator validates jobs, as sent to the Nomad API, against a JSON schema.
+type JSONSchemaValidator struct {
+	name   string
+	logger hclog.Logger
+	schema *jsonschema.Schema
+}
+
+func (v *JSONSchemaValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, admissionctrl.ControllerFailure(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, admissionctrl.ControllerFailure(err)
+	}
+
+	err = v.schema.Validate(withoutNulls(doc))
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, admissionctrl.ControllerFailure(err)
+	}
+	var errs *multierror.Error
+	for _, violation := range violations(validationErr) {
+		location := violation.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		logger.Debug("Job violates schema", "rule", v.name, "job", job.ID, "location", location, "error", violation.Message)
+		errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+			Msg:  fmt.Sprintf("%s: %s", location, violation.Message),
+			Rule: v.name,
+		})
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+// violations returns the leaves of the validation error tree, every leaf is a single violation.
+func violations(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, violations(cause)...)
+	}
+	return leaves
+}
+
+// withoutNulls drops the unset fields of the job, so schemas don't have to allow null everywhere.
+func withoutNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if field == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = withoutNulls(field)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = withoutNulls(element)
+		}
+	}
+	return value
+}
+
+func (v *JSONSchemaValidator) Name() string {
+	return v.name
+}
+
+// NewJSONSchemaValidator creates a validator loading the JSON schema from schemaFile.
+func NewJSONSchemaValidator(name string, schemaFile string, logger hclog.Logger) (*JSONSchemaValidator, error) {
+	schema, err := jsonschema.Compile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", schemaFile, err)
+	}
+	return &JSONSchemaValidator{
+		name:   name,
+		logger: logger,
+		schema: schema,
+	}, nil
+}
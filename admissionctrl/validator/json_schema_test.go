@@ -0,0 +1,71 @@
+package validator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     *api.Job
+		wantErr []error
+	}{
+		{
+			name: "valid job",
+			job: &api.Job{
+				ID:          pointer.Of("web"),
+				Datacenters: []string{"dc1"},
+				TaskGroups:  []*api.TaskGroup{{Name: pointer.Of("frontend"), Count: pointer.Of(3)}},
+			},
+		},
+		{
+			name: "every violation is reported",
+			job: &api.Job{
+				ID:         pointer.Of("Web"),
+				TaskGroups: []*api.TaskGroup{{Name: pointer.Of("frontend"), Count: pointer.Of(30)}},
+			},
+			wantErr: []error{
+				&admissionctrl.RuleMessage{Msg: "/: missing properties: 'Datacenters'", Rule: "schema"},
+				&admissionctrl.RuleMessage{Msg: "/ID: does not match pattern '^[a-z][a-z0-9-]*$'", Rule: "schema"},
+				&admissionctrl.RuleMessage{Msg: "/TaskGroups/0/Count: must be <= 10 but found 30", Rule: "schema"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewJSONSchemaValidator("schema", testutil.Filepath(t, "schema/job.schema.json"), hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var merr *multierror.Error
+			require.ErrorAs(t, err, &merr)
+			assert.ElementsMatch(t, tt.wantErr, merr.Errors)
+		})
+	}
+}
+
+func TestNewJSONSchemaValidatorRejectsInvalidSchema(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "invalid.schema.json")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(`{"type": 42}`), 0600))
+
+	_, err := NewJSONSchemaValidator("schema", schemaFile, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "failed to compile schema")
+}
@@ -0,0 +1,87 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// NetworkCaps limits the network resources a group or task may reserve, nil caps are unlimited.
+type NetworkCaps struct {
+	MaxMBits         *int
+	MaxReservedPorts *int
+}
+
+// NetworkCapsValidator rejects jobs reserving more bandwidth or static ports than allowed.
+type NetworkCapsValidator struct {
+	name   string
+	logger hclog.Logger
+	caps   NetworkCaps
+}
+
+func (v *NetworkCapsValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		group := stringValue(tg.Name)
+		errs = multierror.Append(errs, v.check(logger, "Group "+group, tg.Networks)...)
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			errs = multierror.Append(errs, v.check(logger, fmt.Sprintf("Task %s/%s", group, task.Name), task.Resources.Networks)...)
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+// check compares the sums of the networks against the caps.
+func (v *NetworkCapsValidator) check(logger hclog.Logger, subject string, networks []*api.NetworkResource) []error {
+	mbits, ports := 0, 0
+	for _, n := range networks {
+		if n == nil {
+			continue
+		}
+		mbits += n.Megabits()
+		ports += len(n.ReservedPorts)
+	}
+	var errs []error
+	if v.caps.MaxMBits != nil && mbits > *v.caps.MaxMBits {
+		logger.Debug("Bandwidth reservation exceeds cap", "rule", v.name, "subject", subject, "mbits", mbits)
+		errs = append(errs, &admissionctrl.RuleMessage{
+			Msg:  fmt.Sprintf("%s reserves %d MBits, at most %d are allowed", subject, mbits, *v.caps.MaxMBits),
+			Rule: v.name,
+		})
+	}
+	if v.caps.MaxReservedPorts != nil && ports > *v.caps.MaxReservedPorts {
+		logger.Debug("Reserved ports exceed cap", "rule", v.name, "subject", subject, "ports", ports)
+		errs = append(errs, &admissionctrl.RuleMessage{
+			Msg:  fmt.Sprintf("%s reserves %d static ports, at most %d are allowed", subject, ports, *v.caps.MaxReservedPorts),
+			Rule: v.name,
+		})
+	}
+	return errs
+}
+
+func (v *NetworkCapsValidator) Name() string {
+	return v.name
+}
+
+// NewNetworkCapsValidator creates a validator enforcing the network caps on every group and task.
+func NewNetworkCapsValidator(name string, caps NetworkCaps, logger hclog.Logger) (*NetworkCapsValidator, error) {
+	if caps.MaxMBits != nil && *caps.MaxMBits < 0 {
+		return nil, fmt.Errorf("max mbits must not be negative")
+	}
+	if caps.MaxReservedPorts != nil && *caps.MaxReservedPorts < 0 {
+		return nil, fmt.Errorf("max reserved ports must not be negative")
+	}
+	return &NetworkCapsValidator{
+		name:   name,
+		logger: logger,
+		caps:   caps,
+	}, nil
+}
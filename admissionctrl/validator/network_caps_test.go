@@ -0,0 +1,95 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkCapsValidator(t *testing.T) {
+	caps := NetworkCaps{MaxMBits: pointer.Of(100), MaxReservedPorts: pointer.Of(1)}
+	jobWithNetworks := func(group []*api.NetworkResource, task []*api.NetworkResource) *api.Job {
+		return &api.Job{TaskGroups: []*api.TaskGroup{{
+			Name:     pointer.Of("cache"),
+			Networks: group,
+			Tasks:    []*api.Task{{Name: "redis", Resources: &api.Resources{Networks: task}}},
+		}}}
+	}
+	tests := []struct {
+		name    string
+		caps    NetworkCaps
+		job     *api.Job
+		wantErr []string
+	}{
+		{
+			name: "compliant reservation",
+			caps: caps,
+			job: jobWithNetworks(
+				[]*api.NetworkResource{{ReservedPorts: []api.Port{{Label: "db", Value: 6379}}, DynamicPorts: []api.Port{{Label: "a"}, {Label: "b"}}}},
+				[]*api.NetworkResource{{MBits: pointer.Of(60)}, {MBits: pointer.Of(40)}},
+			),
+		},
+		{
+			name:    "over cap bandwidth",
+			caps:    caps,
+			job:     jobWithNetworks(nil, []*api.NetworkResource{{MBits: pointer.Of(60)}, {MBits: pointer.Of(50)}}),
+			wantErr: []string{"Task cache/redis reserves 110 MBits, at most 100 are allowed (network)"},
+		},
+		{
+			name:    "over cap group bandwidth",
+			caps:    caps,
+			job:     jobWithNetworks([]*api.NetworkResource{{MBits: pointer.Of(1000)}}, nil),
+			wantErr: []string{"Group cache reserves 1000 MBits, at most 100 are allowed (network)"},
+		},
+		{
+			name: "too many reserved ports",
+			caps: caps,
+			job: jobWithNetworks(
+				[]*api.NetworkResource{{ReservedPorts: []api.Port{{Label: "http", Value: 80}, {Label: "https", Value: 443}}}},
+				nil,
+			),
+			wantErr: []string{"Group cache reserves 2 static ports, at most 1 are allowed (network)"},
+		},
+		{
+			name: "no reserved ports allowed",
+			caps: NetworkCaps{MaxReservedPorts: pointer.Of(0)},
+			job: jobWithNetworks(
+				nil,
+				[]*api.NetworkResource{{MBits: pointer.Of(1000), ReservedPorts: []api.Port{{Label: "http", Value: 80}}}},
+			),
+			wantErr: []string{"Task cache/redis reserves 1 static ports, at most 0 are allowed (network)"},
+		},
+		{
+			name: "no caps",
+			job:  jobWithNetworks([]*api.NetworkResource{{MBits: pointer.Of(1000)}}, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewNetworkCapsValidator("network", tt.caps, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestNewNetworkCapsValidatorRejectsNegativeCaps(t *testing.T) {
+	_, err := NewNetworkCapsValidator("network", NetworkCaps{MaxMBits: pointer.Of(-1)}, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
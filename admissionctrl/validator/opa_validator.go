@@ -2,11 +2,11 @@ package validator
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
 	"github.com/mxab/nacp/admissionctrl/opa"
 )
 
@@ -16,41 +16,40 @@ type OpaValidator struct {
 	name   string
 }
 
-func (v *OpaValidator) Validate(job *api.Job) ([]error, error) {
+func (v *OpaValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
 
-	ctx := context.TODO()
 	//iterate over rulesets and evaluate
 	allErrs := &multierror.Error{}
 	allWarnings := make([]error, 0)
 
-	v.logger.Debug("Validating job", "job", job.ID)
+	logger.Debug("Validating job", "job", job.ID)
 
 	// evaluate the query
 
 	results, err := v.query.Query(ctx, job)
 
 	if err != nil {
-		return nil, err
+		return nil, admissionctrl.ControllerFailure(err)
 	}
 
-	// aggregate warnings
-	warnings := results.GetWarnings()
-
-	if len(warnings) > 0 {
-		v.logger.Debug("Got warnings from rule", "rule", v.Name(), "warnings", warnings, "job", job.ID)
-		for _, warn := range warnings {
-			allWarnings = append(allWarnings, fmt.Errorf("%s (%s)", warn, v.Name()))
+	// aggregate warnings and errors, their level decides which is which
+	errsForRule := &multierror.Error{}
+	file, query := v.query.Provenance()
+	for _, m := range results.GetMessages() {
+		msg := &admissionctrl.RuleMessage{Msg: m.String(), Rule: v.Name(), File: file, Query: query}
+		if m.Level == opa.LevelError {
+			errsForRule = multierror.Append(errsForRule, msg)
+		} else {
+			allWarnings = append(allWarnings, msg)
 		}
 	}
+	if len(allWarnings) > 0 {
+		logger.Debug("Got warnings from rule", "rule", v.Name(), "warnings", allWarnings, "job", job.ID)
+	}
 
-	errors := results.GetErrors()
-
-	if len(errors) > 0 { // no errors is ok
-		v.logger.Debug("Got errors from rule", "rule", v.Name(), "errors", errors, "job", job.ID)
-		errsForRule := &multierror.Error{}
-		for _, err := range errors {
-			errsForRule = multierror.Append(errsForRule, fmt.Errorf("%s (%s)", err, v.Name()))
-		}
+	if len(errsForRule.Errors) > 0 { // no errors is ok
+		logger.Debug("Got errors from rule", "rule", v.Name(), "errors", errsForRule.Errors, "job", job.ID)
 		allErrs = multierror.Append(allErrs, errsForRule)
 	}
 
@@ -65,12 +64,18 @@ func (v *OpaValidator) Name() string {
 	return v.name
 }
 
-func NewOpaValidator(name, filename, query string, logger hclog.Logger) (*OpaValidator, error) {
+// Close stops refreshing the remote module of the validator.
+func (v *OpaValidator) Close() {
+	v.query.Close()
+}
+
+func NewOpaValidator(name, filename, query string, logger hclog.Logger, opts ...opa.QueryOption) (*OpaValidator, error) {
 
 	ctx := context.TODO()
 
 	// read the policy file
-	preparedEvalQuery, err := opa.CreateQuery(filename, query, ctx)
+	opts = append([]opa.QueryOption{opa.WithLogger(logger)}, opts...)
+	preparedEvalQuery, err := opa.CreateQuery(filename, query, ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
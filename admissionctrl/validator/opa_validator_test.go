@@ -1,10 +1,13 @@
 package validator
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/opa"
 	"github.com/mxab/nacp/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,7 +41,7 @@ func TestOpaValidator(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			job := testutil.ReadJob(t, tt.jobFile)
-			_, err := opa.Validate(job)
+			_, err := opa.Validate(context.Background(), job)
 			require.Equal(t, tt.wantErr, err != nil, "OpaValidator.Validate() error = %v, wantErr %v", err, tt.wantErr)
 
 		})
@@ -93,10 +96,59 @@ func TestOpaValidatorSimple(t *testing.T) {
 			opa, err := NewOpaValidator("testopavalidator", testutil.Filepath(t, "opa/errors.rego"),
 				tt.query, hclog.NewNullLogger())
 			require.NoError(t, err)
-			warnings, err := opa.Validate(dummyJob)
+			warnings, err := opa.Validate(context.Background(), dummyJob)
 			require.Equal(t, tt.wantErr, err != nil, "OpaValidator.Validate() error = %v, wantErr %v", err, tt.wantErr)
 			assert.Len(t, warnings, tt.wantWarnings, "OpaValidator.Validate() warnings = %v, wantWarnings %v", warnings, tt.wantWarnings)
 		})
 	}
 
 }
+
+func TestOpaValidatorStructuredMessages(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []opa.QueryOption
+		wantWarnings []error
+	}{
+		{
+			name: "info messages are suppressed",
+			wantWarnings: []error{
+				&admissionctrl.RuleMessage{Msg: "Job has no description", Rule: "structured"},
+				&admissionctrl.RuleMessage{Msg: "OWN001: Job has no owner", Rule: "structured"},
+			},
+		},
+		{
+			name: "info messages are shown with min level info",
+			opts: []opa.QueryOption{opa.WithMinLevel(opa.LevelInfo)},
+			wantWarnings: []error{
+				&admissionctrl.RuleMessage{Msg: "Job has no description", Rule: "structured"},
+				&admissionctrl.RuleMessage{Msg: "Job uses the default namespace", Rule: "structured"},
+				&admissionctrl.RuleMessage{Msg: "OWN001: Job has no owner", Rule: "structured"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewOpaValidator("structured", testutil.Filepath(t, "opa/validators/structured_messages.rego"),
+				"errors = data.structured_messages.errors; warnings = data.structured_messages.warnings", hclog.NewNullLogger(), tt.opts...)
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), &api.Job{})
+
+			assert.ElementsMatch(t, tt.wantWarnings, warnings)
+			require.Error(t, err)
+			assert.Equal(t, "1 error occurred:\n\t* COST001: Job has no costcenter (structured)\n\n", err.Error())
+		})
+	}
+}
+
+func TestOpaValidatorProvenance(t *testing.T) {
+	filename := testutil.Filepath(t, "opa/validators/structured_messages.rego")
+	v, err := NewOpaValidator("structured", filename, "errors = data.structured_messages.errors", hclog.NewNullLogger(), opa.WithProvenance())
+	require.NoError(t, err)
+
+	_, err = v.Validate(context.Background(), &api.Job{})
+
+	require.Error(t, err)
+	assert.Equal(t, "1 error occurred:\n\t* COST001: Job has no costcenter (rule=structured file="+filename+" query=\"errors = data.structured_messages.errors\")\n\n", err.Error())
+}
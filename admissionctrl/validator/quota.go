@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// QuotaValidator rejects jobs which would exceed the Nomad Enterprise quota of their namespace.
+// The remaining quota is the limit of the job's region minus the current usage,
+// for updates the resources of the current version of the job are given back.
+// Namespaces without quota are not checked.
+type QuotaValidator struct {
+	name   string
+	logger hclog.Logger
+	client *api.Client
+}
+
+// jobResources are the aggregated resources of all allocations of a job.
+type jobResources struct {
+	cpu      int
+	memoryMB int
+}
+
+func (v *QuotaValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	req := admissionctrl.RequestFromContext(ctx)
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = stringValue(job.Namespace)
+	}
+	if namespace == "" {
+		namespace = api.DefaultNamespace
+	}
+	q := &api.QueryOptions{Namespace: namespace, Region: stringValue(job.Region)}
+	if req.Token != nil {
+		q.AuthToken = req.Token.SecretID
+	}
+
+	ns, _, err := v.client.Namespaces().Info(namespace, q)
+	if err != nil {
+		return nil, admissionctrl.ControllerFailure(fmt.Errorf("failed to read namespace %s: %w", namespace, err))
+	}
+	if ns.Quota == "" {
+		return nil, nil
+	}
+	spec, _, err := v.client.Quotas().Info(ns.Quota, q)
+	if err != nil {
+		return nil, admissionctrl.ControllerFailure(fmt.Errorf("failed to read quota %s: %w", ns.Quota, err))
+	}
+	region := stringValue(job.Region)
+	if region == "" {
+		region = api.GlobalRegion
+	}
+	limit := regionLimit(spec.Limits, region)
+	if limit == nil {
+		return nil, nil
+	}
+	usage, _, err := v.client.Quotas().Usage(ns.Quota, q)
+	if err != nil {
+		return nil, admissionctrl.ControllerFailure(fmt.Errorf("failed to read usage of quota %s: %w", ns.Quota, err))
+	}
+	used := jobResources{}
+	if usage != nil {
+		if u := regionLimit(mapValues(usage.Used), region); u != nil {
+			used = jobResources{cpu: intValue(u.RegionLimit.CPU), memoryMB: intValue(u.RegionLimit.MemoryMB)}
+		}
+	}
+	if req.Operation != admissionctrl.OperationCreate && job.ID != nil {
+		current, _, err := v.client.Jobs().Info(*job.ID, q)
+		switch {
+		case err == nil:
+			currentResources := aggregateResources(current)
+			used.cpu -= currentResources.cpu
+			used.memoryMB -= currentResources.memoryMB
+		case !isNotFound(err):
+			return nil, admissionctrl.ControllerFailure(fmt.Errorf("failed to read job %s: %w", *job.ID, err))
+		}
+	}
+
+	needed := aggregateResources(job)
+	var errs *multierror.Error
+	for _, resource := range []struct {
+		name   string
+		unit   string
+		limit  int
+		used   int
+		needed int
+	}{
+		{"CPU", "MHz", intValue(limit.RegionLimit.CPU), used.cpu, needed.cpu},
+		{"memory", "MB", intValue(limit.RegionLimit.MemoryMB), used.memoryMB, needed.memoryMB},
+	} {
+		// 0 is unlimited, -1 allows none
+		if resource.limit == 0 || resource.needed == 0 {
+			continue
+		}
+		left := resource.limit - resource.used
+		if resource.limit < 0 || left < 0 {
+			left = 0
+		}
+		if resource.needed <= left {
+			continue
+		}
+		logger.Debug("Job exceeds quota", "rule", v.name, "job", job.ID, "quota", ns.Quota, "resource", resource.name, "needed", resource.needed, "left", left)
+		errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+			Msg: fmt.Sprintf("Job %s needs %d %s %s but only %d %s of quota %s are left in namespace %s",
+				stringValue(job.ID), resource.needed, resource.unit, resource.name, left, resource.unit, ns.Quota, namespace),
+			Rule: v.name,
+		})
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func regionLimit(limits []*api.QuotaLimit, region string) *api.QuotaLimit {
+	for _, limit := range limits {
+		if limit != nil && limit.Region == region && limit.RegionLimit != nil {
+			return limit
+		}
+	}
+	return nil
+}
+
+func mapValues(m map[string]*api.QuotaLimit) []*api.QuotaLimit {
+	values := make([]*api.QuotaLimit, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+func aggregateResources(job *api.Job) jobResources {
+	total := jobResources{}
+	for _, tg := range job.TaskGroups {
+		count := 1
+		if tg.Count != nil {
+			count = *tg.Count
+		}
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			total.cpu += count * intValue(task.Resources.CPU)
+			total.memoryMB += count * intValue(task.Resources.MemoryMB)
+		}
+	}
+	return total
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func (v *QuotaValidator) Name() string {
+	return v.name
+}
+
+// NewQuotaValidator creates a validator checking jobs against their namespace quota using the Nomad client.
+// The quota is read with the token of the request if it was resolved.
+func NewQuotaValidator(name string, client *api.Client, logger hclog.Logger) *QuotaValidator {
+	return &QuotaValidator{
+		name:   name,
+		logger: logger,
+		client: client,
+	}
+}
+
+// isNotFound reports if the Nomad API responded with 404, e.g. for a job which is not registered yet.
+func isNotFound(err error) bool {
+	var respErr api.UnexpectedResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode() == http.StatusNotFound
+}
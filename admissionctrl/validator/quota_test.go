@@ -0,0 +1,149 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jobWithResources(id string, count int, cpu int, memoryMB int) *api.Job {
+	return &api.Job{
+		ID: pointer.Of(id),
+		TaskGroups: []*api.TaskGroup{{
+			Name:  pointer.Of("group"),
+			Count: pointer.Of(count),
+			Tasks: []*api.Task{{Name: "task", Resources: &api.Resources{CPU: pointer.Of(cpu), MemoryMB: pointer.Of(memoryMB)}}},
+		}},
+	}
+}
+
+func newQuotaNomad(t *testing.T) *httptest.Server {
+	responses := map[string]interface{}{
+		"/v1/namespace/team-a": &api.Namespace{Name: "team-a", Quota: "team-quota"},
+		"/v1/namespace/team-b": &api.Namespace{Name: "team-b"},
+		"/v1/quota/team-quota": &api.QuotaSpec{Name: "team-quota", Limits: []*api.QuotaLimit{
+			{Region: "global", RegionLimit: &api.Resources{CPU: pointer.Of(4000), MemoryMB: pointer.Of(0)}},
+			{Region: "eu", RegionLimit: &api.Resources{CPU: pointer.Of(-1)}},
+		}},
+		"/v1/quota/usage/team-quota": &api.QuotaUsage{Name: "team-quota", Used: map[string]*api.QuotaLimit{
+			"aGFzaA==": {Region: "global", RegionLimit: &api.Resources{CPU: pointer.Of(3000), MemoryMB: pointer.Of(4096)}},
+		}},
+		"/v1/job/web":    jobWithResources("web", 3, 500, 256),
+		"/v1/job/locked": http.StatusForbidden,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		resp, ok := responses[req.URL.Path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if status, ok := resp.(int); ok {
+			rw.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(rw).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestQuotaValidator(t *testing.T) {
+	nomad := newQuotaNomad(t)
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+
+	euJob := jobWithResources("edge", 1, 100, 64)
+	euJob.Region = pointer.Of("eu")
+
+	tests := []struct {
+		name      string
+		namespace string
+		operation string
+		job       *api.Job
+		wantErr   string
+	}{
+		{
+			name:      "job within quota",
+			namespace: "team-a",
+			operation: admissionctrl.OperationCreate,
+			job:       jobWithResources("api", 2, 500, 1024),
+		},
+		{
+			name:      "job over quota",
+			namespace: "team-a",
+			operation: admissionctrl.OperationCreate,
+			job:       jobWithResources("api", 4, 500, 1024),
+			wantErr:   "Job api needs 2000 MHz CPU but only 1000 MHz of quota team-quota are left in namespace team-a (quota)",
+		},
+		{
+			name:      "update gives back the resources of the current job",
+			namespace: "team-a",
+			operation: admissionctrl.OperationUpdate,
+			job:       jobWithResources("web", 5, 500, 256),
+		},
+		{
+			name:      "update of an unregistered job",
+			namespace: "team-a",
+			operation: admissionctrl.OperationUpdate,
+			job:       jobWithResources("api", 2, 500, 1024),
+		},
+		{
+			name:      "region without any allowed CPU",
+			namespace: "team-a",
+			operation: admissionctrl.OperationCreate,
+			job:       euJob,
+			wantErr:   "Job edge needs 100 MHz CPU but only 0 MHz of quota team-quota are left in namespace team-a (quota)",
+		},
+		{
+			name:      "namespace without quota",
+			namespace: "team-b",
+			operation: admissionctrl.OperationCreate,
+			job:       jobWithResources("api", 100, 5000, 1024),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewQuotaValidator("quota", client, hclog.NewNullLogger())
+			ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Namespace: tt.namespace, Operation: tt.operation})
+
+			warnings, err := v.Validate(ctx, tt.job)
+			assert.Empty(t, warnings)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, "1 error occurred:\n\t* "+tt.wantErr+"\n\n")
+		})
+	}
+}
+
+func TestQuotaValidatorFailsIfNamespaceIsUnknown(t *testing.T) {
+	nomad := newQuotaNomad(t)
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+	v := NewQuotaValidator("quota", client, hclog.NewNullLogger())
+	ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Namespace: "unknown"})
+
+	_, err = v.Validate(ctx, jobWithResources("api", 1, 100, 64))
+	assert.ErrorContains(t, err, "failed to read namespace unknown")
+}
+
+func TestQuotaValidatorFailsIfCurrentJobIsUnreadable(t *testing.T) {
+	nomad := newQuotaNomad(t)
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+	v := NewQuotaValidator("quota", client, hclog.NewNullLogger())
+	ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{Namespace: "team-a", Operation: admissionctrl.OperationUpdate})
+
+	_, err = v.Validate(ctx, jobWithResources("locked", 1, 100, 64))
+	assert.ErrorContains(t, err, "failed to read job locked")
+}
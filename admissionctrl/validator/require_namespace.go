@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// RequireNamespaceValidator rejects jobs without an explicit namespace,
+// in a forbidden namespace or outside of the allowed namespaces.
+type RequireNamespaceValidator struct {
+	name      string
+	logger    hclog.Logger
+	forbidden []string
+	allowed   []string
+}
+
+func (v *RequireNamespaceValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	namespace := effectiveNamespace(ctx, job)
+	var msg string
+	switch {
+	case namespace == "":
+		msg = fmt.Sprintf("Job %s must set a namespace", stringValue(job.ID))
+	case contains(v.forbidden, namespace):
+		msg = fmt.Sprintf("Job %s must not use the namespace %s", stringValue(job.ID), namespace)
+	case len(v.allowed) > 0 && !contains(v.allowed, namespace):
+		msg = fmt.Sprintf("Job %s uses the namespace %s, allowed are %s", stringValue(job.ID), namespace, strings.Join(v.allowed, ", "))
+	default:
+		return nil, nil
+	}
+	logger.Debug("Namespace not permitted", "rule", v.name, "job", job.ID, "namespace", namespace)
+	return nil, &admissionctrl.RuleMessage{Msg: msg, Rule: v.name}
+}
+
+// effectiveNamespace is the namespace of the request, the namespace query parameter overrides
+// the one of the job. Without a request, or if the proxy defaulted it, it is the namespace of the job.
+func effectiveNamespace(ctx context.Context, job *api.Job) string {
+	if req := admissionctrl.RequestFromContext(ctx); req.ExplicitNamespace {
+		return req.Namespace
+	}
+	return stringValue(job.Namespace)
+}
+
+func (v *RequireNamespaceValidator) Name() string {
+	return v.name
+}
+
+// NewRequireNamespaceValidator creates a validator requiring jobs to set a permitted namespace.
+// Nil forbidden namespaces default to the default namespace, empty allowed namespaces allow all others.
+func NewRequireNamespaceValidator(name string, forbidden []string, allowed []string, logger hclog.Logger) (*RequireNamespaceValidator, error) {
+	if forbidden == nil {
+		forbidden = []string{api.DefaultNamespace}
+	}
+	for _, namespace := range allowed {
+		if contains(forbidden, namespace) {
+			return nil, fmt.Errorf("namespace %s is both allowed and forbidden", namespace)
+		}
+	}
+	return &RequireNamespaceValidator{
+		name:      name,
+		logger:    logger,
+		forbidden: forbidden,
+		allowed:   allowed,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireNamespaceValidator(t *testing.T) {
+	tests := []struct {
+		name      string
+		forbidden []string
+		allowed   []string
+		namespace string
+		// requestNamespace is the effective namespace resolved by the proxy
+		requestNamespace string
+		// implicit marks a request namespace the proxy defaulted
+		implicit bool
+		wantErr  string
+	}{
+		{name: "empty", wantErr: "Job example must set a namespace (namespace)"},
+		{name: "default", namespace: "default", wantErr: "Job example must not use the namespace default (namespace)"},
+		{name: "unset resolves to default", requestNamespace: "default", implicit: true, wantErr: "Job example must set a namespace (namespace)"},
+		{name: "explicit", namespace: "team-a"},
+		{name: "query parameter overrides the body", namespace: "default", requestNamespace: "team-a"},
+		{name: "query parameter to default", namespace: "team-a", requestNamespace: "default", wantErr: "Job example must not use the namespace default (namespace)"},
+		{name: "custom forbidden", forbidden: []string{"sandbox"}, namespace: "sandbox", wantErr: "Job example must not use the namespace sandbox (namespace)"},
+		{name: "custom forbidden allows default", forbidden: []string{"sandbox"}, namespace: "default"},
+		{name: "allowed", allowed: []string{"team-a", "team-b"}, namespace: "team-b"},
+		{name: "not allowed", allowed: []string{"team-a", "team-b"}, namespace: "team-c", wantErr: "Job example uses the namespace team-c, allowed are team-a, team-b (namespace)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewRequireNamespaceValidator("namespace", tt.forbidden, tt.allowed, hclog.NewNullLogger())
+			require.NoError(t, err)
+			job := &api.Job{ID: pointer.Of("example")}
+			if tt.namespace != "" {
+				job.Namespace = pointer.Of(tt.namespace)
+			}
+			ctx := context.Background()
+			if tt.requestNamespace != "" {
+				ctx = admissionctrl.WithRequest(ctx, &admissionctrl.Request{Namespace: tt.requestNamespace, ExplicitNamespace: !tt.implicit})
+			}
+
+			warnings, err := v.Validate(ctx, job)
+			assert.Empty(t, warnings)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewRequireNamespaceValidatorConflict(t *testing.T) {
+	_, err := NewRequireNamespaceValidator("namespace", nil, []string{"team-a", "default"}, hclog.NewNullLogger())
+	assert.EqualError(t, err, "namespace default is both allowed and forbidden")
+}
@@ -0,0 +1,64 @@
+package validator
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// RequiredFields selects which fields a job must set.
+type RequiredFields struct {
+	Datacenters bool
+	Type        bool
+	Namespace   bool
+	Constraints bool
+}
+
+// RequiredFieldsValidator rejects jobs missing any of the required fields.
+type RequiredFieldsValidator struct {
+	name     string
+	logger   hclog.Logger
+	required RequiredFields
+}
+
+func (v *RequiredFieldsValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var missing []string
+	if v.required.Datacenters && len(job.Datacenters) == 0 {
+		missing = append(missing, "Job must specify at least one datacenter")
+	}
+	if v.required.Type && (job.Type == nil || *job.Type == "") {
+		missing = append(missing, "Job must specify a type")
+	}
+	if v.required.Namespace && (job.Namespace == nil || *job.Namespace == "") {
+		missing = append(missing, "Job must specify a namespace")
+	}
+	if v.required.Constraints && len(job.Constraints) == 0 {
+		missing = append(missing, "Job must specify at least one constraint")
+	}
+
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	logger.Debug("Job is missing required fields", "rule", v.name, "missing", missing, "job", job.ID)
+	errs := &multierror.Error{}
+	for _, msg := range missing {
+		errs = multierror.Append(errs, &admissionctrl.RuleMessage{Msg: msg, Rule: v.name})
+	}
+	return nil, errs
+}
+
+func (v *RequiredFieldsValidator) Name() string {
+	return v.name
+}
+
+func NewRequiredFieldsValidator(name string, required RequiredFields, logger hclog.Logger) *RequiredFieldsValidator {
+	return &RequiredFieldsValidator{
+		name:     name,
+		logger:   logger,
+		required: required,
+	}
+}
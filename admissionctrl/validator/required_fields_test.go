@@ -0,0 +1,71 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredFieldsValidator(t *testing.T) {
+	all := RequiredFields{Datacenters: true, Type: true, Namespace: true, Constraints: true}
+	tests := []struct {
+		name       string
+		required   RequiredFields
+		job        *api.Job
+		wantErrors []string
+	}{
+		{
+			name:     "complete job",
+			required: all,
+			job: &api.Job{
+				Datacenters: []string{"dc1"},
+				Type:        pointer.Of("service"),
+				Namespace:   pointer.Of("team-a"),
+				Constraints: []*api.Constraint{api.NewConstraint("${attr.kernel.name}", "=", "linux")},
+			},
+		},
+		{
+			name:     "reports every missing field",
+			required: all,
+			job:      &api.Job{Type: pointer.Of("")},
+			wantErrors: []string{
+				"Job must specify at least one datacenter (required)",
+				"Job must specify a type (required)",
+				"Job must specify a namespace (required)",
+				"Job must specify at least one constraint (required)",
+			},
+		},
+		{
+			name:       "only checks enabled fields",
+			required:   RequiredFields{Datacenters: true},
+			job:        &api.Job{},
+			wantErrors: []string{"Job must specify at least one datacenter (required)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewRequiredFieldsValidator("required", tt.required, hclog.NewNullLogger())
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Empty(t, warnings)
+			if len(tt.wantErrors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			merr, ok := err.(*multierror.Error)
+			require.True(t, ok, "expected a multierror, got %v", err)
+			var got []string
+			for _, e := range merr.Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tt.wantErrors, got)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const (
+	// ResourceCoresOnlyCores requires tasks to reserve cores instead of cpu
+	ResourceCoresOnlyCores = "cores"
+	// ResourceCoresOnlyCPU forbids tasks to reserve cores
+	ResourceCoresOnlyCPU = "cpu"
+)
+
+// ResourceCoresValidator rejects tasks specifying both resources.cores and resources.cpu.
+// Optionally it only allows one of them.
+type ResourceCoresValidator struct {
+	name   string
+	logger hclog.Logger
+	only   string
+}
+
+func (v *ResourceCoresValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			if msg := v.check(task.Resources); msg != "" {
+				logger.Debug("Task violates cores policy", "rule", v.name, "job", job.ID, "group", tg.Name, "task", task.Name)
+				errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+					Msg:  fmt.Sprintf("Task %s/%s %s", stringValue(tg.Name), task.Name, msg),
+					Rule: v.name,
+				})
+			}
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func (v *ResourceCoresValidator) check(resources *api.Resources) string {
+	hasCores := resources.Cores != nil && *resources.Cores > 0
+	hasCPU := resources.CPU != nil && *resources.CPU > 0
+	switch {
+	case hasCores && hasCPU:
+		return "must not specify both cores and cpu"
+	case v.only == ResourceCoresOnlyCores && hasCPU:
+		return "must specify cores instead of cpu"
+	case v.only == ResourceCoresOnlyCPU && hasCores:
+		return "must specify cpu instead of cores"
+	}
+	return ""
+}
+
+func (v *ResourceCoresValidator) Name() string {
+	return v.name
+}
+
+// NewResourceCoresValidator creates the validator, only may be empty,
+// ResourceCoresOnlyCores or ResourceCoresOnlyCPU.
+func NewResourceCoresValidator(name string, only string, logger hclog.Logger) (*ResourceCoresValidator, error) {
+	switch only {
+	case "", ResourceCoresOnlyCores, ResourceCoresOnlyCPU:
+	default:
+		return nil, fmt.Errorf("invalid value %q for only, must be %q or %q", only, ResourceCoresOnlyCores, ResourceCoresOnlyCPU)
+	}
+	return &ResourceCoresValidator{
+		name:   name,
+		logger: logger,
+		only:   only,
+	}, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,80 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceCoresValidator(t *testing.T) {
+	jobWithResources := func(resources *api.Resources) *api.Job {
+		return &api.Job{
+			TaskGroups: []*api.TaskGroup{{
+				Name:  pointer.Of("group"),
+				Tasks: []*api.Task{{Name: "task", Resources: resources}},
+			}},
+		}
+	}
+	tests := []struct {
+		name    string
+		only    string
+		job     *api.Job
+		wantErr string
+	}{
+		{
+			name:    "both cores and cpu",
+			job:     jobWithResources(&api.Resources{Cores: pointer.Of(2), CPU: pointer.Of(500)}),
+			wantErr: "Task group/task must not specify both cores and cpu (cores)",
+		},
+		{
+			name: "only cores",
+			job:  jobWithResources(&api.Resources{Cores: pointer.Of(2)}),
+		},
+		{
+			name: "only cpu",
+			job:  jobWithResources(&api.Resources{CPU: pointer.Of(500)}),
+		},
+		{
+			name: "no resources",
+			job:  jobWithResources(nil),
+		},
+		{
+			name:    "cpu when cores are required",
+			only:    ResourceCoresOnlyCores,
+			job:     jobWithResources(&api.Resources{CPU: pointer.Of(500)}),
+			wantErr: "Task group/task must specify cores instead of cpu (cores)",
+		},
+		{
+			name:    "cores when cpu is required",
+			only:    ResourceCoresOnlyCPU,
+			job:     jobWithResources(&api.Resources{Cores: pointer.Of(2)}),
+			wantErr: "Task group/task must specify cpu instead of cores (cores)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewResourceCoresValidator("cores", tt.only, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Empty(t, warnings)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewResourceCoresValidatorInvalidOnly(t *testing.T) {
+	_, err := NewResourceCoresValidator("cores", "memory", hclog.NewNullLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// Nomad's defaults of unset resources.
+const (
+	defaultTaskCPU       = 100
+	defaultTaskMemoryMB  = 300
+	defaultEphemeralDisk = 300
+)
+
+// ResourceLimit caps requested resources, nil limits are unlimited.
+type ResourceLimit struct {
+	CPU      *int
+	Cores    *int
+	MemoryMB *int
+	// DiskMB caps the ephemeral disk, it is only checked per job.
+	DiskMB *int
+}
+
+// ResourceLimits are the limits of every task and of the sum of a job, its groups times their count.
+type ResourceLimits struct {
+	Task ResourceLimit
+	Job  ResourceLimit
+}
+
+// ResourceLimitsValidator rejects jobs requesting more resources than allowed.
+type ResourceLimitsValidator struct {
+	name   string
+	logger hclog.Logger
+	limits ResourceLimits
+}
+
+// resourceUsage is the sum of requested resources.
+type resourceUsage struct {
+	cpu, cores, memoryMB, diskMB int
+}
+
+func (u *resourceUsage) add(other resourceUsage, times int) {
+	u.cpu += other.cpu * times
+	u.cores += other.cores * times
+	u.memoryMB += other.memoryMB * times
+	u.diskMB += other.diskMB * times
+}
+
+func (v *ResourceLimitsValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	total := resourceUsage{}
+	for _, tg := range job.TaskGroups {
+		group := stringValue(tg.Name)
+		usage := resourceUsage{diskMB: defaultEphemeralDisk}
+		if tg.EphemeralDisk != nil && tg.EphemeralDisk.SizeMB != nil {
+			usage.diskMB = *tg.EphemeralDisk.SizeMB
+		}
+		for _, task := range tg.Tasks {
+			taskUsage := taskResources(task)
+			errs = multierror.Append(errs, v.check(logger, fmt.Sprintf("Task %s/%s", group, task.Name), taskUsage, v.limits.Task, "")...)
+			usage.add(taskUsage, 1)
+		}
+		count := 1
+		if tg.Count != nil {
+			count = *tg.Count
+		}
+		total.add(usage, count)
+	}
+	errs = multierror.Append(errs, v.check(logger, "Job "+stringValue(job.ID), total, v.limits.Job, " in total")...)
+	return nil, errs.ErrorOrNil()
+}
+
+// taskResources returns the resources of the task, using Nomad's defaults for unset ones.
+// Tasks with cores request no MHz.
+func taskResources(task *api.Task) resourceUsage {
+	usage := resourceUsage{cpu: defaultTaskCPU, memoryMB: defaultTaskMemoryMB}
+	if task.Resources == nil {
+		return usage
+	}
+	if task.Resources.Cores != nil && *task.Resources.Cores > 0 {
+		usage.cpu = 0
+		usage.cores = *task.Resources.Cores
+	} else if task.Resources.CPU != nil {
+		usage.cpu = *task.Resources.CPU
+	}
+	if task.Resources.MemoryMB != nil {
+		usage.memoryMB = *task.Resources.MemoryMB
+	}
+	return usage
+}
+
+// check compares the usage against the limit.
+func (v *ResourceLimitsValidator) check(logger hclog.Logger, subject string, usage resourceUsage, limit ResourceLimit, suffix string) []error {
+	var errs []error
+	exceeds := func(resource string, requested int, max *int) {
+		if max == nil || requested <= *max {
+			return
+		}
+		logger.Debug("Resource request exceeds limit", "rule", v.name, "subject", subject, "resource", resource, "requested", requested)
+		errs = append(errs, &admissionctrl.RuleMessage{
+			Msg:  fmt.Sprintf("%s requests %d %s%s, at most %d are allowed", subject, requested, resource, suffix, *max),
+			Rule: v.name,
+		})
+	}
+	exceeds("MHz cpu", usage.cpu, limit.CPU)
+	exceeds("cores", usage.cores, limit.Cores)
+	exceeds("MB memory", usage.memoryMB, limit.MemoryMB)
+	exceeds("MB disk", usage.diskMB, limit.DiskMB)
+	return errs
+}
+
+func (v *ResourceLimitsValidator) Name() string {
+	return v.name
+}
+
+// NewResourceLimitsValidator creates a validator enforcing the limits on every task and job.
+func NewResourceLimitsValidator(name string, limits ResourceLimits, logger hclog.Logger) (*ResourceLimitsValidator, error) {
+	if limits.Task.DiskMB != nil {
+		return nil, fmt.Errorf("disk can only be limited per job")
+	}
+	for _, limit := range []ResourceLimit{limits.Task, limits.Job} {
+		for _, value := range []*int{limit.CPU, limit.Cores, limit.MemoryMB, limit.DiskMB} {
+			if value != nil && *value < 0 {
+				return nil, fmt.Errorf("resource limits must not be negative")
+			}
+		}
+	}
+	return &ResourceLimitsValidator{
+		name:   name,
+		logger: logger,
+		limits: limits,
+	}, nil
+}
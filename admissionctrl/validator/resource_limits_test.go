@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimitsValidator(t *testing.T) {
+	task := func(name string, cpu, memory int) *api.Task {
+		return &api.Task{Name: name, Resources: &api.Resources{CPU: pointer.Of(cpu), MemoryMB: pointer.Of(memory)}}
+	}
+	group := func(name string, count int, tasks ...*api.Task) *api.TaskGroup {
+		return &api.TaskGroup{Name: pointer.Of(name), Count: pointer.Of(count), Tasks: tasks}
+	}
+	limits := ResourceLimits{
+		Task: ResourceLimit{CPU: pointer.Of(2000), MemoryMB: pointer.Of(4096), Cores: pointer.Of(2)},
+		Job:  ResourceLimit{CPU: pointer.Of(10000), MemoryMB: pointer.Of(16384), Cores: pointer.Of(4), DiskMB: pointer.Of(3000)},
+	}
+	tests := []struct {
+		name    string
+		job     *api.Job
+		wantErr []string
+	}{
+		{
+			name: "within limits",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				group("web", 2, task("nginx", 1000, 1024), task("sidecar", 500, 256)),
+				group("cache", 1, task("redis", 2000, 4096)),
+			}},
+		},
+		{
+			name: "task above its limit",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				group("web", 1, task("nginx", 2500, 8192)),
+			}},
+			wantErr: []string{
+				"Task web/nginx requests 2500 MHz cpu, at most 2000 are allowed (limits)",
+				"Task web/nginx requests 8192 MB memory, at most 4096 are allowed (limits)",
+			},
+		},
+		{
+			name: "count multiplies the groups",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				// 4 * (1500 + 500) + 3 * 1000 = 11000 MHz, 4 * (2048 + 1024) + 3 * 1024 = 15360 MB
+				group("web", 4, task("nginx", 1500, 2048), task("sidecar", 500, 1024)),
+				group("worker", 3, task("app", 1000, 1024)),
+			}},
+			wantErr: []string{"Job example requests 11000 MHz cpu in total, at most 10000 are allowed (limits)"},
+		},
+		{
+			name: "ephemeral disk per group times count",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				// 3 * 900 + 2 * 300 (default) = 3300 MB
+				{Name: pointer.Of("web"), Count: pointer.Of(3), EphemeralDisk: &api.EphemeralDisk{SizeMB: pointer.Of(900)}, Tasks: []*api.Task{task("nginx", 100, 100)}},
+				group("worker", 2, task("app", 100, 100)),
+			}},
+			wantErr: []string{"Job example requests 3300 MB disk in total, at most 3000 are allowed (limits)"},
+		},
+		{
+			name: "unset resources use nomad's defaults",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				// 60 tasks with 300 MB each = 18000 MB, the default group count is 1
+				{Name: pointer.Of("web"), Tasks: []*api.Task{{Name: "nginx"}}},
+				group("worker", 59, &api.Task{Name: "app"}),
+			}},
+			wantErr: []string{
+				"Job example requests 18000 MB memory in total, at most 16384 are allowed (limits)",
+				"Job example requests 18000 MB disk in total, at most 3000 are allowed (limits)",
+			},
+		},
+		{
+			name: "cores are counted instead of cpu",
+			job: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{
+				group("web", 3, &api.Task{Name: "nginx", Resources: &api.Resources{Cores: pointer.Of(2), CPU: pointer.Of(5000)}}),
+			}},
+			wantErr: []string{"Job example requests 6 cores in total, at most 4 are allowed (limits)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewResourceLimitsValidator("limits", limits, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.wantErr, errorMessages(t, err))
+		})
+	}
+}
+
+func TestNewResourceLimitsValidatorRejectsInvalidLimits(t *testing.T) {
+	_, err := NewResourceLimitsValidator("limits", ResourceLimits{Job: ResourceLimit{CPU: pointer.Of(-1)}}, hclog.NewNullLogger())
+	assert.Error(t, err)
+
+	_, err = NewResourceLimitsValidator("limits", ResourceLimits{Task: ResourceLimit{DiskMB: pointer.Of(100)}}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "disk can only be limited per job")
+}
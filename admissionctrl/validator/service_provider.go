@@ -0,0 +1,75 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// defaultServiceProvider is the provider Nomad uses for services without one.
+const defaultServiceProvider = "consul"
+
+// ServiceProviderValidator rejects services registered with a provider which is not allowed.
+type ServiceProviderValidator struct {
+	name    string
+	logger  hclog.Logger
+	allowed []string
+}
+
+func (v *ServiceProviderValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, v.logger)
+	var errs *multierror.Error
+	check := func(location string, services []*api.Service) {
+		for _, service := range services {
+			provider := service.Provider
+			if provider == "" {
+				provider = defaultServiceProvider
+			}
+			if v.isAllowed(provider) {
+				continue
+			}
+			logger.Debug("Service provider not allowed", "rule", v.name, "job", job.ID, "service", service.Name, "provider", provider)
+			errs = multierror.Append(errs, &admissionctrl.RuleMessage{
+				Msg:  fmt.Sprintf("Service %s of %s uses provider %s, allowed are %s", service.Name, location, provider, strings.Join(v.allowed, ", ")),
+				Rule: v.name,
+			})
+		}
+	}
+	for _, tg := range job.TaskGroups {
+		check("group "+stringValue(tg.Name), tg.Services)
+		for _, task := range tg.Tasks {
+			check("task "+stringValue(tg.Name)+"/"+task.Name, task.Services)
+		}
+	}
+	return nil, errs.ErrorOrNil()
+}
+
+func (v *ServiceProviderValidator) isAllowed(provider string) bool {
+	for _, allowed := range v.allowed {
+		if provider == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *ServiceProviderValidator) Name() string {
+	return v.name
+}
+
+// NewServiceProviderValidator creates a validator only allowing services of the given providers.
+func NewServiceProviderValidator(name string, allowed []string, logger hclog.Logger) (*ServiceProviderValidator, error) {
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("at least one allowed service provider is required")
+	}
+	return &ServiceProviderValidator{
+		name:    name,
+		logger:  logger,
+		allowed: allowed,
+	}, nil
+}
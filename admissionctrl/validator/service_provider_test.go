@@ -0,0 +1,80 @@
+package validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceProviderValidator(t *testing.T) {
+	jobWithServices := func(groupService, taskService *api.Service) *api.Job {
+		tg := &api.TaskGroup{Name: pointer.Of("group"), Tasks: []*api.Task{{Name: "task"}}}
+		if groupService != nil {
+			tg.Services = []*api.Service{groupService}
+		}
+		if taskService != nil {
+			tg.Tasks[0].Services = []*api.Service{taskService}
+		}
+		return &api.Job{TaskGroups: []*api.TaskGroup{tg}}
+	}
+	tests := []struct {
+		name    string
+		allowed []string
+		job     *api.Job
+		wantErr []string
+	}{
+		{
+			name:    "nomad service with only nomad allowed",
+			allowed: []string{"nomad"},
+			job:     jobWithServices(&api.Service{Name: "web", Provider: "nomad"}, nil),
+		},
+		{
+			name:    "consul services with only nomad allowed",
+			allowed: []string{"nomad"},
+			job:     jobWithServices(&api.Service{Name: "web", Provider: "consul"}, &api.Service{Name: "metrics"}),
+			wantErr: []string{
+				"Service web of group group uses provider consul, allowed are nomad (provider)",
+				"Service metrics of task group/task uses provider consul, allowed are nomad (provider)",
+			},
+		},
+		{
+			name:    "service without provider defaults to consul",
+			allowed: []string{"consul"},
+			job:     jobWithServices(nil, &api.Service{Name: "web"}),
+		},
+		{
+			name:    "nomad service with only consul allowed",
+			allowed: []string{"consul"},
+			job:     jobWithServices(nil, &api.Service{Name: "web", Provider: "nomad"}),
+			wantErr: []string{"Service web of task group/task uses provider nomad, allowed are consul (provider)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewServiceProviderValidator("provider", tt.allowed, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			warnings, err := v.Validate(context.Background(), tt.job)
+
+			assert.Empty(t, warnings)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestNewServiceProviderValidatorRequiresAllowed(t *testing.T) {
+	_, err := NewServiceProviderValidator("provider", nil, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
@@ -1,15 +1,16 @@
 package validator
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 )
 
 type WebhookValidator struct {
@@ -17,6 +18,7 @@ type WebhookValidator struct {
 	logger   hclog.Logger
 	method   string
 	name     string
+	client   *webhook.Client
 }
 
 type validationWebhookResponse struct {
@@ -24,31 +26,31 @@ type validationWebhookResponse struct {
 	Warnings []string `json:"warnings"`
 }
 
-func (w *WebhookValidator) Validate(job *api.Job) ([]error, error) {
+func (w *WebhookValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	logger := admissionctrl.Logger(ctx, w.logger)
 
 	data, err := json.Marshal(job)
 	if err != nil {
-		return nil, err
+		return nil, admissionctrl.ControllerFailure(err)
 	}
-	req, err := http.NewRequest(w.method, w.endpoint.String(), bytes.NewReader(data))
+	resp, err := w.client.Do(ctx, w.method, w.endpoint.String(), data)
 	if err != nil {
-		return nil, err
+		return nil, admissionctrl.ControllerFailure(err)
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	defer resp.Body.Close()
+	if err := webhook.CheckResponse(resp); err != nil {
+		return nil, admissionctrl.ControllerFailure(err)
 	}
 
 	valdationResult := &validationWebhookResponse{}
 	err = json.NewDecoder(resp.Body).Decode(valdationResult)
 
 	if err != nil {
-		return nil, err
+		return nil, admissionctrl.ControllerFailure(err)
 	}
 
 	if len(valdationResult.Errors) > 0 {
-		w.logger.Error("validation errors", "errors", valdationResult.Errors, "rule", w.name, "job", job.ID)
+		logger.Error("validation errors", "errors", valdationResult.Errors, "rule", w.name, "job", job.ID)
 		oneError := &multierror.Error{}
 		for _, e := range valdationResult.Errors {
 			oneError = multierror.Append(oneError, fmt.Errorf("%v", e))
@@ -70,7 +72,7 @@ func (w *WebhookValidator) Validate(job *api.Job) ([]error, error) {
 func (w *WebhookValidator) Name() string {
 	return w.name
 }
-func NewWebhookValidator(name string, endpoint string, method string, logger hclog.Logger) (*WebhookValidator, error) {
+func NewWebhookValidator(name string, endpoint string, method string, logger hclog.Logger, opts ...webhook.ClientOption) (*WebhookValidator, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -80,5 +82,6 @@ func NewWebhookValidator(name string, endpoint string, method string, logger hcl
 		logger:   logger,
 		endpoint: u,
 		method:   method,
+		client:   webhook.NewClient(append([]webhook.ClientOption{webhook.WithLogger(logger)}, opts...)...),
 	}, nil
 }
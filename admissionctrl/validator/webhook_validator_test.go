@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,9 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -96,7 +100,7 @@ func TestWebhookValidator(t *testing.T) {
 			validator, err := NewWebhookValidator("test", server.URL+tc.endpointPath, tc.method, hclog.NewNullLogger())
 			require.NoError(t, err)
 
-			warnings, err := validator.Validate(&api.Job{ID: &tc.name})
+			warnings, err := validator.Validate(context.Background(), &api.Job{ID: &tc.name})
 
 			require.True(t, webhookCalled, "webhook was not called")
 			assert.Equal(t, tc.wantErr, err)
@@ -105,3 +109,34 @@ func TestWebhookValidator(t *testing.T) {
 	}
 
 }
+
+func TestWebhookValidatorRejectsErrorResponses(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int
+	}{
+		{name: "500 after retries", status: http.StatusInternalServerError, wantAttempts: 2},
+		{name: "4xx", status: http.StatusBadRequest, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"error":"down"}`))
+			}))
+			defer server.Close()
+
+			validator, err := NewWebhookValidator("test", server.URL, "POST", hclog.NewNullLogger(), webhook.WithRetry(webhook.RetryPolicy{MaxAttempts: 2}))
+			require.NoError(t, err)
+
+			_, err = validator.Validate(context.Background(), &api.Job{ID: pointer.Of("example")})
+
+			assert.ErrorIs(t, err, admissionctrl.ErrControllerFailure, "the job must be rejected")
+			assert.ErrorContains(t, err, fmt.Sprintf("webhook responded with %d", tt.status))
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
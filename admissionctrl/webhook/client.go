@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// RetryPolicy configures how requests failing with connection errors or
+// 5xx responses are retried. 4xx responses are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2 disable retries.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling with every further retry.
+	Backoff time.Duration
+	// Jitter adds a random wait of up to this duration to every backoff.
+	Jitter time.Duration
+	// MaxElapsed caps the total time spent including retries, zero means no cap.
+	// A deadline of the request context caps it as well.
+	MaxElapsed time.Duration
+}
+
+// DefaultMaxResponseSize limits the webhook responses read by the client.
+const DefaultMaxResponseSize int64 = 10 * 1024 * 1024
+
+type Client struct {
+	httpClient      *http.Client
+	retry           RetryPolicy
+	maxResponseSize int64
+	logger          hclog.Logger
+	sleep           func(context.Context, time.Duration) error
+}
+
+type ClientOption func(*Client)
+
+// WithRetry retries failed requests according to the policy.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithMaxResponseSize fails reading response bodies larger than size bytes.
+func WithMaxResponseSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.maxResponseSize = size
+	}
+}
+
+// WithLogger logs retried requests.
+func WithLogger(logger hclog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithTransport sends the requests with the transport, e.g. to use a client certificate.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+// DefaultClient sends requests without retries.
+var DefaultClient = NewClient()
+
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient:      &http.Client{},
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          hclog.NewNullLogger(),
+		sleep:           sleep,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Do sends the json body to the url. Once all attempts are used up the last
+// response or error is returned, check the response with CheckResponse.
+func (c *Client) Do(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	if c.retry.MaxElapsed > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.MaxElapsed)
+		defer cancel()
+	}
+
+	logger := admissionctrl.Logger(ctx, c.logger)
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, url, body)
+		if !retryable(resp, err) || attempt >= c.retry.MaxAttempts {
+			return c.limit(resp), err
+		}
+
+		wait := c.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			logger.Debug("Not retrying webhook, retry would exceed the deadline", "url", url, "attempt", attempt)
+			return c.limit(resp), err
+		}
+		logger.Debug("Retrying webhook", "url", url, "attempt", attempt, "wait", wait, "error", err, "status", status(resp))
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CheckResponse returns an error for responses that aren't 2xx, like the last 5xx
+// response once the retries are used up, so their body isn't taken for a result.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("webhook responded with %s", resp.Status)
+}
+
+func (c *Client) send(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := admissionctrl.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(admissionctrl.RequestIDHeader, id)
+	}
+	return c.httpClient.Do(req)
+}
+
+func (c *Client) limit(resp *http.Response) *http.Response {
+	if resp != nil && c.maxResponseSize > 0 {
+		resp.Body = http.MaxBytesReader(nil, resp.Body, c.maxResponseSize)
+	}
+	return resp
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.retry.Backoff << (attempt - 1)
+	if c.retry.Jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(c.retry.Jitter)))
+	}
+	return wait
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// the request context is done, retrying won't help
+		return !isContextError(err)
+	}
+	return resp.StatusCode >= 500
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func status(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
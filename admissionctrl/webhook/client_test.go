@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retry        RetryPolicy
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "retries 5xx until success",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			retry:        RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "does not retry 4xx",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			retry:        RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			wantStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+		{
+			name:         "returns last response after max attempts",
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			retry:        RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			wantStatus:   http.StatusInternalServerError,
+			wantAttempts: 2,
+		},
+		{
+			name:         "no retries by default",
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			wantStatus:   http.StatusInternalServerError,
+			wantAttempts: 1,
+		},
+		{
+			name:         "stops when the backoff exceeds the max elapsed time",
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			retry:        RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxElapsed: time.Second},
+			wantStatus:   http.StatusInternalServerError,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				assert.Equal(t, `{"ID":"example"}`, string(body), "body is resent on every attempt")
+				rw.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			var waits []time.Duration
+			c := NewClient(WithRetry(tt.retry))
+			c.sleep = func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+
+			resp, err := c.Do(context.Background(), http.MethodPost, server.URL, []byte(`{"ID":"example"}`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantAttempts, attempts)
+			assert.Len(t, waits, tt.wantAttempts-1)
+		})
+	}
+}
+
+func TestClientRetriesConnectionErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var waits []time.Duration
+	c := NewClient(WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond, Jitter: 5 * time.Millisecond}))
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	_, err := c.Do(context.Background(), http.MethodPost, url, nil)
+	assert.Error(t, err)
+	require.Len(t, waits, 2)
+	assert.GreaterOrEqual(t, waits[0], 10*time.Millisecond)
+	assert.Less(t, waits[0], 15*time.Millisecond)
+	assert.GreaterOrEqual(t, waits[1], 20*time.Millisecond, "backoff doubles")
+	assert.Less(t, waits[1], 25*time.Millisecond)
+}
+
+func TestClientStopsAtContextDeadline(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := NewClient(WithRetry(RetryPolicy{MaxAttempts: 10, Backoff: 20 * time.Millisecond}))
+
+	start := time.Now()
+	resp, err := c.Do(ctx, http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.LessOrEqual(t, attempts, 2)
+}
+
+func TestClientLimitsResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"errors":["too long"]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(WithMaxResponseSize(10))
+	resp, err := c.Do(context.Background(), http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	var maxBytesErr *http.MaxBytesError
+	assert.ErrorAs(t, err, &maxBytesErr)
+}
+
+func TestClientForwardsRequestID(t *testing.T) {
+	var requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requestID = req.Header.Get(admissionctrl.RequestIDHeader)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().Do(admissionctrl.WithRequestID(context.Background(), "abc123"), http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "abc123", requestID)
+}
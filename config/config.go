@@ -1,6 +1,8 @@
 package config
 
 import (
+	"path/filepath"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsimple"
 )
@@ -8,23 +10,246 @@ import (
 type Webhook struct {
 	Endpoint string `hcl:"endpoint"`
 	Method   string `hcl:"method"`
+
+	// HealthPath is requested at startup to check the webhook is reachable.
+	// If empty a HEAD request is sent to the endpoint itself.
+	HealthPath string `hcl:"health_path,optional"`
+	// FailOnUnreachable aborts the startup instead of only warning if the
+	// webhook is not reachable.
+	FailOnUnreachable bool `hcl:"fail_on_unreachable,optional"`
+
+	Retry *WebhookRetry `hcl:"retry,block"`
+	TLS   *WebhookTLS   `hcl:"tls,block"`
+}
+
+// WebhookTLS configures the TLS connection to the webhook, independent of the one to Nomad.
+type WebhookTLS struct {
+	// CaFile verifies the webhook's certificate instead of the system roots.
+	CaFile string `hcl:"ca_file,optional"`
+	// CertFile and KeyFile are the client certificate for mTLS.
+	CertFile           string `hcl:"cert_file,optional"`
+	KeyFile            string `hcl:"key_file,optional"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+}
+
+// WebhookRetry retries webhook requests failing with connection errors or 5xx responses.
+type WebhookRetry struct {
+	// MaxAttempts including the first one, defaults to 3.
+	MaxAttempts int `hcl:"max_attempts,optional"`
+	// Backoff before the first retry, doubling with every retry, defaults to "100ms".
+	Backoff string `hcl:"backoff,optional"`
+	// Jitter adds a random wait of up to this duration to every backoff.
+	Jitter string `hcl:"jitter,optional"`
+	// MaxElapsed caps the total time of all attempts, defaults to "10s".
+	MaxElapsed string `hcl:"max_elapsed,optional"`
 }
 type OpaRule struct {
-	Query    string `hcl:"query"`
-	Filename string `hcl:"filename"`
+	// Query defaults to the errors, warnings and patch rules of the module's package.
+	Query    string `hcl:"query,optional"`
+	Filename string `hcl:"filename,optional"`
+	// BundlePath is a directory or tarball of rego modules and data documents loaded alongside the module,
+	// tarballs may also be downloaded from a http(s) url.
+	BundlePath string `hcl:"bundle_path,optional"`
+	// Checksum pins the module to its sha256 checksum, like "sha256:<hex>".
+	Checksum string `hcl:"checksum,optional"`
+	// MinLevel drops structured policy messages below "info", "warn" (default) or "error".
+	MinLevel string `hcl:"min_level,optional"`
+	// DataFile is a JSON object available to the policy as data.
+	DataFile string `hcl:"data_file,optional"`
+}
+
+type MetaDefaults struct {
+	Meta  map[string]string `hcl:"meta"`
+	Force bool              `hcl:"force,optional"`
+}
+
+type JobIDNamespace struct {
+	// Prefixes maps job id prefixes to namespaces, the longest matching prefix wins.
+	Prefixes map[string]string `hcl:"prefixes"`
+}
+
+// FieldMigration moves deprecated job fields to their replacements.
+type FieldMigration struct {
+	Rules []FieldMigrationRule `hcl:"rule,block"`
+}
+
+type FieldMigrationRule struct {
+	// From and To are dot separated field paths of the API job, "*" matches every list element.
+	// An empty To drops the field.
+	From    string `hcl:"from"`
+	To      string `hcl:"to,optional"`
+	Message string `hcl:"message,optional"`
+}
+
+// StripFields removes fields clients must not set from jobs.
+type StripFields struct {
+	// Paths are JSON pointers like "/VaultToken" or "/Meta/owner".
+	Paths []string `hcl:"paths"`
+}
+
+type DatacenterDefaults struct {
+	Datacenters []string `hcl:"datacenters"`
+}
+
+// ResourceDefaults sets resources of tasks and constraints of jobs which don't specify them.
+type ResourceDefaults struct {
+	CPU         *int                         `hcl:"cpu,optional"`
+	MemoryMB    *int                         `hcl:"memory,optional"`
+	MemoryMaxMB *int                         `hcl:"memory_max,optional"`
+	Constraints []ResourceDefaultsConstraint `hcl:"constraint,block"`
+}
+
+type ResourceDefaultsConstraint struct {
+	Attribute string `hcl:"attribute"`
+	// Operator defaults to "=".
+	Operator string `hcl:"operator,optional"`
+	Value    string `hcl:"value,optional"`
+}
+
+type RequiredFields struct {
+	Datacenters bool `hcl:"datacenters,optional"`
+	Type        bool `hcl:"type,optional"`
+	Namespace   bool `hcl:"namespace,optional"`
+	Constraints bool `hcl:"constraints,optional"`
+}
+
+type ResourceCores struct {
+	Only string `hcl:"only,optional"`
+}
+
+type ClientDisconnect struct {
+	JobTypes []string `hcl:"job_types,optional"`
+	Min      string   `hcl:"min,optional"`
+	Max      string   `hcl:"max,optional"`
+	// Warn reports groups without max_client_disconnect as warning instead of rejecting the job.
+	Warn bool `hcl:"warn,optional"`
+}
+
+// DriverConfigPolicy restricts the task config keys per driver.
+type DriverConfigPolicy struct {
+	Drivers []DriverConfigRule `hcl:"driver,block"`
+}
+
+type DriverConfigRule struct {
+	Driver string   `hcl:"driver,label"`
+	Allow  []string `hcl:"allow,optional"`
+	Deny   []string `hcl:"deny,optional"`
+}
+
+// AllowedImages lists the registries container tasks may pull their images from.
+type AllowedImages struct {
+	Registries []string `hcl:"registries,optional"`
+	Patterns   []string `hcl:"patterns,optional"`
+}
+
+// ResourceLimits caps the resources of every task and the sum of a job.
+type ResourceLimits struct {
+	Task *ResourceLimit `hcl:"task,block"`
+	Job  *ResourceLimit `hcl:"job,block"`
+}
+
+type ResourceLimit struct {
+	CPU      *int `hcl:"cpu,optional"`
+	Cores    *int `hcl:"cores,optional"`
+	MemoryMB *int `hcl:"memory,optional"`
+	DiskMB   *int `hcl:"disk,optional"`
+}
+
+// NetworkCaps limits the reserved bandwidth and static ports of every group and task.
+type NetworkCaps struct {
+	MaxMBits         *int `hcl:"max_mbits,optional"`
+	MaxReservedPorts *int `hcl:"max_reserved_ports,optional"`
+}
+
+// JSONSchema validates jobs against the JSON schema in SchemaFile.
+type JSONSchema struct {
+	SchemaFile string `hcl:"schema_file"`
+}
+
+// RequireNamespace requires jobs to set a namespace which is not forbidden.
+type RequireNamespace struct {
+	// Forbidden defaults to the default namespace.
+	Forbidden []string `hcl:"forbidden,optional"`
+	// Allowed restricts the namespaces, empty allows all but the forbidden ones.
+	Allowed []string `hcl:"allowed,optional"`
+}
+
+type ServiceProvider struct {
+	Allowed []string `hcl:"allowed"`
+}
+
+// CSIPlugin allowlists the identities which may deploy CSI plugins.
+type CSIPlugin struct {
+	// AllowedTokens are token names or accessor ids.
+	AllowedTokens   []string `hcl:"allowed_tokens,optional"`
+	AllowedPolicies []string `hcl:"allowed_policies,optional"`
+	AllowManagement bool     `hcl:"allow_management,optional"`
+	// AllowedPluginIDs restricts which plugins may be deployed, empty allows all.
+	AllowedPluginIDs []string `hcl:"allowed_plugin_ids,optional"`
 }
 
 type Validator struct {
-	Type    string   `hcl:"type,label"`
-	Name    string   `hcl:"name,label"`
-	OpaRule *OpaRule `hcl:"opa_rule,block"`
-	Webhook *Webhook `hcl:"webhook,block"`
+	Type      string `hcl:"type,label"`
+	Name      string `hcl:"name,label"`
+	Namespace string `hcl:"namespace,optional"`
+	// Enabled set to false skips the validator, defaults to true.
+	Enabled *bool `hcl:"enabled,optional"`
+	// Timeout cancels the validator if it takes longer, e.g. "2s".
+	Timeout string `hcl:"timeout,optional"`
+	// EnforcementLevel is "enforce" (default) or "warn", which reports errors as warnings.
+	EnforcementLevel string   `hcl:"enforcement_level,optional"`
+	OpaRule          *OpaRule `hcl:"opa_rule,block"`
+	Webhook          *Webhook `hcl:"webhook,block"`
+
+	RequiredFields   *RequiredFields   `hcl:"required_fields,block"`
+	ResourceCores    *ResourceCores    `hcl:"resource_cores,block"`
+	ServiceProvider  *ServiceProvider  `hcl:"service_provider,block"`
+	ClientDisconnect *ClientDisconnect `hcl:"client_disconnect,block"`
+	CSIPlugin        *CSIPlugin        `hcl:"csi_plugin,block"`
+
+	DriverConfigPolicy *DriverConfigPolicy `hcl:"driver_config_policy,block"`
+	NetworkCaps        *NetworkCaps        `hcl:"network_caps,block"`
+	JSONSchema         *JSONSchema         `hcl:"json_schema,block"`
+	AllowedImages      *AllowedImages      `hcl:"allowed_images,block"`
+	ResourceLimits     *ResourceLimits     `hcl:"resource_limits,block"`
+	RequireNamespace   *RequireNamespace   `hcl:"require_namespace,block"`
+
+	// Options configure validator types registered with admissionctrl.RegisterValidatorFactory.
+	Options map[string]string `hcl:"options,optional"`
+}
+
+// IsEnabled reports if the validator is created.
+func (v Validator) IsEnabled() bool {
+	return v.Enabled == nil || *v.Enabled
 }
+
 type Mutator struct {
-	Type    string   `hcl:"type,label"`
-	Name    string   `hcl:"name,label"`
-	OpaRule *OpaRule `hcl:"opa_rule,block"`
-	Webhook *Webhook `hcl:"webhook,block"`
+	Type      string `hcl:"type,label"`
+	Name      string `hcl:"name,label"`
+	Namespace string `hcl:"namespace,optional"`
+	// Enabled set to false skips the mutator, defaults to true.
+	Enabled *bool `hcl:"enabled,optional"`
+	// Phase is "pre" (default) to run before the validators or "post" to run after them.
+	Phase string `hcl:"phase,optional"`
+	// Timeout cancels the mutator if it takes longer, e.g. "2s".
+	Timeout      string        `hcl:"timeout,optional"`
+	OpaRule      *OpaRule      `hcl:"opa_rule,block"`
+	Webhook      *Webhook      `hcl:"webhook,block"`
+	MetaDefaults *MetaDefaults `hcl:"meta_defaults,block"`
+
+	DatacenterDefaults *DatacenterDefaults `hcl:"datacenter_defaults,block"`
+	JobIDNamespace     *JobIDNamespace     `hcl:"job_id_namespace,block"`
+	FieldMigration     *FieldMigration     `hcl:"field_migration,block"`
+	ResourceDefaults   *ResourceDefaults   `hcl:"resource_defaults,block"`
+	StripFields        *StripFields        `hcl:"strip_fields,block"`
+
+	// Options configure mutator types registered with admissionctrl.RegisterMutatorFactory.
+	Options map[string]string `hcl:"options,optional"`
+}
+
+// IsEnabled reports if the mutator is created.
+func (m Mutator) IsEnabled() bool {
+	return m.Enabled == nil || *m.Enabled
 }
 
 type NomadServerTLS struct {
@@ -34,24 +259,259 @@ type NomadServerTLS struct {
 	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
 }
 type NomadServer struct {
+	// Region selects the requests of a nomad_region block by their region query parameter.
+	Region  string          `hcl:"region,optional"`
 	Address string          `hcl:"address"`
 	TLS     *NomadServerTLS `hcl:"tls,block"`
+
+	// Timeouts of the transport to Nomad as durations like "10s".
+	// Unset values use the defaults of Go's default transport,
+	// response_header_timeout defaults to none to not break blocking queries.
+	DialTimeout           string `hcl:"dial_timeout,optional"`
+	TLSHandshakeTimeout   string `hcl:"tls_handshake_timeout,optional"`
+	ResponseHeaderTimeout string `hcl:"response_header_timeout,optional"`
+	IdleConnTimeout       string `hcl:"idle_conn_timeout,optional"`
+	// BlockingQueryTimeout replaces the response_header_timeout for blocking queries, defaults to none.
+	// It is only supported in the nomad block and applies to all regions.
+	BlockingQueryTimeout string `hcl:"blocking_query_timeout,optional"`
+	// RequestTimeout bounds each request including its admission controllers, blocking queries excluded.
+	// It is only supported in the nomad block and applies to all regions, defaults to none.
+	RequestTimeout string `hcl:"request_timeout,optional"`
+
+	// Token is NACP's own Nomad token for its requests to Nomad, TokenFile reads it from a file.
+	// They are only supported in the nomad block, tokens are replicated to all regions.
+	Token     string `hcl:"token,optional"`
+	TokenFile string `hcl:"token_file,optional"`
+
+	// Connection pool of the transport to Nomad, unset values use the defaults of the proxy.
+	MaxIdleConns        int `hcl:"max_idle_conns,optional"`
+	MaxIdleConnsPerHost int `hcl:"max_idle_conns_per_host,optional"`
+	// MaxConnsPerHost limits the connections to Nomad including blocking queries, defaults to no limit.
+	MaxConnsPerHost int `hcl:"max_conns_per_host,optional"`
+	// DisableHTTP2 keeps the connections to Nomad on HTTP/1.1, HTTP/2 is negotiated over TLS otherwise.
+	DisableHTTP2 bool `hcl:"disable_http2,optional"`
 }
 type ProxyTLS struct {
 	CertFile string `hcl:"cert_file"`
 	KeyFile  string `hcl:"key_file"`
 	CaFile   string `hcl:"ca_file"`
 }
+
+// RemotePolicies configures rego modules loaded from http(s) urls.
+type RemotePolicies struct {
+	// CacheDir stores the downloaded modules, defaults to a temp directory.
+	CacheDir string `hcl:"cache_dir,optional"`
+	// RefreshInterval is a duration like "5m", "0" disables refreshing.
+	RefreshInterval string `hcl:"refresh_interval,optional"`
+}
+
+// PolicyVerification requires rego modules to be signed.
+type PolicyVerification struct {
+	// PublicKeyFile is a PEM encoded ed25519 public key verifying the "<module>.sig" signatures.
+	PublicKeyFile string `hcl:"public_key_file"`
+}
+
+// BundleVerification requires OPA bundles to be signed, e.g. with `opa sign`.
+type BundleVerification struct {
+	// PublicKeyFile holds the PEM encoded public key, or the secret for HMAC algorithms.
+	PublicKeyFile string `hcl:"public_key_file"`
+	// KeyID names the key, defaults to "nacp".
+	KeyID string `hcl:"key_id,optional"`
+	// Algorithm defaults to RS256.
+	Algorithm string `hcl:"algorithm,optional"`
+	// Scope must match the scope of the signatures, if set.
+	Scope string `hcl:"scope,optional"`
+	// ExcludeFiles are glob patterns of bundle files not covered by the signatures.
+	ExcludeFiles []string `hcl:"exclude_files,optional"`
+}
+
+// OpaInput configures what is passed to OPA rules besides the job.
+type OpaInput struct {
+	Request *OpaRequestInput `hcl:"request,block"`
+	// CurrentJob looks up the registered version of the job at Nomad as input.current_job.
+	CurrentJob bool `hcl:"current_job,optional"`
+	// Normalized adds the raw job as input.job and a driver independent view of its tasks as input.normalized.
+	Normalized bool `hcl:"normalized,optional"`
+}
+
+// OpaRequestInput selects the request metadata available as input.nacp.request.
+type OpaRequestInput struct {
+	Method bool `hcl:"method,optional"`
+	Path   bool `hcl:"path,optional"`
+	// Operation adds is_create, is_update and is_revert.
+	Operation bool `hcl:"operation,optional"`
+	Region    bool `hcl:"region,optional"`
+	Namespace bool `hcl:"namespace,optional"`
+	ClientIP  bool `hcl:"client_ip,optional"`
+}
+
+// Identity configures how the identity of the request token is used.
+// If present, the token of every job submission is looked up at Nomad.
+type Identity struct {
+	// StampOwner sets the owner meta of every job from the request token,
+	// overriding any user supplied value.
+	StampOwner bool `hcl:"stamp_owner,optional"`
+	// OwnerMetaKey defaults to "nacp.owner".
+	OwnerMetaKey string `hcl:"owner_meta_key,optional"`
+}
+type Response struct {
+	// HideRuleSource strips the "(rule)" annotation of policy messages
+	// returned to clients. Server logs keep the annotation.
+	HideRuleSource bool `hcl:"hide_rule_source,optional"`
+	// RuleSourceReplacement replaces the annotation instead of stripping it.
+	RuleSourceReplacement string `hcl:"rule_source_replacement,optional"`
+	// RuleProvenance annotates the messages of OPA rules with their policy file and query,
+	// as "(rule=name file=... query="...")" instead of "(rule)".
+	RuleProvenance bool `hcl:"rule_provenance,optional"`
+	// WarningDigest starts the warnings with a summary counting them per rule.
+	WarningDigest bool `hcl:"warning_digest,optional"`
+	// CollapseWarnings only returns the summary of the warning digest.
+	CollapseWarnings bool `hcl:"collapse_warnings,optional"`
+	// InjectWarnings adds the warnings of the admission controllers to Nomad's
+	// register, plan and validate responses, defaults to true.
+	InjectWarnings *bool `hcl:"inject_warnings,optional"`
+	// WarningTrailers sends the warnings as X-Nacp-Warning response trailers too.
+	WarningTrailers bool `hcl:"warning_trailers,optional"`
+	// MutateParsedJobs applies the mutators to jobs parsed from HCL by /v1/jobs/parse.
+	MutateParsedJobs bool `hcl:"mutate_parsed_jobs,optional"`
+	// ValidatePostMutation applies the mutators to jobs of /v1/validate/job before validating them, defaults to true.
+	// Set to false they are validated and sent to Nomad as submitted.
+	ValidatePostMutation *bool `hcl:"validate_post_mutation,optional"`
+}
+type MutationDiff struct {
+	// Header attaches the diff base64 encoded as X-Nacp-Mutations response header.
+	Header bool `hcl:"header,optional"`
+}
+type Tracing struct {
+	// Endpoint of the OTLP/HTTP collector, e.g. localhost:4318
+	Endpoint    string `hcl:"endpoint"`
+	Insecure    bool   `hcl:"insecure,optional"`
+	ServiceName string `hcl:"service_name,optional"`
+}
+
+// RateLimit limits job submissions per token or client ip.
+type RateLimit struct {
+	// Rate of allowed submissions per second.
+	Rate float64 `hcl:"rate"`
+	// Burst defaults to the rate rounded up.
+	Burst int `hcl:"burst,optional"`
+	// Key is "token" (default) or "ip". Requests without a token are limited per ip.
+	Key string `hcl:"key,optional"`
+}
+
+// APIAccess restricts which Nomad API requests are proxied.
+type APIAccess struct {
+	// DefaultAction of requests matching no rule, "allow" (default) or "deny".
+	DefaultAction string          `hcl:"default_action,optional"`
+	Rules         []APIAccessRule `hcl:"rule,block"`
+}
+
+// APIAccessRule allows or denies requests, the first matching rule wins.
+type APIAccessRule struct {
+	// Method matches any method if empty.
+	Method string `hcl:"method,optional"`
+	// Path is a pattern like "/v1/job/*", a trailing "/**" matches all sub paths.
+	Path   string `hcl:"path"`
+	Action string `hcl:"action"`
+}
+
+// Audit writes a JSON line for every admission decision.
+type Audit struct {
+	// Output is a file the records are appended to, or "stdout".
+	Output string `hcl:"output"`
+	// BufferSize is the number of records buffered before records are dropped, defaults to 1024.
+	BufferSize int `hcl:"buffer_size,optional"`
+}
+
+// ReloadEndpoint enables POST /nacp/reload, protected by a shared secret.
+type ReloadEndpoint struct {
+	// Secret must be sent in the X-Nacp-Reload-Secret header.
+	Secret string `hcl:"secret"`
+}
+
+// RecentDecisions keeps the last admission decisions in memory, served at /nacp/recent.
+type RecentDecisions struct {
+	// Size is the number of decisions kept, defaults to 100.
+	Size int `hcl:"size,optional"`
+}
+
+// CORS allows browsers to call the /nacp/ management endpoints from the allowed origins.
+type CORS struct {
+	// AllowedOrigins may contain "*" to allow every origin.
+	AllowedOrigins []string `hcl:"allowed_origins"`
+	// AllowedMethods default to GET.
+	AllowedMethods []string `hcl:"allowed_methods,optional"`
+	AllowedHeaders []string `hcl:"allowed_headers,optional"`
+	// MaxAge of preflight responses, e.g. "10m".
+	MaxAge string `hcl:"max_age,optional"`
+}
+
+// Readiness bounds the retries of the Nomad check at startup, /nacp/ready reports not ready until Nomad is reachable.
+type Readiness struct {
+	// Attempts of the check at startup, defaults to 10.
+	Attempts int `hcl:"attempts,optional"`
+	// InitialBackoff doubles after every failed attempt up to MaxBackoff, defaults to "1s" and "30s".
+	InitialBackoff string `hcl:"initial_backoff,optional"`
+	MaxBackoff     string `hcl:"max_backoff,optional"`
+}
+
+// Profile is a named set of controllers handling the jobs of its namespaces.
+// Controllers referenced by no profile apply to every profile.
+type Profile struct {
+	Name       string   `hcl:"name,label"`
+	Namespaces []string `hcl:"namespaces,optional"`
+	Mutators   []string `hcl:"mutators,optional"`
+	Validators []string `hcl:"validators,optional"`
+}
+
 type Config struct {
 	Port int    `hcl:"port,optional"`
 	Bind string `hcl:"bind,optional"`
+	// BindAddresses listens on each of the addresses instead of only on Bind.
+	BindAddresses []string `hcl:"bind_addresses,optional"`
+	// ListenNetwork is "tcp" (default) to listen on IPv4 and IPv6, "tcp4" or "tcp6".
+	ListenNetwork string `hcl:"listen_network,optional"`
+
+	LogLevel string `hcl:"log_level,optional"`
+	// MaxJobSize limits job submissions and decoded responses in bytes, defaults to 10MB.
+	MaxJobSize int64     `hcl:"max_job_size,optional"`
+	Tls        *ProxyTLS `hcl:"tls,block"`
+	Response   *Response `hcl:"response,block"`
+	// TrustedProxies are ip addresses or CIDR ranges whose X-Forwarded-* headers are kept.
+	TrustedProxies []string `hcl:"trusted_proxies,optional"`
 
-	LogLevel string    `hcl:"log_level,optional"`
-	Tls      *ProxyTLS `hcl:"tls,block"`
+	MutationDiff *MutationDiff `hcl:"mutation_diff,block"`
+	Tracing      *Tracing      `hcl:"tracing,block"`
+	RateLimit    *RateLimit    `hcl:"rate_limit,block"`
+	APIAccess    *APIAccess    `hcl:"api_access,block"`
+	CORS         *CORS         `hcl:"cors,block"`
+	Audit        *Audit        `hcl:"audit,block"`
 
-	Nomad      *NomadServer `hcl:"nomad,block"`
-	Validators []Validator  `hcl:"validator,block"`
-	Mutators   []Mutator    `hcl:"mutator,block"`
+	RecentDecisions *RecentDecisions `hcl:"recent_decisions,block"`
+
+	ReloadEndpoint *ReloadEndpoint `hcl:"reload_endpoint,block"`
+	Readiness      *Readiness      `hcl:"readiness,block"`
+
+	RemotePolicies     *RemotePolicies     `hcl:"remote_policies,block"`
+	PolicyVerification *PolicyVerification `hcl:"policy_verification,block"`
+	BundleVerification *BundleVerification `hcl:"bundle_verification,block"`
+	OpaInput           *OpaInput           `hcl:"opa_input,block"`
+	Identity           *Identity           `hcl:"identity,block"`
+
+	Nomad *NomadServer `hcl:"nomad,block"`
+	// NomadRegions are the Nomad servers of other regions, requests without a known region go to Nomad.
+	NomadRegions []*NomadServer `hcl:"nomad_region,block"`
+	Validators   []Validator    `hcl:"validator,block"`
+	Mutators     []Mutator      `hcl:"mutator,block"`
+	// ValidatorConcurrency limits how many validators of a job run at the same time, defaults to the number of CPUs.
+	ValidatorConcurrency int `hcl:"validator_concurrency,optional"`
+	// SkipJobIDPrefixes and SkipNamespaces exempt jobs from all mutators and validators.
+	SkipJobIDPrefixes []string `hcl:"skip_job_id_prefixes,optional"`
+	SkipNamespaces    []string `hcl:"skip_namespaces,optional"`
+
+	Profiles []*Profile `hcl:"profile,block"`
+	// DefaultProfile handles the jobs of namespaces not mapped to a profile.
+	DefaultProfile string `hcl:"default_profile,optional"`
 }
 
 func DefaultConfig() *Config {
@@ -67,11 +527,15 @@ func DefaultConfig() *Config {
 	}
 	return c
 }
+
+// LoadConfig decodes the config file, values can use the env, file and trimspace functions.
 func LoadConfig(name string) (*Config, error) {
 
 	c := DefaultConfig()
 
-	evalContext := &hcl.EvalContext{}
+	evalContext := &hcl.EvalContext{
+		Functions: configFunctions(filepath.Dir(name)),
+	}
 	err := hclsimple.DecodeFile(name, evalContext, c)
 	if err != nil {
 		return nil, err
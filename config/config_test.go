@@ -3,6 +3,8 @@ package config
 import (
 	"testing"
 
+	"github.com/hashicorp/nomad/helper/pointer"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -64,8 +66,9 @@ func TestLoadConfig(t *testing.T) {
 				},
 				Mutators: []Mutator{
 					{
-						Type: "opa_json_patch",
-						Name: "some_opa_mutator",
+						Type:      "opa_json_patch",
+						Name:      "some_opa_mutator",
+						Namespace: "team-a",
 						OpaRule: &OpaRule{
 
 							Query:    "patch = data.hello_world_meta.patch",
@@ -89,3 +92,37 @@ func TestLoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigWithFunctions(t *testing.T) {
+	t.Setenv("NACP_TEST_NOMAD_ADDR", "https://nomad.example.com:4646")
+
+	config, err := LoadConfig("testdata/with_functions.hcl")
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://nomad.example.com:4646", config.Nomad.Address)
+	assert.Equal(t, "info", config.LogLevel, "fallback of an unset variable")
+	assert.Equal(t, &ReloadEndpoint{Secret: "s3cret"}, config.ReloadEndpoint)
+
+	t.Setenv("NACP_TEST_LOG_LEVEL", "debug")
+	config, err = LoadConfig("testdata/with_functions.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, "debug", config.LogLevel)
+}
+
+func TestLoadConfigWithUnsetEnv(t *testing.T) {
+	_, err := LoadConfig("testdata/with_functions.hcl")
+
+	assert.ErrorContains(t, err, "environment variable NACP_TEST_NOMAD_ADDR is not set")
+}
+
+func TestLoadConfigWithDisabledControllers(t *testing.T) {
+	config, err := LoadConfig("testdata/with_disabled.hcl")
+
+	require.NoError(t, err)
+	require.Len(t, config.Validators, 1)
+	assert.Equal(t, pointer.Of(false), config.Validators[0].Enabled)
+	assert.False(t, config.Validators[0].IsEnabled())
+	require.Len(t, config.Mutators, 1)
+	assert.Nil(t, config.Mutators[0].Enabled)
+	assert.True(t, config.Mutators[0].IsEnabled(), "controllers are enabled by default")
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsimple"
+)
+
+// LoadConfigDir decodes and merges the *.hcl files of the directory in lexical order.
+// The validator, mutator, nomad_region and profile blocks of all files are concatenated,
+// any other setting may only be set by one file, or to the same value by several.
+func LoadConfigDir(dir string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.hcl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.hcl config files in %s", dir)
+	}
+	evalContext := &hcl.EvalContext{
+		Functions: configFunctions(dir),
+	}
+	c := &Config{}
+	origins := map[string]string{}
+	for _, file := range files {
+		fragment := &Config{}
+		if err := hclsimple.DecodeFile(file, evalContext, fragment); err != nil {
+			return nil, err
+		}
+		if err := c.merge(fragment, file, origins); err != nil {
+			return nil, err
+		}
+	}
+	c.setDefaults(DefaultConfig())
+	return c, nil
+}
+
+// merge adds the settings of the fragment decoded from file. Origins records
+// the file of every setting, to report the files of conflicting settings.
+func (c *Config) merge(fragment *Config, file string, origins map[string]string) error {
+	target := reflect.ValueOf(c).Elem()
+	source := reflect.ValueOf(fragment).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		value := source.Field(i)
+		if value.IsZero() {
+			continue
+		}
+		field := target.Type().Field(i)
+		name, kind, _ := strings.Cut(field.Tag.Get("hcl"), ",")
+		if kind == "block" && field.Type.Kind() == reflect.Slice {
+			target.Field(i).Set(reflect.AppendSlice(target.Field(i), value))
+			continue
+		}
+		if origin, ok := origins[name]; ok {
+			if !reflect.DeepEqual(target.Field(i).Interface(), value.Interface()) {
+				return fmt.Errorf("%s is set differently in %s and %s", name, origin, file)
+			}
+			continue
+		}
+		origins[name] = file
+		target.Field(i).Set(value)
+	}
+	return nil
+}
+
+// setDefaults sets the settings no file set to the defaults.
+func (c *Config) setDefaults(defaults *Config) {
+	target := reflect.ValueOf(c).Elem()
+	source := reflect.ValueOf(defaults).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		if target.Field(i).IsZero() {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+}
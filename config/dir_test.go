@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigDir(t *testing.T) {
+	c, err := LoadConfigDir("testdata/conf.d")
+	require.NoError(t, err)
+
+	assert.Equal(t, &Config{
+		Port:     6465,
+		Bind:     "0.0.0.0",
+		LogLevel: "info",
+		Nomad:    &NomadServer{Address: "http://nomad.service.consul:4646"},
+		Validators: []Validator{
+			{Type: "required_fields", Name: "team_a_basics", Namespace: "team-a", RequiredFields: &RequiredFields{Datacenters: true}},
+			{Type: "resource_cores", Name: "team_b_cores", Namespace: "team-b"},
+		},
+		Mutators: []Mutator{
+			{Type: "meta_defaults", Name: "team_b_owner", Namespace: "team-b", MetaDefaults: &MetaDefaults{Meta: map[string]string{"owner": "team-b"}}},
+		},
+	}, c)
+	assert.NoError(t, c.Validate())
+}
+
+func TestLoadConfigDirErrors(t *testing.T) {
+	write := func(t *testing.T, files map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+		}
+		return dir
+	}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "conflicting ports",
+			files:   map[string]string{"a.hcl": "port = 6464", "b.hcl": "port = 7474"},
+			wantErr: "port is set differently in",
+		},
+		{
+			name:    "conflicting blocks",
+			files:   map[string]string{"a.hcl": `nomad { address = "http://a:4646" }`, "b.hcl": `nomad { address = "http://b:4646" }`},
+			wantErr: "nomad is set differently in",
+		},
+		{
+			name:    "invalid file",
+			files:   map[string]string{"a.hcl": "port = "},
+			wantErr: "a.hcl",
+		},
+		{
+			name:    "no config files",
+			files:   map[string]string{"README.md": "# config"},
+			wantErr: "no *.hcl config files in",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := LoadConfigDir(write(t, tt.files))
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Nil(t, c)
+		})
+	}
+
+	t.Run("same value in several files", func(t *testing.T) {
+		c, err := LoadConfigDir(write(t, map[string]string{"a.hcl": "port = 7474", "b.hcl": "port = 7474"}))
+		require.NoError(t, err)
+		assert.Equal(t, 7474, c.Port)
+	})
+}
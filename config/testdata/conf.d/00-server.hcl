@@ -0,0 +1,5 @@
+port = 6465
+
+nomad {
+    address = "http://nomad.service.consul:4646"
+}
@@ -0,0 +1,7 @@
+validator "required_fields" "team_a_basics" {
+    namespace = "team-a"
+
+    required_fields {
+        datacenters = true
+    }
+}
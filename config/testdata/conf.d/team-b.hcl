@@ -0,0 +1,15 @@
+log_level = "info"
+
+validator "resource_cores" "team_b_cores" {
+    namespace = "team-b"
+}
+
+mutator "meta_defaults" "team_b_owner" {
+    namespace = "team-b"
+
+    meta_defaults {
+        meta = {
+            owner = "team-b"
+        }
+    }
+}
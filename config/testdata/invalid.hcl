@@ -0,0 +1,6 @@
+
+validator "opa_rule" "costcenter" {
+}
+
+validator "opa" "costcenter" {
+}
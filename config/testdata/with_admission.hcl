@@ -8,6 +8,7 @@ validator "opa" "some_opa_validator" {
 }
 
 mutator "opa_json_patch" "some_opa_mutator" {
+    namespace = "team-a"
 
     opa_rule {
         query = "patch = data.hello_world_meta.patch"
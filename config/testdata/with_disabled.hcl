@@ -0,0 +1,11 @@
+validator "resource_cores" "cores" {
+  enabled = false
+}
+
+mutator "meta_defaults" "owner" {
+  meta_defaults {
+    meta = {
+      owner = "platform"
+    }
+  }
+}
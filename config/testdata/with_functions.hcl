@@ -0,0 +1,9 @@
+nomad {
+  address = env("NACP_TEST_NOMAD_ADDR")
+}
+
+log_level = env("NACP_TEST_LOG_LEVEL", "info")
+
+reload_endpoint {
+  secret = trimspace(file("reload_secret.txt"))
+}
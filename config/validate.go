@@ -0,0 +1,369 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// enforcementLevels of validators, "" enforces.
+var enforcementLevels = map[string]bool{"": true, "enforce": true, "warn": true}
+
+// mutatorPhases relative to the validators, "" runs before them.
+var mutatorPhases = map[string]bool{"": true, "pre": true, "post": true}
+
+// bundleAlgorithms are the signing algorithms OPA verifies bundles with.
+var bundleAlgorithms = map[string]bool{
+	"": true, "RS256": true, "RS384": true, "RS512": true, "PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true, "HS256": true, "HS384": true, "HS512": true,
+}
+
+// listenNetworks of the server, "" listens on tcp.
+var listenNetworks = map[string]bool{"": true, "tcp": true, "tcp4": true, "tcp6": true}
+
+// messageLevels are the levels of structured policy messages, see opa.WithMinLevel.
+var messageLevels = map[string]bool{"info": true, "warn": true, "warning": true, "error": true}
+
+// The controller types known to Validate with the block they require, "" if none.
+var (
+	typesMu        sync.RWMutex
+	mutatorTypes   = map[string]string{}
+	validatorTypes = map[string]string{}
+)
+
+// RegisterMutatorType makes a mutator type known to Validate, mutators of the type
+// require the named block unless it is "". admissionctrl.RegisterMutatorFactory calls it.
+func RegisterMutatorType(typeName string, requiredBlock string) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	mutatorTypes[typeName] = requiredBlock
+}
+
+// RegisterValidatorType makes a validator type known to Validate, validators of the type
+// require the named block unless it is "". admissionctrl.RegisterValidatorFactory calls it.
+func RegisterValidatorType(typeName string, requiredBlock string) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	validatorTypes[typeName] = requiredBlock
+}
+
+// lookupType returns the block required by the registered type.
+func lookupType(registered map[string]string, typeName string) (requiredBlock string, ok bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	requiredBlock, ok = registered[typeName]
+	return requiredBlock, ok
+}
+
+// hasBlock reports whether the block of the mutator or validator named by its hcl tag is set.
+func hasBlock(controller interface{}, name string) bool {
+	v := reflect.ValueOf(controller)
+	for i := 0; i < v.NumField(); i++ {
+		tag, kind, _ := strings.Cut(v.Type().Field(i).Tag.Get("hcl"), ",")
+		if tag == name && kind == "block" {
+			return !v.Field(i).IsNil()
+		}
+	}
+	return false
+}
+
+// Validate reports all malformed controller definitions at once: unknown types,
+// missing blocks, duplicate names, invalid timeouts and missing policy files.
+// Nomad regions need a unique region.
+func (c *Config) Validate() error {
+	var problems *multierror.Error
+
+	if c.Nomad != nil {
+		problems = multierror.Append(problems, validateNomadAddress("nomad", c.Nomad.Address)...)
+		problems = multierror.Append(problems, validateNomadPool("nomad", c.Nomad)...)
+	}
+	if c.Nomad != nil && c.Nomad.BlockingQueryTimeout != "" {
+		if _, err := time.ParseDuration(c.Nomad.BlockingQueryTimeout); err != nil {
+			problems = multierror.Append(problems, fmt.Errorf("nomad has an invalid blocking_query_timeout: %w", err))
+		}
+	}
+	if c.Nomad != nil && c.Nomad.RequestTimeout != "" {
+		if _, err := time.ParseDuration(c.Nomad.RequestTimeout); err != nil {
+			problems = multierror.Append(problems, fmt.Errorf("nomad has an invalid request_timeout: %w", err))
+		}
+	}
+	if c.Nomad != nil && c.Nomad.Token != "" && c.Nomad.TokenFile != "" {
+		problems = multierror.Append(problems, fmt.Errorf("nomad can't have both a token and a token_file"))
+	}
+	if c.Nomad != nil && c.Nomad.TokenFile != "" {
+		if _, err := os.Stat(c.Nomad.TokenFile); err != nil {
+			problems = multierror.Append(problems, fmt.Errorf("nomad token_file: %w", err))
+		}
+	}
+	if v := c.BundleVerification; v != nil {
+		if _, err := os.Stat(v.PublicKeyFile); err != nil {
+			problems = multierror.Append(problems, fmt.Errorf("bundle_verification public_key_file: %w", err))
+		}
+		if !bundleAlgorithms[v.Algorithm] {
+			problems = multierror.Append(problems, fmt.Errorf("bundle_verification has an unsupported algorithm %q", v.Algorithm))
+		}
+	}
+	for _, n := range c.NomadRegions {
+		kind := fmt.Sprintf("nomad_region %q", n.Region)
+		problems = multierror.Append(problems, validateNomadAddress(kind, n.Address)...)
+		problems = multierror.Append(problems, validateNomadPool(kind, n)...)
+		if n.BlockingQueryTimeout != "" {
+			problems = multierror.Append(problems, fmt.Errorf("%s: blocking_query_timeout is only supported in the nomad block", kind))
+		}
+		if n.RequestTimeout != "" {
+			problems = multierror.Append(problems, fmt.Errorf("%s: request_timeout is only supported in the nomad block", kind))
+		}
+		if n.Token != "" || n.TokenFile != "" {
+			problems = multierror.Append(problems, fmt.Errorf("%s: token and token_file are only supported in the nomad block", kind))
+		}
+	}
+
+	if !listenNetworks[c.ListenNetwork] {
+		problems = multierror.Append(problems, fmt.Errorf("listen_network %q must be tcp, tcp4 or tcp6", c.ListenNetwork))
+	}
+
+	if c.CORS != nil && c.CORS.MaxAge != "" {
+		if _, err := time.ParseDuration(c.CORS.MaxAge); err != nil {
+			problems = multierror.Append(problems, fmt.Errorf("cors has an invalid max_age: %w", err))
+		}
+	}
+	if c.RecentDecisions != nil && c.RecentDecisions.Size < 0 {
+		problems = multierror.Append(problems, fmt.Errorf("recent_decisions size must not be negative"))
+	}
+	if c.ReloadEndpoint != nil && c.ReloadEndpoint.Secret == "" {
+		problems = multierror.Append(problems, fmt.Errorf("reload_endpoint requires a secret"))
+	}
+
+	if r := c.Readiness; r != nil {
+		if r.Attempts < 0 {
+			problems = multierror.Append(problems, fmt.Errorf("readiness attempts must not be negative"))
+		}
+		for _, setting := range []struct{ name, value string }{
+			{"initial_backoff", r.InitialBackoff},
+			{"max_backoff", r.MaxBackoff},
+		} {
+			if setting.value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(setting.value); err != nil {
+				problems = multierror.Append(problems, fmt.Errorf("readiness has an invalid %s: %w", setting.name, err))
+			}
+		}
+	}
+
+	if c.ValidatorConcurrency < 0 {
+		problems = multierror.Append(problems, fmt.Errorf("validator_concurrency must not be negative"))
+	}
+	for _, p := range c.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				problems = multierror.Append(problems, fmt.Errorf("trusted_proxies: %q is neither an ip address nor a CIDR range", p))
+			}
+		}
+	}
+
+	regions := map[string]bool{}
+	for _, n := range c.NomadRegions {
+		if n.Region == "" {
+			problems = multierror.Append(problems, fmt.Errorf("nomad_region %s requires a region", n.Address))
+			continue
+		}
+		if regions[n.Region] {
+			problems = multierror.Append(problems, fmt.Errorf("nomad_region %q is defined more than once", n.Region))
+		}
+		regions[n.Region] = true
+	}
+
+	names := map[string]bool{}
+	for _, m := range c.Mutators {
+		kind := fmt.Sprintf("mutator %q", m.Name)
+		if names[m.Name] {
+			problems = multierror.Append(problems, fmt.Errorf("%s is defined more than once", kind))
+		}
+		names[m.Name] = true
+		requiredBlock, ok := lookupType(mutatorTypes, m.Type)
+		if !ok {
+			problems = multierror.Append(problems, fmt.Errorf("%s has unknown type %q", kind, m.Type))
+			continue
+		}
+		problems = multierror.Append(problems, validateController(kind, requiredBlock, hasBlock(m, requiredBlock), m.Timeout, m.OpaRule)...)
+		problems = multierror.Append(problems, validateWebhookTLS(kind, m.Webhook)...)
+		if !mutatorPhases[m.Phase] {
+			problems = multierror.Append(problems, fmt.Errorf("%s has an unknown phase %q, must be pre or post", kind, m.Phase))
+		}
+	}
+
+	names = map[string]bool{}
+	for _, v := range c.Validators {
+		kind := fmt.Sprintf("validator %q", v.Name)
+		if names[v.Name] {
+			problems = multierror.Append(problems, fmt.Errorf("%s is defined more than once", kind))
+		}
+		names[v.Name] = true
+		requiredBlock, ok := lookupType(validatorTypes, v.Type)
+		if !ok {
+			problems = multierror.Append(problems, fmt.Errorf("%s has unknown type %q", kind, v.Type))
+			continue
+		}
+		problems = multierror.Append(problems, validateController(kind, requiredBlock, hasBlock(v, requiredBlock), v.Timeout, v.OpaRule)...)
+		problems = multierror.Append(problems, validateWebhookTLS(kind, v.Webhook)...)
+		if !enforcementLevels[v.EnforcementLevel] {
+			problems = multierror.Append(problems, fmt.Errorf("%s has an unknown enforcement_level %q", kind, v.EnforcementLevel))
+		}
+		if v.JSONSchema != nil {
+			if _, err := os.Stat(v.JSONSchema.SchemaFile); err != nil {
+				problems = multierror.Append(problems, fmt.Errorf("%s schema file: %w", kind, err))
+			}
+		}
+	}
+
+	problems = multierror.Append(problems, c.validateProfiles()...)
+
+	return problems.ErrorOrNil()
+}
+
+func (c *Config) validateProfiles() []error {
+	var problems []error
+	mutators := map[string]bool{}
+	for _, m := range c.Mutators {
+		mutators[m.Name] = true
+	}
+	validators := map[string]bool{}
+	for _, v := range c.Validators {
+		validators[v.Name] = true
+	}
+	profiles := map[string]bool{}
+	namespaces := map[string]string{}
+	for _, p := range c.Profiles {
+		kind := fmt.Sprintf("profile %q", p.Name)
+		if profiles[p.Name] {
+			problems = append(problems, fmt.Errorf("%s is defined more than once", kind))
+		}
+		profiles[p.Name] = true
+		for _, name := range p.Mutators {
+			if !mutators[name] {
+				problems = append(problems, fmt.Errorf("%s references unknown mutator %q", kind, name))
+			}
+		}
+		for _, name := range p.Validators {
+			if !validators[name] {
+				problems = append(problems, fmt.Errorf("%s references unknown validator %q", kind, name))
+			}
+		}
+		for _, namespace := range p.Namespaces {
+			if other, ok := namespaces[namespace]; ok {
+				problems = append(problems, fmt.Errorf("namespace %q is mapped to profile %q and %q", namespace, other, p.Name))
+			}
+			namespaces[namespace] = p.Name
+		}
+	}
+	if c.DefaultProfile != "" && !profiles[c.DefaultProfile] {
+		problems = append(problems, fmt.Errorf("default_profile %q is not defined", c.DefaultProfile))
+	}
+	return problems
+}
+
+func validateNomadAddress(kind string, address string) []error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return []error{fmt.Errorf("%s has an invalid address: %w", kind, err)}
+	}
+	if u.Scheme == "unix" {
+		if u.Path == "" {
+			return []error{fmt.Errorf("%s address %q requires a socket path like unix:///var/run/nomad.sock", kind, address)}
+		}
+		return nil
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []error{fmt.Errorf("%s address %q must be an http or https url like http://localhost:4646", kind, address)}
+	}
+	return nil
+}
+
+func validateNomadPool(kind string, nomad *NomadServer) []error {
+	var problems []error
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"max_idle_conns", nomad.MaxIdleConns},
+		{"max_idle_conns_per_host", nomad.MaxIdleConnsPerHost},
+		{"max_conns_per_host", nomad.MaxConnsPerHost},
+	} {
+		if setting.value < 0 {
+			problems = append(problems, fmt.Errorf("%s %s must not be negative", kind, setting.name))
+		}
+	}
+	return problems
+}
+
+func validateController(kind string, requiredBlock string, hasRequiredBlock bool, timeout string, rule *OpaRule) []error {
+	var problems []error
+	if requiredBlock != "" && !hasRequiredBlock {
+		problems = append(problems, fmt.Errorf("%s requires a %s block", kind, requiredBlock))
+	}
+	if timeout != "" {
+		if _, err := time.ParseDuration(timeout); err != nil {
+			problems = append(problems, fmt.Errorf("%s has an invalid timeout: %w", kind, err))
+		}
+	}
+	if rule != nil {
+		problems = append(problems, validateOpaRule(kind, rule)...)
+	}
+	return problems
+}
+
+func validateOpaRule(kind string, rule *OpaRule) []error {
+	var problems []error
+	if rule.Filename == "" && rule.BundlePath == "" {
+		problems = append(problems, fmt.Errorf("%s requires a filename or bundle_path", kind))
+	} else if rule.Filename == "" && rule.Query == "" {
+		problems = append(problems, fmt.Errorf("%s requires a query to use a bundle_path without filename", kind))
+	}
+	if rule.MinLevel != "" && !messageLevels[strings.ToLower(rule.MinLevel)] {
+		problems = append(problems, fmt.Errorf("%s has an unknown min_level %q", kind, rule.MinLevel))
+	}
+	if rule.Filename != "" && !strings.HasPrefix(rule.Filename, "http://") && !strings.HasPrefix(rule.Filename, "https://") {
+		if _, err := os.Stat(rule.Filename); err != nil {
+			problems = append(problems, fmt.Errorf("%s policy file: %w", kind, err))
+		}
+	}
+	if rule.DataFile != "" {
+		if _, err := os.Stat(rule.DataFile); err != nil {
+			problems = append(problems, fmt.Errorf("%s data file: %w", kind, err))
+		}
+	}
+	// bundles are directories or tarballs, remote tarballs are downloaded when the rule is created
+	if rule.BundlePath != "" && !strings.HasPrefix(rule.BundlePath, "http://") && !strings.HasPrefix(rule.BundlePath, "https://") {
+		if _, err := os.Stat(rule.BundlePath); err != nil {
+			problems = append(problems, fmt.Errorf("%s bundle: %w", kind, err))
+		}
+	}
+	return problems
+}
+
+func validateWebhookTLS(kind string, webhook *Webhook) []error {
+	if webhook == nil || webhook.TLS == nil {
+		return nil
+	}
+	var problems []error
+	if (webhook.TLS.CertFile == "") != (webhook.TLS.KeyFile == "") {
+		problems = append(problems, fmt.Errorf("%s webhook tls requires both a cert_file and a key_file", kind))
+	}
+	for _, file := range []string{webhook.TLS.CaFile, webhook.TLS.CertFile, webhook.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, fmt.Errorf("%s webhook tls: %w", kind, err))
+		}
+	}
+	return problems
+}
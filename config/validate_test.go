@@ -0,0 +1,308 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The controller types of the tests, the proxy package registers the builtin ones with their factories.
+func init() {
+	RegisterMutatorType("opa_json_patch", "opa_rule")
+	RegisterMutatorType("json_patch_webhook", "webhook")
+	RegisterMutatorType("meta_defaults", "meta_defaults")
+	RegisterValidatorType("opa", "opa_rule")
+	RegisterValidatorType("webhook", "webhook")
+	RegisterValidatorType("required_fields", "required_fields")
+	RegisterValidatorType("resource_cores", "")
+	RegisterValidatorType("json_schema", "json_schema")
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidatorType("custom_validate_test", "")
+
+	tests := []struct {
+		name     string
+		config   *Config
+		problems []string
+	}{
+		{
+			name:   "default config",
+			config: DefaultConfig(),
+		},
+		{
+			name: "valid controllers",
+			config: &Config{
+				Mutators: []Mutator{
+					{Type: "opa_json_patch", Name: "hello", OpaRule: &OpaRule{Query: "patch = data.hello_world_meta.patch", Filename: "../testdata/opa/mutators/hello_world_meta.rego"}},
+					{Type: "meta_defaults", Name: "meta", MetaDefaults: &MetaDefaults{}, Timeout: "1s"},
+				},
+				Validators: []Validator{
+					{Type: "opa", Name: "owner", OpaRule: &OpaRule{Query: "errors = data.policies.owner.errors", BundlePath: "../testdata/opa/bundle"}},
+					{Type: "opa", Name: "remote", OpaRule: &OpaRule{Query: "errors = data.remote.errors", Filename: "https://policies.example.com/remote.rego"}},
+					{Type: "opa", Name: "tarball", OpaRule: &OpaRule{Query: "errors = data.policies.owner.errors", BundlePath: "testdata/bundle.tar.gz"}},
+					{Type: "opa", Name: "remote_bundle", OpaRule: &OpaRule{Query: "errors = data.policies.owner.errors", BundlePath: "https://policies.example.com/bundle.tar.gz"}},
+					{Type: "resource_cores", Name: "cores"},
+					{Type: "custom_validate_test", Name: "custom"},
+				},
+			},
+		},
+		{
+			name: "unknown types",
+			config: &Config{
+				Mutators:   []Mutator{{Type: "meta_default", Name: "meta"}},
+				Validators: []Validator{{Type: "opa_rule", Name: "costcenter"}},
+			},
+			problems: []string{
+				`mutator "meta" has unknown type "meta_default"`,
+				`validator "costcenter" has unknown type "opa_rule"`,
+			},
+		},
+		{
+			name: "missing blocks",
+			config: &Config{
+				Mutators:   []Mutator{{Type: "json_patch_webhook", Name: "hook"}},
+				Validators: []Validator{{Type: "opa", Name: "costcenter"}, {Type: "required_fields", Name: "fields", OpaRule: &OpaRule{Query: "errors = []", BundlePath: "../testdata/opa/bundle"}}},
+			},
+			problems: []string{
+				`mutator "hook" requires a webhook block`,
+				`validator "costcenter" requires a opa_rule block`,
+				`validator "fields" requires a required_fields block`,
+			},
+		},
+		{
+			name: "duplicate names",
+			config: &Config{
+				Validators: []Validator{{Type: "resource_cores", Name: "cores"}, {Type: "resource_cores", Name: "cores"}},
+			},
+			problems: []string{`validator "cores" is defined more than once`},
+		},
+		{
+			name: "invalid timeout",
+			config: &Config{
+				Validators: []Validator{{Type: "resource_cores", Name: "cores", Timeout: "soon"}},
+			},
+			problems: []string{`validator "cores" has an invalid timeout: time: invalid duration "soon"`},
+		},
+		{
+			name: "missing policy files",
+			config: &Config{
+				Validators: []Validator{
+					{Type: "opa", Name: "missing", OpaRule: &OpaRule{Query: "errors = []", Filename: "testdata/missing.rego"}},
+					{Type: "opa", Name: "bundle", OpaRule: &OpaRule{Query: "errors = []", BundlePath: "testdata/missing.tar.gz"}},
+					{Type: "opa", Name: "data", OpaRule: &OpaRule{Query: "errors = []", Filename: "testdata/simple.hcl", DataFile: "testdata/missing.json"}},
+					{Type: "opa", Name: "empty", OpaRule: &OpaRule{Query: "errors = []"}},
+					{Type: "opa", Name: "level", OpaRule: &OpaRule{Query: "errors = []", BundlePath: "testdata", MinLevel: "debug"}},
+					{Type: "opa", Name: "bundle_query", OpaRule: &OpaRule{BundlePath: "testdata"}},
+				},
+			},
+			problems: []string{
+				`validator "missing" policy file: stat testdata/missing.rego: no such file or directory`,
+				`validator "bundle" bundle: stat testdata/missing.tar.gz: no such file or directory`,
+				`validator "data" data file: stat testdata/missing.json: no such file or directory`,
+				`validator "empty" requires a filename or bundle_path`,
+				`validator "level" has an unknown min_level "debug"`,
+				`validator "bundle_query" requires a query to use a bundle_path without filename`,
+			},
+		},
+		{
+			name: "missing schema file",
+			config: &Config{
+				Validators: []Validator{{Type: "json_schema", Name: "shape", JSONSchema: &JSONSchema{SchemaFile: "testdata/missing.schema.json"}}},
+			},
+			problems: []string{`validator "shape" schema file: stat testdata/missing.schema.json: no such file or directory`},
+		},
+		{
+			name: "profiles",
+			config: &Config{
+				Validators: []Validator{{Type: "resource_cores", Name: "cores"}},
+				Profiles: []*Profile{
+					{Name: "strict", Namespaces: []string{"prod"}, Validators: []string{"cores", "missing"}, Mutators: []string{"hello"}},
+					{Name: "strict", Namespaces: []string{"prod"}},
+				},
+				DefaultProfile: "lenient",
+			},
+			problems: []string{
+				`profile "strict" references unknown mutator "hello"`,
+				`profile "strict" references unknown validator "missing"`,
+				`profile "strict" is defined more than once`,
+				`namespace "prod" is mapped to profile "strict" and "strict"`,
+				`default_profile "lenient" is not defined`,
+			},
+		},
+		{
+			name: "nomad regions",
+			config: &Config{
+				NomadRegions: []*NomadServer{
+					{Region: "eu", Address: "https://nomad-eu:4646"},
+					{Region: "eu", Address: "https://nomad-eu-2:4646"},
+					{Address: "https://nomad-us:4646"},
+				},
+			},
+			problems: []string{
+				`nomad_region "eu" is defined more than once`,
+				"nomad_region https://nomad-us:4646 requires a region",
+			},
+		},
+		{
+			name: "blocking query timeout",
+			config: &Config{
+				Nomad:        &NomadServer{Address: "http://localhost:4646", BlockingQueryTimeout: "soon"},
+				NomadRegions: []*NomadServer{{Region: "eu", Address: "https://nomad-eu:4646", BlockingQueryTimeout: "10m"}},
+			},
+			problems: []string{
+				`nomad has an invalid blocking_query_timeout: time: invalid duration "soon"`,
+				`nomad_region "eu": blocking_query_timeout is only supported in the nomad block`,
+			},
+		},
+		{
+			name: "request timeout",
+			config: &Config{
+				Nomad:        &NomadServer{Address: "http://localhost:4646", RequestTimeout: "soon"},
+				NomadRegions: []*NomadServer{{Region: "eu", Address: "https://nomad-eu:4646", RequestTimeout: "30s"}},
+			},
+			problems: []string{
+				`nomad has an invalid request_timeout: time: invalid duration "soon"`,
+				`nomad_region "eu": request_timeout is only supported in the nomad block`,
+			},
+		},
+		{
+			name:   "readiness",
+			config: &Config{Readiness: &Readiness{Attempts: -1, InitialBackoff: "soon", MaxBackoff: "1m"}},
+			problems: []string{
+				"readiness attempts must not be negative",
+				`readiness has an invalid initial_backoff: time: invalid duration "soon"`,
+			},
+		},
+		{
+			name: "nomad token",
+			config: &Config{
+				Nomad:        &NomadServer{Address: "http://localhost:4646", Token: "secret", TokenFile: "testdata/missing-token"},
+				NomadRegions: []*NomadServer{{Region: "eu", Address: "https://nomad-eu:4646", Token: "secret"}},
+			},
+			problems: []string{
+				"nomad can't have both a token and a token_file",
+				"nomad token_file: stat testdata/missing-token: no such file or directory",
+				`nomad_region "eu": token and token_file are only supported in the nomad block`,
+			},
+		},
+		{
+			name:   "bundle verification",
+			config: &Config{BundleVerification: &BundleVerification{PublicKeyFile: "testdata/missing.pem", Algorithm: "EdDSA"}},
+			problems: []string{
+				"bundle_verification public_key_file: stat testdata/missing.pem: no such file or directory",
+				`bundle_verification has an unsupported algorithm "EdDSA"`,
+			},
+		},
+		{
+			name:     "reload endpoint without secret",
+			config:   &Config{ReloadEndpoint: &ReloadEndpoint{}},
+			problems: []string{"reload_endpoint requires a secret"},
+		},
+		{
+			name:     "negative validator concurrency",
+			config:   &Config{ValidatorConcurrency: -1},
+			problems: []string{"validator_concurrency must not be negative"},
+		},
+		{
+			name: "enforcement levels",
+			config: &Config{
+				Validators: []Validator{
+					{Type: "resource_cores", Name: "enforced", EnforcementLevel: "enforce"},
+					{Type: "resource_cores", Name: "observed", EnforcementLevel: "warn"},
+					{Type: "resource_cores", Name: "cores", EnforcementLevel: "audit"},
+				},
+			},
+			problems: []string{`validator "cores" has an unknown enforcement_level "audit"`},
+		},
+		{
+			name: "mutator phases",
+			config: &Config{
+				Mutators: []Mutator{
+					{Type: "meta_defaults", Name: "pre", Phase: "pre", MetaDefaults: &MetaDefaults{}},
+					{Type: "meta_defaults", Name: "post", Phase: "post", MetaDefaults: &MetaDefaults{}},
+					{Type: "meta_defaults", Name: "later", Phase: "later", MetaDefaults: &MetaDefaults{}},
+				},
+			},
+			problems: []string{`mutator "later" has an unknown phase "later", must be pre or post`},
+		},
+		{
+			name: "trusted proxies",
+			config: &Config{
+				TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1", "::1", "localhost", "10.0.0.0/33"},
+			},
+			problems: []string{
+				`trusted_proxies: "localhost" is neither an ip address nor a CIDR range`,
+				`trusted_proxies: "10.0.0.0/33" is neither an ip address nor a CIDR range`,
+			},
+		},
+		{
+			name: "webhook tls",
+			config: &Config{
+				Validators: []Validator{
+					{Type: "webhook", Name: "hook", Webhook: &Webhook{Endpoint: "https://hook", TLS: &WebhookTLS{CertFile: "testdata/simple.hcl", CaFile: "testdata/missing.pem"}}},
+				},
+			},
+			problems: []string{
+				`validator "hook" webhook tls requires both a cert_file and a key_file`,
+				`validator "hook" webhook tls: stat testdata/missing.pem: no such file or directory`,
+			},
+		},
+		{
+			name: "nomad connection pool",
+			config: &Config{
+				Nomad: &NomadServer{Address: "http://localhost:4646", MaxIdleConns: -1, MaxConnsPerHost: -1},
+			},
+			problems: []string{
+				`nomad max_idle_conns must not be negative`,
+				`nomad max_conns_per_host must not be negative`,
+			},
+		},
+		{
+			name: "listen network",
+			config: &Config{
+				ListenNetwork: "udp",
+			},
+			problems: []string{
+				`listen_network "udp" must be tcp, tcp4 or tcp6`,
+			},
+		},
+		{
+			name: "nomad addresses",
+			config: &Config{
+				Nomad: &NomadServer{Address: "localhost:4646"},
+				NomadRegions: []*NomadServer{
+					{Region: "eu", Address: "tcp://nomad-eu:4646"},
+					{Region: "us", Address: "https://"},
+					{Region: "ap", Address: "unix://"},
+					{Region: "local", Address: "unix:///var/run/nomad.sock"},
+				},
+			},
+			problems: []string{
+				`nomad address "localhost:4646" must be an http or https url like http://localhost:4646`,
+				`nomad_region "eu" address "tcp://nomad-eu:4646" must be an http or https url like http://localhost:4646`,
+				`nomad_region "us" address "https://" must be an http or https url like http://localhost:4646`,
+				`nomad_region "ap" address "unix://" requires a socket path like unix:///var/run/nomad.sock`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if len(tt.problems) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			merr, ok := err.(*multierror.Error)
+			require.True(t, ok, "expected a multierror, got %v", err)
+			var problems []string
+			for _, e := range merr.Errors {
+				problems = append(problems, e.Error())
+			}
+			assert.Equal(t, tt.problems, problems)
+		})
+	}
+}
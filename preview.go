@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/proxy"
+)
+
+// jobPreview is the outcome of applying the admission controllers to a job.
+type jobPreview struct {
+	mutation []byte
+	warnings []error
+	errors   []error
+}
+
+// runPreview applies the admission controllers of a proposed config to all jobs
+// registered in Nomad and reports which jobs would be mutated, warned about or rejected,
+// without changing anything. It returns 1 if any job would be rejected.
+func runPreview(configFile string, token string, stdout io.Writer, stderr io.Writer) int {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "nacp",
+		Level:  hclog.Warn,
+		Output: stderr,
+	})
+	c, err := loadConfig(configFile, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	jobHandler, err := proxy.NewJobHandler(c, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating admission controllers: %s\n", err)
+		return 1
+	}
+	client, err := proxy.NewNomadClient(c.Nomad, token)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating Nomad client: %s\n", err)
+		return 1
+	}
+	stubs, _, err := client.Jobs().List(&api.QueryOptions{Namespace: "*"})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error listing jobs: %s\n", err)
+		return 1
+	}
+
+	var previewed, mutated, warned, rejected int
+	for _, stub := range stubs {
+		// dispatched and periodic instances are covered by their parent
+		if stub.ParentID != "" {
+			continue
+		}
+		name := stub.Namespace + "/" + stub.ID
+		job, _, err := client.Jobs().Info(stub.ID, &api.QueryOptions{Namespace: stub.Namespace})
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading job %s: %s\n", name, err)
+			return 1
+		}
+		preview, err := previewJob(jobHandler, stub.Namespace, job)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error previewing job %s: %s\n", name, err)
+			return 1
+		}
+
+		previewed++
+		outcome := "ok"
+		switch {
+		case len(preview.errors) > 0:
+			outcome = "rejected"
+			rejected++
+		case preview.mutation != nil:
+			outcome = "mutated"
+		}
+		if preview.mutation != nil {
+			mutated++
+		}
+		if len(preview.warnings) > 0 {
+			warned++
+		}
+		fmt.Fprintf(stdout, "%s: %s\n", name, outcome)
+		for _, e := range preview.errors {
+			fmt.Fprintf(stdout, "  error: %s\n", e)
+		}
+		for _, w := range preview.warnings {
+			fmt.Fprintf(stdout, "  warning: %s\n", w)
+		}
+		if preview.mutation != nil {
+			fmt.Fprintf(stdout, "  mutation: %s\n", preview.mutation)
+		}
+	}
+	fmt.Fprintf(stdout, "Previewed %d jobs: %d rejected, %d mutated, %d with warnings\n", previewed, rejected, mutated, warned)
+	if rejected > 0 {
+		return 1
+	}
+	return 0
+}
+
+// previewJob applies the mutators and validators to the job like an update of it would.
+func previewJob(jobHandler *admissionctrl.JobHandler, namespace string, job *api.Job) (*jobPreview, error) {
+	original, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{
+		Namespace: namespace,
+		Operation: admissionctrl.OperationUpdate,
+	})
+	preview := &jobPreview{}
+	job, warnings, validationErr, err := jobHandler.MutateAndValidate(ctx, job)
+	if err != nil {
+		preview.errors = append(preview.errors, err)
+		return preview, nil
+	}
+	mutated, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := jsonpatch.CreateMergePatch(original, mutated)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(diff, []byte("{}")) {
+		preview.mutation = diff
+	}
+
+	preview.warnings = warnings
+	if merr, ok := validationErr.(*multierror.Error); ok {
+		preview.errors = merr.Errors
+	} else if validationErr != nil {
+		preview.errors = []error{validationErr}
+	}
+	return preview, nil
+}
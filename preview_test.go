@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPreview(t *testing.T) {
+	jobs := map[string]*api.Job{
+		"billing": {ID: pointer.Of("billing"), Namespace: pointer.Of("default"), Meta: map[string]string{"costcenter": "cccode-billing", "owner": "billing"}},
+		"web":     {ID: pointer.Of("web"), Namespace: pointer.Of("default"), Meta: map[string]string{"costcenter": "cccode-web"}},
+		"batch":   {ID: pointer.Of("batch"), Namespace: pointer.Of("team-a")},
+	}
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodGet, req.Method, "the preview must not change any job")
+		assert.Equal(t, "secret", req.Header.Get("X-Nomad-Token"))
+		if req.URL.Path == "/v1/jobs" {
+			assert.Equal(t, "*", req.URL.Query().Get("namespace"))
+			json.NewEncoder(rw).Encode([]*api.JobListStub{
+				{ID: "billing", Namespace: "default"},
+				{ID: "web", Namespace: "default"},
+				{ID: "batch", Namespace: "team-a"},
+				{ID: "batch/periodic-1700000000", Namespace: "team-a", ParentID: "batch"},
+			})
+			return
+		}
+		job, ok := jobs[req.URL.Path[len("/v1/job/"):]]
+		if !ok {
+			t.Errorf("unexpected request %s", req.URL)
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, *job.Namespace, req.URL.Query().Get("namespace"))
+		json.NewEncoder(rw).Encode(job)
+	}))
+	defer nomadDummy.Close()
+
+	configFile := filepath.Join(t.TempDir(), "proposed.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+nomad {
+  address = %q
+}
+
+mutator "meta_defaults" "owner" {
+  meta_defaults {
+    meta = { owner = "platform" }
+  }
+}
+
+validator "opa" "costcenter" {
+  opa_rule {
+    query    = "errors = data.costcenter_meta.errors"
+    filename = "testdata/opa/validators/costcenter_meta.rego"
+  }
+}
+`, nomadDummy.URL)), 0600))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runPreview(configFile, "secret", stdout, stderr)
+
+	assert.Equal(t, 1, code, stderr.String())
+	assert.Equal(t, `team-a/batch: rejected
+  error: Every job must have a costcenter metadata label (costcenter)
+  mutation: {"Meta":{"owner":"platform"}}
+default/billing: ok
+default/web: mutated
+  mutation: {"Meta":{"owner":"platform"}}
+Previewed 3 jobs: 1 rejected, 2 mutated, 0 with warnings
+`, stdout.String())
+}
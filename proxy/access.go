@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Access rule actions.
+const (
+	AccessAllow = "allow"
+	AccessDeny  = "deny"
+)
+
+// AccessRule allows or denies requests matching its method and path pattern.
+type AccessRule struct {
+	// Method matches any method if empty.
+	Method string
+	// Path is matched segment by segment with path.Match, a trailing "**" segment matches the rest of the path.
+	Path   string
+	Action string
+}
+
+// AccessPolicy decides which Nomad API requests are proxied.
+// The first matching rule wins, requests matching no rule get the default action.
+type AccessPolicy struct {
+	rules        []AccessRule
+	defaultAllow bool
+}
+
+// NewAccessPolicy checks the rules, an empty defaultAction allows.
+func NewAccessPolicy(defaultAction string, rules []AccessRule) (*AccessPolicy, error) {
+	if err := validateAccessAction(defaultAction, true); err != nil {
+		return nil, fmt.Errorf("default action: %w", err)
+	}
+	for i, rule := range rules {
+		if err := validateAccessAction(rule.Action, false); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("rule %d: path %q must start with /", i, rule.Path)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid path %q: %w", i, rule.Path, err)
+		}
+	}
+	return &AccessPolicy{
+		rules:        rules,
+		defaultAllow: defaultAction != AccessDeny,
+	}, nil
+}
+
+func validateAccessAction(action string, optional bool) error {
+	if action == AccessAllow || action == AccessDeny || (optional && action == "") {
+		return nil
+	}
+	return fmt.Errorf("invalid action %q, must be %q or %q", action, AccessAllow, AccessDeny)
+}
+
+// WithAccessPolicy answers requests denied by the policy with 403 instead of proxying them.
+func WithAccessPolicy(policy *AccessPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.accessPolicy = policy
+	}
+}
+
+func (p *AccessPolicy) allows(r *http.Request) bool {
+	for _, rule := range p.rules {
+		if rule.matches(r) {
+			return rule.Action == AccessAllow
+		}
+	}
+	return p.defaultAllow
+}
+
+func (rule AccessRule) matches(r *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	return matchPath(rule.Path, r.URL.Path)
+}
+
+func matchPath(pattern string, requestPath string) bool {
+	patterns := strings.Split(pattern, "/")
+	segments := strings.Split(requestPath, "/")
+	for i, p := range patterns {
+		if p == "**" && i == len(patterns)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if ok, _ := path.Match(p, segments[i]); !ok {
+			return false
+		}
+	}
+	return len(patterns) == len(segments)
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPath(t *testing.T) {
+	tt := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "/v1/jobs", path: "/v1/jobs", want: true},
+		{pattern: "/v1/jobs", path: "/v1/jobs/parse", want: false},
+		{pattern: "/v1/job/*", path: "/v1/job/example", want: true},
+		{pattern: "/v1/job/*", path: "/v1/job/example/plan", want: false},
+		{pattern: "/v1/job/*/plan", path: "/v1/job/example/plan", want: true},
+		{pattern: "/v1/job/**", path: "/v1/job/example/plan", want: true},
+		{pattern: "/v1/job/**", path: "/v1/jobs", want: false},
+		{pattern: "/**", path: "/v1/status/leader", want: true},
+		{pattern: "/v1/acl/token*", path: "/v1/acl/tokens", want: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.pattern+" "+tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.want, matchPath(tc.pattern, tc.path))
+		})
+	}
+}
+
+func TestNewAccessPolicy(t *testing.T) {
+	tt := []struct {
+		name          string
+		defaultAction string
+		rules         []AccessRule
+		wantErr       string
+	}{
+		{name: "defaults"},
+		{name: "deny by default", defaultAction: AccessDeny, rules: []AccessRule{{Path: "/v1/jobs", Action: AccessAllow}}},
+		{name: "invalid default", defaultAction: "block", wantErr: `default action: invalid action "block"`},
+		{name: "missing action", rules: []AccessRule{{Path: "/v1/jobs"}}, wantErr: `rule 0: invalid action ""`},
+		{name: "relative path", rules: []AccessRule{{Path: "v1/jobs", Action: AccessDeny}}, wantErr: `rule 0: path "v1/jobs" must start with /`},
+		{name: "bad pattern", rules: []AccessRule{{Path: "/v1/[", Action: AccessDeny}}, wantErr: "rule 0: invalid path"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAccessPolicy(tc.defaultAction, tc.rules)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAccessPolicy(t *testing.T) {
+	tt := []struct {
+		name          string
+		defaultAction string
+		rules         []AccessRule
+		method        string
+		path          string
+		wantStatus    int
+	}{
+		{
+			name:       "denied purge",
+			rules:      []AccessRule{{Method: "DELETE", Path: "/v1/job/*", Action: AccessDeny}},
+			method:     http.MethodDelete,
+			path:       "/v1/job/example",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "other methods pass",
+			rules:      []AccessRule{{Method: "delete", Path: "/v1/job/*", Action: AccessDeny}},
+			method:     http.MethodGet,
+			path:       "/v1/job/example",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "allow list",
+			defaultAction: AccessDeny,
+			rules:         []AccessRule{{Path: "/v1/jobs", Action: AccessAllow}},
+			method:        http.MethodGet,
+			path:          "/v1/jobs",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "not on the allow list",
+			defaultAction: AccessDeny,
+			rules:         []AccessRule{{Path: "/v1/jobs", Action: AccessAllow}},
+			method:        http.MethodGet,
+			path:          "/v1/nodes",
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name: "first match wins",
+			rules: []AccessRule{
+				{Path: "/v1/job/allowed", Action: AccessAllow},
+				{Path: "/v1/job/*", Action: AccessDeny},
+			},
+			method:     http.MethodDelete,
+			path:       "/v1/job/allowed",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadCalled := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				nomadCalled = true
+				rw.Write([]byte("{}"))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			policy, err := NewAccessPolicy(tc.defaultAction, tc.rules)
+			require.NoError(t, err)
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithAccessPolicy(policy))
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			req, err := http.NewRequest(tc.method, proxyServer.URL+tc.path, nil)
+			require.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+			assert.Equal(t, tc.wantStatus == http.StatusOK, nomadCalled, "only allowed requests reach nomad")
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Audit decisions.
+const (
+	AuditAllow = "allow"
+	AuditDeny  = "deny"
+)
+
+// DefaultAuditBufferSize is the default number of audit records buffered before records are dropped.
+const DefaultAuditBufferSize = 1024
+
+var auditRecordsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "nacp",
+	Name:      "audit_records_dropped_total",
+	Help:      "Audit records dropped because the audit log could not keep up.",
+})
+
+// AuditRecord is written as one JSON line for every admission decision.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	JobID     string    `json:"job_id"`
+	Namespace string    `json:"namespace"`
+	// TokenAccessorHash is the sha256 of the accessor id of the resolved token.
+	TokenAccessorHash string   `json:"token_accessor_hash,omitempty"`
+	ClientIP          string   `json:"client_ip"`
+	Profile           string   `json:"profile,omitempty"`
+	Mutators          []string `json:"mutators"`
+	Warnings          []string `json:"warnings"`
+	Errors            []string `json:"errors"`
+	Decision          string   `json:"decision"`
+}
+
+// AuditLog writes audit records in the background. Records are buffered,
+// if the buffer is full they are dropped and counted instead of blocking the request.
+type AuditLog struct {
+	out     io.Writer
+	records chan *AuditRecord
+	dropped atomic.Uint64
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditLog starts writing audit records to out, buffering up to bufferSize records.
+func NewAuditLog(out io.Writer, bufferSize int) *AuditLog {
+	if bufferSize <= 0 {
+		bufferSize = DefaultAuditBufferSize
+	}
+	a := &AuditLog{
+		out:     out,
+		records: make(chan *AuditRecord, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.write()
+	return a
+}
+
+func (a *AuditLog) write() {
+	defer close(a.done)
+	encoder := json.NewEncoder(a.out)
+	for record := range a.records {
+		// a failing writer must not stop draining the buffer
+		_ = encoder.Encode(record)
+	}
+}
+
+// Record queues the record without blocking. Records of a closed audit log are dropped.
+func (a *AuditLog) Record(record *AuditRecord) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.dropped.Add(1)
+		auditRecordsDropped.Inc()
+		return
+	}
+	select {
+	case a.records <- record:
+	default:
+		a.dropped.Add(1)
+		auditRecordsDropped.Inc()
+	}
+}
+
+// Dropped returns the number of records dropped because the buffer was full or the log was closed.
+func (a *AuditLog) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close writes the buffered records and stops the audit log.
+// Closing the underlying writer is up to the caller.
+func (a *AuditLog) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// WithAuditLog records every admission decision in the audit log.
+func WithAuditLog(audit *AuditLog) HandlerOption {
+	return func(o *handlerOptions) {
+		o.audit = audit
+	}
+}
+
+// auditDecision records the outcome of the admission controllers for the job
+// in the audit log and the recent decisions. Jobs are denied if err is not nil.
+func (o *handlerOptions) auditDecision(ctx context.Context, job *api.Job, warnings []error, err error) {
+	if o.audit == nil && o.recent == nil {
+		return
+	}
+	req := admissionctrl.RequestFromContext(ctx)
+	record := &AuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: req.Operation,
+		Method:    req.Method,
+		Path:      req.Path,
+		Namespace: req.Namespace,
+		ClientIP:  req.ClientIP,
+		Profile:   req.Profile,
+		Mutators:  append([]string{}, req.Mutators...),
+		Warnings:  []string{},
+		Errors:    []string{},
+		Decision:  AuditAllow,
+	}
+	if job != nil && job.ID != nil {
+		record.JobID = *job.ID
+	}
+	if req.Token != nil && req.Token.AccessorID != "" {
+		sum := sha256.Sum256([]byte(req.Token.AccessorID))
+		record.TokenAccessorHash = hex.EncodeToString(sum[:])
+	}
+	for _, w := range warnings {
+		record.Warnings = append(record.Warnings, w.Error())
+	}
+	if err != nil {
+		record.Decision = AuditDeny
+		for _, e := range flattenErrors(err) {
+			record.Errors = append(record.Errors, e.Error())
+		}
+	}
+	if o.audit != nil {
+		o.audit.Record(record)
+	}
+	if o.recent != nil {
+		o.recent.Add(record)
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAuditRecords(t *testing.T, data []byte) []*AuditRecord {
+	t.Helper()
+	var records []*AuditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		record := &AuditRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditDecisions(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		validator    admissionctrl.JobValidator
+		wantDecision string
+		wantWarnings []string
+		wantErrors   []string
+	}{
+		{
+			name:         "allowed job",
+			validator:    mockValidatorReturningWarnings("some warning"),
+			wantDecision: AuditAllow,
+			wantWarnings: []string{"some warning"},
+			wantErrors:   []string{},
+		},
+		{
+			name:         "denied job",
+			validator:    mockValidatorReturningError("some error"),
+			wantDecision: AuditDeny,
+			wantWarnings: []string{},
+			wantErrors:   []string{"some error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			audit := NewAuditLog(out, 10)
+			jobHandler := admissionctrl.NewJobHandler(
+				[]admissionctrl.JobMutator{&testutil.HelloMutator{MutatorName: "hello"}},
+				[]admissionctrl.JobValidator{tt.validator},
+				hclog.NewNullLogger(),
+			)
+			resolver := func(secretID string) (*api.ACLToken, error) {
+				return &api.ACLToken{AccessorID: "accessor", SecretID: secretID}, nil
+			}
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithAuditLog(audit), WithTokenResolver(resolver))
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs?namespace=team-a", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+			require.NoError(t, err)
+			req.Header.Set("X-Nomad-Token", "secret")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			audit.Close()
+
+			records := readAuditRecords(t, out.Bytes())
+			require.Len(t, records, 1)
+			record := records[0]
+			assert.Equal(t, tt.wantDecision, record.Decision)
+			assert.Equal(t, "example", record.JobID)
+			assert.Equal(t, "team-a", record.Namespace)
+			assert.Equal(t, admissionctrl.OperationCreate, record.Operation)
+			assert.Equal(t, "4fc565ab79d6764db998ad5eba4dd7d63144cbfcb7718af45918e12248cfb6e2", record.TokenAccessorHash)
+			assert.NotContains(t, out.String(), "secret", "the token itself is never logged")
+			assert.Equal(t, []string{"hello"}, record.Mutators)
+			assert.Equal(t, tt.wantWarnings, record.Warnings)
+			assert.Equal(t, tt.wantErrors, record.Errors)
+			assert.False(t, record.Time.IsZero())
+		})
+	}
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	out     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.out.Write(p)
+}
+
+func TestAuditLogDropsRecordsOnOverflow(t *testing.T) {
+	writer := &blockingWriter{release: make(chan struct{})}
+	audit := NewAuditLog(writer, 2)
+
+	// one record is taken by the blocked writer, two are buffered
+	for i := 0; i < 10; i++ {
+		audit.Record(&AuditRecord{JobID: "example"})
+	}
+	assert.GreaterOrEqual(t, audit.Dropped(), uint64(7))
+	assert.LessOrEqual(t, audit.Dropped(), uint64(8))
+
+	close(writer.release)
+	audit.Close()
+	records := readAuditRecords(t, writer.out.Bytes())
+	assert.Equal(t, uint64(10), audit.Dropped()+uint64(len(records)))
+
+	audit.Record(&AuditRecord{JobID: "late"})
+	assert.Equal(t, uint64(11), audit.Dropped()+uint64(len(records)), "records after closing are dropped")
+}
+
+func TestAuditLogFromConfig(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	c := config.DefaultConfig()
+	c.Nomad.Address = nomadDummy.URL
+	c.Audit = &config.Audit{Output: auditFile}
+	reloader, err := newReloader(c, hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	proxyServer := httptest.NewServer(reloader)
+	defer proxyServer.Close()
+
+	_, _, err = buildNomadClient(t, proxyServer).Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+	require.NoError(t, err)
+
+	// reloading with another output flushes the previous audit log
+	reloaded := *c
+	reloaded.Audit = &config.Audit{Output: filepath.Join(t.TempDir(), "other.log")}
+	require.NoError(t, reloader.Reload(&reloaded))
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	records := readAuditRecords(t, data)
+	require.Len(t, records, 1)
+	assert.Equal(t, "example", records[0].JobID)
+	assert.Equal(t, AuditAllow, records[0].Decision)
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const backendErrorHint = "check that the nomad address of the NACP config is correct and Nomad is reachable from NACP"
+
+// BackendError is the body of the response if Nomad can't be reached.
+type BackendError struct {
+	Error   string `json:"error"`
+	Backend string `json:"backend"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// responseError marks errors of processing the Nomad response, Nomad was reachable.
+type responseError struct {
+	err error
+}
+
+func (e *responseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseError) Unwrap() error {
+	return e.err
+}
+
+// backendErrorHandler answers requests failing to reach Nomad with a status and message
+// telling connection, timeout and TLS problems apart.
+func backendErrorHandler(address *url.URL, logger hclog.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		logger := admissionctrl.Logger(r.Context(), logger)
+		if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+			logger.Debug("Client canceled the request to Nomad", "backend", address.String(), "path", r.URL.Path)
+			return
+		}
+		status, message, hint := classifyBackendError(err)
+		if isRequestTimeout(r) {
+			status, message, hint = http.StatusGatewayTimeout, "request exceeded the request_timeout", ""
+		}
+		logger.Error("Request to Nomad failed", "backend", address.String(), "path", r.URL.Path, "status", status, "error", err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(BackendError{
+			Error:   message + ": " + err.Error(),
+			Backend: address.String(),
+			Hint:    hint,
+		})
+	}
+}
+
+// classifyBackendError returns the status, message and hint for the error of a request to Nomad.
+func classifyBackendError(err error) (int, string, string) {
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		return http.StatusBadGateway, "failed to process the Nomad response", ""
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout, "timed out waiting for Nomad", backendErrorHint
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostErr      x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return http.StatusBadGateway, "TLS connection to Nomad failed", "check the tls block of the nomad config and that the address uses the right scheme"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return http.StatusBadGateway, "could not resolve the Nomad address", backendErrorHint
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return http.StatusBadGateway, "Nomad refused the connection", backendErrorHint
+	}
+	return http.StatusBadGateway, "could not reach Nomad", backendErrorHint
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnreachableBackend(t *testing.T) {
+	closedAddress := func(t *testing.T) string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := "http://" + listener.Addr().String()
+		require.NoError(t, listener.Close())
+		return address
+	}
+	slowAddress := func(t *testing.T) string {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	tlsAddress := func(t *testing.T) string {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	tt := []struct {
+		name        string
+		address     func(t *testing.T) string
+		wantStatus  int
+		wantMessage string
+	}{
+		{name: "connection refused", address: closedAddress, wantStatus: http.StatusBadGateway, wantMessage: "Nomad refused the connection"},
+		{name: "timeout", address: slowAddress, wantStatus: http.StatusGatewayTimeout, wantMessage: "timed out waiting for Nomad"},
+		{name: "tls error", address: tlsAddress, wantStatus: http.StatusBadGateway, wantMessage: "TLS connection to Nomad failed"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nomad, err := url.Parse(tc.address(t))
+			require.NoError(t, err)
+
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.ResponseHeaderTimeout = 100 * time.Millisecond
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), transport)
+
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(http.MethodGet, "/v1/jobs", nil))
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var body BackendError
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+			assert.Contains(t, body.Error, tc.wantMessage)
+			assert.Equal(t, nomad.String(), body.Backend)
+			assert.NotEmpty(t, body.Hint)
+		})
+	}
+}
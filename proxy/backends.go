@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// regionBackend is the Nomad server of a region, see WithRegionBackend.
+type regionBackend struct {
+	address   *url.URL
+	transport *http.Transport
+}
+
+// WithRegionBackend proxies requests for the region, selected by their region
+// query parameter or X-Nomad-Region header, to a separate Nomad server.
+// Requests for other regions or without a region go to the default Nomad server.
+func WithRegionBackend(region string, address *url.URL, transport *http.Transport) HandlerOption {
+	return func(o *handlerOptions) {
+		if o.regions == nil {
+			o.regions = map[string]regionBackend{}
+		}
+		o.regions[region] = regionBackend{address: address, transport: transport}
+	}
+}
+
+// backend proxies requests to one Nomad server.
+type backend struct {
+	proxy    *httputil.ReverseProxy
+	plan     planner
+	versions versionFetcher
+	jobs     jobFetcher
+}
+
+func newBackend(address *url.URL, transport *http.Transport, modifyResponse func(*http.Response) error, logger hclog.Logger, options *handlerOptions) *backend {
+	proxy := httputil.NewSingleHostReverseProxy(address)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		options.setForwardedHeaders(r)
+	}
+	proxy.Transport = &tracingTransport{base: http.DefaultTransport}
+	if transport != nil {
+		proxy.Transport = &tracingTransport{base: withBlockingQueryTransport(transport, options.blockingQueryTimeout)}
+	}
+	proxy.ModifyResponse = modifyResponse
+	proxy.ErrorHandler = backendErrorHandler(address, logger)
+	return &backend{
+		proxy:    proxy,
+		plan:     nomadPlanner(address, proxy.Transport, options.maxBodySize),
+		versions: nomadVersionFetcher(address, proxy.Transport, options.maxBodySize),
+		jobs:     nomadJobFetcher(address, proxy.Transport, options.maxBodySize, options.nomadToken),
+	}
+}
+
+// WithBlockingQueryTimeout sets the response header timeout of blocking queries,
+// zero waits as long as Nomad does. Other requests keep the timeout of their transport.
+func WithBlockingQueryTimeout(timeout time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.blockingQueryTimeout = timeout
+	}
+}
+
+// blockingQueryTransport sends blocking queries with their own transport,
+// Nomad holds them until the index changes or their wait time is over.
+type blockingQueryTransport struct {
+	base     http.RoundTripper
+	blocking http.RoundTripper
+}
+
+// withBlockingQueryTransport applies the timeout to the blocking queries sent with the transport.
+func withBlockingQueryTransport(transport *http.Transport, timeout time.Duration) http.RoundTripper {
+	if transport.ResponseHeaderTimeout == timeout {
+		return transport
+	}
+	blocking := transport.Clone()
+	blocking.ResponseHeaderTimeout = timeout
+	return &blockingQueryTransport{base: transport, blocking: blocking}
+}
+
+func (t *blockingQueryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if isBlockingQuery(r) {
+		return t.blocking.RoundTrip(r)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// backendRouter picks the backend of a request by its region.
+type backendRouter struct {
+	fallback *backend
+	regions  map[string]*backend
+}
+
+func (b *backendRouter) route(r *http.Request) *backend {
+	if backend, ok := b.regions[requestRegion(r)]; ok {
+		return backend
+	}
+	return b.fallback
+}
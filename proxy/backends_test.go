@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionBackends(t *testing.T) {
+	registered := map[string]int{}
+	newNomadDummy := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPut {
+				registered[name]++
+			}
+			rw.Header().Set("X-Backend", name)
+			rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	global := newNomadDummy("global")
+	eu := newNomadDummy("eu")
+	us := newNomadDummy("us")
+
+	c := config.DefaultConfig()
+	c.Nomad.Address = global.URL
+	c.NomadRegions = []*config.NomadServer{
+		{Region: "eu", Address: eu.URL},
+		{Region: "us", Address: us.URL},
+	}
+	server, err := New(c, hclog.NewNullLogger(), WithValidators(mockValidatorReturningWarnings("some warning")))
+	require.NoError(t, err)
+	proxyServer := httptest.NewServer(server.Handler)
+	defer proxyServer.Close()
+
+	tests := []struct {
+		region      string
+		wantBackend string
+	}{
+		{region: "eu", wantBackend: "eu"},
+		{region: "us", wantBackend: "us"},
+		{region: "ap", wantBackend: "global"},
+		{region: "", wantBackend: "global"},
+	}
+	for _, tt := range tests {
+		t.Run("region "+tt.region, func(t *testing.T) {
+			query := ""
+			if tt.region != "" {
+				query = "?region=" + tt.region
+			}
+
+			res, err := http.Get(proxyServer.URL + "/v1/jobs" + query)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, tt.wantBackend, res.Header.Get("X-Backend"))
+
+			// job submissions are routed after the admission controllers
+			before := registered[tt.wantBackend]
+			resp, _, err := buildNomadClient(t, proxyServer).Jobs().Register(testutil.ReadJob(t, "job.json"), &api.WriteOptions{Region: tt.region})
+			require.NoError(t, err)
+			assert.Contains(t, resp.Warnings, "some warning")
+			assert.Equal(t, before+1, registered[tt.wantBackend])
+		})
+	}
+}
+
+func TestBackendRouter(t *testing.T) {
+	fallback := &backend{}
+	eu := &backend{}
+	router := &backendRouter{fallback: fallback, regions: map[string]*backend{"eu": eu}}
+
+	assert.Same(t, eu, router.route(httptest.NewRequest("GET", "/v1/jobs?region=eu", nil)))
+	assert.Same(t, fallback, router.route(httptest.NewRequest("GET", "/v1/jobs?region=us", nil)))
+	assert.Same(t, fallback, router.route(httptest.NewRequest("GET", "/v1/jobs", nil)))
+
+	byHeader := httptest.NewRequest("GET", "/v1/jobs", nil)
+	byHeader.Header.Set("X-Nomad-Region", "eu")
+	assert.Same(t, eu, router.route(byHeader))
+}
+
+func TestCrossRegionRegister(t *testing.T) {
+	global := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("eu submission reached the global region: %s", req.URL)
+	}))
+	defer global.Close()
+	var received *http.Request
+	var receivedJob *api.Job
+	eu := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		received = req
+		register := &api.JobRegisterRequest{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(register))
+		receivedJob = register.Job
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer eu.Close()
+	globalURL, err := url.Parse(global.URL)
+	require.NoError(t, err)
+	euURL, err := url.Parse(eu.URL)
+	require.NoError(t, err)
+
+	opaValidator, err := validator.NewOpaValidator("region", testutil.Filepath(t, "opa/validators/region.rego"), "errors = data.region.errors", hclog.NewNullLogger())
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{opaValidator}, hclog.NewNullLogger())
+	proxy := NewHandler(globalURL, jobHandler, hclog.NewNullLogger(), nil, WithRegionBackend("eu", euURL, nil))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	tests := []struct {
+		name    string
+		query   string
+		header  string
+		meta    map[string]string
+		wantErr string
+	}{
+		{name: "query parameter", query: "?region=eu", meta: map[string]string{"gdpr": "none"}},
+		{name: "header", header: "eu", meta: map[string]string{"gdpr": "none"}},
+		{name: "policy of the region applies", query: "?region=eu", wantErr: "Jobs in the eu region must set the gdpr meta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, receivedJob = nil, nil
+			job := &api.Job{ID: pointer.Of("example"), Region: pointer.Of("eu"), Meta: tt.meta}
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs"+tt.query, strings.NewReader(registerRequestJson(t, job)))
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("X-Nomad-Region", tt.header)
+			}
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			body := readClosterToString(t, res.Body)
+
+			if tt.wantErr != "" {
+				assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+				assert.Contains(t, body, tt.wantErr)
+				assert.Nil(t, received, "denied submissions don't reach nomad")
+				return
+			}
+			require.Equal(t, http.StatusOK, res.StatusCode, body)
+			require.NotNil(t, received)
+			assert.Equal(t, strings.TrimPrefix(tt.query, "?"), received.URL.RawQuery)
+			assert.Equal(t, tt.header, received.Header.Get("X-Nomad-Region"))
+			assert.Equal(t, "eu", *receivedJob.Region)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// managementPathPrefix is the prefix of the endpoints of NACP itself.
+const managementPathPrefix = "/nacp/"
+
+// CORSPolicy allows browsers of the allowed origins to call the /nacp/ management endpoints.
+// The proxied Nomad API never gets CORS headers.
+type CORSPolicy struct {
+	// AllowedOrigins may contain "*" to allow every origin.
+	AllowedOrigins []string
+	// AllowedMethods default to GET.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache preflight responses, zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// WithCORS adds the CORS headers of the policy to the responses of the management endpoints.
+func WithCORS(policy *CORSPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.cors = policy
+	}
+}
+
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) methods() []string {
+	if len(p.AllowedMethods) == 0 {
+		return []string{http.MethodGet}
+	}
+	return p.AllowedMethods
+}
+
+// handle adds the CORS headers for requests to the management endpoints.
+// It reports whether the request was a preflight request and was answered.
+func (p *CORSPolicy) handle(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, managementPathPrefix) {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if origin == "" || !p.allowsOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		return preflight
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if !preflight {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.methods(), ", "))
+	if len(p.AllowedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	}
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
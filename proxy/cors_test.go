@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("[]"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithCORS(&CORSPolicy{
+		AllowedOrigins: []string{"https://dashboard.example.com"},
+		AllowedHeaders: []string{"X-Nomad-Token"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+		wantMaxAge  string
+	}{
+		{
+			name:       "management endpoint",
+			method:     http.MethodGet,
+			path:       "/nacp/version",
+			origin:     "https://dashboard.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://dashboard.example.com",
+		},
+		{
+			name:        "preflight",
+			method:      http.MethodOptions,
+			path:        "/nacp/version",
+			origin:      "https://dashboard.example.com",
+			preflight:   true,
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "https://dashboard.example.com",
+			wantMethods: "GET",
+			wantMaxAge:  "600",
+		},
+		{
+			name:       "preflight of other origin",
+			method:     http.MethodOptions,
+			path:       "/nacp/version",
+			origin:     "https://evil.example.com",
+			preflight:  true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "other origin",
+			method:     http.MethodGet,
+			path:       "/nacp/version",
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "nomad api",
+			method:     http.MethodGet,
+			path:       "/v1/jobs",
+			origin:     "https://dashboard.example.com",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			assert.Equal(t, tc.wantOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.wantMethods, rr.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tc.wantMaxAge, rr.Header().Get("Access-Control-Max-Age"))
+			if tc.preflight && tc.wantStatus == http.StatusNoContent {
+				assert.Equal(t, "X-Nomad-Token", rr.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
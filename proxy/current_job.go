@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// jobFetcher returns the registered job, nil if there is none, on behalf of the client request.
+type jobFetcher func(ctx context.Context, r *http.Request, jobID string, namespace string) (*api.Job, error)
+
+// WithNomadToken sets NACP's own Nomad token. The lookups of the registered jobs
+// send it instead of the token of the client request. It is never proxied.
+func WithNomadToken(token string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.nomadToken = token
+	}
+}
+
+// nomadJobFetcher looks up jobs with the job endpoint of the Nomad server, forwarding the
+// region of the client request and its token, unless NACP has its own token.
+func nomadJobFetcher(nomadAddress *url.URL, transport http.RoundTripper, maxBodySize int64, token string) jobFetcher {
+	client := &http.Client{Transport: transport}
+	return func(ctx context.Context, r *http.Request, jobID string, namespace string) (*api.Job, error) {
+		jobURL := nomadAddress.JoinPath("v1", "job", jobID)
+		query := forwardedQuery(r)
+		if namespace != "" {
+			query.Set("namespace", namespace)
+		}
+		jobURL.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, jobURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("X-Nomad-Token", token)
+		} else {
+			forwardAuthorization(r, req)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		reader := io.Reader(res.Body)
+		if maxBodySize > 0 {
+			reader = io.LimitReader(res.Body, maxBodySize)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		if !isSuccess(res) {
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &upstreamError{status: res.StatusCode, body: data}
+		}
+		job := &api.Job{}
+		if err := json.NewDecoder(reader).Decode(job); err != nil {
+			return nil, fmt.Errorf("failed to decode job %s: %w", jobID, err)
+		}
+		return job, nil
+	}
+}
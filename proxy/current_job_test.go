@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentJobLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		registered *api.Job
+		count      int
+		wantStatus int
+	}{
+		{
+			name:       "count decreased too much",
+			registered: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(10)}}},
+			count:      2,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "count kept",
+			registered: &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(10)}}},
+			count:      10,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "new job",
+			count:      2,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var lookups atomic.Int32
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodGet && req.URL.Path == "/v1/job/example" {
+					lookups.Add(1)
+					assert.Equal(t, "team-a", req.URL.Query().Get("namespace"))
+					assert.Equal(t, "secret", req.Header.Get("X-Nomad-Token"))
+					if tc.registered == nil {
+						http.Error(rw, "job not found", http.StatusNotFound)
+						return
+					}
+					rw.Write([]byte(toJson(t, tc.registered)))
+					return
+				}
+				rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			var validators []admissionctrl.JobValidator
+			for _, name := range []string{"first", "second"} {
+				v, err := validator.NewOpaValidator(name, testutil.Filepath(t, "opa/validators/count_decrease.rego"), "errors = data.count_decrease.errors", hclog.NewNullLogger(), opa.WithCurrentJobInput())
+				require.NoError(t, err)
+				validators = append(validators, v)
+			}
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, validators, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			job := &api.Job{ID: pointer.Of("example"), Namespace: pointer.Of("team-a"), TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(tc.count)}}}
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, job)))
+			require.NoError(t, err)
+			req.Header.Set("X-Nomad-Token", "secret")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+			assert.Equal(t, int32(1), lookups.Load(), "the job should be looked up once per request")
+		})
+	}
+}
+
+func TestCurrentJobLookupWithNomadToken(t *testing.T) {
+	tokens := map[string]string{}
+	var mu sync.Mutex
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		tokens[req.Method+" "+req.URL.Path] = req.Header.Get("X-Nomad-Token")
+		mu.Unlock()
+		if req.Method == http.MethodGet {
+			http.Error(rw, "job not found", http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	v, err := validator.NewOpaValidator("count", testutil.Filepath(t, "opa/validators/count_decrease.rego"), "errors = data.count_decrease.errors", hclog.NewNullLogger(), opa.WithCurrentJobInput())
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{v}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithNomadToken("nacp-token"))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	job := &api.Job{ID: pointer.Of("example"), TaskGroups: []*api.TaskGroup{{Name: pointer.Of("web"), Count: pointer.Of(1)}}}
+	req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, job)))
+	require.NoError(t, err)
+	req.Header.Set("X-Nomad-Token", "client-token")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, map[string]string{
+		"GET /v1/job/example": "nacp-token",
+		"PUT /v1/jobs":        "client-token",
+	}, tokens, "the lookup uses nacp's token, the client request keeps its own")
+}
@@ -0,0 +1,314 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+)
+
+// The builtin controller types with the block they require.
+func init() {
+	admissionctrl.RegisterMutatorFactory("opa_json_patch", "opa_rule", newOpaJsonPatchMutator)
+	admissionctrl.RegisterMutatorFactory("json_patch_webhook", "webhook", newJsonPatchWebhookMutator)
+	admissionctrl.RegisterMutatorFactory("meta_defaults", "meta_defaults", newMetaDefaultsMutator)
+	admissionctrl.RegisterMutatorFactory("datacenter_defaults", "datacenter_defaults", newDatacenterDefaultsMutator)
+	admissionctrl.RegisterMutatorFactory("job_id_namespace", "job_id_namespace", newJobIDNamespaceMutator)
+	admissionctrl.RegisterMutatorFactory("field_migration", "field_migration", newFieldMigrationMutator)
+	admissionctrl.RegisterMutatorFactory("resource_defaults", "resource_defaults", newResourceDefaultsMutator)
+	admissionctrl.RegisterMutatorFactory("strip_fields", "strip_fields", newStripFieldsMutator)
+
+	admissionctrl.RegisterValidatorFactory("opa", "opa_rule", newOpaValidator)
+	admissionctrl.RegisterValidatorFactory("webhook", "webhook", newWebhookValidator)
+	admissionctrl.RegisterValidatorFactory("required_fields", "required_fields", newRequiredFieldsValidator)
+	admissionctrl.RegisterValidatorFactory("resource_cores", "", newResourceCoresValidator)
+	admissionctrl.RegisterValidatorFactory("csi_plugin", "csi_plugin", newCSIPluginValidator)
+	admissionctrl.RegisterValidatorFactory("service_provider", "service_provider", newServiceProviderValidator)
+	admissionctrl.RegisterValidatorFactory("client_disconnect", "client_disconnect", newClientDisconnectValidator)
+	admissionctrl.RegisterValidatorFactory("driver_config_policy", "driver_config_policy", newDriverConfigPolicyValidator)
+	admissionctrl.RegisterValidatorFactory("quota", "", newQuotaValidator)
+	admissionctrl.RegisterValidatorFactory("network_caps", "network_caps", newNetworkCapsValidator)
+	admissionctrl.RegisterValidatorFactory("json_schema", "json_schema", newJSONSchemaValidator)
+	admissionctrl.RegisterValidatorFactory("allowed_images", "allowed_images", newAllowedImagesValidator)
+	admissionctrl.RegisterValidatorFactory("resource_limits", "resource_limits", newResourceLimitsValidator)
+	admissionctrl.RegisterValidatorFactory("require_namespace", "", newRequireNamespaceValidator)
+}
+
+func newOpaJsonPatchMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	opaOpts, err := opaQueryOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	mutator, err := mutator.NewOpaJsonPatchMutator(m.Name, m.OpaRule.Filename, m.OpaRule.Query, logger.Named("opa_mutator"), opaRuleOptions(m.OpaRule, opaOpts)...)
+	if err != nil {
+		return nil, fmt.Errorf("mutator %s: %w", m.Name, err)
+	}
+	return mutator, nil
+}
+
+func newJsonPatchWebhookMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	webhookOpts, err := webhookClientOptions(c, m.Webhook)
+	if err != nil {
+		return nil, fmt.Errorf("mutator %s: %w", m.Name, err)
+	}
+	mutator, err := mutator.NewJsonPatchWebhookMutator(m.Name, m.Webhook.Endpoint, m.Webhook.Method, logger.Named("json_patch_webhook_mutator"), webhookOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return mutator, nil
+}
+
+func newMetaDefaultsMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.MetaDefaults == nil {
+		return nil, fmt.Errorf("mutator %s requires a meta_defaults block", m.Name)
+	}
+	return mutator.NewMetaDefaultsMutator(m.Name, m.MetaDefaults.Meta, m.MetaDefaults.Force, logger.Named("meta_defaults_mutator")), nil
+}
+
+func newDatacenterDefaultsMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.DatacenterDefaults == nil {
+		return nil, fmt.Errorf("mutator %s requires a datacenter_defaults block", m.Name)
+	}
+	return mutator.NewDatacenterDefaultsMutator(m.Name, m.DatacenterDefaults.Datacenters, logger.Named("datacenter_defaults_mutator")), nil
+}
+
+func newJobIDNamespaceMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.JobIDNamespace == nil {
+		return nil, fmt.Errorf("mutator %s requires a job_id_namespace block", m.Name)
+	}
+	return mutator.NewJobIDNamespaceMutator(m.Name, m.JobIDNamespace.Prefixes, logger.Named("job_id_namespace_mutator")), nil
+}
+
+func newFieldMigrationMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.FieldMigration == nil {
+		return nil, fmt.Errorf("mutator %s requires a field_migration block", m.Name)
+	}
+	rules := make([]mutator.MigrationRule, 0, len(m.FieldMigration.Rules))
+	for _, r := range m.FieldMigration.Rules {
+		rules = append(rules, mutator.MigrationRule{From: r.From, To: r.To, Message: r.Message})
+	}
+	return mutator.NewFieldMigrationMutator(m.Name, rules, logger.Named("field_migration_mutator"))
+}
+
+func newResourceDefaultsMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.ResourceDefaults == nil {
+		return nil, fmt.Errorf("mutator %s requires a resource_defaults block", m.Name)
+	}
+	defaults := mutator.ResourceDefaults{
+		CPU:         m.ResourceDefaults.CPU,
+		MemoryMB:    m.ResourceDefaults.MemoryMB,
+		MemoryMaxMB: m.ResourceDefaults.MemoryMaxMB,
+	}
+	for _, c := range m.ResourceDefaults.Constraints {
+		defaults.Constraints = append(defaults.Constraints, &api.Constraint{LTarget: c.Attribute, Operand: c.Operator, RTarget: c.Value})
+	}
+	mutator, err := mutator.NewResourceDefaultsMutator(m.Name, defaults, logger.Named("resource_defaults_mutator"))
+	if err != nil {
+		return nil, fmt.Errorf("mutator %s: %w", m.Name, err)
+	}
+	return mutator, nil
+}
+
+func newStripFieldsMutator(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+	if m.StripFields == nil {
+		return nil, fmt.Errorf("mutator %s requires a strip_fields block", m.Name)
+	}
+	mutator, err := mutator.NewStripFieldsMutator(m.Name, m.StripFields.Paths, logger.Named("strip_fields_mutator"))
+	if err != nil {
+		return nil, fmt.Errorf("mutator %s: %w", m.Name, err)
+	}
+	return mutator, nil
+}
+
+func newOpaValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	opaOpts, err := opaQueryOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	opaValidator, err := validator.NewOpaValidator(v.Name, v.OpaRule.Filename, v.OpaRule.Query, logger.Named("opa_validator"), opaRuleOptions(v.OpaRule, opaOpts)...)
+	if err != nil {
+		return nil, fmt.Errorf("validator %s: %w", v.Name, err)
+	}
+	return opaValidator, nil
+}
+
+func newWebhookValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	webhookOpts, err := webhookClientOptions(c, v.Webhook)
+	if err != nil {
+		return nil, fmt.Errorf("validator %s: %w", v.Name, err)
+	}
+	validator, err := validator.NewWebhookValidator(v.Name, v.Webhook.Endpoint, v.Webhook.Method, logger.Named("webhook_validator"), webhookOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return validator, nil
+}
+
+func newRequiredFieldsValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.RequiredFields == nil {
+		return nil, fmt.Errorf("validator %s requires a required_fields block", v.Name)
+	}
+	return validator.NewRequiredFieldsValidator(v.Name, validator.RequiredFields(*v.RequiredFields), logger.Named("required_fields_validator")), nil
+}
+
+func newResourceCoresValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	only := ""
+	if v.ResourceCores != nil {
+		only = v.ResourceCores.Only
+	}
+	validator, err := validator.NewResourceCoresValidator(v.Name, only, logger.Named("resource_cores_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newCSIPluginValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.CSIPlugin == nil {
+		return nil, fmt.Errorf("validator %s requires a csi_plugin block", v.Name)
+	}
+	if c.Identity == nil {
+		return nil, fmt.Errorf("validator %s requires an identity block to resolve request tokens", v.Name)
+	}
+	return validator.NewCSIPluginValidator(v.Name, validator.CSIPluginAllowlist{
+		Tokens:     v.CSIPlugin.AllowedTokens,
+		Policies:   v.CSIPlugin.AllowedPolicies,
+		Management: v.CSIPlugin.AllowManagement,
+		PluginIDs:  v.CSIPlugin.AllowedPluginIDs,
+	}, logger.Named("csi_plugin_validator")), nil
+}
+
+func newServiceProviderValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.ServiceProvider == nil {
+		return nil, fmt.Errorf("validator %s requires a service_provider block", v.Name)
+	}
+	validator, err := validator.NewServiceProviderValidator(v.Name, v.ServiceProvider.Allowed, logger.Named("service_provider_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newClientDisconnectValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.ClientDisconnect == nil {
+		return nil, fmt.Errorf("validator %s requires a client_disconnect block", v.Name)
+	}
+	policy := validator.ClientDisconnectPolicy{
+		JobTypes: v.ClientDisconnect.JobTypes,
+		WarnOnly: v.ClientDisconnect.Warn,
+	}
+	for _, bound := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"min", v.ClientDisconnect.Min, &policy.Min},
+		{"max", v.ClientDisconnect.Max, &policy.Max},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("validator %s: invalid %s: %w", v.Name, bound.name, err)
+		}
+		*bound.target = d
+	}
+	validator, err := validator.NewClientDisconnectValidator(v.Name, policy, logger.Named("client_disconnect_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newNetworkCapsValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.NetworkCaps == nil {
+		return nil, fmt.Errorf("validator %s requires a network_caps block", v.Name)
+	}
+	caps := validator.NetworkCaps{MaxMBits: v.NetworkCaps.MaxMBits, MaxReservedPorts: v.NetworkCaps.MaxReservedPorts}
+	validator, err := validator.NewNetworkCapsValidator(v.Name, caps, logger.Named("network_caps_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newJSONSchemaValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.JSONSchema == nil {
+		return nil, fmt.Errorf("validator %s requires a json_schema block", v.Name)
+	}
+	validator, err := validator.NewJSONSchemaValidator(v.Name, v.JSONSchema.SchemaFile, logger.Named("json_schema_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newDriverConfigPolicyValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.DriverConfigPolicy == nil {
+		return nil, fmt.Errorf("validator %s requires a driver_config_policy block", v.Name)
+	}
+	drivers := map[string]validator.DriverConfigRule{}
+	for _, rule := range v.DriverConfigPolicy.Drivers {
+		drivers[rule.Driver] = validator.DriverConfigRule{Allow: rule.Allow, Deny: rule.Deny}
+	}
+	validator, err := validator.NewDriverConfigPolicyValidator(v.Name, drivers, logger.Named("driver_config_policy_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newAllowedImagesValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.AllowedImages == nil {
+		return nil, fmt.Errorf("validator %s requires an allowed_images block", v.Name)
+	}
+	validator, err := validator.NewAllowedImagesValidator(v.Name, v.AllowedImages.Registries, v.AllowedImages.Patterns, logger.Named("allowed_images_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newResourceLimitsValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	if v.ResourceLimits == nil {
+		return nil, fmt.Errorf("validator %s requires a resource_limits block", v.Name)
+	}
+	limit := func(l *config.ResourceLimit) validator.ResourceLimit {
+		if l == nil {
+			return validator.ResourceLimit{}
+		}
+		return validator.ResourceLimit{CPU: l.CPU, Cores: l.Cores, MemoryMB: l.MemoryMB, DiskMB: l.DiskMB}
+	}
+	limits := validator.ResourceLimits{Task: limit(v.ResourceLimits.Task), Job: limit(v.ResourceLimits.Job)}
+	validator, err := validator.NewResourceLimitsValidator(v.Name, limits, logger.Named("resource_limits_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newRequireNamespaceValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	policy := config.RequireNamespace{}
+	if v.RequireNamespace != nil {
+		policy = *v.RequireNamespace
+	}
+	validator, err := validator.NewRequireNamespaceValidator(v.Name, policy.Forbidden, policy.Allowed, logger.Named("require_namespace_validator"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator %s: %w", v.Name, err)
+	}
+	return validator, nil
+}
+
+func newQuotaValidator(c *config.Config, v config.Validator, logger hclog.Logger) (admissionctrl.JobValidator, error) {
+	client, err := NewNomadClient(c.Nomad, "")
+	if err != nil {
+		return nil, fmt.Errorf("validator %s: failed to create Nomad client: %w", v.Name, err)
+	}
+	return validator.NewQuotaValidator(v.Name, client, logger.Named("quota_validator")), nil
+}
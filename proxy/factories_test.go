@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinControllersAreRegistered(t *testing.T) {
+	for _, typeName := range []string{"opa_json_patch", "json_patch_webhook", "meta_defaults", "datacenter_defaults", "job_id_namespace", "field_migration", "resource_defaults", "strip_fields"} {
+		_, ok := admissionctrl.LookupMutatorFactory(typeName)
+		assert.True(t, ok, "mutator %s", typeName)
+	}
+	for _, typeName := range []string{"opa", "webhook", "required_fields", "resource_cores", "csi_plugin", "service_provider", "client_disconnect", "driver_config_policy", "quota", "allowed_images", "resource_limits", "require_namespace"} {
+		_, ok := admissionctrl.LookupValidatorFactory(typeName)
+		assert.True(t, ok, "validator %s", typeName)
+	}
+}
+
+func TestBuiltinControllersRequireTheirBlocks(t *testing.T) {
+	c := &config.Config{
+		Mutators:   []config.Mutator{{Type: "resource_defaults", Name: "defaults"}},
+		Validators: []config.Validator{{Type: "allowed_images", Name: "images"}, {Type: "quota", Name: "quota"}},
+	}
+
+	err := c.Validate()
+
+	assert.ErrorContains(t, err, `mutator "defaults" requires a resource_defaults block`)
+	assert.ErrorContains(t, err, `validator "images" requires a allowed_images block`)
+	assert.NotContains(t, err.Error(), `validator "quota"`, "quota requires no block")
+}
+
+func TestCreateMutatorsWithRegisteredType(t *testing.T) {
+	admissionctrl.RegisterMutatorFactory("proxy_test_hello", "", func(c *config.Config, m config.Mutator, logger hclog.Logger) (admissionctrl.JobMutator, error) {
+		return &testutil.HelloMutator{MutatorName: m.Options["name"]}, nil
+	})
+	c := &config.Config{
+		Mutators: []config.Mutator{
+			{Type: "proxy_test_hello", Name: "hello", Namespace: "team-a", Options: map[string]string{"name": "custom"}},
+		},
+	}
+
+	mutators, err := createMutators(c, hclog.NewNullLogger())
+
+	require.NoError(t, err)
+	require.Len(t, mutators, 1)
+	assert.Equal(t, "custom", mutators[0].Name())
+	_, unscoped := mutators[0].(*testutil.HelloMutator)
+	assert.False(t, unscoped, "custom types are scoped to their namespace like the builtin ones")
+}
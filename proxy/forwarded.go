@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WithTrustedProxies keeps the X-Forwarded-* headers of requests sent by the
+// given networks and appends to their X-Forwarded-For chain. The headers of
+// all other clients are replaced, so they can't spoof their address.
+func WithTrustedProxies(networks []*net.IPNet) HandlerOption {
+	return func(o *handlerOptions) {
+		o.trustedProxies = networks
+	}
+}
+
+// ParseTrustedProxies parses ip addresses and CIDR ranges like "10.0.0.0/8".
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (o *handlerOptions) isTrustedProxy(r *http.Request) bool {
+	return o.isTrusted(net.ParseIP(remoteIP(r)))
+}
+
+func (o *handlerOptions) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range o.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withClientIP records the client address of the request for clientIP. Requests of trusted
+// proxies are from the last X-Forwarded-For address that is no trusted proxy itself.
+func (o *handlerOptions) withClientIP(r *http.Request) *http.Request {
+	ip := remoteIP(r)
+	if o.isTrustedProxy(r) {
+		var chain []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(header, ",")...)
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			forwarded := net.ParseIP(strings.TrimSpace(chain[i]))
+			if forwarded == nil {
+				break
+			}
+			ip = forwarded.String()
+			if !o.isTrusted(forwarded) {
+				break
+			}
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxClientIP, ip))
+}
+
+// setForwardedHeaders prepares the X-Forwarded-* headers of the outgoing request.
+// The reverse proxy appends the client address to X-Forwarded-For afterwards.
+func (o *handlerOptions) setForwardedHeaders(r *http.Request) {
+	trusted := o.isTrustedProxy(r)
+	if !trusted {
+		r.Header.Del("X-Forwarded-For")
+	}
+	if !trusted || r.Header.Get("X-Forwarded-Host") == "" {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+	if !trusted || r.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+		r.Header.Set("X-Forwarded-Proto", proto)
+	}
+}
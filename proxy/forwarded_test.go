@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		received <- req.Header
+		rw.Write([]byte("[]"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithTrustedProxies(trusted))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		header     map[string]string
+		wantFor    string
+		wantHost   string
+		wantProto  string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.7:4321",
+			wantFor:    "203.0.113.7",
+			wantHost:   "nacp.example.com",
+			wantProto:  "http",
+		},
+		{
+			name:       "direct with tls",
+			remoteAddr: "203.0.113.7:4321",
+			tls:        true,
+			wantFor:    "203.0.113.7",
+			wantHost:   "nacp.example.com",
+			wantProto:  "https",
+		},
+		{
+			name:       "spoofed by untrusted client",
+			remoteAddr: "203.0.113.7:4321",
+			header:     map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Host": "evil.example.com", "X-Forwarded-Proto": "https"},
+			wantFor:    "203.0.113.7",
+			wantHost:   "nacp.example.com",
+			wantProto:  "http",
+		},
+		{
+			name:       "chained through trusted proxy",
+			remoteAddr: "10.1.2.3:4321",
+			header:     map[string]string{"X-Forwarded-For": "198.51.100.1, 10.9.9.9", "X-Forwarded-Host": "nomad.example.com", "X-Forwarded-Proto": "https"},
+			wantFor:    "198.51.100.1, 10.9.9.9, 10.1.2.3",
+			wantHost:   "nomad.example.com",
+			wantProto:  "https",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "192.168.1.1:4321",
+			wantFor:    "192.168.1.1",
+			wantHost:   "nacp.example.com",
+			wantProto:  "http",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://nacp.example.com/v1/jobs", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rw := httptest.NewRecorder()
+			proxy(rw, req)
+			require.Equal(t, http.StatusOK, rw.Code)
+
+			header := <-received
+			assert.Equal(t, tt.wantFor, header.Get("X-Forwarded-For"))
+			assert.Equal(t, tt.wantHost, header.Get("X-Forwarded-Host"))
+			assert.Equal(t, tt.wantProto, header.Get("X-Forwarded-Proto"))
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	options := &handlerOptions{trustedProxies: trusted}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:4321", want: "203.0.113.7"},
+		{name: "spoofed by untrusted client", remoteAddr: "203.0.113.7:4321", forwarded: "1.2.3.4", want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:4321", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.1.2.3:4321", forwarded: "1.2.3.4, 198.51.100.1, 10.9.9.9", want: "198.51.100.1"},
+		{name: "trusted proxy without header", remoteAddr: "10.1.2.3:4321", want: "10.1.2.3"},
+		{name: "invalid forwarded address", remoteAddr: "10.1.2.3:4321", forwarded: "garbage", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/v1/jobs", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			assert.Equal(t, tt.want, clientIP(options.withClientIP(r)))
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies([]string{"10.0.0.0/8", "127.0.0.1", "::1"})
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "127.0.0.1/32", networks[1].String())
+	assert.Equal(t, "::1/128", networks[2].String())
+
+	_, err = ParseTrustedProxies([]string{"localhost"})
+	assert.ErrorContains(t, err, `invalid trusted proxy "localhost"`)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.ErrorContains(t, err, `invalid trusted proxy "10.0.0.0/33"`)
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/mxab/nacp/config"
+)
+
+// Listen opens a listener on the bind address, or on every bind address of
+// bind_addresses, using the listen network. If any address can't be bound
+// the listeners opened so far are closed again.
+func Listen(c *config.Config) ([]net.Listener, error) {
+	network := c.ListenNetwork
+	if network == "" {
+		network = "tcp"
+	}
+	addresses := c.BindAddresses
+	if len(addresses) == 0 {
+		addresses = []string{c.Bind}
+	}
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := net.Listen(network, net.JoinHostPort(address, strconv.Itoa(c.Port)))
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// Serve serves the server on all listeners, with TLS if tlsConfig is set.
+// It returns once serving on any of the listeners stops.
+func Serve(server *http.Server, listeners []net.Listener, tlsConfig *config.ProxyTLS) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if tlsConfig != nil {
+				errs <- server.ServeTLS(l, tlsConfig.CertFile, tlsConfig.KeyFile)
+			} else {
+				errs <- server.Serve(l)
+			}
+		}(l)
+	}
+	return <-errs
+}
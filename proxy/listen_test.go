@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestListen(t *testing.T) {
+	tt := []struct {
+		name      string
+		config    *config.Config
+		wantAddrs []string
+		wantErr   string
+	}{
+		{
+			name:      "bind",
+			config:    &config.Config{Bind: "127.0.0.1"},
+			wantAddrs: []string{"127.0.0.1"},
+		},
+		{
+			name:      "bind addresses",
+			config:    &config.Config{Bind: "0.0.0.0", BindAddresses: []string{"127.0.0.1", "127.0.0.2"}, ListenNetwork: "tcp4"},
+			wantAddrs: []string{"127.0.0.1", "127.0.0.2"},
+		},
+		{
+			name:    "network mismatch",
+			config:  &config.Config{Bind: "127.0.0.1", ListenNetwork: "tcp6"},
+			wantErr: "failed to listen on 127.0.0.1",
+		},
+		{
+			name:    "duplicate address",
+			config:  &config.Config{BindAddresses: []string{"127.0.0.1", "127.0.0.1"}},
+			wantErr: "address already in use",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Port = freePort(t)
+			listeners, err := Listen(tc.config)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				// the listeners opened before the failing one are closed again
+				l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(tc.config.Port)))
+				require.NoError(t, err)
+				l.Close()
+				return
+			}
+			require.NoError(t, err)
+			defer func() {
+				for _, l := range listeners {
+					l.Close()
+				}
+			}()
+			addrs := []string{}
+			for _, l := range listeners {
+				addr := l.Addr().(*net.TCPAddr)
+				assert.Equal(t, tc.config.Port, addr.Port)
+				addrs = append(addrs, addr.IP.String())
+			}
+			assert.Equal(t, tc.wantAddrs, addrs)
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	c := &config.Config{BindAddresses: []string{"127.0.0.1", "127.0.0.2"}, Port: freePort(t)}
+	listeners, err := Listen(c)
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("ok"))
+	})}
+	served := make(chan error)
+	go func() { served <- Serve(server, listeners, nil) }()
+
+	for _, l := range listeners {
+		res, err := http.Get("http://" + l.Addr().String())
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+	}
+
+	server.Close()
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+}
@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const nacpMetricsPath = "/nacp/metrics"
+
+var (
+	rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nacp",
+		Name:      "rate_limited_requests_total",
+		Help:      "Job submissions rejected by the rate limiter.",
+	}, []string{"key_type"})
+)
+
+func isNacpMetrics(r *http.Request) bool {
+	return r.Method == "GET" && r.URL.Path == nacpMetricsPath
+}
+
+var metricsHandler = promhttp.Handler()
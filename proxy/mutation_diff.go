@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+)
+
+// MutationsHeader carries the base64 encoded mutation diff of the job.
+const MutationsHeader = "X-Nacp-Mutations"
+
+type contextKeyMutations struct{}
+
+var ctxMutations = contextKeyMutations{}
+
+// WithMutationDiff logs a diff between the submitted and the mutated job.
+// If header is true the diff is also returned as X-Nacp-Mutations response header.
+// The diff is a JSON merge patch (RFC 7386).
+func WithMutationDiff(header bool) HandlerOption {
+	return func(o *handlerOptions) {
+		o.mutationDiff = true
+		o.mutationDiffHeader = header
+	}
+}
+
+// snapshotJob returns the json of the job before it gets mutated,
+// or nil if the mutation diff is disabled.
+func (o *handlerOptions) snapshotJob(job *api.Job) []byte {
+	if !o.mutationDiff {
+		return nil
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// recordMutationDiff logs the changes of the admission controllers made to
+// the snapshot and keeps them for the response header.
+func (o *handlerOptions) recordMutationDiff(r *http.Request, appLogger hclog.Logger, snapshot []byte, job *api.Job) *http.Request {
+	if snapshot == nil {
+		return r
+	}
+	mutated, err := json.Marshal(job)
+	if err != nil {
+		appLogger.Warn("Failed to marshal mutated job for diff", "error", err)
+		return r
+	}
+	diff, err := jsonpatch.CreateMergePatch(snapshot, mutated)
+	if err != nil {
+		appLogger.Warn("Failed to create mutation diff", "error", err)
+		return r
+	}
+	if bytes.Equal(diff, []byte("{}")) {
+		return r
+	}
+	appLogger.Info("Job mutated by admission controllers", "job", job.ID, "diff", string(diff))
+	if !o.mutationDiffHeader {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxMutations, diff))
+}
+
+func setMutationsHeader(resp *http.Response) {
+	if diff, ok := resp.Request.Context().Value(ctxMutations).([]byte); ok {
+		resp.Header.Set(MutationsHeader, base64.StdEncoding.EncodeToString(diff))
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutationDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []HandlerOption
+		mutators   []admissionctrl.JobMutator
+		wantHeader string
+		wantLog    bool
+	}{
+		{
+			name:       "header and log",
+			opts:       []HandlerOption{WithMutationDiff(true)},
+			mutators:   []admissionctrl.JobMutator{&testutil.HelloMutator{}},
+			wantHeader: `{"Meta":{"hello":"world"}}`,
+			wantLog:    true,
+		},
+		{
+			name:     "log only",
+			opts:     []HandlerOption{WithMutationDiff(false)},
+			mutators: []admissionctrl.JobMutator{&testutil.HelloMutator{}},
+			wantLog:  true,
+		},
+		{
+			name:     "nothing mutated",
+			opts:     []HandlerOption{WithMutationDiff(true)},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:     "disabled",
+			mutators: []admissionctrl.JobMutator{&testutil.HelloMutator{}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Write([]byte("{}"))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			logs := &strings.Builder{}
+			logger := hclog.New(&hclog.LoggerOptions{Output: logs})
+			jobHandler := admissionctrl.NewJobHandler(tc.mutators, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, logger, nil, tc.opts...)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			header := res.Header.Get(MutationsHeader)
+			if tc.wantHeader == "" {
+				assert.Empty(t, header)
+			} else {
+				diff, err := base64.StdEncoding.DecodeString(header)
+				require.NoError(t, err)
+				assert.JSONEq(t, tc.wantHeader, string(diff))
+			}
+			assert.Equal(t, tc.wantLog, strings.Contains(logs.String(), "Job mutated by admission controllers"))
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+)
+
+const nacpOpenAPIPath = "/nacp/openapi.json"
+
+func isNacpOpenAPI(r *http.Request) bool {
+	return r.Method == "GET" && r.URL.Path == nacpOpenAPIPath
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPISpec []byte
+	openAPIErr  error
+)
+
+func serveOpenAPI(w http.ResponseWriter, appLogger hclog.Logger) {
+	openAPIOnce.Do(func() {
+		openAPISpec, openAPIErr = json.Marshal(newOpenAPISpec())
+	})
+	if openAPIErr != nil {
+		appLogger.Error("Failed to generate OpenAPI spec", "error", openAPIErr)
+		http.Error(w, openAPIErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+type jsonObject = map[string]interface{}
+
+// newOpenAPISpec describes the standalone admission endpoints,
+// the schemas are generated from the Go request and response types.
+func newOpenAPISpec() jsonObject {
+	g := newSchemaGenerator()
+
+	jobRequestBody := func(t reflect.Type) jsonObject {
+		return jsonObject{
+			"required": true,
+			"content":  jsonObject{"application/json": jsonObject{"schema": g.schema(t)}},
+		}
+	}
+	errorResponses := func(responses jsonObject) jsonObject {
+		responses["400"] = jsonObject{"description": "The request could not be decoded or contains no job"}
+		responses["413"] = jsonObject{"description": "The job exceeds the maximum size"}
+		responses["429"] = jsonObject{"description": "Rate limit exceeded"}
+		responses["500"] = jsonObject{"description": "An admission controller failed"}
+		return responses
+	}
+
+	validate := jsonObject{
+		"summary":     "Apply the admission controllers to a job without submitting it to Nomad",
+		"operationId": "validateJob",
+		"parameters": []jsonObject{{
+			"name":     "format",
+			"in":       "query",
+			"required": false,
+			"schema":   jsonObject{"type": "string", "enum": []string{"json", "sarif"}, "default": "json"},
+		}},
+		"requestBody": jobRequestBody(reflect.TypeOf(api.JobValidateRequest{})),
+		"responses": errorResponses(jsonObject{
+			"200": jsonObject{
+				"description": "The validation result",
+				"content": jsonObject{
+					"application/json":       jsonObject{"schema": g.schema(reflect.TypeOf(api.JobValidateResponse{}))},
+					"application/sarif+json": jsonObject{"schema": jsonObject{"type": "object"}},
+				},
+			},
+		}),
+	}
+	mutate := jsonObject{
+		"summary":     "Apply the admission mutators to a job and return the mutated job",
+		"operationId": "mutateJob",
+		"requestBody": jobRequestBody(reflect.TypeOf(MutateRequest{})),
+		"responses": errorResponses(jsonObject{
+			"200": jsonObject{
+				"description": "The mutated job",
+				"content":     jsonObject{"application/json": jsonObject{"schema": g.schema(reflect.TypeOf(MutateResponse{}))}},
+			},
+		}),
+	}
+
+	check := jsonObject{
+		"summary":     "Apply the admission controllers to a job and optionally plan the mutated job with Nomad",
+		"operationId": "checkJob",
+		"requestBody": jobRequestBody(reflect.TypeOf(CheckRequest{})),
+		"responses": errorResponses(jsonObject{
+			"200": jsonObject{
+				"description": "The mutated job, the validation result and the plan",
+				"content":     jsonObject{"application/json": jsonObject{"schema": g.schema(reflect.TypeOf(CheckResponse{}))}},
+			},
+			"502": jsonObject{"description": "Nomad could not be reached to plan the job"},
+		}),
+	}
+
+	return jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":   "nacp",
+			"version": "1.0.0",
+		},
+		"paths": jsonObject{
+			nacpValidatePath: jsonObject{"put": validate, "post": validate},
+			nacpMutatePath:   jsonObject{"put": mutate, "post": mutate},
+			nacpCheckPath:    jsonObject{"put": check, "post": check},
+			nacpOpenAPIPath: jsonObject{
+				"get": jsonObject{
+					"summary":     "This OpenAPI spec",
+					"operationId": "openAPI",
+					"responses":   jsonObject{"200": jsonObject{"description": "The OpenAPI spec"}},
+				},
+			},
+		},
+		"components": jsonObject{"schemas": g.schemas},
+	}
+}
+
+// schemaGenerator derives OpenAPI schemas from Go types, following their
+// encoding/json representation. Named structs become shared components.
+type schemaGenerator struct {
+	schemas jsonObject
+	names   map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		schemas: jsonObject{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) jsonObject {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return jsonObject{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return jsonObject{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return jsonObject{"type": "string", "format": "byte"}
+		}
+		return jsonObject{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return jsonObject{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return jsonObject{"$ref": "#/components/schemas/" + g.component(t)}
+	}
+	// interfaces and anything else can hold any value
+	return jsonObject{}
+}
+
+// component registers the schema of a named struct once and returns its component name.
+func (g *schemaGenerator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	g.names[t] = name
+	// reserve the name before descending to support recursive types
+	g.schemas[name] = jsonObject{}
+	g.schemas[name] = g.structSchema(t)
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) jsonObject {
+	properties := jsonObject{}
+	g.addFields(t, properties)
+	return jsonObject{"type": "object", "properties": properties}
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties jsonObject) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+	}
+}
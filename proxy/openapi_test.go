@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeOpenAPI(t *testing.T) {
+	server := newValidateAPIServer(t)
+
+	res, err := http.Get(server.URL + "/nacp/openapi.json")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	spec := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+
+	paths := spec["paths"].(map[string]interface{})
+	assert.Contains(t, paths, "/nacp/validate")
+	assert.Contains(t, paths, "/nacp/mutate")
+	assert.Contains(t, paths, "/nacp/check")
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"JobValidateRequest", "JobValidateResponse", "MutateRequest", "MutateResponse", "CheckRequest", "CheckResponse", "JobPlanResponse", "Job", "TaskGroup", "Task"} {
+		assert.Contains(t, schemas, name)
+	}
+	// embedded WriteRequest fields are inlined
+	validateRequest := schemas["JobValidateRequest"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, validateRequest, "Job")
+	assert.Contains(t, validateRequest, "Namespace")
+}
+
+type schemaTestNode struct {
+	Name     string `json:"name"`
+	Ignored  string `json:"-"`
+	Children []*schemaTestNode
+	Labels   map[string]int64 `json:",omitempty"`
+	secret   string
+}
+
+func TestSchemaGenerator(t *testing.T) {
+	g := newSchemaGenerator()
+
+	ref := g.schema(reflect.TypeOf(&schemaTestNode{}))
+
+	assert.Equal(t, jsonObject{"$ref": "#/components/schemas/schemaTestNode"}, ref)
+	assert.Equal(t, jsonObject{
+		"schemaTestNode": jsonObject{
+			"type": "object",
+			"properties": jsonObject{
+				"name":     jsonObject{"type": "string"},
+				"Children": jsonObject{"type": "array", "items": ref},
+				"Labels":   jsonObject{"type": "object", "additionalProperties": jsonObject{"type": "integer", "format": "int64"}},
+			},
+		},
+	}, g.schemas)
+}
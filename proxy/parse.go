@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// WithParsedJobMutation applies the mutators to the jobs Nomad parses from HCL
+// at /v1/jobs/parse, so clients see the job as it will be registered.
+//
+// The mutators run again when the parsed job is registered, so they must be
+// idempotent: setting defaults is, appending to a list is not. Validators are
+// not applied, parsing a job never fails because of a policy.
+func WithParsedJobMutation() HandlerOption {
+	return func(o *handlerOptions) {
+		o.mutateParsedJobs = true
+	}
+}
+
+func isParse(r *http.Request) bool {
+	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == "/v1/jobs/parse"
+}
+
+// handleParseResponse mutates the job parsed by Nomad. If a mutator fails the
+// job is returned as parsed, the error is reported once the job is registered.
+func handleParseResponse(resp *http.Response, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) error {
+	if !options.mutateParsedJobs {
+		return nil
+	}
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body, options.maxBodySize)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	job := &api.Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return err
+	}
+	mutated, warnings, err := jobHandler.AdmissionMutators(admissionContext(resp.Request, job), job)
+	if err != nil {
+		appLogger.Warn("Mutating parsed job failed, returning it as parsed", "job", job.ID, "error", err)
+	} else {
+		if len(warnings) > 0 {
+			// the parse response has no warnings, they are returned once the job is registered
+			appLogger.Debug("Mutating parsed job returned warnings", "job", job.ID, "warnings", warnings)
+		}
+		if data, err = json.Marshal(mutated); err != nil {
+			return err
+		}
+	}
+	if isGzip {
+		rewriteResponseGzip(resp, data)
+	} else {
+		rewriteResponse(resp, data)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsedJobMutation(t *testing.T) {
+	failing := new(testutil.MockMutator)
+	failing.On("Mutate", mock.Anything).Return((*api.Job)(nil), []error{}, errors.New("mutation failed"))
+
+	tests := []struct {
+		name     string
+		mutator  admissionctrl.JobMutator
+		opts     []HandlerOption
+		wantMeta map[string]string
+	}{
+		{
+			name:     "mutated",
+			mutator:  &testutil.HelloMutator{MutatorName: "hello"},
+			opts:     []HandlerOption{WithParsedJobMutation()},
+			wantMeta: map[string]string{"hello": "world"},
+		},
+		{
+			name:    "disabled",
+			mutator: &testutil.HelloMutator{MutatorName: "hello"},
+		},
+		{
+			name:    "failing mutator returns the parsed job",
+			mutator: failing,
+			opts:    []HandlerOption{WithParsedJobMutation()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/v1/jobs/parse", req.URL.Path)
+				rw.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(rw).Encode(&api.Job{ID: pointer.Of("example")})
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{tt.mutator}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, tt.opts...)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			body := `{"JobHCL": "job \"example\" {}", "Canonicalize": true}`
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs/parse", strings.NewReader(body))
+			require.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			job := &api.Job{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(job))
+			assert.Equal(t, "example", *job.ID)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+		})
+	}
+}
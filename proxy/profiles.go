@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+)
+
+// controllerSet holds the controllers created from the enabled ones of the config, in config order,
+// and the ones added around them.
+type controllerSet struct {
+	mutators   []admissionctrl.JobMutator
+	validators []admissionctrl.JobValidator
+	// extraMutators and extraValidators apply to every profile, after the configured ones.
+	extraMutators   []admissionctrl.JobMutator
+	extraValidators []admissionctrl.JobValidator
+}
+
+// close releases the configured controllers, the extra ones belong to the caller of the server.
+func (s *controllerSet) close() {
+	for _, m := range s.mutators {
+		admissionctrl.CloseController(m)
+	}
+	for _, v := range s.validators {
+		admissionctrl.CloseController(v)
+	}
+}
+
+// selectControllers returns the configured controllers the include funcs accept, keeping their order.
+func (s *controllerSet) selectControllers(c *config.Config, includeMutator func(string) bool, includeValidator func(string) bool) ([]admissionctrl.JobMutator, []admissionctrl.JobValidator) {
+	var mutators []admissionctrl.JobMutator
+	i := 0
+	for _, m := range c.Mutators {
+		if !m.IsEnabled() {
+			continue
+		}
+		if includeMutator(m.Name) {
+			mutators = append(mutators, s.mutators[i])
+		}
+		i++
+	}
+	var validators []admissionctrl.JobValidator
+	i = 0
+	for _, v := range c.Validators {
+		if !v.IsEnabled() {
+			continue
+		}
+		if includeValidator(v.Name) {
+			validators = append(validators, s.validators[i])
+		}
+		i++
+	}
+	return append(mutators, s.extraMutators...), append(validators, s.extraValidators...)
+}
+
+// profileOptions splits the controllers into the ones of the handler, which are referenced by
+// no profile, and the profiles, which combine them with their own.
+func profileOptions(c *config.Config, s *controllerSet) ([]admissionctrl.JobMutator, []admissionctrl.JobValidator, []admissionctrl.JobHandlerOption) {
+	profiledMutators := map[string]bool{}
+	profiledValidators := map[string]bool{}
+	for _, p := range c.Profiles {
+		for _, name := range p.Mutators {
+			profiledMutators[name] = true
+		}
+		for _, name := range p.Validators {
+			profiledValidators[name] = true
+		}
+	}
+	shared := func(profiled map[string]bool) func(string) bool {
+		return func(name string) bool { return !profiled[name] }
+	}
+	mutators, validators := s.selectControllers(c, shared(profiledMutators), shared(profiledValidators))
+	if len(c.Profiles) == 0 {
+		return mutators, validators, nil
+	}
+
+	var profiles []*admissionctrl.Profile
+	namespaces := map[string]string{}
+	for _, p := range c.Profiles {
+		own := func(names []string, profiled map[string]bool) func(string) bool {
+			return func(name string) bool { return !profiled[name] || contains(names, name) }
+		}
+		profile := &admissionctrl.Profile{Name: p.Name}
+		profile.Mutators, profile.Validators = s.selectControllers(c, own(p.Mutators, profiledMutators), own(p.Validators, profiledValidators))
+		profiles = append(profiles, profile)
+		for _, namespace := range p.Namespaces {
+			namespaces[namespace] = p.Name
+		}
+	}
+	return mutators, validators, []admissionctrl.JobHandlerOption{admissionctrl.WithProfiles(profiles, namespaces, c.DefaultProfile)}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHandlerProfiles(t *testing.T) {
+	metaMutator := func(name string) config.Mutator {
+		return config.Mutator{Type: "meta_defaults", Name: name, MetaDefaults: &config.MetaDefaults{Meta: map[string]string{name: "true"}}}
+	}
+	c := config.DefaultConfig()
+	c.Mutators = []config.Mutator{metaMutator("strict"), metaMutator("shared"), metaMutator("lenient")}
+	c.Identity = &config.Identity{StampOwner: true}
+	c.Profiles = []*config.Profile{
+		{Name: "strict", Namespaces: []string{"prod"}, Mutators: []string{"strict"}},
+		{Name: "lenient", Namespaces: []string{"dev"}, Mutators: []string{"lenient"}},
+	}
+	c.DefaultProfile = "lenient"
+	require.NoError(t, c.Validate())
+
+	handler, err := NewJobHandler(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	tests := []struct {
+		namespace    string
+		wantProfile  string
+		wantMutators []string
+	}{
+		{namespace: "prod", wantProfile: "strict", wantMutators: []string{"strict", "shared", "nacp_owner"}},
+		{namespace: "dev", wantProfile: "lenient", wantMutators: []string{"shared", "lenient", "nacp_owner"}},
+		{namespace: "team-a", wantProfile: "lenient", wantMutators: []string{"shared", "lenient", "nacp_owner"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			req := &admissionctrl.Request{Namespace: tt.namespace}
+			job, _, err := handler.ApplyAdmissionControllers(admissionctrl.WithRequest(context.Background(), req), &api.Job{ID: pointer.Of("example")})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantProfile, req.Profile)
+			assert.Equal(t, tt.wantMutators, req.Mutators)
+			for _, name := range tt.wantMutators[:len(tt.wantMutators)-1] {
+				assert.Equal(t, "true", job.Meta[name])
+			}
+		})
+	}
+}
+
+func TestJobHandlerProfilesSkipDisabledControllers(t *testing.T) {
+	metaMutator := func(name string) config.Mutator {
+		return config.Mutator{Type: "meta_defaults", Name: name, MetaDefaults: &config.MetaDefaults{Meta: map[string]string{name: "true"}}}
+	}
+	c := config.DefaultConfig()
+	c.Mutators = []config.Mutator{metaMutator("disabled"), metaMutator("shared"), metaMutator("strict")}
+	c.Mutators[0].Enabled = pointer.Of(false)
+	c.Profiles = []*config.Profile{
+		{Name: "strict", Namespaces: []string{"prod"}, Mutators: []string{"strict", "disabled"}},
+	}
+	require.NoError(t, c.Validate())
+
+	handler, err := NewJobHandler(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	req := &admissionctrl.Request{Namespace: "prod"}
+	job, _, err := handler.ApplyAdmissionControllers(admissionctrl.WithRequest(context.Background(), req), &api.Job{ID: pointer.Of("example")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shared", "strict"}, req.Mutators)
+	assert.NotContains(t, job.Meta, "disabled")
+}
@@ -0,0 +1,937 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+type contextKeyWarnings struct{}
+type contextKeyValidationError struct{}
+type contextKeyToken struct{}
+type contextKeyJobFetcher struct{}
+type contextKeyClientIP struct{}
+
+var (
+	ctxWarnings        = contextKeyWarnings{}
+	ctxValidationError = contextKeyValidationError{}
+	ctxToken           = contextKeyToken{}
+	ctxJobFetcher      = contextKeyJobFetcher{}
+	ctxClientIP        = contextKeyClientIP{}
+	jobPathRegex       = regexp.MustCompile(`^/v1/job/[a-zA-Z]+[a-z-Z0-9\-]*$`)
+	jobPlanPathRegex   = regexp.MustCompile(`^/v1/job/[a-zA-Z]+[a-z-Z0-9\-]*/plan$`)
+)
+
+// errMissingJob rejects job submissions without a job.
+var errMissingJob = errors.New("request does not contain a job")
+
+// errInvalidBody rejects requests whose body is not the expected JSON.
+var errInvalidBody = errors.New("failed to parse the request body as JSON")
+
+// decodeBody decodes the JSON body into v. Malformed bodies are wrapped in
+// errInvalidBody, other errors like exceeding the maximum size are returned as is.
+func decodeBody(body io.Reader, v interface{}) error {
+	err := json.NewDecoder(body).Decode(v)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %s", errInvalidBody, err)
+	}
+	return err
+}
+
+// HandlerOption configures optional behaviour of the proxy handler.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	hideRuleSource        bool
+	ruleSourceReplacement string
+	resolveToken          TokenResolver
+	mutationDiff          bool
+	mutationDiffHeader    bool
+	maxBodySize           int64
+	rateLimiter           *RateLimiter
+	accessPolicy          *AccessPolicy
+	cors                  *CORSPolicy
+	audit                 *AuditLog
+	recent                *RecentDecisions
+	warningDigest         bool
+	collapseWarnings      bool
+	skipWarningInjection  bool
+	regions               map[string]regionBackend
+	trustedProxies        []*net.IPNet
+	mutateParsedJobs      bool
+	blockingQueryTimeout  time.Duration
+	requestTimeout        time.Duration
+	nomadToken            string
+	warningTrailers       bool
+	readiness             *Readiness
+	skipValidateMutation  bool
+}
+
+// DefaultMaxBodySize is the default limit of job submissions and decoded responses.
+const DefaultMaxBodySize int64 = 10 * 1024 * 1024
+
+// WithMaxBodySize limits the size of job submissions and the Nomad responses
+// decoded by the proxy. Larger submissions are rejected with 413.
+func WithMaxBodySize(size int64) HandlerOption {
+	return func(o *handlerOptions) {
+		o.maxBodySize = size
+	}
+}
+
+// TokenResolver looks up the ACL token of a secret id.
+type TokenResolver func(secretID string) (*api.ACLToken, error)
+
+// WithTokenResolver resolves the token of every job submission and passes it on
+// to the admission controllers.
+func WithTokenResolver(resolver TokenResolver) HandlerOption {
+	return func(o *handlerOptions) {
+		o.resolveToken = resolver
+	}
+}
+
+// WithHiddenRuleSource strips the rule annotation from messages returned to
+// the client, or replaces it with replacement if that is not empty.
+// The server logs keep the full message.
+func WithHiddenRuleSource(replacement string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.hideRuleSource = true
+		o.ruleSourceReplacement = replacement
+	}
+}
+
+// NewHandler creates the handler proxying requests to Nomad and applying the admission controllers to job submissions.
+func NewHandler(nomadAddress *url.URL, jobHandler *admissionctrl.JobHandler, appLogger hclog.Logger, transport *http.Transport, opts ...HandlerOption) func(http.ResponseWriter, *http.Request) {
+
+	options := &handlerOptions{maxBodySize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	modifyResponse := func(resp *http.Response) error {
+		logger := admissionctrl.Logger(resp.Request.Context(), appLogger)
+
+		var err error
+
+		if isBlockingQuery(resp.Request) {
+			return nil
+		}
+		if !isSuccess(resp) {
+			// pass Nomad's error through as is, it may not even be JSON
+			return nil
+		}
+		setMutationsHeader(resp)
+		if options.keepsResponse(resp.Request, logger) {
+			options.setWarningTrailers(resp)
+			return nil
+		}
+		if isRegister(resp.Request) || isRevert(resp.Request) {
+			err = handRegisterResponse(resp, logger, options)
+		} else if isPlan(resp.Request) {
+			err = handleJobPlanResponse(resp, logger, options)
+		} else if isValidate(resp.Request) {
+			err = handleJobValdidateResponse(resp, logger, options)
+		} else if isParse(resp.Request) {
+			err = handleParseResponse(resp, logger, jobHandler, options)
+		}
+		if err != nil {
+			logger.Error("Preparing response failed", "error", err)
+			return &responseError{err}
+		}
+		options.setWarningTrailers(resp)
+
+		return nil
+	}
+
+	router := &backendRouter{
+		fallback: newBackend(nomadAddress, transport, modifyResponse, appLogger, options),
+		regions:  map[string]*backend{},
+	}
+	for region, b := range options.regions {
+		router.regions[region] = newBackend(b.address, b.transport, modifyResponse, appLogger, options)
+	}
+	if options.readiness != nil {
+		options.readiness.setBackend(nomadAddress, router.fallback.proxy.Transport)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, logger := withRequestID(w, r, appLogger)
+		r = options.withClientIP(r)
+
+		logger.Info("Request received", "path", r.URL.Path, "method", r.Method)
+		r, span := startRequestSpan(r)
+		defer span.End()
+		if options.cors != nil && options.cors.handle(w, r) {
+			return
+		}
+		if options.accessPolicy != nil && !options.accessPolicy.allows(r) {
+			logger.Warn("Request denied by access policy", "path", r.URL.Path, "method", r.Method)
+			http.Error(w, fmt.Sprintf("%s %s is not allowed by NACP", r.Method, r.URL.Path), http.StatusForbidden)
+			return
+		}
+		backend := router.route(r)
+
+		if isBlockingQuery(r) {
+			// blocking queries long-poll until Nomad answers, stream them through untouched
+			backend.proxy.ServeHTTP(w, r)
+			return
+		}
+
+		r, cancel := options.withRequestTimeout(r)
+		defer cancel()
+
+		// lets the admission controllers look up the registered job at this backend
+		r = r.WithContext(context.WithValue(r.Context(), ctxJobFetcher, backend.jobs))
+
+		var err error
+		//var err error
+		intercepted := isRegister(r) || isPlan(r) || isRevert(r) || isValidate(r) || isNacpValidate(r) || isNacpMutate(r) || isNacpCheck(r)
+		if intercepted && options.maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, options.maxBodySize)
+		}
+		if intercepted {
+			if err := decompressRequest(w, r, options.maxBodySize); err != nil {
+				logger.Warn("Failed decompressing request", "error", err)
+				http.Error(w, fmt.Sprintf("invalid gzip body: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if options.resolveToken != nil && intercepted {
+			r = resolveRequestToken(r, options.resolveToken, logger)
+		}
+		if intercepted && options.rateLimiter != nil {
+			if ok, retryAfter := options.rateLimiter.allow(r); !ok {
+				logger.Warn("Rate limit exceeded", "path", r.URL.Path, "retry_after", retryAfter)
+				writeRateLimited(w, retryAfter)
+				return
+			}
+		}
+		if isNacpMetrics(r) {
+			metricsHandler.ServeHTTP(w, r)
+			return
+		}
+		if options.recent != nil && isNacpRecent(r) {
+			serveRecent(w, options.recent)
+			return
+		}
+		if isNacpVersion(r) {
+			serveVersion(w)
+			return
+		}
+		if options.readiness != nil && isNacpReady(r) {
+			serveReady(w, r, options.readiness)
+			return
+		}
+		if isNacpOpenAPI(r) {
+			serveOpenAPI(w, logger)
+			return
+		}
+		if isNacpValidate(r) {
+			handleNacpValidate(w, r, logger, jobHandler, options)
+			return
+		}
+		if isNacpMutate(r) {
+			handleNacpMutate(w, r, logger, jobHandler, options)
+			return
+		}
+		if isNacpCheck(r) {
+			handleNacpCheck(w, r, logger, jobHandler, backend.plan, options)
+			return
+		}
+		if isRegister(r) {
+			r, err = handleRegister(r, logger, jobHandler, options)
+
+		} else if isPlan(r) {
+
+			r, err = handlePlan(r, logger, jobHandler, options)
+
+		} else if isValidate(r) {
+			r, err = handleValidate(r, logger, jobHandler, options)
+
+		} else if isRevert(r) {
+			r, err = handleRevert(r, logger, jobHandler, backend.versions, options)
+		}
+		if err != nil && isRequestTimeout(r) {
+			logger.Warn("Request exceeded the request timeout", "path", r.URL.Path, "timeout", options.requestTimeout, "error", err)
+			options.writeRequestTimeout(w)
+		} else if err != nil {
+			logAdmissionError(logger, err)
+			writeError(w, options.userFacing(err))
+
+		} else {
+			backend.proxy.ServeHTTP(w, options.userFacingContext(r))
+		}
+
+	}
+
+}
+
+// logAdmissionError logs failing admission controllers as errors, while
+// rejections by policies are expected and only logged as info.
+func logAdmissionError(appLogger hclog.Logger, err error) {
+	if errors.Is(err, errInvalidBody) {
+		appLogger.Info("Rejected request with a malformed body", "error", err)
+		return
+	}
+	var failed, denied []string
+	for _, e := range flattenErrors(err) {
+		var controllerErr *admissionctrl.ControllerError
+		if !errors.As(e, &controllerErr) {
+			continue
+		}
+		if errors.Is(controllerErr, admissionctrl.ErrControllerFailure) {
+			failed = append(failed, controllerErr.Controller)
+		} else {
+			denied = append(denied, controllerErr.Controller)
+		}
+	}
+	switch {
+	case len(failed) > 0:
+		appLogger.Error("Admission controller failed", "controllers", failed, "denied_by", denied, "error", err)
+	case len(denied) > 0:
+		appLogger.Info("Job denied by policy", "rules", denied, "error", err)
+	default:
+		appLogger.Warn("Error applying admission controllers", "error", err)
+	}
+}
+
+// userFacing returns err as it should be presented to the client.
+func (o *handlerOptions) userFacing(err error) error {
+	if !o.hideRuleSource || err == nil {
+		return err
+	}
+	if merr, ok := err.(*multierror.Error); ok {
+		redacted := &multierror.Error{ErrorFormat: merr.ErrorFormat}
+		for _, e := range merr.Errors {
+			redacted = multierror.Append(redacted, o.userFacing(e))
+		}
+		return redacted
+	}
+	messages := ruleMessages(err)
+	if len(messages) == 0 {
+		return err
+	}
+	msg := err.Error()
+	for _, m := range messages {
+		redacted := m.Msg
+		if o.ruleSourceReplacement != "" {
+			redacted = fmt.Sprintf("%s (%s)", m.Msg, o.ruleSourceReplacement)
+		}
+		msg = strings.ReplaceAll(msg, m.Error(), redacted)
+	}
+	return errors.New(msg)
+}
+
+// userFacingContext applies userFacing to the warnings and validation error
+// which are attached to the response later on.
+func (o *handlerOptions) userFacingContext(r *http.Request) *http.Request {
+	if !o.hideRuleSource {
+		return r
+	}
+	ctx := r.Context()
+	if warnings, ok := ctx.Value(ctxWarnings).([]error); ok {
+		redacted := make([]error, 0, len(warnings))
+		for _, w := range warnings {
+			redacted = append(redacted, o.userFacing(w))
+		}
+		ctx = context.WithValue(ctx, ctxWarnings, redacted)
+	}
+	if validationErr, ok := ctx.Value(ctxValidationError).(error); ok {
+		ctx = context.WithValue(ctx, ctxValidationError, o.userFacing(validationErr))
+	}
+	return r.WithContext(ctx)
+}
+
+func ruleMessages(err error) []*admissionctrl.RuleMessage {
+	switch e := err.(type) {
+	case *admissionctrl.RuleMessage:
+		return []*admissionctrl.RuleMessage{e}
+	case *multierror.Error:
+		var messages []*admissionctrl.RuleMessage
+		for _, inner := range e.Errors {
+			messages = append(messages, ruleMessages(inner)...)
+		}
+		return messages
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		return ruleMessages(inner)
+	}
+	return nil
+}
+
+// resolveRequestToken attaches the ACL token of the request secret to the request context.
+func resolveRequestToken(r *http.Request, resolve TokenResolver, appLogger hclog.Logger) *http.Request {
+	secretID := requestSecretID(r)
+	if secretID == "" {
+		return r
+	}
+	token, err := resolve(secretID)
+	if err != nil {
+		appLogger.Debug("Could not resolve request token", "error", err)
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxToken, token))
+}
+
+// requestSecretID returns the Nomad token of the request, sent either
+// as X-Nomad-Token header or as bearer token.
+func requestSecretID(r *http.Request) string {
+	if token := r.Header.Get("X-Nomad-Token"); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// regionHeader selects the region like the region query parameter.
+const regionHeader = "X-Nomad-Region"
+
+// requestRegion returns the region a request is sent to, the region query
+// parameter takes precedence over the X-Nomad-Region header.
+func requestRegion(r *http.Request) string {
+	if region := r.URL.Query().Get("region"); region != "" {
+		return region
+	}
+	return r.Header.Get(regionHeader)
+}
+
+// resolveRegion returns the region a job submission targets, the region of
+// the request falling back to the region set in the job body.
+func resolveRegion(r *http.Request, job *api.Job) string {
+	if region := requestRegion(r); region != "" {
+		return region
+	}
+	if job != nil && job.Region != nil {
+		return *job.Region
+	}
+	return ""
+}
+
+// admissionContext returns the context the admission controllers are applied with.
+func admissionContext(r *http.Request, job *api.Job) context.Context {
+	token, _ := r.Context().Value(ctxToken).(*api.ACLToken)
+	req := &admissionctrl.Request{
+		Namespace:         resolveNamespace(r, job),
+		ExplicitNamespace: r.URL.Query().Get("namespace") != "" || (job != nil && job.Namespace != nil && *job.Namespace != ""),
+		Token:             token,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Operation:         operation(r),
+		Region:            resolveRegion(r, job),
+		ClientIP:          clientIP(r),
+	}
+	if fetch, ok := r.Context().Value(ctxJobFetcher).(jobFetcher); ok && job != nil && job.ID != nil {
+		jobID := *job.ID
+		req.SetCurrentJobLookup(func(ctx context.Context) (*api.Job, error) {
+			// mutators may have routed the job to another namespace
+			return fetch(ctx, r, jobID, req.Namespace)
+		})
+	}
+	return admissionctrl.WithRequest(r.Context(), req)
+}
+
+func operation(r *http.Request) string {
+	switch {
+	case isCreate(r):
+		return admissionctrl.OperationCreate
+	case isUpdate(r):
+		return admissionctrl.OperationUpdate
+	case isPlan(r):
+		return admissionctrl.OperationPlan
+	case isRevert(r):
+		return admissionctrl.OperationRevert
+	case isValidate(r), isNacpValidate(r), isNacpCheck(r):
+		return admissionctrl.OperationValidate
+	}
+	return ""
+}
+
+// clientIP is the address of the client sending the request, as forwarded by trusted proxies.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxClientIP).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// remoteIP is the address of the peer sending the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func handRegisterResponse(resp *http.Response, appLogger hclog.Logger, options *handlerOptions) error {
+
+	warnings, ok := resp.Request.Context().Value(ctxWarnings).([]error)
+	if !ok && len(warnings) == 0 {
+		return nil
+	}
+
+	response := &api.JobRegisterResponse{}
+	reader := resp.Body
+
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, reader, options.maxBodySize)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := json.NewDecoder(reader).Decode(response); err != nil {
+		return err
+	}
+	appLogger.Info("Job after admission controllers", "job", response.JobModifyIndex)
+
+	response.Warnings = options.mergeWarnings(response.Warnings, warnings)
+
+	responeData, err := json.Marshal(response)
+
+	if err != nil {
+		return err
+	}
+
+	if isGzip {
+		rewriteResponseGzip(resp, responeData)
+	} else {
+		rewriteResponse(resp, responeData)
+	}
+
+	return nil
+}
+
+// decompressRequest replaces a gzip encoded request body with its decompressed content,
+// which is limited to maxSize bytes as well. The body is forwarded uncompressed.
+func decompressRequest(w http.ResponseWriter, r *http.Request, maxSize int64) error {
+	if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	gzipReader, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = gzipReader
+	if maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, gzipReader, maxSize)
+	}
+	r.Header.Del("Content-Encoding")
+	r.ContentLength = -1
+	return nil
+}
+
+// checkIfGzipAndTransformReader returns a reader of the decompressed body,
+// failing once more than maxSize bytes are read.
+func checkIfGzipAndTransformReader(resp *http.Response, reader io.ReadCloser, maxSize int64) (bool, io.ReadCloser, error) {
+	enc := resp.Header.Get("Content-Encoding")
+	isGzip := strings.EqualFold(enc, "gzip")
+	if isGzip {
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return false, nil, err
+		}
+
+		reader = gzipReader
+	}
+	if maxSize > 0 {
+		reader = http.MaxBytesReader(nil, reader, maxSize)
+	}
+	return isGzip, reader, nil
+}
+func handleJobPlanResponse(resp *http.Response, appLogger hclog.Logger, options *handlerOptions) error {
+	warnings, ok := resp.Request.Context().Value(ctxWarnings).([]error)
+	if !ok && len(warnings) == 0 {
+		return nil
+	}
+
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body, options.maxBodySize)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	// the plan is kept as sent by Nomad, decoding it into api.JobPlanResponse
+	// would drop the fields of the diff our api version doesn't know
+	responeData, err := replaceWarnings(data, func(upstream string) string {
+		return options.mergeWarnings(upstream, warnings)
+	})
+	if err != nil {
+		return err
+	}
+	appLogger.Info("Job plan after admission controllers", "warnings", len(warnings))
+
+	if isGzip {
+		rewriteResponseGzip(resp, responeData)
+	} else {
+		rewriteResponse(resp, responeData)
+	}
+	return nil
+}
+func handleJobValdidateResponse(resp *http.Response, appLogger hclog.Logger, options *handlerOptions) error {
+
+	ctx := resp.Request.Context()
+	validationErr, okErr := ctx.Value(ctxValidationError).(error)
+	warnings, okWarnings := resp.Request.Context().Value(ctxWarnings).([]error)
+	if !okErr && !okWarnings {
+		return nil
+	}
+
+	response := &api.JobValidateResponse{}
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body, options.maxBodySize)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(response); err != nil {
+		return err
+	}
+
+	if validationErr != nil {
+		validationErrors := []string{}
+		var validationError string
+		if merr, ok := validationErr.(*multierror.Error); ok {
+			for _, err := range merr.Errors {
+				validationErrors = append(validationErrors, err.Error())
+			}
+			validationError = merr.Error()
+		} else {
+			validationErrors = append(validationErrors, validationErr.Error())
+			validationError = validationErr.Error()
+		}
+
+		response.ValidationErrors = validationErrors
+		response.Error = validationError
+	}
+
+	if len(warnings) > 0 {
+		response.Warnings = options.mergeWarnings(response.Warnings, warnings)
+	}
+
+	responeData, err := json.Marshal(response)
+
+	if err != nil {
+		appLogger.Error("Error marshalling job", "error", err)
+		return err
+	}
+
+	if isGzip {
+		rewriteResponseGzip(resp, responeData)
+	} else {
+		rewriteResponse(resp, responeData)
+	}
+
+	return nil
+}
+
+// buildFullWarningMsg joins Nomad's and the admission controllers' warnings,
+// sorted and without duplicates.
+func buildFullWarningMsg(upstreamResponseWarnings string, warnings []error) string {
+	var messages []string
+	if upstreamResponseWarnings != "" {
+		messages = append(messages, upstreamResponseWarnings)
+	}
+	for _, w := range warnings {
+		for _, e := range flattenErrors(w) {
+			messages = append(messages, e.Error())
+		}
+	}
+	sort.Strings(messages)
+
+	allWarnings := &multierror.Error{}
+	for i, msg := range messages {
+		if i > 0 && msg == messages[i-1] {
+			continue
+		}
+		allWarnings = multierror.Append(allWarnings, errors.New(msg))
+	}
+	warningMsg := helper.MergeMultierrorWarnings(allWarnings)
+	return warningMsg
+}
+
+// replaceWarnings replaces the Warnings of a JSON response with the merged warnings,
+// the other fields are copied as they are.
+func replaceWarnings(data []byte, merge func(upstream string) string) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var upstream string
+	if raw, ok := fields["Warnings"]; ok {
+		if err := json.Unmarshal(raw, &upstream); err != nil {
+			return nil, err
+		}
+	}
+	warnings, err := json.Marshal(merge(upstream))
+	if err != nil {
+		return nil, err
+	}
+	fields["Warnings"] = warnings
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(fields); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func rewriteResponse(resp *http.Response, newResponeData []byte) {
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(newResponeData)))
+
+	resp.ContentLength = int64(len(newResponeData))
+	resp.Body = io.NopCloser(bytes.NewBuffer(newResponeData))
+}
+func rewriteResponseGzip(resp *http.Response, newResponeData []byte) {
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(newResponeData)
+	gz.Close()
+
+	resp.Header.Set("Content-Length", strconv.Itoa(compressed.Len()))
+	resp.ContentLength = int64(compressed.Len())
+
+	resp.Body = io.NopCloser(&compressed)
+}
+
+// rewriteRequest replaces the body of r. The url, method and headers are kept,
+// only the framing of the original body is dropped as it no longer applies.
+func rewriteRequest(r *http.Request, data []byte) {
+
+	r.ContentLength = int64(len(data))
+	r.Body = io.NopCloser(bytes.NewBuffer(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.TransferEncoding = nil
+	r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+}
+
+func handleRegister(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) (*http.Request, error) {
+	body := r.Body
+	jobRegisterRequest := &api.JobRegisterRequest{}
+
+	if err := decodeBody(body, jobRegisterRequest); err != nil {
+		return r, fmt.Errorf("failed decoding job, skipping admission controller: %w", err)
+	}
+	if jobRegisterRequest.Job == nil {
+		return r, errMissingJob
+	}
+	orginalJob := jobRegisterRequest.Job
+	snapshot := options.snapshotJob(orginalJob)
+
+	admissionCtx := admissionContext(r, orginalJob)
+	job, warnings, err := jobHandler.ApplyAdmissionControllers(admissionCtx, orginalJob)
+	options.auditDecision(admissionCtx, orginalJob, warnings, err)
+	if err != nil {
+		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
+	}
+	jobRegisterRequest.Job = job
+	r = options.recordMutationDiff(r, appLogger, snapshot, job)
+
+	data, err := json.Marshal(jobRegisterRequest)
+
+	if err != nil {
+		return r, fmt.Errorf("error marshalling job: %w", err)
+	}
+
+	ctx := r.Context()
+	if len(warnings) > 0 {
+		ctx = context.WithValue(ctx, ctxWarnings, warnings)
+	}
+
+	appLogger.Info("Job after admission controllers", "job", string(data))
+	r = r.WithContext(ctx)
+	rewriteRequest(r, data)
+	return r, nil
+}
+func handlePlan(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) (*http.Request, error) {
+	body := r.Body
+	jobPlanRequest := &api.JobPlanRequest{}
+
+	if err := decodeBody(body, jobPlanRequest); err != nil {
+		return r, fmt.Errorf("failed decoding job, skipping admission controller: %w", err)
+	}
+	if jobPlanRequest.Job == nil {
+		return r, errMissingJob
+	}
+	orginalJob := jobPlanRequest.Job
+	snapshot := options.snapshotJob(orginalJob)
+
+	admissionCtx := admissionContext(r, orginalJob)
+	job, warnings, err := jobHandler.ApplyAdmissionControllers(admissionCtx, orginalJob)
+	options.auditDecision(admissionCtx, orginalJob, warnings, err)
+	if err != nil {
+		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
+	}
+
+	jobPlanRequest.Job = job
+	r = options.recordMutationDiff(r, appLogger, snapshot, job)
+
+	data, err := json.Marshal(jobPlanRequest)
+
+	if err != nil {
+		return r, fmt.Errorf("error marshalling job: %w", err)
+	}
+	ctx := r.Context()
+	if len(warnings) > 0 {
+		ctx = context.WithValue(ctx, ctxWarnings, warnings)
+
+	}
+	r = r.WithContext(ctx)
+	appLogger.Info("Job after admission controllers", "job", string(data))
+	rewriteRequest(r, data)
+	return r, nil
+}
+
+// WithoutValidateMutation validates the jobs of /v1/validate/job as submitted, without applying the mutators.
+// Users see the errors of what they wrote, but jobs relying on mutators to complete them fail
+// validation even though their registration would pass.
+func WithoutValidateMutation() HandlerOption {
+	return func(o *handlerOptions) {
+		o.skipValidateMutation = true
+	}
+}
+
+func handleValidate(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) (*http.Request, error) {
+
+	body := r.Body
+	jobValidateRequest := &api.JobValidateRequest{}
+	err := decodeBody(body, jobValidateRequest)
+	if err != nil {
+		return r, err
+	}
+	if jobValidateRequest.Job == nil {
+		return r, errMissingJob
+	}
+	job := jobValidateRequest.Job
+	admissionCtx := admissionContext(r, job)
+
+	var validateWarnings []error
+	var validationErr error
+	if options.skipValidateMutation {
+		// Nomad validates the job as submitted too
+		validateWarnings, validationErr = jobHandler.AdmissionValidators(admissionCtx, job)
+	} else {
+		snapshot := options.snapshotJob(job)
+		job, validateWarnings, validationErr, err = jobHandler.MutateAndValidate(admissionCtx, job)
+		if err != nil {
+			options.auditDecision(admissionCtx, jobValidateRequest.Job, nil, err)
+			return r, err
+		}
+		jobValidateRequest.Job = job
+		r = options.recordMutationDiff(r, appLogger, snapshot, job)
+	}
+
+	options.auditDecision(admissionCtx, job, validateWarnings, validationErr)
+	//copied from https: //github.com/hashicorp/nomad/blob/v1.5.0/nomad/job_endpoint.go#L574
+
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, ctxValidationError, validationErr)
+
+	data, err := json.Marshal(jobValidateRequest)
+	if err != nil {
+		return r, err
+	}
+
+	if len(validateWarnings) > 0 {
+		ctx = context.WithValue(ctx, ctxWarnings, validateWarnings)
+
+	}
+	r = r.WithContext(ctx)
+	rewriteRequest(r, data)
+	return r, nil
+
+}
+
+// resolveNamespace returns the namespace a job submission targets.
+// Like Nomad, the namespace query parameter takes precedence over the
+// namespace set in the job body, falling back to the default namespace.
+func resolveNamespace(r *http.Request, job *api.Job) string {
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		return namespace
+	}
+	if job != nil && job.Namespace != nil && *job.Namespace != "" {
+		return *job.Namespace
+	}
+	return api.DefaultNamespace
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("job submission exceeds the maximum size of %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, errMissingJob) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errInvalidBody) {
+		http.Error(w, errInvalidBody.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(err.Error()))
+}
+func isRegister(r *http.Request) bool {
+	isRegister := isCreate(r) || isUpdate(r)
+	return isRegister
+}
+
+func isCreate(r *http.Request) bool {
+	return r.Method == "PUT" && r.URL.Path == "/v1/jobs"
+}
+func isUpdate(r *http.Request) bool {
+
+	return r.Method == "PUT" && jobPathRegex.MatchString(r.URL.Path)
+}
+func isPlan(r *http.Request) bool {
+
+	return r.Method == "PUT" && jobPlanPathRegex.MatchString(r.URL.Path)
+}
+
+// isSuccess reports whether Nomad answered with a 2xx status.
+func isSuccess(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// isBlockingQuery reports whether the request is a Nomad blocking query,
+// a read waiting for changes after the given index.
+func isBlockingQuery(r *http.Request) bool {
+	return (r.Method == "GET" || r.Method == "HEAD") && r.URL.Query().Has("index")
+}
+
+func isValidate(r *http.Request) bool {
+
+	return r.Method == "PUT" && r.URL.Path == "/v1/validate/job"
+}
@@ -0,0 +1,1373 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rewrite the test above as table driven test
+func TestProxy(t *testing.T) {
+
+	type test struct {
+		name   string
+		path   string
+		method string
+
+		requestSender         func(*api.Client) (interface{}, *api.WriteMeta, error)
+		wantNomadRequestJson  string
+		wantProxyResponse     interface{}
+		nomadResponse         string
+		nomadResponseEncoding string
+		//	responseWarnings []error
+		validators []admissionctrl.JobValidator
+		mutators   []admissionctrl.JobMutator
+	}
+
+	tests := []test{
+
+		{
+			name:   "create job adds hello meta",
+			path:   "/v1/jobs",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+			},
+			wantNomadRequestJson: registerRequestJson(t, jobWithHelloWorldMeta(t)),
+
+			wantProxyResponse: &api.JobRegisterResponse{},
+
+			nomadResponse: toJson(t, &api.JobRegisterResponse{}),
+			validators:    []admissionctrl.JobValidator{},
+			mutators: []admissionctrl.JobMutator{
+				&testutil.HelloMutator{},
+			},
+		},
+
+		{
+			name:   "plan job adds hello meta",
+			path:   "/v1/job/example/plan",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Plan(testutil.ReadJob(t, "job.json"), false, nil)
+			},
+
+			wantNomadRequestJson: planRequestJson(t, jobWithHelloWorldMeta(t)),
+
+			wantProxyResponse: &api.JobPlanResponse{},
+
+			nomadResponse: toJson(t, &api.JobPlanResponse{}),
+
+			validators: []admissionctrl.JobValidator{},
+			mutators: []admissionctrl.JobMutator{
+				&testutil.HelloMutator{},
+			},
+		},
+		{
+			name:   "plan job appends warning",
+			path:   "/v1/job/example/plan",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Plan(testutil.ReadJob(t, "job.json"), false, nil)
+			},
+
+			wantNomadRequestJson: planRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobPlanResponse{
+				// TODO: rework error concatination
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobPlanResponse{
+				Warnings: multierror.Append(nil, fmt.Errorf("some warning")).Error(),
+			}),
+
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "plan job appends warning with gzip encoding",
+			path:   "/v1/job/example/plan",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Plan(testutil.ReadJob(t, "job.json"), false, nil)
+			},
+
+			wantNomadRequestJson: planRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobPlanResponse{
+				// TODO: rework error concatination
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobPlanResponse{
+				Warnings: multierror.Append(nil, fmt.Errorf("some warning")).Error(),
+			}),
+			nomadResponseEncoding: "gzip",
+
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "create job adds warnings",
+			path:   "/v1/jobs",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+			},
+
+			wantNomadRequestJson: registerRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobRegisterResponse{
+				Warnings: "1 warning:\n\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobRegisterResponse{}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "create job concats warnings",
+			path:   "/v1/jobs",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+			},
+
+			wantNomadRequestJson: registerRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobRegisterResponse{
+				// TODO: rework error concatination
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobRegisterResponse{
+				Warnings: multierror.Append(nil, fmt.Errorf("some warning")).Error(),
+			}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "create job concats warnings if encoding is gzip",
+			path:   "/v1/jobs",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+			},
+
+			wantNomadRequestJson: registerRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobRegisterResponse{
+				// TODO: rework error concatination
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobRegisterResponse{
+				Warnings: multierror.Append(nil, fmt.Errorf("some warning")).Error(),
+			}),
+			nomadResponseEncoding: "gzip",
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "plan job adds warnings",
+			path:   "/v1/job/example/plan",
+			method: "PUT",
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Plan(testutil.ReadJob(t, "job.json"), false, nil)
+			},
+
+			wantNomadRequestJson: planRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobPlanResponse{
+				Warnings: "1 warning:\n\n* some warning",
+			},
+
+			nomadResponse: toJson(t, &api.JobPlanResponse{}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "validate job adds hello meta",
+			path:   "/v1/validate/job",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Validate(testutil.ReadJob(t, "job.json"), nil)
+			},
+			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: jobWithHelloWorldMeta(t)}),
+
+			wantProxyResponse: &api.JobValidateResponse{},
+
+			nomadResponse: toJson(t, &api.JobValidateResponse{}),
+			validators:    []admissionctrl.JobValidator{},
+			mutators: []admissionctrl.JobMutator{
+				&testutil.HelloMutator{},
+			},
+		},
+		{
+			name:   "validate job appends warnings",
+			path:   "/v1/validate/job",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Validate(&api.Job{}, nil)
+			},
+			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
+
+			wantProxyResponse: &api.JobValidateResponse{
+				Warnings: helper.MergeMultierrorWarnings(errors.New("some warning")),
+			},
+
+			nomadResponse: toJson(t, &api.JobValidateResponse{}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "validate job appends validation errors",
+			path:   "/v1/validate/job",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Validate(&api.Job{}, nil)
+			},
+			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
+
+			wantProxyResponse: &api.JobValidateResponse{
+				ValidationErrors: []string{"some error"},
+				Error:            "1 error occurred:\n\t* some error\n\n",
+			},
+
+			nomadResponse: toJson(t, &api.JobValidateResponse{}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningError("some error"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+		{
+			name:   "validate job appends warnings and handles gzip",
+			path:   "/v1/validate/job",
+			method: "PUT",
+
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Validate(&api.Job{}, nil)
+			},
+			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
+
+			wantProxyResponse: &api.JobValidateResponse{
+				Warnings: helper.MergeMultierrorWarnings(errors.New("some warning")),
+			},
+
+			nomadResponse:         toJson(t, &api.JobValidateResponse{}),
+			nomadResponseEncoding: "gzip",
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadBackendCalled := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				// Test request parameters
+				nomadBackendCalled = true
+				assert.Equal(t, req.Method, tc.method, "Ensure method is set")
+				assert.Equal(t, req.URL.Path, tc.path, "Ensure path is set")
+				jsonData, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				json := string(jsonData)
+				assert.JSONEq(t, tc.wantNomadRequestJson, json, "Body matches")
+
+				//set encoding to gzip
+				if tc.nomadResponseEncoding == "gzip" {
+					rw.Header().Set("Content-Encoding", "gzip")
+					rw.WriteHeader(http.StatusOK)
+					//write gzip response
+					gzipWriter := gzip.NewWriter(rw)
+					defer gzipWriter.Close()
+					gzipWriter.Write([]byte(tc.nomadResponse))
+
+				} else {
+					rw.WriteHeader(http.StatusOK)
+					rw.Write([]byte(tc.nomadResponse))
+				}
+
+			}))
+			// Close the server when test finishes
+			defer nomadDummy.Close()
+
+			// Use Client & URL from our local test server
+
+			nomad, err := url.Parse(nomadDummy.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobHandler := admissionctrl.NewJobHandler(
+				tc.mutators,
+				tc.validators,
+				hclog.NewNullLogger(),
+			)
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+			nomadClient := buildNomadClient(t, proxyServer)
+
+			resp, _, err := tc.requestSender(nomadClient)
+
+			assert.NoError(t, err, "No http call error")
+			assert.Equal(t, tc.wantProxyResponse, resp, "OK response is expected")
+
+			assert.True(t, nomadBackendCalled, "Nomad backend was called")
+
+		})
+	}
+
+}
+func TestJobUpdateProxy(t *testing.T) {
+
+	type test struct {
+		name        string
+		path        string
+		method      string
+		requestJson string
+
+		wantNomadRequestJson  string
+		wantProxyResponseJson string
+		nomadResponse         string
+		//	responseWarnings []error
+		validators []admissionctrl.JobValidator
+		mutators   []admissionctrl.JobMutator
+	}
+
+	tests := []test{
+
+		{
+			name:        "update job adds hello meta (does this method actually exist?)",
+			path:        "/v1/job/example",
+			method:      "PUT",
+			requestJson: registerRequestJson(t, testutil.ReadJob(t, "job.json")),
+
+			wantNomadRequestJson:  registerRequestJson(t, jobWithHelloWorldMeta(t)),
+			wantProxyResponseJson: toJson(t, &api.JobRegisterResponse{}),
+
+			nomadResponse: toJson(t, &api.JobRegisterResponse{}),
+			validators:    []admissionctrl.JobValidator{},
+			mutators: []admissionctrl.JobMutator{
+				&testutil.HelloMutator{},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadBackendCalled := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				// Test request parameters
+				nomadBackendCalled = true
+				assert.Equal(t, req.Method, tc.method, "Ensure method is set")
+				assert.Equal(t, req.URL.Path, tc.path, "Ensure path is set")
+				jsonData, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				json := string(jsonData)
+				assert.JSONEq(t, tc.wantNomadRequestJson, json, "Body matches")
+
+				_, _ = rw.Write([]byte(tc.nomadResponse))
+			}))
+			// Close the server when test finishes
+			defer nomadDummy.Close()
+
+			// Use Client & URL from our local test server
+
+			nomad, err := url.Parse(nomadDummy.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jobHandler := admissionctrl.NewJobHandler(
+				tc.mutators,
+				tc.validators,
+				hclog.NewNullLogger(),
+			)
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, fmt.Sprintf("%s%s", proxyServer.URL, tc.path), strings.NewReader(tc.requestJson))
+			assert.NoError(t, err, "No http call error")
+			assert.Equal(t, 200, res.StatusCode, "OK response is expected")
+			assert.JSONEq(t, tc.wantProxyResponseJson, readClosterToString(t, res.Body), "Body matches")
+			assert.True(t, nomadBackendCalled, "Nomad backend was called")
+
+		})
+	}
+
+}
+
+func buildNomadClient(t *testing.T, proxyServer *httptest.Server) *api.Client {
+	t.Helper()
+	nomadClient, err := api.NewClient(&api.Config{
+		Address: proxyServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nomadClient
+}
+func mockValidatorReturningWarnings(warning string) admissionctrl.JobValidator {
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf(warning)}, nil)
+	return validator
+}
+func mockValidatorReturningError(err string) admissionctrl.JobValidator {
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf(err))
+	return validator
+}
+
+func readClosterToString(t *testing.T, rc io.ReadCloser) string {
+	t.Helper()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+func jobWithHelloWorldMeta(t *testing.T) *api.Job {
+	wantJob := testutil.ReadJob(t, "job.json")
+	wantJob.Meta = map[string]string{
+		"hello": "world",
+	}
+	return wantJob
+}
+func toJson(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+func registerRequestJson(t *testing.T, wantJob *api.Job) string {
+	t.Helper()
+	register := &api.JobRegisterRequest{
+		Job: wantJob,
+	}
+	return toJson(t, register)
+
+}
+
+func planRequestJson(t *testing.T, wantJob *api.Job) string {
+	t.Helper()
+	plan := &api.JobPlanRequest{
+		Job: wantJob,
+	}
+	return toJson(t, plan)
+
+}
+
+func TestAdmissionControllerErrors(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+
+		_, _ = rw.Write([]byte(`you should not see this`))
+	}))
+	// Close the server when test finishes
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("some error"))
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{},
+		[]admissionctrl.JobValidator{validator},
+		hclog.NewNullLogger(),
+	)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+
+	defer proxyServer.Close()
+
+	jobRequestJson := registerRequestJson(t, testutil.ReadJob(t, "job.json"))
+	res, err := sendPut(t, fmt.Sprintf("%s%s", proxyServer.URL, "/v1/jobs"), strings.NewReader(jobRequestJson))
+	require.NoError(t, err, "No http call error")
+	assert.Equal(t, 500, res.StatusCode, "Should return 400")
+	_, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+}
+
+func TestMissingJobIsRejected(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("request without job should not reach Nomad: %s", req.URL.Path)
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	validator := new(testutil.MockValidator)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	for _, tc := range []struct {
+		path string
+		body string
+	}{
+		{path: "/v1/jobs", body: `{"Job": null}`},
+		{path: "/v1/job/example", body: `{}`},
+		{path: "/v1/job/example/plan", body: `{"Diff": true}`},
+		{path: "/v1/validate/job", body: `{"Job": null}`},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := sendPut(t, proxyServer.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Equal(t, "request does not contain a job\n", readClosterToString(t, res.Body))
+		})
+	}
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+}
+
+func TestMalformedBodyIsRejected(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("malformed request should not reach Nomad: %s", req.URL.Path)
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	validator := new(testutil.MockValidator)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	for _, tc := range []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "garbage register", path: "/v1/jobs", body: "\x00\xffnot json at all"},
+		{name: "truncated update", path: "/v1/job/example", body: `{"Job": {"ID": "example"`},
+		{name: "wrong type plan", path: "/v1/job/example/plan", body: `{"Job": "secret-value"}`},
+		{name: "empty validate", path: "/v1/validate/job", body: ""},
+		{name: "garbage revert", path: "/v1/job/example/revert", body: "<xml/>"},
+		{name: "garbage nacp validate", path: "/nacp/validate", body: "not json"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := sendPut(t, proxyServer.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			body := readClosterToString(t, res.Body)
+			assert.Equal(t, "failed to parse the request body as JSON\n", body)
+			assert.NotContains(t, body, "secret-value")
+		})
+	}
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+}
+
+func sendPut(t *testing.T, url string, body io.Reader) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
+func TestResolveNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		job  *api.Job
+		want string
+	}{
+		{
+			name: "query parameter takes precedence",
+			url:  "/v1/jobs?namespace=query",
+			job:  &api.Job{Namespace: pointer.Of("body")},
+			want: "query",
+		},
+		{
+			name: "job namespace is used without query parameter",
+			url:  "/v1/jobs",
+			job:  &api.Job{Namespace: pointer.Of("body")},
+			want: "body",
+		},
+		{
+			name: "falls back to default namespace",
+			url:  "/v1/jobs",
+			job:  &api.Job{},
+			want: "default",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, tc.url, nil)
+			assert.Equal(t, tc.want, resolveNamespace(r, tc.job))
+		})
+	}
+}
+
+func TestResolveRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		job    *api.Job
+		want   string
+	}{
+		{name: "query parameter", url: "/v1/jobs?region=eu", header: "us", job: &api.Job{Region: pointer.Of("ap")}, want: "eu"},
+		{name: "header", url: "/v1/jobs", header: "us", job: &api.Job{Region: pointer.Of("ap")}, want: "us"},
+		{name: "job", url: "/v1/jobs", job: &api.Job{Region: pointer.Of("ap")}, want: "ap"},
+		{name: "none", url: "/v1/jobs", job: &api.Job{}, want: ""},
+		{name: "no job", url: "/v1/jobs", want: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, tc.url, nil)
+			if tc.header != "" {
+				r.Header.Set("X-Nomad-Region", tc.header)
+			}
+			assert.Equal(t, tc.want, resolveRegion(r, tc.job))
+		})
+	}
+}
+
+func TestHiddenRuleSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		replacement string
+		want        string
+	}{
+		{
+			name: "strips rule source",
+			want: "Every job must have a costcenter",
+		},
+		{
+			name:        "replaces rule source",
+			replacement: "nacp policy",
+			want:        "Every job must have a costcenter (nacp policy)",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				t.Fatal("Nomad should not be called")
+			}))
+			defer nomadDummy.Close()
+
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.Anything).Return([]error{}, multierror.Append(nil, &admissionctrl.RuleMessage{
+				Msg:  "Every job must have a costcenter",
+				Rule: "policies/internal/costcenter.rego",
+			}))
+
+			logs := &strings.Builder{}
+			logger := hclog.New(&hclog.LoggerOptions{Output: logs})
+
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+			jobHandler := admissionctrl.NewJobHandler(
+				[]admissionctrl.JobMutator{},
+				[]admissionctrl.JobValidator{validator},
+				hclog.NewNullLogger(),
+			)
+			proxy := NewHandler(nomad, jobHandler, logger, nil, WithHiddenRuleSource(tc.replacement))
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+			require.NoError(t, err)
+			body := readClosterToString(t, res.Body)
+
+			assert.Contains(t, body, tc.want)
+			assert.NotContains(t, body, "policies/internal/costcenter.rego")
+			assert.Contains(t, logs.String(), "policies/internal/costcenter.rego")
+		})
+	}
+}
+
+func TestOwnerIsStampedFromResolvedToken(t *testing.T) {
+	var receivedJob *api.Job
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		request := &api.JobRegisterRequest{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(request))
+		receivedJob = request.Job
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+
+	resolver := func(secretID string) (*api.ACLToken, error) {
+		assert.Equal(t, "secret", secretID)
+		return &api.ACLToken{AccessorID: "a1b2", Name: "alice"}, nil
+	}
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{mutator.NewOwnerMutator("owner", "", hclog.NewNullLogger())},
+		[]admissionctrl.JobValidator{},
+		hclog.NewNullLogger(),
+	)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithTokenResolver(resolver))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	job := testutil.ReadJob(t, "job.json")
+	job.Meta = map[string]string{"nacp.owner": "mallory"}
+	nomadClient, err := api.NewClient(&api.Config{Address: proxyServer.URL, SecretID: "secret"})
+	require.NoError(t, err)
+	_, _, err = nomadClient.Jobs().Register(job, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"nacp.owner": "alice"}, receivedJob.Meta)
+}
+
+func TestAdmissionContextRequestMetadata(t *testing.T) {
+	tests := []struct {
+		method        string
+		target        string
+		wantOperation string
+	}{
+		{method: "PUT", target: "/v1/jobs?region=eu", wantOperation: admissionctrl.OperationCreate},
+		{method: "PUT", target: "/v1/job/example?region=eu", wantOperation: admissionctrl.OperationUpdate},
+		{method: "PUT", target: "/v1/job/example/plan?region=eu", wantOperation: admissionctrl.OperationPlan},
+		{method: "PUT", target: "/v1/validate/job?region=eu", wantOperation: admissionctrl.OperationValidate},
+	}
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			r.RemoteAddr = "10.0.0.1:4711"
+
+			req := admissionctrl.RequestFromContext(admissionContext(r, &api.Job{}))
+
+			assert.Equal(t, tc.method, req.Method)
+			assert.Equal(t, strings.Split(tc.target, "?")[0], req.Path)
+			assert.Equal(t, tc.wantOperation, req.Operation)
+			assert.Equal(t, "eu", req.Region)
+			assert.Equal(t, "10.0.0.1", req.ClientIP)
+		})
+	}
+}
+
+func TestAdmissionContextExplicitNamespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		job     *api.Job
+		wantErr string
+	}{
+		{name: "unset", target: "/v1/jobs", job: &api.Job{ID: pointer.Of("example")}, wantErr: "Job example must set a namespace (namespace)"},
+		{name: "job namespace", target: "/v1/jobs", job: &api.Job{ID: pointer.Of("example"), Namespace: pointer.Of("team-a")}},
+		{name: "query parameter", target: "/v1/jobs?namespace=team-a", job: &api.Job{ID: pointer.Of("example")}},
+		{name: "explicit default", target: "/v1/jobs?namespace=default", job: &api.Job{ID: pointer.Of("example")}, wantErr: "Job example must not use the namespace default (namespace)"},
+	}
+	v, err := validator.NewRequireNamespaceValidator("namespace", nil, nil, hclog.NewNullLogger())
+	require.NoError(t, err)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, tc.target, nil)
+
+			_, err := v.Validate(admissionContext(r, tc.job), tc.job)
+
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMaxJobSize(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("{}"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithMaxBodySize(1024))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	small := registerRequestJson(t, &api.Job{ID: pointer.Of("example")})
+	large := registerRequestJson(t, &api.Job{ID: pointer.Of("example"), Meta: map[string]string{"padding": strings.Repeat("x", 2048)}})
+
+	for _, path := range []string{"/v1/jobs", "/v1/job/example/plan", "/v1/validate/job", "/nacp/validate"} {
+		t.Run(path, func(t *testing.T) {
+			res, err := sendPut(t, proxyServer.URL+path, strings.NewReader(large))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+			res, err = sendPut(t, proxyServer.URL+path, strings.NewReader(small))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		})
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{Warnings: strings.Repeat("x", 2048)})))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{mockValidatorReturningWarnings("some warning")}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithMaxBodySize(1024))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+}
+
+func TestIsBlockingQuery(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   bool
+	}{
+		{method: "GET", url: "/v1/jobs?index=42&wait=5m", want: true},
+		{method: "GET", url: "/v1/job/example?index=42", want: true},
+		{method: "HEAD", url: "/v1/jobs?index=1", want: true},
+		{method: "GET", url: "/v1/jobs", want: false},
+		{method: "PUT", url: "/v1/jobs?index=42", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+			assert.Equal(t, tt.want, isBlockingQuery(r))
+		})
+	}
+}
+
+func TestLogAdmissionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "policy denial",
+			err:  multierror.Append(&admissionctrl.ControllerError{Controller: "owner", Kind: admissionctrl.ErrPolicyDenied, Err: errors.New("no owner")}),
+			want: `[INFO]  Job denied by policy: rules=["owner"]`,
+		},
+		{
+			name: "controller failure",
+			err: fmt.Errorf("admission controllers send an error, returning error: %w", multierror.Append(
+				&admissionctrl.ControllerError{Controller: "owner", Kind: admissionctrl.ErrPolicyDenied, Err: errors.New("no owner")},
+				&admissionctrl.ControllerError{Controller: "scanner", Kind: admissionctrl.ErrControllerFailure, Err: errors.New("connection refused")},
+			)),
+			want: `[ERROR] Admission controller failed: controllers=["scanner"] denied_by=["owner"]`,
+		},
+		{
+			name: "other error",
+			err:  errors.New("failed decoding job"),
+			want: `[WARN]  Error applying admission controllers: error="failed decoding job"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			logAdmissionError(hclog.New(&hclog.LoggerOptions{Output: out}), tt.err)
+			assert.Contains(t, out.String(), tt.want)
+		})
+	}
+}
+
+func TestBuildFullWarningMsg(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		warnings []error
+		want     string
+	}{
+		{
+			name: "none",
+			want: "",
+		},
+		{
+			name:     "sorted",
+			warnings: []error{errors.New("b"), errors.New("a")},
+			want:     "2 warnings:\n\n* a\n* b",
+		},
+		{
+			name:     "overlapping",
+			upstream: "image is not pinned (image_policy)",
+			warnings: []error{
+				&admissionctrl.RuleMessage{Msg: "no owner", Rule: "owner"},
+				multierror.Append(
+					&admissionctrl.RuleMessage{Msg: "image is not pinned", Rule: "image_policy"},
+					&admissionctrl.RuleMessage{Msg: "no owner", Rule: "owner"},
+				),
+				&admissionctrl.RuleMessage{Msg: "no owner", Rule: "owner_v2"},
+			},
+			want: "3 warnings:\n\n* image is not pinned (image_policy)\n* no owner (owner)\n* no owner (owner_v2)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildFullWarningMsg(tt.upstream, tt.warnings))
+		})
+	}
+}
+
+func TestJobValidateResponseErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		validationErr error
+		wantErrors    []string
+		wantError     string
+	}{
+		{
+			name:          "single error",
+			validationErr: errors.New("job has no owner"),
+			wantErrors:    []string{"job has no owner"},
+			wantError:     "job has no owner",
+		},
+		{
+			name:          "multiple errors",
+			validationErr: multierror.Append(nil, errors.New("job has no owner"), errors.New("image is not pinned")),
+			wantErrors:    []string{"job has no owner", "image is not pinned"},
+			wantError:     multierror.Append(nil, errors.New("job has no owner"), errors.New("image is not pinned")).Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/v1/validate/job", nil)
+			req = req.WithContext(context.WithValue(req.Context(), ctxValidationError, tt.validationErr))
+			resp := &http.Response{
+				Request: req,
+				Header:  http.Header{},
+				Body:    io.NopCloser(strings.NewReader(toJson(t, &api.JobValidateResponse{}))),
+			}
+
+			require.NoError(t, handleJobValdidateResponse(resp, hclog.NewNullLogger(), &handlerOptions{}))
+
+			response := &api.JobValidateResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(response))
+			assert.Equal(t, tt.wantErrors, response.ValidationErrors)
+			assert.Equal(t, tt.wantError, response.Error)
+		})
+	}
+}
+
+func TestValidateWithoutMutation(t *testing.T) {
+	tests := []struct {
+		name                 string
+		opts                 []HandlerOption
+		wantNomadMeta        map[string]string
+		wantValidationErrors []string
+	}{
+		{
+			name:          "validates the mutated job",
+			wantNomadMeta: map[string]string{"hello": "world"},
+		},
+		{
+			name:                 "validates the job as submitted",
+			opts:                 []HandlerOption{WithoutValidateMutation()},
+			wantValidationErrors: []string{"job has no hello meta"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nomadRequest api.JobValidateRequest
+			nomad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&nomadRequest))
+				rw.Write([]byte(toJson(t, &api.JobValidateResponse{})))
+			}))
+			defer nomad.Close()
+			nomadURL, err := url.Parse(nomad.URL)
+			require.NoError(t, err)
+
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.MatchedBy(func(job *api.Job) bool { return job.Meta["hello"] == "" })).Return([]error{}, errors.New("job has no hello meta"))
+			validator.On("Validate", mock.Anything).Return([]error{}, nil)
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{&testutil.HelloMutator{}}, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger())
+			proxy := NewHandler(nomadURL, jobHandler, hclog.NewNullLogger(), nil, tt.opts...)
+
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(http.MethodPut, "/v1/validate/job", strings.NewReader(toJson(t, &api.JobValidateRequest{Job: &api.Job{ID: pointer.Of("example")}}))))
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantNomadMeta, nomadRequest.Job.Meta, "Nomad validates the same job")
+			response := &api.JobValidateResponse{}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(response))
+			assert.Equal(t, tt.wantValidationErrors, response.ValidationErrors)
+		})
+	}
+}
+
+func TestJobPlanResponseKeepsThePlan(t *testing.T) {
+	// a plan as sent by a newer Nomad, with fields our api version doesn't know
+	plan := `{"Annotations":{"DesiredTGUpdates":{"web":{"Ignore":0,"Place":1,"Migrate":0,"Stop":0,"InPlaceUpdate":0,"DestructiveUpdate":1,"Canary":0,"Preemptions":0}},"PreemptedAllocs":null},` +
+		`"CreatedEvals":null,` +
+		`"Diff":{"Fields":null,"ID":"example","Objects":null,"Type":"Edited","TaskGroups":[{"Fields":[{"Annotations":null,"Name":"Count","New":"2","Old":"1","Type":"Edited"}],"Name":"web","Objects":null,"Tasks":[{"Annotations":["forces create/destroy update"],"Fields":[{"Annotations":null,"Name":"Config[image]","New":"nginx:1.25","Old":"nginx:1.24","Type":"Edited"}],"Name":"nginx","Objects":[{"Fields":[{"Annotations":null,"Name":"RTarget","New":">= 1.7","Old":"","Type":"Added"}],"Name":"Constraint","Objects":null,"Type":"Added"}],"Type":"Edited","FutureTaskField":{"Kind":"new"}}],"Type":"Edited","Updates":{"create/destroy update":1}}]},` +
+		`"FailedTGAllocs":{"web":{"NodesEvaluated":3,"NodesFiltered":1,"NodesAvailable":{"dc1":3},"ClassFiltered":null,"ConstraintFiltered":{"${attr.kernel.name} = linux":1},"NodesExhausted":0,"ClassExhausted":null,"DimensionExhausted":null,"QuotaExhausted":null,"ResourcesExhausted":null,"Scores":null,"AllocationTime":12345,"CoalescedFailures":0}},` +
+		`"FuturePlanField":[1,2,3],` +
+		`"JobModifyIndex":42,` +
+		`"NextPeriodicLaunch":"2026-01-01T00:00:00Z",` +
+		`"Warnings":"nomad warning"}`
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/job/example/plan", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxWarnings, []error{errors.New("nacp warning")}))
+	resp := &http.Response{
+		Request: req,
+		Header:  http.Header{},
+		Body:    io.NopCloser(strings.NewReader(plan)),
+	}
+
+	require.NoError(t, handleJobPlanResponse(resp, hclog.NewNullLogger(), &handlerOptions{}))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	want := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal([]byte(plan), &want))
+	got := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(body, &got))
+	require.Len(t, got, len(want))
+	for field, raw := range want {
+		if field == "Warnings" {
+			continue
+		}
+		assert.Equal(t, string(raw), string(got[field]), field)
+	}
+	var warnings string
+	require.NoError(t, json.Unmarshal(got["Warnings"], &warnings))
+	assert.Contains(t, warnings, "nomad warning")
+	assert.Contains(t, warnings, "nacp warning")
+}
+
+func TestBlockingQueryIsStreamedThrough(t *testing.T) {
+	received := make(chan struct{}, 2)
+	release := make(chan struct{})
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "42", req.URL.Query().Get("index"))
+		received <- struct{}{}
+		<-release
+		rw.Header().Set("X-Nomad-Index", "43")
+		rw.Write([]byte(`[]`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	// neither controllers nor the rate limiter may touch a blocking query
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{new(testutil.MockMutator)},
+		[]admissionctrl.JobValidator{new(testutil.MockValidator)},
+		hclog.NewNullLogger(),
+	)
+	limiter, err := NewRateLimiter(0.001, 1, RateLimitByIP)
+	require.NoError(t, err)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithRateLimiter(limiter))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	type result struct {
+		res *http.Response
+		err error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			res, err := http.Get(proxyServer.URL + "/v1/jobs?index=42&wait=5m")
+			results <- result{res, err}
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("blocking query was not forwarded to Nomad")
+		}
+	}
+	select {
+	case <-results:
+		t.Fatal("blocking query answered before Nomad did")
+	default:
+	}
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		r := <-results
+		require.NoError(t, r.err)
+		assert.Equal(t, http.StatusOK, r.res.StatusCode)
+		assert.Equal(t, "43", r.res.Header.Get("X-Nomad-Index"))
+		body, err := io.ReadAll(r.res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "[]", string(body))
+	}
+}
+
+func TestBlockingQueryTimeout(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		rw.Header().Set("X-Nomad-Index", "43")
+		rw.Write([]byte(`[]`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name       string
+		path       string
+		opts       []HandlerOption
+		wantStatus int
+	}{
+		{name: "blocking query waits for nomad", path: "/v1/jobs?index=42&wait=5m", wantStatus: http.StatusOK},
+		{name: "other reads keep the timeout", path: "/v1/jobs", wantStatus: http.StatusGatewayTimeout},
+		{name: "blocking query timeout", path: "/v1/jobs?index=42&wait=5m", opts: []HandlerOption{WithBlockingQueryTimeout(100 * time.Millisecond)}, wantStatus: http.StatusGatewayTimeout},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.ResponseHeaderTimeout = 100 * time.Millisecond
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), transport, tc.opts...)
+
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestUpstreamErrorsArePassedThrough(t *testing.T) {
+	for _, path := range []string{"/v1/jobs", "/v1/job/example/plan", "/v1/validate/job"} {
+		t.Run(path, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Type", "text/plain")
+				rw.WriteHeader(http.StatusInternalServerError)
+				rw.Write([]byte("rpc error: no leader"))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{mockValidatorReturningWarnings("some warning")}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, proxyServer.URL+path, strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+			assert.Equal(t, "rpc error: no leader", readClosterToString(t, res.Body))
+		})
+	}
+}
+
+func TestRewrittenRequestsKeepQueryAndHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		mutate bool
+	}{
+		{name: "register", path: "/v1/jobs", mutate: true},
+		{name: "update", path: "/v1/job/example", mutate: true},
+		{name: "plan", path: "/v1/job/example/plan", mutate: true},
+		{name: "validate", path: "/v1/validate/job", mutate: true},
+		{name: "register without mutators", path: "/v1/jobs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type received struct {
+				method string
+				path   string
+				query  url.Values
+				header http.Header
+				length int64
+				job    *api.Job
+			}
+			forwarded := make(chan received, 1)
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				body := &struct{ Job *api.Job }{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(body))
+				forwarded <- received{req.Method, req.URL.Path, req.URL.Query(), req.Header, req.ContentLength, body.Job}
+				rw.Write([]byte(`{}`))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			mutators := []admissionctrl.JobMutator{}
+			if tt.mutate {
+				mutators = append(mutators, &testutil.HelloMutator{MutatorName: "hello"})
+			}
+			jobHandler := admissionctrl.NewJobHandler(mutators, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			// a chunked body must not leave its framing on the rewritten request
+			body := io.MultiReader(strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+tt.path+"?namespace=foo&region=bar", body)
+			require.NoError(t, err)
+			req.Header.Set("X-Nomad-Token", "secret")
+			req.Header.Set("X-Custom", "custom")
+			req.Header.Set("Content-Type", "application/json")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+
+			got := <-forwarded
+			assert.Equal(t, http.MethodPut, got.method)
+			assert.Equal(t, tt.path, got.path)
+			assert.Equal(t, url.Values{"namespace": {"foo"}, "region": {"bar"}}, got.query)
+			assert.Equal(t, "secret", got.header.Get("X-Nomad-Token"))
+			assert.Equal(t, "custom", got.header.Get("X-Custom"))
+			assert.Equal(t, "application/json", got.header.Get("Content-Type"))
+			assert.Positive(t, got.length, "body is sent with its length")
+			assert.Equal(t, "example", *got.job.ID)
+			if tt.mutate {
+				assert.Equal(t, "world", got.job.Meta["hello"])
+			}
+		})
+	}
+}
+
+func gzipped(t *testing.T, data string) *bytes.Buffer {
+	t.Helper()
+	compressed := &bytes.Buffer{}
+	gz := gzip.NewWriter(compressed)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return compressed
+}
+
+func TestGzipEncodedRequests(t *testing.T) {
+	forwarded := make(chan *api.Job, 1)
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Content-Encoding"), "rewritten body is sent uncompressed")
+		body := &struct{ Job *api.Job }{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(body))
+		forwarded <- body.Job
+		rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{&testutil.HelloMutator{MutatorName: "hello"}},
+		[]admissionctrl.JobValidator{},
+		hclog.NewNullLogger(),
+	)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithMaxBodySize(1024))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	sendGzip := func(t *testing.T, path string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, proxyServer.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "gzip")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	job := registerRequestJson(t, &api.Job{ID: pointer.Of("example")})
+
+	for _, path := range []string{"/v1/jobs", "/v1/job/example/plan", "/v1/validate/job"} {
+		t.Run(path, func(t *testing.T) {
+			res := sendGzip(t, path, gzipped(t, job))
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			got := <-forwarded
+			assert.Equal(t, "example", *got.ID)
+			assert.Equal(t, "world", got.Meta["hello"])
+		})
+	}
+
+	t.Run("nacp mutate", func(t *testing.T) {
+		res := sendGzip(t, "/nacp/mutate", gzipped(t, job))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		resp := &MutateResponse{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+		assert.Equal(t, "world", resp.Job.Meta["hello"])
+	})
+
+	t.Run("invalid gzip", func(t *testing.T) {
+		res := sendGzip(t, "/v1/jobs", strings.NewReader(job))
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("decompressed size is limited", func(t *testing.T) {
+		large := registerRequestJson(t, &api.Job{ID: pointer.Of("example"), Meta: map[string]string{"padding": strings.Repeat("x", 4096)}})
+		compressed := gzipped(t, large)
+		require.Less(t, compressed.Len(), 1024)
+		res := sendGzip(t, "/v1/jobs", compressed)
+		res.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// RateLimitByToken keys the rate limit by the resolved request token,
+	// falling back to the client ip for anonymous or unresolved requests.
+	RateLimitByToken = "token"
+	// RateLimitByIP keys the rate limit by the client ip.
+	RateLimitByIP = "ip"
+
+	rateLimiterIdleTimeout = 10 * time.Minute
+)
+
+// RateLimiter is a token bucket rate limiter per token or client ip.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	key   string
+
+	mu          sync.Mutex
+	limiters    map[string]*visitor
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows perSecond requests per key with bursts of up to burst requests.
+func NewRateLimiter(perSecond float64, burst int, key string) (*RateLimiter, error) {
+	switch key {
+	case "":
+		key = RateLimitByToken
+	case RateLimitByToken, RateLimitByIP:
+	default:
+		return nil, fmt.Errorf("invalid rate limit key %q, must be %q or %q", key, RateLimitByToken, RateLimitByIP)
+	}
+	if perSecond <= 0 {
+		return nil, fmt.Errorf("rate limit rate must be positive")
+	}
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(perSecond)))
+	}
+	return &RateLimiter{
+		limit:    rate.Limit(perSecond),
+		burst:    burst,
+		key:      key,
+		limiters: map[string]*visitor{},
+		now:      time.Now,
+	}, nil
+}
+
+// WithRateLimiter rejects job submissions exceeding the limiter with 429.
+func WithRateLimiter(limiter *RateLimiter) HandlerOption {
+	return func(o *handlerOptions) {
+		o.rateLimiter = limiter
+	}
+}
+
+// allow reports whether the request may pass, otherwise how long to wait before retrying.
+func (l *RateLimiter) allow(r *http.Request) (bool, time.Duration) {
+	keyType, key := l.requestKey(r)
+	now := l.now()
+
+	l.mu.Lock()
+	l.cleanup(now)
+	v, ok := l.limiters[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = v
+	}
+	v.lastSeen = now
+	l.mu.Unlock()
+
+	reservation := v.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return true, 0
+	}
+	reservation.CancelAt(now)
+	rateLimitedRequests.WithLabelValues(keyType).Inc()
+	return false, delay
+}
+
+// requestKey keys requests by the accessor of their resolved token, a made up
+// secret must not get a fresh bucket, so all others are keyed by the client ip.
+func (l *RateLimiter) requestKey(r *http.Request) (string, string) {
+	if l.key == RateLimitByToken {
+		if token, ok := r.Context().Value(ctxToken).(*api.ACLToken); ok && token.AccessorID != "" {
+			return RateLimitByToken, "accessor:" + token.AccessorID
+		}
+	}
+	return RateLimitByIP, "ip:" + clientIP(r)
+}
+
+// cleanup forgets keys which have not been seen for a while.
+func (l *RateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	l.lastCleanup = now
+	for key, v := range l.limiters {
+		if now.Sub(v.lastSeen) > rateLimiterIdleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("{}"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	limiter, err := NewRateLimiter(0.01, 2, RateLimitByToken)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+	resolver := func(secretID string) (*api.ACLToken, error) {
+		return &api.ACLToken{AccessorID: "accessor-" + secretID}, nil
+	}
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithRateLimiter(limiter), WithTokenResolver(resolver))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	submit := func(token string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+		require.NoError(t, err)
+		req.Header.Set("X-Nomad-Token", token)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	throttled := promtestutil.ToFloat64(rateLimitedRequests.WithLabelValues(RateLimitByToken))
+
+	assert.Equal(t, http.StatusOK, submit("token-a").StatusCode)
+	assert.Equal(t, http.StatusOK, submit("token-a").StatusCode)
+
+	res := submit("token-a")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "100", res.Header.Get("Retry-After"))
+	assert.Equal(t, throttled+1, promtestutil.ToFloat64(rateLimitedRequests.WithLabelValues(RateLimitByToken)))
+
+	assert.Equal(t, http.StatusOK, submit("token-b").StatusCode, "other tokens have their own bucket")
+
+	res, err = http.Get(proxyServer.URL + "/v1/jobs")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "reads are not limited")
+
+	res, err = http.Get(proxyServer.URL + "/nacp/metrics")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, readClosterToString(t, res.Body), `nacp_rate_limited_requests_total{key_type="token"}`)
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	limiter, err := NewRateLimiter(1, 1, RateLimitByToken)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/jobs", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	keyType, key := limiter.requestKey(r)
+	assert.Equal(t, RateLimitByIP, keyType, "anonymous requests are limited per ip")
+	assert.Equal(t, "ip:10.0.0.1", key)
+
+	r.Header.Set("X-Nomad-Token", "secret")
+	keyType, key = limiter.requestKey(r)
+	assert.Equal(t, RateLimitByIP, keyType, "unresolved tokens are limited per ip")
+	assert.Equal(t, "ip:10.0.0.1", key)
+
+	resolved := r.WithContext(context.WithValue(r.Context(), ctxToken, &api.ACLToken{AccessorID: "accessor"}))
+	keyType, key = limiter.requestKey(resolved)
+	assert.Equal(t, RateLimitByToken, keyType)
+	assert.Equal(t, "accessor:accessor", key)
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	_, key = limiter.requestKey((&handlerOptions{trustedProxies: trusted}).withClientIP(r))
+	assert.Equal(t, "ip:198.51.100.1", key, "clients of trusted proxies are limited per forwarded ip")
+
+	ipLimiter, err := NewRateLimiter(1, 1, RateLimitByIP)
+	require.NoError(t, err)
+	keyType, _ = ipLimiter.requestKey(r)
+	assert.Equal(t, RateLimitByIP, keyType)
+
+	_, err = NewRateLimiter(1, 1, "namespace")
+	assert.Error(t, err)
+	_, err = NewRateLimiter(0, 1, RateLimitByIP)
+	assert.Error(t, err)
+}
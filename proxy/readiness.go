@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+)
+
+const nacpReadyPath = "/nacp/ready"
+
+// Defaults of the readiness check at startup.
+const (
+	DefaultReadinessAttempts       = 10
+	DefaultReadinessInitialBackoff = time.Second
+	DefaultReadinessMaxBackoff     = 30 * time.Second
+)
+
+// readinessProbeTimeout bounds every check of Nomad.
+const readinessProbeTimeout = 5 * time.Second
+
+// ReadinessRetry bounds the checks of WaitForNomad.
+type ReadinessRetry struct {
+	Attempts int
+	// InitialBackoff doubles after every failed attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// ReadinessStatus is the response of GET /nacp/ready.
+type ReadinessStatus struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness tracks whether Nomad is reachable. Once Nomad answered it stays ready,
+// until a reload changes the Nomad address.
+type Readiness struct {
+	mu      sync.Mutex
+	address *url.URL
+	client  *http.Client
+	ready   bool
+}
+
+// NewReadiness creates a readiness which is not ready until Nomad answered a check.
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// WithReadiness serves the readiness at GET /nacp/ready and checks the Nomad server of the handler with it.
+func WithReadiness(readiness *Readiness) HandlerOption {
+	return func(o *handlerOptions) {
+		o.readiness = readiness
+	}
+}
+
+// setBackend sets the Nomad server checked, a new address is not ready until it answered.
+func (r *Readiness) setBackend(address *url.URL, transport http.RoundTripper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.address == nil || r.address.String() != address.String() {
+		r.ready = false
+	}
+	r.address = address
+	r.client = &http.Client{Transport: transport, Timeout: readinessProbeTimeout}
+}
+
+// check asks Nomad for its leader, unless it answered before.
+func (r *Readiness) check(ctx context.Context) error {
+	r.mu.Lock()
+	ready, address, client := r.ready, r.address, r.client
+	r.mu.Unlock()
+	if ready {
+		return nil
+	}
+	if address == nil {
+		return errors.New("no Nomad server configured")
+	}
+	err := probeNomad(ctx, client, address)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// a reload may have changed the server in the meantime
+	if r.address == address {
+		r.ready = err == nil
+	}
+	return err
+}
+
+func probeNomad(ctx context.Context, client *http.Client, address *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address.ResolveReference(&url.URL{Path: "/v1/status/leader"}).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Nomad responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// WaitForNomad checks Nomad until it answers, backing off between the attempts.
+// It gives up after the attempts, /nacp/ready keeps checking Nomad on every request.
+func (r *Readiness) WaitForNomad(ctx context.Context, retry ReadinessRetry, logger hclog.Logger) error {
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.check(ctx)
+		if err == nil {
+			logger.Info("Nomad is reachable", "attempts", attempt)
+			return nil
+		}
+		if attempt >= retry.Attempts {
+			return fmt.Errorf("Nomad is unreachable after %d attempts: %w", attempt, err)
+		}
+		logger.Warn("Nomad is unreachable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+}
+
+// readinessRetry returns the retries of the config, unset values use the defaults.
+func readinessRetry(c *config.Readiness) (ReadinessRetry, error) {
+	retry := ReadinessRetry{
+		Attempts:       DefaultReadinessAttempts,
+		InitialBackoff: DefaultReadinessInitialBackoff,
+		MaxBackoff:     DefaultReadinessMaxBackoff,
+	}
+	if c == nil {
+		return retry, nil
+	}
+	if c.Attempts > 0 {
+		retry.Attempts = c.Attempts
+	}
+	for _, setting := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"initial_backoff", c.InitialBackoff, &retry.InitialBackoff},
+		{"max_backoff", c.MaxBackoff, &retry.MaxBackoff},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil {
+			return retry, fmt.Errorf("invalid readiness %s: %w", setting.name, err)
+		}
+		*setting.target = d
+	}
+	return retry, nil
+}
+
+func isNacpReady(r *http.Request) bool {
+	return r.Method == "GET" && r.URL.Path == nacpReadyPath
+}
+
+func serveReady(w http.ResponseWriter, r *http.Request, readiness *Readiness) {
+	status := ReadinessStatus{Ready: true}
+	code := http.StatusOK
+	if err := readiness.check(r.Context()); err != nil {
+		status = ReadinessStatus{Error: err.Error()}
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyNomad answers the leader checks with 500 until up is set.
+func flakyNomad(t *testing.T, up *atomic.Bool, checks *atomic.Int32) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/status/leader" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		checks.Add(1)
+		if !up.Load() {
+			http.Error(rw, "No cluster leader", http.StatusInternalServerError)
+			return
+		}
+		rw.Write([]byte(`"127.0.0.1:4647"`))
+	}))
+	t.Cleanup(server.Close)
+	address, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return address
+}
+
+func TestReadinessEndpoint(t *testing.T) {
+	var up atomic.Bool
+	var checks atomic.Int32
+	nomad := flakyNomad(t, &up, &checks)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithReadiness(NewReadiness()))
+
+	ready := func() (int, ReadinessStatus) {
+		rr := httptest.NewRecorder()
+		proxy(rr, httptest.NewRequest(http.MethodGet, "/nacp/ready", nil))
+		var status ReadinessStatus
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+		return rr.Code, status
+	}
+
+	code, status := ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, ReadinessStatus{Error: "Nomad responded with 500 Internal Server Error"}, status)
+
+	up.Store(true)
+	code, status = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReadinessStatus{Ready: true}, status)
+
+	up.Store(false)
+	code, _ = ready()
+	assert.Equal(t, http.StatusOK, code, "it stays ready once Nomad answered")
+	assert.Equal(t, int32(2), checks.Load())
+}
+
+func TestWaitForNomad(t *testing.T) {
+	retry := ReadinessRetry{Attempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	t.Run("retries until Nomad is reachable", func(t *testing.T) {
+		var up atomic.Bool
+		var checks atomic.Int32
+		readiness := NewReadiness()
+		readiness.setBackend(flakyNomad(t, &up, &checks), http.DefaultTransport)
+		time.AfterFunc(10*time.Millisecond, func() { up.Store(true) })
+
+		require.NoError(t, readiness.WaitForNomad(context.Background(), ReadinessRetry{Attempts: 100, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}, hclog.NewNullLogger()))
+		assert.Greater(t, checks.Load(), int32(1))
+		assert.NoError(t, readiness.check(context.Background()))
+	})
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		var up atomic.Bool
+		var checks atomic.Int32
+		readiness := NewReadiness()
+		readiness.setBackend(flakyNomad(t, &up, &checks), http.DefaultTransport)
+
+		err := readiness.WaitForNomad(context.Background(), retry, hclog.NewNullLogger())
+		assert.EqualError(t, err, "Nomad is unreachable after 5 attempts: Nomad responded with 500 Internal Server Error")
+		assert.Equal(t, int32(5), checks.Load())
+
+		up.Store(true)
+		assert.NoError(t, readiness.check(context.Background()), "later checks still succeed")
+	})
+	t.Run("stops when cancelled", func(t *testing.T) {
+		var up atomic.Bool
+		var checks atomic.Int32
+		readiness := NewReadiness()
+		readiness.setBackend(flakyNomad(t, &up, &checks), http.DefaultTransport)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, readiness.WaitForNomad(ctx, retry, hclog.NewNullLogger()), context.Canceled)
+	})
+}
+
+func TestReadinessResetOnNewAddress(t *testing.T) {
+	var up atomic.Bool
+	var checks atomic.Int32
+	up.Store(true)
+	readiness := NewReadiness()
+	readiness.setBackend(flakyNomad(t, &up, &checks), http.DefaultTransport)
+	require.NoError(t, readiness.check(context.Background()))
+
+	var otherUp atomic.Bool
+	readiness.setBackend(flakyNomad(t, &otherUp, &checks), http.DefaultTransport)
+	assert.Error(t, readiness.check(context.Background()), "a new Nomad address is not ready until it answered")
+}
+
+func TestReloaderWaitForNomad(t *testing.T) {
+	var up atomic.Bool
+	var checks atomic.Int32
+	nomad := flakyNomad(t, &up, &checks)
+	c := config.DefaultConfig()
+	c.Nomad.Address = nomad.String()
+	c.Readiness = &config.Readiness{Attempts: 3, InitialBackoff: "1ms", MaxBackoff: "1ms"}
+	server, err := New(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	reloader := server.Handler.(*Reloader)
+
+	assert.EqualError(t, reloader.WaitForNomad(context.Background()), "Nomad is unreachable after 3 attempts: Nomad responded with 500 Internal Server Error")
+	rr := httptest.NewRecorder()
+	reloader.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/nacp/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "the proxy keeps serving while Nomad is unreachable")
+
+	up.Store(true)
+	rr = httptest.NewRecorder()
+	reloader.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/nacp/ready", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// DefaultRecentDecisionsSize is the default number of admission decisions kept by RecentDecisions.
+const DefaultRecentDecisionsSize = 100
+
+const nacpRecentPath = "/nacp/recent"
+
+// RecentDecisions keeps the last admission decisions in memory, older ones are overwritten.
+type RecentDecisions struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+	next    int
+	full    bool
+}
+
+// NewRecentDecisions keeps up to size decisions.
+func NewRecentDecisions(size int) *RecentDecisions {
+	if size <= 0 {
+		size = DefaultRecentDecisionsSize
+	}
+	return &RecentDecisions{records: make([]*AuditRecord, size)}
+}
+
+// Add keeps the record, overwriting the oldest one if the buffer is full.
+func (d *RecentDecisions) Add(record *AuditRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records[d.next] = record
+	d.next = (d.next + 1) % len(d.records)
+	if d.next == 0 {
+		d.full = true
+	}
+}
+
+// List returns the kept decisions, the most recent first.
+func (d *RecentDecisions) List() []*AuditRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.next
+	if d.full {
+		n = len(d.records)
+	}
+	list := make([]*AuditRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, d.records[(d.next-i+len(d.records))%len(d.records)])
+	}
+	return list
+}
+
+// WithRecentDecisions keeps the admission decisions and serves them at GET /nacp/recent.
+func WithRecentDecisions(recent *RecentDecisions) HandlerOption {
+	return func(o *handlerOptions) {
+		o.recent = recent
+	}
+}
+
+func isNacpRecent(r *http.Request) bool {
+	return r.Method == "GET" && r.URL.Path == nacpRecentPath
+}
+
+func serveRecent(w http.ResponseWriter, recent *RecentDecisions) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recent.List())
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentDecisions(t *testing.T) {
+	jobIDs := func(records []*AuditRecord) []string {
+		ids := []string{}
+		for _, r := range records {
+			ids = append(ids, r.JobID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name  string
+		added int
+		want  []string
+	}{
+		{name: "empty", added: 0, want: []string{}},
+		{name: "partially filled", added: 2, want: []string{"job-1", "job-0"}},
+		{name: "full", added: 3, want: []string{"job-2", "job-1", "job-0"}},
+		{name: "overwrites the oldest", added: 5, want: []string{"job-4", "job-3", "job-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recent := NewRecentDecisions(3)
+			for i := 0; i < tt.added; i++ {
+				recent.Add(&AuditRecord{JobID: fmt.Sprintf("job-%d", i)})
+			}
+			assert.Equal(t, tt.want, jobIDs(recent.List()))
+		})
+	}
+}
+
+func TestRecentDecisionsConcurrentAccess(t *testing.T) {
+	recent := NewRecentDecisions(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recent.Add(&AuditRecord{JobID: "example"})
+				recent.List()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, recent.List(), 10)
+}
+
+func TestRecentDecisionsEndpoint(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+
+	c := reloadTestConfig(t, "info")
+	c.Nomad.Address = nomadDummy.URL
+	c.RecentDecisions = &config.RecentDecisions{Size: 10}
+	reloader, err := newReloader(c, hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	proxyServer := httptest.NewServer(reloader)
+	defer proxyServer.Close()
+
+	job := &api.Job{ID: pointer.Of("example")}
+	res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, job)))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	// decisions are kept as long as the config of the buffer doesn't change
+	require.NoError(t, reloader.Reload(c))
+
+	res, err = http.Get(proxyServer.URL + "/nacp/recent")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var records []*AuditRecord
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&records))
+	require.Len(t, records, 1)
+	assert.Equal(t, "example", records[0].JobID)
+	assert.Equal(t, AuditDeny, records[0].Decision)
+	assert.NotEmpty(t, records[0].Errors)
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+)
+
+// Reloader serves the proxy of the current config and swaps it on reloads.
+type Reloader struct {
+	logger  hclog.Logger
+	options *serverOptions
+
+	mu          sync.Mutex
+	config      *config.Config
+	jobHandler  *admissionctrl.JobHandler
+	controllers *controllerSet
+	dataDigest  string
+	audit       *openAuditLog
+	recent      *RecentDecisions
+	readiness   *Readiness
+	handler     atomic.Value
+}
+
+// openAuditLog is an audit log with the file it writes to.
+type openAuditLog struct {
+	*AuditLog
+	file *os.File
+}
+
+func openAudit(c *config.Audit) (*openAuditLog, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Output == "stdout" {
+		return &openAuditLog{AuditLog: NewAuditLog(os.Stdout, c.BufferSize)}, nil
+	}
+	file, err := os.OpenFile(c.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &openAuditLog{AuditLog: NewAuditLog(file, c.BufferSize), file: file}, nil
+}
+
+func (a *openAuditLog) close() {
+	if a == nil {
+		return
+	}
+	a.Close()
+	if a.file != nil {
+		a.file.Close()
+	}
+}
+
+func (a *openAuditLog) log() *AuditLog {
+	if a == nil {
+		return nil
+	}
+	return a.AuditLog
+}
+
+func newReloader(c *config.Config, logger hclog.Logger, options *serverOptions) (*Reloader, error) {
+	r := &Reloader{logger: logger, options: options, readiness: NewReadiness()}
+	if err := r.Reload(c); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if isNacpReload(req) {
+		if secret := r.reloadSecret(); secret != "" {
+			r.serveReload(w, req, secret)
+			return
+		}
+	}
+	r.handler.Load().(http.Handler).ServeHTTP(w, req)
+}
+
+// WaitForNomad checks the Nomad server of the config until it is reachable, with the retries of its readiness block.
+// Until then /nacp/ready reports not ready, the proxy keeps serving after the attempts ran out.
+func (r *Reloader) WaitForNomad(ctx context.Context) error {
+	r.mu.Lock()
+	retry, err := readinessRetry(r.config.Readiness)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.readiness.WaitForNomad(ctx, retry, r.logger.Named("readiness"))
+}
+
+// Reload applies the config. The admission controllers are only rebuilt if
+// their config changed, otherwise only the runtime settings are applied.
+// On errors the previous config stays active.
+func (r *Reloader) Reload(c *config.Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobHandler, controllers := r.jobHandler, r.controllers
+	dataDigest := policyDataDigest(c)
+	if jobHandler == nil || controllersChanged(r.config, c) || dataDigest != r.dataDigest {
+		var err error
+		jobHandler, controllers, err = buildJobHandler(c, r.logger, r.options)
+		if err != nil {
+			return err
+		}
+	} else {
+		r.logger.Info("Admission controllers unchanged, only applying runtime settings")
+	}
+	audit := r.audit
+	if r.config == nil || !reflect.DeepEqual(r.config.Audit, c.Audit) {
+		var err error
+		audit, err = openAudit(c.Audit)
+		if err != nil {
+			if controllers != r.controllers {
+				controllers.close()
+			}
+			return err
+		}
+	}
+	recent := r.recent
+	if r.config == nil || !reflect.DeepEqual(r.config.RecentDecisions, c.RecentDecisions) {
+		recent = nil
+		if c.RecentDecisions != nil {
+			recent = NewRecentDecisions(c.RecentDecisions.Size)
+		}
+	}
+	proxy, err := buildProxy(c, r.logger, jobHandler, audit.log(), recent, r.readiness)
+	if err != nil {
+		if audit != r.audit {
+			audit.close()
+		}
+		if controllers != r.controllers {
+			controllers.close()
+		}
+		return err
+	}
+	if r.config != nil && listenerChanged(r.config, c) {
+		r.logger.Warn("Changes of bind, bind_addresses, listen_network, port and tls require a restart")
+	}
+
+	r.logger.SetLevel(hclog.LevelFromString(c.LogLevel))
+	r.handler.Store(proxy)
+	if audit != r.audit {
+		// requests still served by the previous proxy drop their records from now on
+		r.audit.close()
+	}
+	if controllers != r.controllers && r.controllers != nil {
+		// requests still served by the previous controllers keep the policies they loaded
+		r.controllers.close()
+	}
+	r.config = c
+	r.jobHandler = jobHandler
+	r.controllers = controllers
+	r.dataDigest = dataDigest
+	r.audit = audit
+	r.recent = recent
+	return nil
+}
+
+// controllersChanged reports whether the config of the admission
+// controllers differs, requiring them to be rebuilt. The quota validator
+// connects to Nomad with the nomad settings.
+func controllersChanged(old *config.Config, c *config.Config) bool {
+	return !reflect.DeepEqual(old.Validators, c.Validators) ||
+		!reflect.DeepEqual(old.Nomad, c.Nomad) ||
+		!reflect.DeepEqual(old.Mutators, c.Mutators) ||
+		!reflect.DeepEqual(old.RemotePolicies, c.RemotePolicies) ||
+		!reflect.DeepEqual(old.PolicyVerification, c.PolicyVerification) ||
+		!reflect.DeepEqual(old.BundleVerification, c.BundleVerification) ||
+		!reflect.DeepEqual(old.OpaInput, c.OpaInput) ||
+		ruleProvenance(old) != ruleProvenance(c) ||
+		!reflect.DeepEqual(old.Identity, c.Identity) ||
+		!reflect.DeepEqual(old.Profiles, c.Profiles) ||
+		old.DefaultProfile != c.DefaultProfile ||
+		old.ValidatorConcurrency != c.ValidatorConcurrency ||
+		!reflect.DeepEqual(old.SkipJobIDPrefixes, c.SkipJobIDPrefixes) ||
+		!reflect.DeepEqual(old.SkipNamespaces, c.SkipNamespaces)
+}
+
+// ruleProvenance reports whether the OPA rules annotate their messages with their file and query.
+func ruleProvenance(c *config.Config) bool {
+	return c.Response != nil && c.Response.RuleProvenance
+}
+
+// policyDataDigest fingerprints the data files of the OPA rules, so reloads
+// pick up changed data even if the config didn't change.
+func policyDataDigest(c *config.Config) string {
+	hash := sha256.New()
+	addFile := func(rule *config.OpaRule) {
+		if rule == nil || rule.DataFile == "" {
+			return
+		}
+		fmt.Fprintf(hash, "%s\x00", rule.DataFile)
+		if data, err := os.ReadFile(rule.DataFile); err == nil {
+			hash.Write(data)
+		}
+		hash.Write([]byte{0})
+	}
+	for _, v := range c.Validators {
+		addFile(v.OpaRule)
+	}
+	for _, m := range c.Mutators {
+		addFile(m.OpaRule)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func listenerChanged(old *config.Config, c *config.Config) bool {
+	return old.Bind != c.Bind || old.Port != c.Port || old.ListenNetwork != c.ListenNetwork ||
+		!reflect.DeepEqual(old.BindAddresses, c.BindAddresses) || !reflect.DeepEqual(old.Tls, c.Tls)
+}
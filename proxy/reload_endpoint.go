@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mxab/nacp/config"
+)
+
+const nacpReloadPath = "/nacp/reload"
+
+// ReloadSecretHeader carries the secret of the reload_endpoint block.
+const ReloadSecretHeader = "X-Nacp-Reload-Secret"
+
+// ConfigLoader loads the config applied by POST /nacp/reload.
+type ConfigLoader func() (*config.Config, error)
+
+// WithConfigLoader enables POST /nacp/reload, if the config has a reload_endpoint block.
+func WithConfigLoader(load ConfigLoader) Option {
+	return func(o *serverOptions) {
+		o.loadConfig = load
+	}
+}
+
+// ReloadSummary is the response of a successful reload.
+type ReloadSummary struct {
+	Mutators   []string `json:"mutators"`
+	Validators []string `json:"validators"`
+}
+
+func isNacpReload(r *http.Request) bool {
+	return r.URL.Path == nacpReloadPath
+}
+
+// reloadSecret returns the secret of the reload endpoint of the active config, "" if it is disabled.
+func (r *Reloader) reloadSecret() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.options.loadConfig == nil || r.config.ReloadEndpoint == nil {
+		return ""
+	}
+	return r.config.ReloadEndpoint.Secret
+}
+
+// serveReload loads and applies the config, the previous config stays active on errors.
+func (r *Reloader) serveReload(w http.ResponseWriter, req *http.Request, secret string) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get(ReloadSecretHeader)), []byte(secret)) != 1 {
+		r.logger.Warn("Reload request with invalid secret", "remote_addr", req.RemoteAddr)
+		http.Error(w, "invalid reload secret", http.StatusUnauthorized)
+		return
+	}
+	r.logger.Info("Received reload request, reloading config")
+	c, err := r.options.loadConfig()
+	if err == nil {
+		err = r.Reload(c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		r.logger.Error("Failed to reload config, keeping the previous one", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	summary := ReloadSummary{Mutators: []string{}, Validators: []string{}}
+	for _, m := range c.Mutators {
+		summary.Mutators = append(summary.Mutators, m.Name)
+	}
+	for _, v := range c.Validators {
+		summary.Validators = append(summary.Validators, v.Name)
+	}
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadEndpoint(t *testing.T) {
+	withEndpoint := func(c *config.Config) *config.Config {
+		c.ReloadEndpoint = &config.ReloadEndpoint{Secret: "s3cret"}
+		return c
+	}
+	brokenConfig := withEndpoint(reloadTestConfig(t, "info"))
+	brokenConfig.Validators[0].OpaRule.Filename = "does-not-exist.rego"
+
+	tests := []struct {
+		name        string
+		method      string
+		secret      string
+		load        ConfigLoader
+		wantStatus  int
+		wantRebuilt bool
+		wantBody    string
+	}{
+		{
+			name:   "reloads the config",
+			method: http.MethodPost,
+			secret: "s3cret",
+			load: func() (*config.Config, error) {
+				c := withEndpoint(reloadTestConfig(t, "info"))
+				c.Validators[0].OpaRule.Query = "errors = data.dummy.errors\nwarnings = data.dummy.warnings"
+				return c, nil
+			},
+			wantStatus:  http.StatusOK,
+			wantRebuilt: true,
+			wantBody:    `{"mutators":[],"validators":["errors"]}`,
+		},
+		{
+			name:       "keeps the config if it can't be loaded",
+			method:     http.MethodPost,
+			secret:     "s3cret",
+			load:       func() (*config.Config, error) { return nil, errors.New("invalid config") },
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"invalid config"}`,
+		},
+		{
+			name:       "keeps the config if it can't be applied",
+			method:     http.MethodPost,
+			secret:     "s3cret",
+			load:       func() (*config.Config, error) { return brokenConfig, nil },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejects invalid secrets",
+			method:     http.MethodPost,
+			secret:     "guess",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "requires POST",
+			method:     http.MethodGet,
+			secret:     "s3cret",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			load := tc.load
+			if load == nil {
+				load = func() (*config.Config, error) {
+					t.Fatal("config should not be loaded")
+					return nil, nil
+				}
+			}
+			r, err := newReloader(withEndpoint(reloadTestConfig(t, "info")), hclog.NewNullLogger(), &serverOptions{loadConfig: load})
+			require.NoError(t, err)
+			jobHandler := r.jobHandler
+
+			req := httptest.NewRequest(tc.method, "/nacp/reload", nil)
+			req.Header.Set(ReloadSecretHeader, tc.secret)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantBody != "" {
+				assert.JSONEq(t, tc.wantBody, rr.Body.String())
+			}
+			if tc.wantRebuilt {
+				assert.NotSame(t, jobHandler, r.jobHandler)
+			} else {
+				assert.Same(t, jobHandler, r.jobHandler)
+			}
+		})
+	}
+}
+
+func TestReloadEndpointIsDisabledWithoutBlock(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer nomadDummy.Close()
+	c := reloadTestConfig(t, "info")
+	c.Nomad.Address = nomadDummy.URL
+
+	r, err := newReloader(c, hclog.NewNullLogger(), &serverOptions{loadConfig: func() (*config.Config, error) {
+		t.Fatal("config should not be loaded")
+		return nil, nil
+	}})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/nacp/reload", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code, "the request should be proxied")
+}
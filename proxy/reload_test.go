@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reloadTestConfig(t *testing.T, logLevel string) *config.Config {
+	t.Helper()
+	c := config.DefaultConfig()
+	c.LogLevel = logLevel
+	c.Validators = []config.Validator{
+		{
+			Type: "opa",
+			Name: "errors",
+			OpaRule: &config.OpaRule{
+				Query:    "errors = data.dummy.errors",
+				Filename: testutil.Filepath(t, "opa/errors.rego"),
+			},
+		},
+	}
+	return c
+}
+
+func TestReloadOnlyRuntimeSettings(t *testing.T) {
+	logger := hclog.New(&hclog.LoggerOptions{Level: hclog.Info, Output: io.Discard})
+	r, err := newReloader(reloadTestConfig(t, "info"), logger, &serverOptions{})
+	require.NoError(t, err)
+	jobHandler := r.jobHandler
+
+	require.NoError(t, r.Reload(reloadTestConfig(t, "debug")))
+
+	assert.Same(t, jobHandler, r.jobHandler, "controllers should not be rebuilt")
+	assert.Equal(t, hclog.Debug, logger.GetLevel())
+}
+
+func TestReloadRebuildsChangedControllers(t *testing.T) {
+	r, err := newReloader(reloadTestConfig(t, "info"), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	jobHandler := r.jobHandler
+
+	c := reloadTestConfig(t, "info")
+	c.Validators[0].OpaRule.Query = "errors = data.dummy.errors\nwarnings = data.dummy.warnings"
+	require.NoError(t, r.Reload(c))
+
+	assert.NotSame(t, jobHandler, r.jobHandler, "controllers should be rebuilt")
+}
+
+func TestReloadRebuildsOnRuleProvenance(t *testing.T) {
+	r, err := newReloader(reloadTestConfig(t, "info"), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	jobHandler := r.jobHandler
+
+	c := reloadTestConfig(t, "info")
+	c.Response = &config.Response{RuleProvenance: true}
+	require.NoError(t, r.Reload(c))
+
+	assert.NotSame(t, jobHandler, r.jobHandler, "the rules must record their provenance")
+}
+
+func TestReloadRebuildsOnChangedNomad(t *testing.T) {
+	r, err := newReloader(reloadTestConfig(t, "info"), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	jobHandler := r.jobHandler
+
+	c := reloadTestConfig(t, "info")
+	c.Nomad.Address = "http://nomad.example.com:4646"
+	require.NoError(t, r.Reload(c))
+
+	assert.NotSame(t, jobHandler, r.jobHandler, "the quota validator must connect to the new address")
+}
+
+func TestReloadKeepsPreviousConfigOnError(t *testing.T) {
+	r, err := newReloader(reloadTestConfig(t, "info"), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	previous := r.config
+
+	c := reloadTestConfig(t, "info")
+	c.Validators[0].OpaRule.Filename = "does-not-exist.rego"
+	assert.Error(t, r.Reload(c))
+
+	assert.Same(t, previous, r.config)
+}
+
+func TestReloadRebuildsOnChangedDataFile(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "images.json")
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"images": {"allowed": ["nginx:1.25"]}}`), 0600))
+	dataConfig := func() *config.Config {
+		c := reloadTestConfig(t, "info")
+		c.Validators[0].OpaRule = &config.OpaRule{
+			Query:    "errors = data.allowed_images.errors",
+			Filename: testutil.Filepath(t, "opa/validators/allowed_images.rego"),
+			DataFile: dataFile,
+		}
+		return c
+	}
+	r, err := newReloader(dataConfig(), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	jobHandler := r.jobHandler
+
+	require.NoError(t, r.Reload(dataConfig()))
+	assert.Same(t, jobHandler, r.jobHandler, "unchanged data should not rebuild the controllers")
+
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"images": {"allowed": ["redis:7"]}}`), 0600))
+	require.NoError(t, r.Reload(dataConfig()))
+	assert.NotSame(t, jobHandler, r.jobHandler, "changed data should rebuild the controllers")
+}
+
+func TestReloadClosesReplacedControllers(t *testing.T) {
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte("package dummy\n\nerrors = []\n"))
+	}))
+	defer server.Close()
+	fetchesOf := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches[path]
+	}
+	remoteConfig := func(path string) *config.Config {
+		c := reloadTestConfig(t, "info")
+		c.Validators[0].OpaRule.Filename = server.URL + path
+		c.RemotePolicies = &config.RemotePolicies{CacheDir: t.TempDir(), RefreshInterval: "10ms"}
+		return c
+	}
+	r, err := newReloader(remoteConfig("/old.rego"), hclog.NewNullLogger(), &serverOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return fetchesOf("/old.rego") > 1 }, time.Second, 10*time.Millisecond, "the policy should be refreshed")
+
+	require.NoError(t, r.Reload(remoteConfig("/new.rego")))
+	// a refresh may still be running
+	time.Sleep(50 * time.Millisecond)
+	fetched := fetchesOf("/old.rego")
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, fetched, fetchesOf("/old.rego"), "the replaced policy should not be refreshed anymore")
+	assert.Greater(t, fetchesOf("/new.rego"), 1)
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// maxRequestIDLength limits the length of request ids sent by clients.
+const maxRequestIDLength = 128
+
+// withRequestID reuses the request id sent by the client or generates one, echoes it
+// in the response and returns the request and logger carrying it.
+func withRequestID(w http.ResponseWriter, r *http.Request, logger hclog.Logger) (*http.Request, hclog.Logger) {
+	id := r.Header.Get(admissionctrl.RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+		r.Header.Set(admissionctrl.RequestIDHeader, id)
+	}
+	w.Header().Set(admissionctrl.RequestIDHeader, id)
+	return r.WithContext(admissionctrl.WithRequestID(r.Context(), id)), logger.With("request_id", id)
+}
+
+// validRequestID only accepts ids which are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
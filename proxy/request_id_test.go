@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	tt := []struct {
+		name     string
+		clientID string
+		wantID   string
+	}{
+		{name: "generated"},
+		{name: "reused", clientID: "client-id_1.2:3", wantID: "client-id_1.2:3"},
+		{name: "unsafe ids are replaced", clientID: "evil\" request_id=forged"},
+		{name: "long ids are replaced", clientID: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Write([]byte("{}"))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			logs := &bytes.Buffer{}
+			logger := hclog.New(&hclog.LoggerOptions{Level: hclog.Debug, Output: logs, JSONFormat: true})
+			requiredFields := validator.NewRequiredFieldsValidator("fields", validator.RequiredFields{Datacenters: true}, logger.Named("validators"))
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{requiredFields}, logger.Named("handler"))
+			proxy := NewHandler(nomad, jobHandler, logger, nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+			require.NoError(t, err)
+			if tc.clientID != "" {
+				req.Header.Set(admissionctrl.RequestIDHeader, tc.clientID)
+			}
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			id := res.Header.Get(admissionctrl.RequestIDHeader)
+			if tc.wantID != "" {
+				assert.Equal(t, tc.wantID, id)
+			} else {
+				assert.Regexp(t, "^[0-9a-f]{32}$", id)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				assert.Contains(t, line, `"request_id":"`+id+`"`)
+			}
+			assert.Contains(t, logs.String(), "Job is missing required fields", "controller logs carry the request id")
+		})
+	}
+}
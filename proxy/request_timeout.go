@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WithRequestTimeout bounds each request, its admission controllers and the round trip to Nomad,
+// by the timeout. Blocking queries are not bounded, zero disables the timeout.
+func WithRequestTimeout(timeout time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.requestTimeout = timeout
+	}
+}
+
+// withRequestTimeout returns the request with the deadline of the request timeout, if set.
+func (o *handlerOptions) withRequestTimeout(r *http.Request) (*http.Request, context.CancelFunc) {
+	if o.requestTimeout <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), o.requestTimeout)
+	return r.WithContext(ctx), cancel
+}
+
+// isRequestTimeout reports whether the request exceeded its request timeout.
+func isRequestTimeout(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.DeadlineExceeded)
+}
+
+func (o *handlerOptions) writeRequestTimeout(w http.ResponseWriter) {
+	http.Error(w, fmt.Sprintf("request exceeded the request_timeout of %s", o.requestTimeout), http.StatusGatewayTimeout)
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowValidator takes its time unless the request is canceled.
+type slowValidator struct {
+	delay time.Duration
+}
+
+func (v *slowValidator) Validate(ctx context.Context, job *api.Job) ([]error, error) {
+	select {
+	case <-time.After(v.delay):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (v *slowValidator) Name() string {
+	return "slow"
+}
+
+func TestRequestTimeout(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-req.Context().Done():
+			return
+		}
+		rw.Header().Set("X-Nomad-Index", "43")
+		rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name       string
+		method     string
+		path       string
+		timeout    time.Duration
+		delay      time.Duration
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "slow nomad", method: http.MethodGet, path: "/v1/jobs", timeout: 100 * time.Millisecond, wantStatus: http.StatusGatewayTimeout, wantBody: "request exceeded the request_timeout"},
+		{name: "within the timeout", method: http.MethodGet, path: "/v1/jobs", timeout: time.Second, wantStatus: http.StatusOK},
+		{name: "no timeout", method: http.MethodGet, path: "/v1/jobs", wantStatus: http.StatusOK},
+		{name: "blocking queries are not bounded", method: http.MethodGet, path: "/v1/jobs?index=42&wait=5m", timeout: 100 * time.Millisecond, wantStatus: http.StatusOK},
+		// neither the validator nor nomad exceed the timeout on their own, their sum does
+		{name: "admission controllers count", method: http.MethodPut, path: "/v1/jobs", timeout: 400 * time.Millisecond, delay: 200 * time.Millisecond, wantStatus: http.StatusGatewayTimeout, wantBody: "request exceeded the request_timeout"},
+		{name: "slow admission controllers", method: http.MethodPut, path: "/v1/jobs", timeout: 100 * time.Millisecond, delay: time.Second, wantStatus: http.StatusGatewayTimeout, wantBody: "request exceeded the request_timeout of 100ms"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{&slowValidator{delay: tc.delay}}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithRequestTimeout(tc.timeout))
+
+			var body *strings.Reader
+			if tc.method == http.MethodPut {
+				body = strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")}))
+			} else {
+				body = strings.NewReader("")
+			}
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			proxy(rr, httptest.NewRequest(tc.method, tc.path, body))
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tc.wantBody)
+			if tc.wantStatus == http.StatusGatewayTimeout {
+				assert.Less(t, time.Since(start), tc.timeout+200*time.Millisecond, "the request is canceled at its deadline")
+			}
+		})
+	}
+}
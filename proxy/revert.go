@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+var jobRevertPathRegex = regexp.MustCompile(`^/v1/job/[a-zA-Z]+[a-z-Z0-9\-]*/revert$`)
+
+func isRevert(r *http.Request) bool {
+	return r.Method == "PUT" && jobRevertPathRegex.MatchString(r.URL.Path)
+}
+
+// versionFetcher returns the given version of a job, on behalf of the client request.
+type versionFetcher func(r *http.Request, jobID string, version uint64) (*api.Job, error)
+
+// nomadVersionFetcher looks up job versions with the versions endpoint of the Nomad server,
+// forwarding the token, namespace and region of the client request.
+func nomadVersionFetcher(nomadAddress *url.URL, transport http.RoundTripper, maxBodySize int64) versionFetcher {
+	client := &http.Client{Transport: transport}
+	return func(r *http.Request, jobID string, version uint64) (*api.Job, error) {
+		versionsURL := nomadAddress.JoinPath("v1", "job", jobID, "versions")
+		versionsURL.RawQuery = forwardedQuery(r).Encode()
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, versionsURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		forwardAuthorization(r, req)
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		reader := io.Reader(res.Body)
+		if maxBodySize > 0 {
+			reader = io.LimitReader(res.Body, maxBodySize)
+		}
+		if !isSuccess(res) {
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &upstreamError{status: res.StatusCode, body: data}
+		}
+		versions := &api.JobVersionsResponse{}
+		if err := json.NewDecoder(reader).Decode(versions); err != nil {
+			return nil, fmt.Errorf("failed to decode job versions: %w", err)
+		}
+		for _, job := range versions.Versions {
+			if job.Version != nil && *job.Version == version {
+				return job, nil
+			}
+		}
+		return nil, fmt.Errorf("job %s has no version %d", jobID, version)
+	}
+}
+
+// handleRevert validates the job version a revert restores. Mutators are not
+// applied, Nomad restores the version as it was submitted.
+func handleRevert(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, fetch versionFetcher, options *handlerOptions) (*http.Request, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return r, err
+	}
+	revertRequest := &api.JobRevertRequest{}
+	if err := decodeBody(bytes.NewReader(data), revertRequest); err != nil {
+		return r, fmt.Errorf("failed decoding revert request: %w", err)
+	}
+	job, err := fetch(r, revertRequest.JobID, revertRequest.JobVersion)
+	if err != nil {
+		return r, fmt.Errorf("failed fetching version %d of job %s: %w", revertRequest.JobVersion, revertRequest.JobID, err)
+	}
+
+	admissionCtx := admissionContext(r, job)
+	warnings, err := jobHandler.AdmissionValidators(admissionCtx, job)
+	options.auditDecision(admissionCtx, job, warnings, err)
+	if err != nil {
+		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
+	}
+	appLogger.Info("Revert passed admission controllers", "job", revertRequest.JobID, "version", revertRequest.JobVersion)
+
+	if len(warnings) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), ctxWarnings, warnings))
+	}
+	rewriteRequest(r, data)
+	return r, nil
+}
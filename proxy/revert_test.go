@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevert(t *testing.T) {
+	versions := []*api.Job{
+		{ID: pointer.Of("example"), Version: pointer.Of(uint64(1)), Meta: map[string]string{"owner": "anyone"}},
+		{ID: pointer.Of("example"), Version: pointer.Of(uint64(0)), Meta: map[string]string{"owner": "team-a"}},
+	}
+	tests := []struct {
+		name         string
+		version      uint64
+		wantStatus   int
+		wantReverted bool
+		wantBody     string
+		wantWarnings string
+	}{
+		{name: "allowed version", version: 0, wantStatus: http.StatusOK, wantReverted: true, wantWarnings: "1 warning:\n\n* owner meta is deprecated"},
+		{name: "rejected version", version: 1, wantStatus: http.StatusInternalServerError, wantBody: "owner anyone is not allowed"},
+		{name: "unknown version", version: 7, wantStatus: http.StatusInternalServerError, wantBody: "job example has no version 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reverted := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "secret", req.Header.Get("X-Nomad-Token"))
+				assert.Equal(t, "prod", req.URL.Query().Get("namespace"))
+				switch req.URL.Path {
+				case "/v1/job/example/versions":
+					json.NewEncoder(rw).Encode(&api.JobVersionsResponse{Versions: versions})
+				case "/v1/job/example/revert":
+					revert := &api.JobRevertRequest{}
+					require.NoError(t, json.NewDecoder(req.Body).Decode(revert))
+					assert.Equal(t, tt.version, revert.JobVersion)
+					reverted = true
+					json.NewEncoder(rw).Encode(&api.JobRegisterResponse{EvalID: "eval"})
+				default:
+					t.Errorf("unexpected request to %s", req.URL.Path)
+				}
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.MatchedBy(func(job *api.Job) bool { return job.Meta["owner"] == "team-a" })).Return([]error{errors.New("owner meta is deprecated")}, nil)
+			validator.On("Validate", mock.MatchedBy(func(job *api.Job) bool { return job.Meta["owner"] == "anyone" })).Return([]error{}, errors.New("owner anyone is not allowed"))
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			body, err := json.Marshal(&api.JobRevertRequest{JobID: "example", JobVersion: tt.version})
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/job/example/revert?namespace=prod", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("X-Nomad-Token", "secret")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantReverted, reverted)
+			data, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			if tt.wantBody != "" {
+				assert.Contains(t, string(data), tt.wantBody)
+			}
+			if tt.wantWarnings != "" {
+				response := &api.JobRegisterResponse{}
+				require.NoError(t, json.Unmarshal(data, response))
+				assert.Equal(t, tt.wantWarnings, response.Warnings)
+			}
+		})
+	}
+}
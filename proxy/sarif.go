@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"errors"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+)
+
+// Minimal subset of the SARIF 2.1.0 log format
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifDefaultRuleID is used for results which do not originate from a rule
+	sarifDefaultRuleID = "nacp"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind"`
+}
+
+// newSarifLog reports the rejections as errors and the warnings as warnings of a single run.
+func (o *handlerOptions) newSarifLog(job *api.Job, namespace string, rejection error, warnings []error) *sarifLog {
+	var location []sarifLocation
+	if job != nil && job.ID != nil {
+		location = []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{
+			Name:               *job.ID,
+			FullyQualifiedName: namespace + "/" + *job.ID,
+			Kind:               "job",
+		}}}}
+	}
+
+	results := []sarifResult{}
+	var rules []sarifRule
+	seen := map[string]bool{}
+	add := func(err error, level string) {
+		ruleID, msg := o.sarifRuleAndMessage(err)
+		results = append(results, sarifResult{
+			RuleID:    ruleID,
+			Level:     level,
+			Message:   sarifMessage{Text: msg},
+			Locations: location,
+		})
+		if !seen[ruleID] {
+			seen[ruleID] = true
+			rules = append(rules, sarifRule{ID: ruleID})
+		}
+	}
+	for _, err := range flattenErrors(rejection) {
+		add(err, "error")
+	}
+	for _, w := range warnings {
+		for _, err := range flattenErrors(w) {
+			add(err, "warning")
+		}
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "nacp",
+				InformationURI: "https://github.com/mxab/nacp",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+// sarifRuleAndMessage returns the rule id and message text of a single result,
+// taking the rule source settings into account.
+func (o *handlerOptions) sarifRuleAndMessage(err error) (string, string) {
+	messages := ruleMessages(err)
+	if len(messages) != 1 || messages[0].Error() != err.Error() {
+		return sarifDefaultRuleID, o.userFacing(err).Error()
+	}
+	ruleID := messages[0].Rule
+	if o.hideRuleSource {
+		ruleID = sarifDefaultRuleID
+		if o.ruleSourceReplacement != "" {
+			ruleID = o.ruleSourceReplacement
+		}
+	}
+	return ruleID, messages[0].Msg
+}
+
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var merr *multierror.Error
+	if !errors.As(err, &merr) {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range merr.Errors {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
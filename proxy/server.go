@@ -0,0 +1,764 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/admissionctrl/webhook"
+	"github.com/mxab/nacp/config"
+)
+
+// Option configures the server created by New.
+type Option func(*serverOptions)
+
+type serverOptions struct {
+	mutators   []admissionctrl.JobMutator
+	validators []admissionctrl.JobValidator
+	loadConfig ConfigLoader
+}
+
+// WithMutators adds mutators applied after the configured ones.
+func WithMutators(mutators ...admissionctrl.JobMutator) Option {
+	return func(o *serverOptions) {
+		o.mutators = append(o.mutators, mutators...)
+	}
+}
+
+// WithValidators adds validators applied after the configured ones.
+func WithValidators(validators ...admissionctrl.JobValidator) Option {
+	return func(o *serverOptions) {
+		o.validators = append(o.validators, validators...)
+	}
+}
+
+// New creates the NACP server for the config, it is not started yet.
+// Its handler is a *Reloader, to apply config changes at runtime.
+func New(c *config.Config, appLogger hclog.Logger, opts ...Option) (*http.Server, error) {
+	options := &serverOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	// webhooks are only probed at startup, not by reloads or NewJobHandler
+	if err := checkWebhooks(c, appLogger.Named("webhook_check")); err != nil {
+		return nil, fmt.Errorf("webhook check failed: %w", err)
+	}
+	reloader, err := newReloader(c, appLogger, options)
+	if err != nil {
+		return nil, err
+	}
+
+	bind := fmt.Sprintf("%s:%d", c.Bind, c.Port)
+	var tlsConfig *tls.Config
+
+	if c.Tls != nil && c.Tls.CaFile != "" {
+		tlsConfig, err = createTlsConfig(c.Tls.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tls config: %w", err)
+
+		}
+	}
+
+	server := &http.Server{
+		Addr:      bind,
+		TLSConfig: tlsConfig,
+		Handler:   reloader,
+	}
+	return server, nil
+}
+
+// NewJobHandler creates the admission controllers of the config the way New does,
+// to apply them to jobs without running the server.
+func NewJobHandler(c *config.Config, appLogger hclog.Logger, opts ...Option) (*admissionctrl.JobHandler, error) {
+	options := &serverOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	jobHandler, _, err := buildJobHandler(c, appLogger, options)
+	return jobHandler, err
+}
+
+// buildJobHandler creates the admission controllers, compiling all policies.
+// The returned controller set must be closed once the handler is replaced.
+func buildJobHandler(c *config.Config, appLogger hclog.Logger, options *serverOptions) (*admissionctrl.JobHandler, *controllerSet, error) {
+	// build all controllers before failing, to report every broken policy at once
+	jobMutators, mutatorsErr := createMutators(c, appLogger.Named("mutators"))
+	jobValidators, validatorsErr := createValidators(c, appLogger.Named("validators"))
+	controllers := &controllerSet{
+		mutators:        jobMutators,
+		validators:      jobValidators,
+		extraMutators:   options.mutators,
+		extraValidators: options.validators,
+	}
+	if err := multierror.Append(mutatorsErr, validatorsErr).ErrorOrNil(); err != nil {
+		controllers.close()
+		return nil, nil, fmt.Errorf("failed to create admission controllers: %w", err)
+	}
+
+	// stamp the owner last, so no mutator can alter it
+	if c.Identity != nil && c.Identity.StampOwner {
+		controllers.extraMutators = append(append([]admissionctrl.JobMutator{}, options.mutators...), mutator.NewOwnerMutator("nacp_owner", c.Identity.OwnerMetaKey, appLogger.Named("owner_mutator")))
+	}
+	jobMutators, jobValidators, handlerOpts := profileOptions(c, controllers)
+	if c.ValidatorConcurrency > 0 {
+		handlerOpts = append(handlerOpts, admissionctrl.WithValidatorConcurrency(c.ValidatorConcurrency))
+	}
+	if len(c.SkipJobIDPrefixes) > 0 || len(c.SkipNamespaces) > 0 {
+		handlerOpts = append(handlerOpts, admissionctrl.WithSkippedJobs(c.SkipJobIDPrefixes, c.SkipNamespaces))
+	}
+
+	return admissionctrl.NewJobHandler(
+
+		jobMutators,
+		jobValidators,
+		appLogger.Named("handler"),
+		handlerOpts...,
+	), controllers, nil
+}
+
+// buildProxy creates the proxy to Nomad applying the given admission controllers.
+func buildProxy(c *config.Config, appLogger hclog.Logger, handler *admissionctrl.JobHandler, audit *AuditLog, recent *RecentDecisions, readiness *Readiness) (http.Handler, error) {
+	backend, err := nomadAddress(c.Nomad, appLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nomad address: %w", err)
+
+	}
+	transport, err := buildTransport(c.Nomad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create custom transport: %w", err)
+
+	}
+
+	var proxyOpts []HandlerOption
+	token, err := nomadToken(c.Nomad)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		proxyOpts = append(proxyOpts, WithNomadToken(token))
+	}
+	if c.Nomad.BlockingQueryTimeout != "" {
+		timeout, err := time.ParseDuration(c.Nomad.BlockingQueryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocking_query_timeout: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithBlockingQueryTimeout(timeout))
+	}
+	if c.Nomad.RequestTimeout != "" {
+		timeout, err := time.ParseDuration(c.Nomad.RequestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request_timeout: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithRequestTimeout(timeout))
+	}
+	if c.Response != nil && c.Response.HideRuleSource {
+		proxyOpts = append(proxyOpts, WithHiddenRuleSource(c.Response.RuleSourceReplacement))
+	}
+	if c.Response != nil && c.Response.InjectWarnings != nil && !*c.Response.InjectWarnings {
+		proxyOpts = append(proxyOpts, WithoutWarningInjection())
+	}
+	if c.Response != nil && c.Response.WarningTrailers {
+		proxyOpts = append(proxyOpts, WithWarningTrailers())
+	}
+	if c.Response != nil && c.Response.MutateParsedJobs {
+		proxyOpts = append(proxyOpts, WithParsedJobMutation())
+	}
+	if c.Response != nil && c.Response.ValidatePostMutation != nil && !*c.Response.ValidatePostMutation {
+		proxyOpts = append(proxyOpts, WithoutValidateMutation())
+	}
+	if c.Response != nil && c.Response.WarningDigest {
+		proxyOpts = append(proxyOpts, WithWarningDigest(c.Response.CollapseWarnings))
+	}
+	if audit != nil {
+		proxyOpts = append(proxyOpts, WithAuditLog(audit))
+	}
+	if recent != nil {
+		proxyOpts = append(proxyOpts, WithRecentDecisions(recent))
+	}
+	if readiness != nil {
+		proxyOpts = append(proxyOpts, WithReadiness(readiness))
+	}
+	if c.MutationDiff != nil {
+		proxyOpts = append(proxyOpts, WithMutationDiff(c.MutationDiff.Header))
+	}
+	if c.MaxJobSize > 0 {
+		proxyOpts = append(proxyOpts, WithMaxBodySize(c.MaxJobSize))
+	}
+	if len(c.TrustedProxies) > 0 {
+		networks, err := ParseTrustedProxies(c.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		proxyOpts = append(proxyOpts, WithTrustedProxies(networks))
+	}
+	if c.APIAccess != nil {
+		rules := make([]AccessRule, 0, len(c.APIAccess.Rules))
+		for _, rule := range c.APIAccess.Rules {
+			rules = append(rules, AccessRule{Method: rule.Method, Path: rule.Path, Action: rule.Action})
+		}
+		policy, err := NewAccessPolicy(c.APIAccess.DefaultAction, rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create api access policy: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithAccessPolicy(policy))
+	}
+	if c.CORS != nil {
+		var maxAge time.Duration
+		if c.CORS.MaxAge != "" {
+			if maxAge, err = time.ParseDuration(c.CORS.MaxAge); err != nil {
+				return nil, fmt.Errorf("failed to parse cors max_age: %w", err)
+			}
+		}
+		proxyOpts = append(proxyOpts, WithCORS(&CORSPolicy{
+			AllowedOrigins: c.CORS.AllowedOrigins,
+			AllowedMethods: c.CORS.AllowedMethods,
+			AllowedHeaders: c.CORS.AllowedHeaders,
+			MaxAge:         maxAge,
+		}))
+	}
+	if c.RateLimit != nil {
+		limiter, err := NewRateLimiter(c.RateLimit.Rate, c.RateLimit.Burst, c.RateLimit.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rate limiter: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithRateLimiter(limiter))
+	}
+	for _, region := range c.NomadRegions {
+		address, err := nomadAddress(region, appLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse nomad address of region %s: %w", region.Region, err)
+		}
+		regionTransport, err := buildTransport(region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transport of region %s: %w", region.Region, err)
+		}
+		proxyOpts = append(proxyOpts, WithRegionBackend(region.Region, address, regionTransport))
+	}
+	if c.Identity != nil {
+		// tokens are replicated from the authoritative region, the default server resolves all of them
+		resolver, err := newNomadTokenResolver(backend.String(), transport)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token resolver: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithTokenResolver(resolver))
+	}
+
+	return http.HandlerFunc(NewHandler(backend, handler, appLogger, transport, proxyOpts...)), nil
+}
+
+// checkWebhooks verifies all enabled webhooks are reachable. Unreachable
+// webhooks are logged, and only fail the startup if they are configured to.
+func checkWebhooks(c *config.Config, logger hclog.Logger) error {
+	var webhooks []namedWebhook
+	for _, v := range c.Validators {
+		if v.Webhook != nil && v.IsEnabled() {
+			webhooks = append(webhooks, namedWebhook{v.Name, v.Webhook})
+		}
+	}
+	for _, m := range c.Mutators {
+		if m.Webhook != nil && m.IsEnabled() {
+			webhooks = append(webhooks, namedWebhook{m.Name, m.Webhook})
+		}
+	}
+
+	var errs error
+	for _, w := range webhooks {
+		err := checkWebhook(w.webhook)
+		if err == nil {
+			logger.Debug("Webhook is reachable", "name", w.name, "endpoint", w.webhook.Endpoint)
+			continue
+		}
+		if w.webhook.FailOnUnreachable {
+			errs = multierror.Append(errs, fmt.Errorf("webhook %s is unreachable: %w", w.name, err))
+		} else {
+			logger.Warn("Webhook is unreachable", "name", w.name, "endpoint", w.webhook.Endpoint, "error", err)
+		}
+	}
+	return errs
+}
+
+type namedWebhook struct {
+	name    string
+	webhook *config.Webhook
+}
+
+func checkWebhook(webhook *config.Webhook) error {
+	endpoint, err := url.Parse(webhook.Endpoint)
+	if err != nil {
+		return err
+	}
+	method := http.MethodHead
+	if webhook.HealthPath != "" {
+		method = http.MethodGet
+		endpoint = endpoint.ResolveReference(&url.URL{Path: webhook.HealthPath})
+	}
+	req, err := http.NewRequest(method, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	if webhook.TLS != nil {
+		if client.Transport, err = buildWebhookTransport(*webhook.TLS); err != nil {
+			return err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// newNomadTokenResolver resolves tokens by looking them up at the Nomad backend.
+func newNomadTokenResolver(address string, transport *http.Transport) (TokenResolver, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if transport != nil {
+		httpClient.Transport = transport
+	}
+	client, err := api.NewClient(&api.Config{
+		Address:    address,
+		HttpClient: httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(secretID string) (*api.ACLToken, error) {
+		token, _, err := client.ACLTokens().Self(&api.QueryOptions{AuthToken: secretID})
+		return token, err
+	}, nil
+}
+
+// NewNomadClient creates an api client for the Nomad server, with the same transport as the proxy.
+// Without a token it uses NACP's own token of the config, if there is one.
+func NewNomadClient(nomad *config.NomadServer, token string) (*api.Client, error) {
+	address, err := nomadAddress(nomad, hclog.NewNullLogger())
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		if token, err = nomadToken(nomad); err != nil {
+			return nil, err
+		}
+	}
+	transport, err := buildTransport(nomad)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewClient(&api.Config{
+		Address:    address.String(),
+		SecretID:   token,
+		HttpClient: &http.Client{Transport: transport},
+	})
+}
+
+// nomadToken returns NACP's own Nomad token, read from the token_file if set.
+func nomadToken(nomad *config.NomadServer) (string, error) {
+	if nomad.TokenFile == "" {
+		return nomad.Token, nil
+	}
+	data, err := os.ReadFile(nomad.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nomad token_file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func createTlsConfig(caFile string) (*tls.Config, error) {
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+	tlsConfig := &tls.Config{
+		ClientCAs:  caCertPool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+
+	return tlsConfig, nil
+}
+
+func opaQueryOptions(c *config.Config) ([]opa.QueryOption, error) {
+	var opts []opa.QueryOption
+	if c.OpaInput != nil && c.OpaInput.Request != nil {
+		opts = append(opts, opa.WithRequestInput(opa.RequestInput(*c.OpaInput.Request)))
+	}
+	if c.Response != nil && c.Response.RuleProvenance {
+		opts = append(opts, opa.WithProvenance())
+	}
+	if c.OpaInput != nil && c.OpaInput.CurrentJob {
+		opts = append(opts, opa.WithCurrentJobInput())
+	}
+	if c.OpaInput != nil && c.OpaInput.Normalized {
+		opts = append(opts, opa.WithNormalizedInput())
+	}
+	if c.PolicyVerification != nil {
+		key, err := opa.LoadVerificationKey(c.PolicyVerification.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy verification key: %w", err)
+		}
+		opts = append(opts, opa.WithVerificationKey(key))
+	}
+	if v := c.BundleVerification; v != nil {
+		key, err := os.ReadFile(v.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load bundle verification key: %w", err)
+		}
+		opts = append(opts, opa.WithBundleVerification(opa.BundleVerification{
+			KeyID:     v.KeyID,
+			PublicKey: string(key),
+			Algorithm: v.Algorithm,
+			Scope:     v.Scope,
+			Exclude:   v.ExcludeFiles,
+		}))
+	}
+	if c.RemotePolicies == nil {
+		return opts, nil
+	}
+	refreshInterval := 5 * time.Minute
+	if c.RemotePolicies.RefreshInterval != "" {
+		var err error
+		refreshInterval, err = time.ParseDuration(c.RemotePolicies.RefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote policies refresh interval: %w", err)
+		}
+	}
+	return append(opts, opa.WithRemoteCache(c.RemotePolicies.CacheDir, refreshInterval)), nil
+}
+
+// opaRuleOptions adds the rule specific options to the shared query options.
+func opaRuleOptions(rule *config.OpaRule, opts []opa.QueryOption) []opa.QueryOption {
+	opts = opts[:len(opts):len(opts)]
+	if rule.BundlePath != "" {
+		opts = append(opts, opa.WithBundle(rule.BundlePath))
+	}
+	if rule.Checksum != "" {
+		opts = append(opts, opa.WithChecksum(rule.Checksum))
+	}
+	if rule.MinLevel != "" {
+		opts = append(opts, opa.WithMinLevel(rule.MinLevel))
+	}
+	if rule.DataFile != "" {
+		opts = append(opts, opa.WithDataFile(rule.DataFile))
+	}
+	return opts
+}
+
+func webhookClientOptions(c *config.Config, w *config.Webhook) ([]webhook.ClientOption, error) {
+	var opts []webhook.ClientOption
+	if c.MaxJobSize > 0 {
+		opts = append(opts, webhook.WithMaxResponseSize(c.MaxJobSize))
+	}
+	if w != nil && w.TLS != nil {
+		transport, err := buildWebhookTransport(*w.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("webhook tls: %w", err)
+		}
+		opts = append(opts, webhook.WithTransport(transport))
+	}
+	if w == nil || w.Retry == nil {
+		return opts, nil
+	}
+	policy := webhook.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     100 * time.Millisecond,
+		MaxElapsed:  10 * time.Second,
+	}
+	if w.Retry.MaxAttempts > 0 {
+		policy.MaxAttempts = w.Retry.MaxAttempts
+	}
+	for _, setting := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"backoff", w.Retry.Backoff, &policy.Backoff},
+		{"jitter", w.Retry.Jitter, &policy.Jitter},
+		{"max_elapsed", w.Retry.MaxElapsed, &policy.MaxElapsed},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook retry %s: %w", setting.name, err)
+		}
+		*setting.target = d
+	}
+	return append(opts, webhook.WithRetry(policy)), nil
+}
+
+// createMutators creates the configured mutators with the factories registered for their types.
+// A failing mutator doesn't stop creating the others, all errors are returned together.
+func createMutators(c *config.Config, logger hclog.Logger) ([]admissionctrl.JobMutator, error) {
+	var jobMutators []admissionctrl.JobMutator
+	var errs *multierror.Error
+	for _, m := range c.Mutators {
+		if !m.IsEnabled() {
+			logger.Info("Skipping disabled mutator", "mutator", m.Name)
+			continue
+		}
+		factory, ok := admissionctrl.LookupMutatorFactory(m.Type)
+		if !ok {
+			errs = multierror.Append(errs, fmt.Errorf("unknown mutator type %s", m.Type))
+			continue
+		}
+		timeout, err := controllerTimeout(m.Timeout)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("mutator %s: %w", m.Name, err))
+			continue
+		}
+		mutator, err := factory(c, m, logger)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		mutator = admissionctrl.LimitMutator(admissionctrl.ScopeMutator(mutator, m.Namespace), timeout)
+		if m.Phase == "post" {
+			mutator = admissionctrl.PostValidationMutator(mutator)
+		}
+		jobMutators = append(jobMutators, mutator)
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		for _, controller := range jobMutators {
+			admissionctrl.CloseController(controller)
+		}
+		return nil, err
+	}
+	return jobMutators, nil
+}
+
+// createValidators creates the configured validators with the factories registered for their types.
+// A failing validator doesn't stop creating the others, all errors are returned together.
+func createValidators(c *config.Config, logger hclog.Logger) ([]admissionctrl.JobValidator, error) {
+	var jobValidators []admissionctrl.JobValidator
+	var errs *multierror.Error
+	for _, v := range c.Validators {
+		if !v.IsEnabled() {
+			logger.Info("Skipping disabled validator", "validator", v.Name)
+			continue
+		}
+		factory, ok := admissionctrl.LookupValidatorFactory(v.Type)
+		if !ok {
+			errs = multierror.Append(errs, fmt.Errorf("unknown validator type %s", v.Type))
+			continue
+		}
+		timeout, err := controllerTimeout(v.Timeout)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("validator %s: %w", v.Name, err))
+			continue
+		}
+		validator, err := factory(c, v, logger)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		validator = admissionctrl.LimitValidator(admissionctrl.ScopeValidator(validator, v.Namespace), timeout)
+		if v.EnforcementLevel == "warn" {
+			validator = admissionctrl.WarnOnlyValidator(validator)
+		}
+		jobValidators = append(jobValidators, validator)
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		for _, controller := range jobValidators {
+			admissionctrl.CloseController(controller)
+		}
+		return nil, err
+	}
+	return jobValidators, nil
+}
+
+func controllerTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %w", err)
+	}
+	return timeout, nil
+}
+
+// unixSocketHost is the placeholder host of requests to a Nomad agent on a unix socket.
+const unixSocketHost = "nomad.sock"
+
+// nomadAddress parses the address of the Nomad server, which must be an http(s) url
+// or a unix socket like unix:///var/run/nomad.sock.
+// With a tls block an http address is upgraded to https.
+func nomadAddress(nomad *config.NomadServer, logger hclog.Logger) (*url.URL, error) {
+	address, err := url.Parse(nomad.Address)
+	if err != nil {
+		return nil, err
+	}
+	if address.Scheme == "unix" {
+		if address.Path == "" {
+			return nil, fmt.Errorf("address %q requires a socket path like unix:///var/run/nomad.sock", nomad.Address)
+		}
+		scheme := "http"
+		if nomad.TLS != nil {
+			scheme = "https"
+		}
+		return &url.URL{Scheme: scheme, Host: unixSocketHost}, nil
+	}
+	if (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return nil, fmt.Errorf("address %q must be an http or https url like http://localhost:4646", nomad.Address)
+	}
+	if nomad.TLS != nil && address.Scheme == "http" {
+		logger.Warn("Nomad has a tls block but an http address, using https", "address", nomad.Address)
+		upgraded := *address
+		upgraded.Scheme = "https"
+		return &upgraded, nil
+	}
+	return address, nil
+}
+
+// DefaultMaxIdleConns is the number of idle connections kept open to Nomad.
+// All requests go to the same host, so it is also the default per host,
+// instead of the 2 of Go's default transport, which would close most connections after a burst.
+const DefaultMaxIdleConns = 100
+
+// buildTransport creates the transport to Nomad with the configured timeouts
+// and, if configured, TLS.
+func buildTransport(nomad *config.NomadServer) (*http.Transport, error) {
+	dialTimeout := 30 * time.Second
+	tlsHandshakeTimeout := 10 * time.Second
+	var responseHeaderTimeout time.Duration
+	idleConnTimeout := 90 * time.Second
+	for _, setting := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"dial_timeout", nomad.DialTimeout, &dialTimeout},
+		{"tls_handshake_timeout", nomad.TLSHandshakeTimeout, &tlsHandshakeTimeout},
+		{"response_header_timeout", nomad.ResponseHeaderTimeout, &responseHeaderTimeout},
+		{"idle_conn_timeout", nomad.IdleConnTimeout, &idleConnTimeout},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", setting.name, err)
+		}
+		*setting.target = d
+	}
+
+	transport := &http.Transport{}
+	if nomad.TLS != nil {
+		var err error
+		transport, err = buildCustomTransport(*nomad.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = dialer.DialContext
+	if address, err := url.Parse(nomad.Address); err == nil && address.Scheme == "unix" {
+		// every connection goes to the socket, whatever the placeholder host
+		socket := address.Path
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.MaxIdleConns = DefaultMaxIdleConns
+	transport.MaxIdleConnsPerHost = DefaultMaxIdleConns
+	if nomad.MaxIdleConns > 0 {
+		transport.MaxIdleConns = nomad.MaxIdleConns
+	}
+	if nomad.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = nomad.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = nomad.MaxConnsPerHost
+	// the custom dialer and tls config would disable HTTP/2 without forcing it
+	transport.ForceAttemptHTTP2 = !nomad.DisableHTTP2
+	if nomad.DisableHTTP2 {
+		// a non nil empty map prevents the transport from upgrading to HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, nil
+}
+
+func buildCustomTransport(config config.NomadServerTLS) (*http.Transport, error) {
+	// Create a custom transport to allow for self-signed certs
+	// and to allow for a custom timeout
+
+	//load key pair
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// create CA pool
+	caCert, err := os.ReadFile(config.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.InsecureSkipVerify,
+
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      caCertPool,
+		},
+	}
+	return transport, err
+}
+
+// buildWebhookTransport creates a transport of its own for the webhook,
+// which is a different trust domain than Nomad. The certificate chain is verified
+// against the ca_file, or the system roots without it.
+func buildWebhookTransport(config config.WebhookTLS) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.CaFile != "" {
+		caCert, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CaFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -0,0 +1,965 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/hashicorp/nomad/helper/tlsutil"
+	"github.com/hashicorp/nomad/lib/file"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/admissionctrl/webhook"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithDefaultConfig(t *testing.T) {
+	server, err := New(config.DefaultConfig(), hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	assert.Equal(t, "0.0.0.0:6464", server.Addr)
+	assert.IsType(t, &Reloader{}, server.Handler)
+}
+
+func TestNewWithCustomControllers(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		job := &api.JobRegisterRequest{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(job))
+		assert.Equal(t, "world", job.Job.Meta["hello"], "custom mutator was applied")
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+
+	c := config.DefaultConfig()
+	c.Nomad.Address = nomadDummy.URL
+	server, err := New(c, hclog.NewNullLogger(),
+		WithMutators(&testutil.HelloMutator{}),
+		WithValidators(mockValidatorReturningWarnings("custom warning")),
+	)
+	require.NoError(t, err)
+	proxyServer := httptest.NewServer(server.Handler)
+	defer proxyServer.Close()
+
+	resp, _, err := buildNomadClient(t, proxyServer).Jobs().Register(testutil.ReadJob(t, "job.json"), nil)
+	require.NoError(t, err)
+	assert.Contains(t, resp.Warnings, "custom warning")
+}
+
+func TestWebhooksAreOnlyCheckedByNew(t *testing.T) {
+	unreachable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	unreachable.Close()
+
+	c := config.DefaultConfig()
+	c.Validators = []config.Validator{{
+		Type:    "webhook",
+		Name:    "unreachable",
+		Webhook: &config.Webhook{Endpoint: unreachable.URL + "/validate", Method: "POST", FailOnUnreachable: true},
+	}}
+
+	_, err := New(c, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "webhook check failed")
+
+	// validate and preview build the handler without probing the webhooks
+	_, err = NewJobHandler(c, hclog.NewNullLogger())
+	assert.NoError(t, err)
+}
+
+func TestCreateValidators(t *testing.T) {
+
+	tt := []struct {
+		name       string
+		validators config.Validator
+		want       admissionctrl.JobValidator
+		wantErr    bool
+	}{
+
+		{
+			name: "opa validator",
+			validators: config.Validator{
+
+				Type: "opa",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			want: &validator.OpaValidator{},
+		},
+		{
+			name: "opa validator from bundle",
+			validators: config.Validator{
+
+				Type: "opa",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:      "errors = data.bundle.owner.errors",
+					BundlePath: testutil.Filepath(t, "opa/bundle"),
+				},
+			},
+			want: &validator.OpaValidator{},
+		},
+		{
+			name: "opa validator without filename or bundle",
+			validators: config.Validator{
+
+				Type: "opa",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query: "errors = data.dummy.errors",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "webhook validator",
+			validators: config.Validator{
+
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+			},
+			want: &validator.WebhookValidator{},
+		},
+		{
+			name: "required fields validator",
+			validators: config.Validator{
+
+				Type: "required_fields",
+				Name: "test",
+				RequiredFields: &config.RequiredFields{
+					Datacenters: true,
+				},
+			},
+			want: &validator.RequiredFieldsValidator{},
+		},
+		{
+			name: "resource cores validator",
+			validators: config.Validator{
+
+				Type: "resource_cores",
+				Name: "test",
+			},
+			want: &validator.ResourceCoresValidator{},
+		},
+		{
+			name: "service provider validator",
+			validators: config.Validator{
+
+				Type: "service_provider",
+				Name: "test",
+				ServiceProvider: &config.ServiceProvider{
+					Allowed: []string{"nomad"},
+				},
+			},
+			want: &validator.ServiceProviderValidator{},
+		},
+		{
+			name: "client disconnect validator",
+			validators: config.Validator{
+
+				Type: "client_disconnect",
+				Name: "test",
+				ClientDisconnect: &config.ClientDisconnect{
+					JobTypes: []string{"service"},
+					Min:      "1h",
+					Max:      "24h",
+				},
+			},
+			want: &validator.ClientDisconnectValidator{},
+		},
+		{
+			name: "client disconnect validator with invalid duration",
+			validators: config.Validator{
+
+				Type: "client_disconnect",
+				Name: "test",
+				ClientDisconnect: &config.ClientDisconnect{
+					Min: "one hour",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "csi plugin validator requires identity",
+			validators: config.Validator{
+
+				Type:      "csi_plugin",
+				Name:      "test",
+				CSIPlugin: &config.CSIPlugin{AllowedTokens: []string{"ops"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid validator type",
+			validators: config.Validator{
+
+				Type: "invalid",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{
+				Validators: []config.Validator{tc.validators},
+			}
+
+			validators, err := createValidators(c, hclog.NewNullLogger())
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.IsType(t, tc.want, validators[0])
+
+		})
+
+	}
+}
+
+func TestCreateCSIPluginValidator(t *testing.T) {
+	c := &config.Config{
+		Identity: &config.Identity{},
+		Validators: []config.Validator{{
+			Type:      "csi_plugin",
+			Name:      "test",
+			CSIPlugin: &config.CSIPlugin{AllowedTokens: []string{"ops"}},
+		}},
+	}
+
+	validators, err := createValidators(c, hclog.NewNullLogger())
+
+	require.NoError(t, err)
+	assert.IsType(t, &validator.CSIPluginValidator{}, validators[0])
+}
+
+func TestCreateWarnOnlyValidators(t *testing.T) {
+	c := &config.Config{
+		Validators: []config.Validator{
+			{Type: "resource_cores", Name: "enforced"},
+			{Type: "resource_cores", Name: "observed", EnforcementLevel: "warn"},
+		},
+	}
+	validators, err := createValidators(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.Len(t, validators, 2)
+
+	_, advisory := validators[0].(admissionctrl.Advisory)
+	assert.False(t, advisory)
+	assert.True(t, validators[1].(admissionctrl.Advisory).WarnOnly())
+	assert.Equal(t, "observed", validators[1].Name())
+}
+
+func TestCreatePostValidationMutators(t *testing.T) {
+	c := &config.Config{
+		Mutators: []config.Mutator{
+			{Type: "meta_defaults", Name: "normalize", MetaDefaults: &config.MetaDefaults{Meta: map[string]string{"a": "b"}}},
+			{Type: "meta_defaults", Name: "defaults", Phase: "post", MetaDefaults: &config.MetaDefaults{Meta: map[string]string{"a": "b"}}},
+		},
+	}
+	mutators, err := createMutators(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.Len(t, mutators, 2)
+
+	_, phased := mutators[0].(admissionctrl.PostValidation)
+	assert.False(t, phased)
+	assert.True(t, mutators[1].(admissionctrl.PostValidation).AfterValidation())
+	assert.Equal(t, "defaults", mutators[1].Name())
+}
+
+func TestCreateMutatators(t *testing.T) {
+	tt := []struct {
+		name     string
+		mutators config.Mutator
+		want     admissionctrl.JobMutator
+		wantErr  bool
+	}{
+		{
+			name: "opa json patch mutator",
+			mutators: config.Mutator{
+
+				Type: "opa_json_patch",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			want: &mutator.OpaJsonPatchMutator{},
+		},
+		{
+			name: "webhook json patch mutator",
+			mutators: config.Mutator{
+
+				Type: "json_patch_webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+			},
+			want: &mutator.JsonPatchWebhookMutator{},
+		},
+		{
+			name: "meta defaults mutator",
+			mutators: config.Mutator{
+
+				Type: "meta_defaults",
+				Name: "test",
+				MetaDefaults: &config.MetaDefaults{
+					Meta: map[string]string{"submitted_by": "nacp"},
+				},
+			},
+			want: &mutator.MetaDefaultsMutator{},
+		},
+		{
+			name: "datacenter defaults mutator",
+			mutators: config.Mutator{
+
+				Type: "datacenter_defaults",
+				Name: "test",
+				DatacenterDefaults: &config.DatacenterDefaults{
+					Datacenters: []string{"dc1"},
+				},
+			},
+			want: &mutator.DatacenterDefaultsMutator{},
+		},
+		{
+			name: "job id namespace mutator",
+			mutators: config.Mutator{
+
+				Type: "job_id_namespace",
+				Name: "test",
+				JobIDNamespace: &config.JobIDNamespace{
+					Prefixes: map[string]string{"billing-": "billing"},
+				},
+			},
+			want: &mutator.JobIDNamespaceMutator{},
+		},
+		{
+			name: "job id namespace mutator without block",
+			mutators: config.Mutator{
+
+				Type: "job_id_namespace",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "meta defaults mutator without block",
+			mutators: config.Mutator{
+
+				Type: "meta_defaults",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid mutator type",
+			mutators: config.Mutator{
+
+				Type: "invalid",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{
+				Mutators: []config.Mutator{tc.mutators},
+			}
+
+			mutators, err := createMutators(c, hclog.NewNullLogger())
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.IsType(t, tc.want, mutators[0])
+
+		})
+
+	}
+}
+
+func TestCreateTlsConfig(t *testing.T) {
+	caCertFileName, _, _, _, cleanup := generateTLSData(t)
+	defer cleanup()
+	config, err := createTlsConfig(caCertFileName)
+	assert.NoError(t, err)
+	assert.NotNil(t, config)
+}
+func TestBuildCustomTransport(t *testing.T) {
+
+	caCertFileName, _, certFileName, pkFileName, cleanup := generateTLSData(t)
+	defer cleanup()
+
+	tls := config.NomadServerTLS{
+		CaFile:   caCertFileName,
+		CertFile: certFileName,
+		KeyFile:  pkFileName,
+	}
+	transport, err := buildCustomTransport(tls)
+	assert.NoError(t, err)
+	assert.NotNil(t, transport)
+
+}
+
+func TestWebhookMTLS(t *testing.T) {
+	caCertFileName, _, certFileName, pkFileName, cleanup := generateTLSData(t)
+	defer cleanup()
+
+	serverTLS, err := createTlsConfig(caCertFileName)
+	require.NoError(t, err)
+	serverCert, err := tls.LoadX509KeyPair(certFileName, pkFileName)
+	require.NoError(t, err)
+	serverTLS.Certificates = []tls.Certificate{serverCert}
+
+	hook := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"errors": []}`))
+	}))
+	hook.TLS = serverTLS
+	hook.StartTLS()
+	defer hook.Close()
+
+	tests := []struct {
+		name    string
+		tls     *config.WebhookTLS
+		wantErr string
+	}{
+		{name: "client certificate", tls: &config.WebhookTLS{CaFile: caCertFileName, CertFile: certFileName, KeyFile: pkFileName}},
+		{name: "without client certificate", tls: &config.WebhookTLS{CaFile: caCertFileName}, wantErr: "certificate"},
+		{name: "unknown authority", tls: &config.WebhookTLS{CertFile: certFileName, KeyFile: pkFileName}, wantErr: "certificate signed by unknown authority"},
+		{name: "without tls block", wantErr: "certificate signed by unknown authority"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := webhookClientOptions(&config.Config{}, &config.Webhook{Endpoint: hook.URL, TLS: tc.tls})
+			require.NoError(t, err)
+
+			resp, err := webhook.NewClient(opts...).Do(context.Background(), http.MethodPost, hook.URL, []byte("{}"))
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+
+	t.Run("health check uses the tls block", func(t *testing.T) {
+		w := &config.Webhook{Endpoint: hook.URL, TLS: &config.WebhookTLS{CaFile: caCertFileName, CertFile: certFileName, KeyFile: pkFileName}}
+		assert.NoError(t, checkWebhook(w))
+	})
+}
+
+func TestBuildTransport(t *testing.T) {
+	caCertFileName, _, certFileName, pkFileName, cleanup := generateTLSData(t)
+	defer cleanup()
+
+	t.Run("defaults", func(t *testing.T) {
+		transport, err := buildTransport(&config.NomadServer{Address: "http://localhost:4646"})
+		require.NoError(t, err)
+		assert.NotNil(t, transport.DialContext)
+		assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, time.Duration(0), transport.ResponseHeaderTimeout)
+		assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+		assert.Nil(t, transport.TLSClientConfig)
+		assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+		assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 0, transport.MaxConnsPerHost)
+	})
+	t.Run("connection pool", func(t *testing.T) {
+		transport, err := buildTransport(&config.NomadServer{Address: "http://localhost:4646", MaxIdleConns: 50, MaxIdleConnsPerHost: 20, MaxConnsPerHost: 200})
+		require.NoError(t, err)
+		assert.Equal(t, 50, transport.MaxIdleConns)
+		assert.Equal(t, 20, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 200, transport.MaxConnsPerHost)
+	})
+	t.Run("connections are reused after a burst", func(t *testing.T) {
+		var newConns atomic.Int32
+		nomad := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			rw.Write([]byte("{}"))
+		}))
+		nomad.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				newConns.Add(1)
+			}
+		}
+		nomad.Start()
+		defer nomad.Close()
+
+		transport, err := buildTransport(&config.NomadServer{Address: nomad.URL})
+		require.NoError(t, err)
+		client := &http.Client{Transport: transport}
+
+		const concurrency = 10
+		for burst := 0; burst < 3; burst++ {
+			var wg sync.WaitGroup
+			for i := 0; i < concurrency; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					res, err := client.Get(nomad.URL)
+					if assert.NoError(t, err) {
+						io.Copy(io.Discard, res.Body)
+						res.Body.Close()
+					}
+				}()
+			}
+			wg.Wait()
+		}
+		assert.LessOrEqual(t, int(newConns.Load()), concurrency, "later bursts reuse the idle connections")
+	})
+	t.Run("timeouts apply with tls", func(t *testing.T) {
+		transport, err := buildTransport(&config.NomadServer{
+			Address: "https://localhost:4646",
+			TLS: &config.NomadServerTLS{
+				CaFile:   caCertFileName,
+				CertFile: certFileName,
+				KeyFile:  pkFileName,
+			},
+			DialTimeout:           "1s",
+			TLSHandshakeTimeout:   "2s",
+			ResponseHeaderTimeout: "3s",
+			IdleConnTimeout:       "4s",
+		})
+		require.NoError(t, err)
+		assert.NotNil(t, transport.TLSClientConfig)
+		assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, 3*time.Second, transport.ResponseHeaderTimeout)
+		assert.Equal(t, 4*time.Second, transport.IdleConnTimeout)
+	})
+	t.Run("invalid duration", func(t *testing.T) {
+		_, err := buildTransport(&config.NomadServer{Address: "http://localhost:4646", DialTimeout: "soon"})
+		assert.ErrorContains(t, err, "dial_timeout")
+	})
+	t.Run("response header timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer slow.Close()
+		transport, err := buildTransport(&config.NomadServer{Address: slow.URL, ResponseHeaderTimeout: "50ms"})
+		require.NoError(t, err)
+
+		_, err = (&http.Client{Transport: transport}).Get(slow.URL)
+		assert.ErrorContains(t, err, "timeout awaiting response headers")
+	})
+}
+
+func TestNomadHTTP2(t *testing.T) {
+	caCertFileName, _, certFileName, pkFileName, cleanup := generateTLSData(t)
+	defer cleanup()
+
+	serverTLS, err := createTlsConfig(caCertFileName)
+	require.NoError(t, err)
+	serverCert, err := tls.LoadX509KeyPair(certFileName, pkFileName)
+	require.NoError(t, err)
+	serverTLS.Certificates = []tls.Certificate{serverCert}
+	serverTLS.NextProtos = []string{"h2", "http/1.1"}
+
+	// the event stream sends its events as they happen, the proxy must not buffer them
+	release := make(chan struct{})
+	var protocol atomic.Value
+	nomad := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		protocol.Store(req.Proto)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"Index": 1}` + "\n"))
+		rw.(http.Flusher).Flush()
+		<-release
+		rw.Write([]byte(`{"Index": 2}` + "\n"))
+	}))
+	nomad.EnableHTTP2 = true
+	nomad.TLS = serverTLS
+	nomad.StartTLS()
+	defer nomad.Close()
+	nomadURL, err := url.Parse(nomad.URL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		disableHTTP2 bool
+		wantProto    string
+	}{
+		{name: "http2", wantProto: "HTTP/2.0"},
+		{name: "disabled", disableHTTP2: true, wantProto: "HTTP/1.1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transport, err := buildTransport(&config.NomadServer{
+				Address:      nomad.URL,
+				DisableHTTP2: tc.disableHTTP2,
+				TLS:          &config.NomadServerTLS{CaFile: caCertFileName, CertFile: certFileName, KeyFile: pkFileName},
+			})
+			require.NoError(t, err)
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{}, hclog.NewNullLogger())
+			proxy := httptest.NewServer(http.HandlerFunc(NewHandler(nomadURL, jobHandler, hclog.NewNullLogger(), transport)))
+			defer proxy.Close()
+
+			resp, err := http.Get(proxy.URL + "/v1/event/stream")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, int64(-1), resp.ContentLength, "the stream stays chunked")
+
+			events := json.NewDecoder(resp.Body)
+			var event map[string]interface{}
+			require.NoError(t, events.Decode(&event), "the first event arrives before the stream ends")
+			assert.Equal(t, float64(1), event["Index"])
+			assert.Equal(t, tc.wantProto, protocol.Load())
+
+			release <- struct{}{}
+			require.NoError(t, events.Decode(&event))
+			assert.Equal(t, float64(2), event["Index"])
+		})
+	}
+}
+
+func TestNomadAddress(t *testing.T) {
+	tt := []struct {
+		name    string
+		nomad   *config.NomadServer
+		want    string
+		wantErr string
+	}{
+		{name: "http", nomad: &config.NomadServer{Address: "http://localhost:4646"}, want: "http://localhost:4646"},
+		{name: "https with tls", nomad: &config.NomadServer{Address: "https://localhost:4646", TLS: &config.NomadServerTLS{}}, want: "https://localhost:4646"},
+		{name: "http with tls is upgraded", nomad: &config.NomadServer{Address: "http://localhost:4646", TLS: &config.NomadServerTLS{}}, want: "https://localhost:4646"},
+		{name: "missing scheme", nomad: &config.NomadServer{Address: "localhost:4646"}, wantErr: "must be an http or https url"},
+		{name: "unsupported scheme", nomad: &config.NomadServer{Address: "tcp://localhost:4646"}, wantErr: "must be an http or https url"},
+		{name: "unix socket", nomad: &config.NomadServer{Address: "unix:///var/run/nomad.sock"}, want: "http://nomad.sock"},
+		{name: "unix socket without path", nomad: &config.NomadServer{Address: "unix://"}, wantErr: "requires a socket path"},
+		{name: "missing host", nomad: &config.NomadServer{Address: "http://"}, wantErr: "must be an http or https url"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			address, err := nomadAddress(tc.nomad, hclog.NewNullLogger())
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, address.String())
+		})
+	}
+}
+
+func TestUnixSocketBackend(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "nomad.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	nomad := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(rw, `{"path":%q}`, req.URL.Path)
+	}))
+	nomad.Listener = listener
+	nomad.Start()
+	defer nomad.Close()
+
+	c := config.DefaultConfig()
+	c.Nomad.Address = "unix://" + socket
+	require.NoError(t, c.Validate())
+	server, err := New(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	proxy := httptest.NewServer(server.Handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/v1/agent/self")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"path":"/v1/agent/self"}`, string(body))
+}
+
+func generateTLSData(t *testing.T) (caCertFileName, caPkFileName, certFileName, pkFileName string, cleanup func()) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cleanup = func() {
+		os.RemoveAll(dir)
+	}
+	domain := "nomad"
+	days := 1
+
+	caCertFileName = fmt.Sprintf("%s/%s-agent-ca.pem", dir, domain)
+	caPkFileName = fmt.Sprintf("%s/%s-agent-ca-key.pem", dir, domain)
+
+	//	constraints := []string{}
+	constraints := []string{domain, "localhost"}
+	commonName := ""
+
+	ca, caPk, err := tlsutil.GenerateCA(tlsutil.CAOpts{Name: commonName, Days: days, PermittedDNSDomains: constraints})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTLSStuff(t, caCertFileName, ca)
+	writeTLSStuff(t, caPkFileName, caPk)
+
+	cluster_region := "global"
+
+	var DNSNames []string
+	var IPAddresses []net.IP
+	var extKeyUsage []x509.ExtKeyUsage
+	var name, prefix string
+
+	server := true
+	client := false
+	if server {
+		name = fmt.Sprintf("server.%s.%s", cluster_region, domain)
+		DNSNames = append(DNSNames, name)
+		DNSNames = append(DNSNames, "localhost")
+
+		IPAddresses = append(IPAddresses, net.ParseIP("127.0.0.1"))
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		prefix = fmt.Sprintf("%s-server-%s", cluster_region, domain)
+
+	} else if client {
+		name = fmt.Sprintf("client.%s.%s", cluster_region, domain)
+		DNSNames = append(DNSNames, []string{name, "localhost"}...)
+		IPAddresses = append(IPAddresses, net.ParseIP("127.0.0.1"))
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+		prefix = fmt.Sprintf("%s-client-%s", cluster_region, domain)
+	}
+
+	certFileName = fmt.Sprintf("%s/%s.pem", dir, prefix)
+	pkFileName = fmt.Sprintf("%s/%s-key.pem", dir, prefix)
+
+	signer, err := tlsutil.ParseSigner(string(caPk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := tlsutil.GenerateCert(tlsutil.CertOpts{
+		Signer: signer, CA: ca, Name: name, Days: days,
+		DNSNames: DNSNames, IPAddresses: IPAddresses, ExtKeyUsage: extKeyUsage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tlsutil.Verify(ca, pub, name); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTLSStuff(t, certFileName, pub)
+
+	writeTLSStuff(t, pkFileName, priv)
+	return
+
+}
+func writeTLSStuff(t *testing.T, name, data string) {
+	t.Helper()
+	if err := file.WriteAtomicWithPerms(name, []byte(data), 0755, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckWebhooks(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/health", req.URL.Path)
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	unreachable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	unreachableURL := unreachable.URL
+	unreachable.Close()
+
+	tests := []struct {
+		name     string
+		webhook  *config.Webhook
+		disabled bool
+		wantErr  bool
+		wantWarn bool
+	}{
+		{
+			name:    "reachable webhook",
+			webhook: &config.Webhook{Endpoint: healthy.URL + "/validate", Method: "POST", HealthPath: "/health"},
+		},
+		{
+			name:     "unreachable webhook warns",
+			webhook:  &config.Webhook{Endpoint: unreachableURL + "/validate", Method: "POST"},
+			wantWarn: true,
+		},
+		{
+			name:    "unreachable webhook fails if configured",
+			webhook: &config.Webhook{Endpoint: unreachableURL + "/validate", Method: "POST", FailOnUnreachable: true},
+			wantErr: true,
+		},
+		{
+			name:     "disabled webhook is not checked",
+			webhook:  &config.Webhook{Endpoint: unreachableURL + "/validate", Method: "POST", FailOnUnreachable: true},
+			disabled: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := &strings.Builder{}
+			logger := hclog.New(&hclog.LoggerOptions{Output: logs})
+			enabled := pointer.Of(!tc.disabled)
+			c := &config.Config{
+				Validators: []config.Validator{{Type: "webhook", Name: "test", Enabled: enabled, Webhook: tc.webhook}},
+				Mutators:   []config.Mutator{{Type: "json_patch_webhook", Name: "test", Enabled: enabled, Webhook: tc.webhook}},
+			}
+
+			err := checkWebhooks(c, logger)
+
+			assert.Equal(t, tc.wantErr, err != nil, "checkWebhooks() error = %v", err)
+			assert.Equal(t, tc.wantWarn, strings.Contains(logs.String(), "Webhook is unreachable"))
+		})
+	}
+}
+
+func TestNomadToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "nomad-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("from-file\n"), 0600))
+
+	tests := []struct {
+		name    string
+		nomad   *config.NomadServer
+		want    string
+		wantErr bool
+	}{
+		{name: "none", nomad: &config.NomadServer{}},
+		{name: "token", nomad: &config.NomadServer{Token: "inline"}, want: "inline"},
+		{name: "token file", nomad: &config.NomadServer{TokenFile: tokenFile}, want: "from-file"},
+		{name: "missing token file", nomad: &config.NomadServer{TokenFile: tokenFile + ".missing"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := nomadToken(tc.nomad)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, token)
+		})
+	}
+}
+
+func TestNomadTokenResolver(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/acl/token/self", req.URL.Path)
+		if req.Header.Get("X-Nomad-Token") != "secret" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		rw.Write([]byte(toJson(t, &api.ACLToken{AccessorID: "a1b2", Name: "alice"})))
+	}))
+	defer nomadDummy.Close()
+
+	resolver, err := newNomadTokenResolver(nomadDummy.URL, nil)
+	require.NoError(t, err)
+
+	token, err := resolver("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", token.Name)
+
+	_, err = resolver("invalid")
+	assert.Error(t, err)
+}
+
+func TestWebhookClientOptions(t *testing.T) {
+	opts, err := webhookClientOptions(&config.Config{}, &config.Webhook{Endpoint: "http://localhost"})
+	require.NoError(t, err)
+	assert.Empty(t, opts, "no retries without retry block")
+
+	opts, err = webhookClientOptions(&config.Config{}, &config.Webhook{Endpoint: "http://localhost", Retry: &config.WebhookRetry{Jitter: "10ms"}})
+	require.NoError(t, err)
+	assert.Len(t, opts, 1)
+
+	_, err = webhookClientOptions(&config.Config{}, &config.Webhook{Endpoint: "http://localhost", Retry: &config.WebhookRetry{Backoff: "fast"}})
+	assert.ErrorContains(t, err, "backoff")
+}
+
+func TestCreateControllersWithTimeout(t *testing.T) {
+	opaRule := &config.OpaRule{
+		Query:    "errors = data.dummy.errors",
+		Filename: testutil.Filepath(t, "opa/errors.rego"),
+	}
+	c := &config.Config{
+		Validators: []config.Validator{{Type: "opa", Name: "slow", Namespace: "team-a", Timeout: "2s", OpaRule: opaRule}},
+		Mutators:   []config.Mutator{{Type: "datacenter_defaults", Name: "dc", Timeout: "500ms", DatacenterDefaults: &config.DatacenterDefaults{Datacenters: []string{"dc1"}}}},
+	}
+
+	validators, err := createValidators(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, validators[0].(admissionctrl.TimeLimited).Timeout())
+	assert.Equal(t, "team-a", validators[0].(admissionctrl.NamespaceScoped).Namespace())
+
+	mutators, err := createMutators(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, mutators[0].(admissionctrl.TimeLimited).Timeout())
+
+	c.Validators[0].Timeout = "soon"
+	_, err = createValidators(c, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
+
+func TestBuildJobHandlerReportsAllBrokenPolicies(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.rego")
+	require.NoError(t, os.WriteFile(broken, []byte("package broken\n\nerrors[msg] {\n  msg := \n}\n"), 0600))
+	unsafe := filepath.Join(dir, "unsafe.rego")
+	require.NoError(t, os.WriteFile(unsafe, []byte("package unsafe\n\npatch[msg] {\n  msg == \"x\"\n}\n"), 0600))
+
+	c := config.DefaultConfig()
+	c.Validators = []config.Validator{
+		{Type: "opa", Name: "ok", OpaRule: &config.OpaRule{Query: "errors = data.dummy.errors", Filename: testutil.Filepath(t, "opa/errors.rego")}},
+		{Type: "opa", Name: "broken", OpaRule: &config.OpaRule{Query: "errors = data.broken.errors", Filename: broken}},
+	}
+	c.Mutators = []config.Mutator{
+		{Type: "opa_json_patch", Name: "unsafe", OpaRule: &config.OpaRule{Query: "patch = data.unsafe.patch", Filename: unsafe}},
+	}
+
+	_, _, err := buildJobHandler(c, hclog.NewNullLogger(), &serverOptions{})
+
+	assert.ErrorContains(t, err, "validator broken: failed to compile policy: "+broken+":5:1: rego_parse_error: unexpected } token")
+	assert.ErrorContains(t, err, "mutator unsafe: failed to compile policy: "+unsafe+":4:3: rego_unsafe_var_error: var msg is unsafe")
+	assert.NotContains(t, err.Error(), "validator ok")
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProxyTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("{}"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(testutil.ReadJob(t, "job.json"), []error{}, nil)
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, nil)
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{mutator},
+		[]admissionctrl.JobValidator{validator},
+		hclog.NewNullLogger(),
+	)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "nacp PUT")
+	root := spans["nacp PUT"].SpanContext()
+	for _, name := range []string{"mutator mock-mutator", "validator mock-validator", "nomad PUT"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, root.SpanID(), spans[name].Parent().SpanID(), "%s should be a child of the request span", name)
+	}
+	assert.Equal(t, trace.SpanKindClient, spans["nomad PUT"].SpanKind())
+}
@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const (
+	nacpValidatePath = "/nacp/validate"
+	nacpMutatePath   = "/nacp/mutate"
+	nacpCheckPath    = "/nacp/check"
+)
+
+func isNacpValidate(r *http.Request) bool {
+	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == nacpValidatePath
+}
+
+// handleNacpValidate applies the admission controllers to the job of a
+// JobValidateRequest without forwarding it to Nomad.
+// The result is returned like Nomad's JobValidateResponse, or as SARIF log with ?format=sarif.
+func handleNacpValidate(w http.ResponseWriter, r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "sarif" {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	jobValidateRequest := &api.JobValidateRequest{}
+	if !decodeJobRequest(w, r, jobValidateRequest, func() *api.Job { return jobValidateRequest.Job }) {
+		return
+	}
+
+	admissionCtx := admissionContext(r, jobValidateRequest.Job)
+	job, warnings, validationErr, err := jobHandler.MutateAndValidate(admissionCtx, jobValidateRequest.Job)
+	if err != nil {
+		options.auditDecision(admissionCtx, jobValidateRequest.Job, nil, err)
+		appLogger.Warn("Error applying admission controllers", "error", err)
+		writeError(w, options.userFacing(err))
+		return
+	}
+	options.auditDecision(admissionCtx, job, warnings, validationErr)
+
+	var body interface{}
+	if format == "sarif" {
+		w.Header().Set("Content-Type", "application/sarif+json")
+		body = options.newSarifLog(job, admissionctrl.RequestFromContext(admissionCtx).Namespace, validationErr, warnings)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		body = options.jobValidateResponse(validationErr, warnings)
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		appLogger.Error("Failed to write validate response", "error", err)
+	}
+}
+
+// MutateRequest is the body of a /nacp/mutate request.
+type MutateRequest struct {
+	Job *api.Job
+}
+
+// MutateResponse holds the job returned by the mutators of a /nacp/mutate request.
+type MutateResponse struct {
+	Job      *api.Job
+	Warnings string `json:",omitempty"`
+}
+
+func isNacpMutate(r *http.Request) bool {
+	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == nacpMutatePath
+}
+
+// handleNacpMutate applies the admission mutators to a job and returns the mutated job
+// without validating it or forwarding it to Nomad.
+func handleNacpMutate(w http.ResponseWriter, r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, options *handlerOptions) {
+	mutateRequest := &MutateRequest{}
+	if !decodeJobRequest(w, r, mutateRequest, func() *api.Job { return mutateRequest.Job }) {
+		return
+	}
+
+	admissionCtx := admissionContext(r, mutateRequest.Job)
+	job, warnings, err := jobHandler.AdmissionMutators(admissionCtx, mutateRequest.Job)
+	options.auditDecision(admissionCtx, mutateRequest.Job, warnings, err)
+	if err != nil {
+		appLogger.Warn("Error applying admission controllers", "error", err)
+		writeError(w, options.userFacing(err))
+		return
+	}
+	resp := &MutateResponse{Job: job}
+	if len(warnings) > 0 {
+		redacted := &multierror.Error{}
+		for _, w := range warnings {
+			redacted = multierror.Append(redacted, options.userFacing(w))
+		}
+		resp.Warnings = options.mergeWarnings("", redacted.Errors)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		appLogger.Error("Failed to write mutate response", "error", err)
+	}
+}
+
+// CheckRequest is the body of a /nacp/check request.
+type CheckRequest struct {
+	Job *api.Job
+	// Plan sends the mutated job to Nomad's plan endpoint if it passes validation.
+	Plan bool
+	// Diff includes the job diff in the plan.
+	Diff bool
+}
+
+// CheckResponse combines the results of the mutators, validators and the optional Nomad plan.
+type CheckResponse struct {
+	Job              *api.Job
+	Warnings         string               `json:",omitempty"`
+	Error            string               `json:",omitempty"`
+	ValidationErrors []string             `json:",omitempty"`
+	Plan             *api.JobPlanResponse `json:",omitempty"`
+}
+
+func isNacpCheck(r *http.Request) bool {
+	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == nacpCheckPath
+}
+
+// planner plans a job with Nomad on behalf of the client request.
+type planner func(r *http.Request, job *api.Job, diff bool) (*api.JobPlanResponse, error)
+
+// handleNacpCheck applies the mutators and validators to a job and, if requested
+// and the job is valid, plans the mutated job with Nomad, all in one response.
+func handleNacpCheck(w http.ResponseWriter, r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, plan planner, options *handlerOptions) {
+	checkRequest := &CheckRequest{}
+	if !decodeJobRequest(w, r, checkRequest, func() *api.Job { return checkRequest.Job }) {
+		return
+	}
+
+	admissionCtx := admissionContext(r, checkRequest.Job)
+	if checkRequest.Plan {
+		admissionctrl.RequestFromContext(admissionCtx).Operation = admissionctrl.OperationPlan
+	}
+	job, warnings, validationErr, err := jobHandler.MutateAndValidate(admissionCtx, checkRequest.Job)
+	if err != nil {
+		options.auditDecision(admissionCtx, checkRequest.Job, nil, err)
+		appLogger.Warn("Error applying admission controllers", "error", err)
+		writeError(w, options.userFacing(err))
+		return
+	}
+	options.auditDecision(admissionCtx, job, warnings, validationErr)
+
+	validateResponse := options.jobValidateResponse(validationErr, warnings)
+	resp := &CheckResponse{
+		Job:              job,
+		Warnings:         validateResponse.Warnings,
+		Error:            validateResponse.Error,
+		ValidationErrors: validateResponse.ValidationErrors,
+	}
+	if checkRequest.Plan && validationErr == nil {
+		if job.ID == nil {
+			http.Error(w, "job has no ID to plan", http.StatusBadRequest)
+			return
+		}
+		resp.Plan, err = plan(r, job, checkRequest.Diff)
+		var upstreamErr *upstreamError
+		if errors.As(err, &upstreamErr) {
+			w.WriteHeader(upstreamErr.status)
+			w.Write(upstreamErr.body)
+			return
+		}
+		if err != nil {
+			appLogger.Error("Failed to plan job with Nomad", "error", err)
+			http.Error(w, fmt.Sprintf("failed to plan job with Nomad: %s", err), http.StatusBadGateway)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		appLogger.Error("Failed to write check response", "error", err)
+	}
+}
+
+// upstreamError is a non-2xx Nomad response, passed on to the client as is.
+type upstreamError struct {
+	status int
+	body   []byte
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("nomad responded with %d: %s", e.status, e.body)
+}
+
+// forwardedQuery returns the namespace and region of the client request.
+func forwardedQuery(r *http.Request) url.Values {
+	query := url.Values{}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	if region := requestRegion(r); region != "" {
+		query.Set("region", region)
+	}
+	return query
+}
+
+// forwardAuthorization sends the token of the client request with req.
+func forwardAuthorization(r *http.Request, req *http.Request) {
+	for _, header := range []string{"X-Nomad-Token", "Authorization"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+}
+
+// nomadPlanner plans jobs with the plan endpoint of the Nomad server,
+// forwarding the token, namespace and region of the client request.
+func nomadPlanner(nomadAddress *url.URL, transport http.RoundTripper, maxBodySize int64) planner {
+	client := &http.Client{Transport: transport}
+	return func(r *http.Request, job *api.Job, diff bool) (*api.JobPlanResponse, error) {
+		body, err := json.Marshal(&api.JobPlanRequest{Job: job, Diff: diff})
+		if err != nil {
+			return nil, err
+		}
+		planURL := nomadAddress.JoinPath("v1", "job", *job.ID, "plan")
+		planURL.RawQuery = forwardedQuery(r).Encode()
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodPut, planURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		forwardAuthorization(r, req)
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		reader := io.Reader(res.Body)
+		if maxBodySize > 0 {
+			reader = io.LimitReader(res.Body, maxBodySize)
+		}
+		if !isSuccess(res) {
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &upstreamError{status: res.StatusCode, body: data}
+		}
+		planResponse := &api.JobPlanResponse{}
+		if err := json.NewDecoder(reader).Decode(planResponse); err != nil {
+			return nil, fmt.Errorf("failed to decode plan response: %w", err)
+		}
+		return planResponse, nil
+	}
+}
+
+// decodeJobRequest decodes the request body into v and writes an error response
+// if it can't be decoded or contains no job.
+func decodeJobRequest(w http.ResponseWriter, r *http.Request, v interface{}, job func() *api.Job) bool {
+	if err := decodeBody(r.Body, v); err != nil {
+		writeError(w, err)
+		return false
+	}
+	if job() == nil {
+		http.Error(w, errMissingJob.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (o *handlerOptions) jobValidateResponse(validationErr error, warnings []error) *api.JobValidateResponse {
+	resp := &api.JobValidateResponse{}
+	if validationErr != nil {
+		validationErr = o.userFacing(validationErr)
+		for _, err := range flattenErrors(validationErr) {
+			resp.ValidationErrors = append(resp.ValidationErrors, err.Error())
+		}
+		resp.Error = validationErr.Error()
+	}
+	if len(warnings) > 0 {
+		redacted := &multierror.Error{}
+		for _, w := range warnings {
+			redacted = multierror.Append(redacted, o.userFacing(w))
+		}
+		resp.Warnings = o.mergeWarnings("", redacted.Errors)
+	}
+	return resp
+}
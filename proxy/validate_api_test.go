@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newValidateAPIServer(t *testing.T, opts ...HandlerOption) *httptest.Server {
+	t.Helper()
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Fatal("Nomad should not be called")
+	}))
+	t.Cleanup(nomadDummy.Close)
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return(
+		[]error{&admissionctrl.RuleMessage{Msg: "Job has no owner", Rule: "policies/owner.rego"}},
+		multierror.Append(nil,
+			&admissionctrl.RuleMessage{Msg: "Every job must have a costcenter", Rule: "policies/costcenter.rego"},
+			errors.New("plain error"),
+		),
+	)
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{},
+		[]admissionctrl.JobValidator{validator},
+		hclog.NewNullLogger(),
+	)
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, opts...)
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	t.Cleanup(proxyServer.Close)
+	return proxyServer
+}
+
+func validateRequestJson(t *testing.T, job *api.Job) string {
+	t.Helper()
+	return toJson(t, &api.JobValidateRequest{Job: job})
+}
+
+func TestNacpValidate(t *testing.T) {
+	server := newValidateAPIServer(t)
+
+	res, err := sendPut(t, server.URL+"/nacp/validate", strings.NewReader(validateRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	resp := &api.JobValidateResponse{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	assert.Equal(t, []string{
+		"Every job must have a costcenter (policies/costcenter.rego)",
+		"plain error",
+	}, resp.ValidationErrors)
+	assert.Contains(t, resp.Error, "Every job must have a costcenter")
+	assert.Contains(t, resp.Warnings, "Job has no owner (policies/owner.rego)")
+}
+
+func TestNacpValidateSarif(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []HandlerOption
+		wantRules []string
+	}{
+		{
+			name:      "rule ids from rule source",
+			wantRules: []string{"policies/costcenter.rego", "nacp", "policies/owner.rego"},
+		},
+		{
+			name:      "hidden rule source",
+			opts:      []HandlerOption{WithHiddenRuleSource("")},
+			wantRules: []string{"nacp", "nacp", "nacp"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newValidateAPIServer(t, tc.opts...)
+
+			res, err := sendPut(t, server.URL+"/nacp/validate?format=sarif", strings.NewReader(validateRequestJson(t, testutil.ReadJob(t, "job.json"))))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "application/sarif+json", res.Header.Get("Content-Type"))
+
+			log := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&log))
+			assert.Equal(t, "2.1.0", log["version"])
+			assert.Equal(t, sarifSchema, log["$schema"])
+
+			runs := log["runs"].([]interface{})
+			require.Len(t, runs, 1)
+			run := runs[0].(map[string]interface{})
+			driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+			assert.Equal(t, "nacp", driver["name"])
+
+			results := run["results"].([]interface{})
+			require.Len(t, results, 3)
+			var rules, levels, messages []string
+			for _, r := range results {
+				result := r.(map[string]interface{})
+				rules = append(rules, result["ruleId"].(string))
+				levels = append(levels, result["level"].(string))
+				messages = append(messages, result["message"].(map[string]interface{})["text"].(string))
+
+				location := result["locations"].([]interface{})[0].(map[string]interface{})
+				logical := location["logicalLocations"].([]interface{})[0].(map[string]interface{})
+				assert.Equal(t, "example", logical["name"])
+			}
+			assert.Equal(t, tc.wantRules, rules)
+			assert.Equal(t, []string{"error", "error", "warning"}, levels)
+			assert.Equal(t, []string{"Every job must have a costcenter", "plain error", "Job has no owner"}, messages)
+		})
+	}
+}
+
+func TestNacpValidateBadRequest(t *testing.T) {
+	server := newValidateAPIServer(t)
+
+	for name, tc := range map[string]struct {
+		path string
+		body string
+	}{
+		"invalid json":       {path: "/nacp/validate", body: "{"},
+		"missing job":        {path: "/nacp/validate", body: "{}"},
+		"unsupported format": {path: "/nacp/validate?format=xml", body: validateRequestJson(t, testutil.ReadJob(t, "job.json"))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res, err := sendPut(t, server.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	}
+}
+
+func TestNacpMutate(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Fatal("Nomad should not be called")
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{&testutil.HelloMutator{}},
+		[]admissionctrl.JobValidator{validator},
+		hclog.NewNullLogger(),
+	)
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	res, err := sendPut(t, proxyServer.URL+"/nacp/mutate", strings.NewReader(toJson(t, &MutateRequest{Job: testutil.ReadJob(t, "job.json")})))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	resp := &MutateResponse{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	assert.Equal(t, "world", resp.Job.Meta["hello"])
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+
+	res, err = sendPut(t, proxyServer.URL+"/nacp/mutate", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestNacpCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		validator    admissionctrl.JobValidator
+		request      *CheckRequest
+		nomadStatus  int
+		wantStatus   int
+		wantPlanned  bool
+		wantErrors   []string
+		wantWarnings string
+	}{
+		{
+			name:         "valid job is planned",
+			validator:    mockValidatorReturningWarnings("some warning"),
+			request:      &CheckRequest{Plan: true, Diff: true},
+			nomadStatus:  http.StatusOK,
+			wantStatus:   http.StatusOK,
+			wantPlanned:  true,
+			wantWarnings: "some warning",
+		},
+		{
+			name:       "invalid job is not planned",
+			validator:  mockValidatorReturningError("some error"),
+			request:    &CheckRequest{Plan: true},
+			wantStatus: http.StatusOK,
+			wantErrors: []string{"some error"},
+		},
+		{
+			name:       "plan is optional",
+			validator:  mockValidatorReturningWarnings("some warning"),
+			request:    &CheckRequest{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "nomad errors are passed through",
+			validator:   mockValidatorReturningWarnings("some warning"),
+			request:     &CheckRequest{Plan: true},
+			nomadStatus: http.StatusForbidden,
+			wantStatus:  http.StatusForbidden,
+			wantPlanned: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planned := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				planned = true
+				assert.Equal(t, "/v1/job/example/plan", req.URL.Path)
+				assert.Equal(t, "team-a", req.URL.Query().Get("namespace"))
+				assert.Equal(t, "secret", req.Header.Get("X-Nomad-Token"))
+
+				planRequest := &api.JobPlanRequest{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(planRequest))
+				assert.Equal(t, "world", planRequest.Job.Meta["hello"], "the mutated job is planned")
+				assert.Equal(t, tt.request.Diff, planRequest.Diff)
+
+				rw.WriteHeader(tt.nomadStatus)
+				if tt.nomadStatus != http.StatusOK {
+					rw.Write([]byte("Permission denied"))
+					return
+				}
+				rw.Write([]byte(toJson(t, &api.JobPlanResponse{JobModifyIndex: 42, Diff: &api.JobDiff{Type: "Added"}})))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			jobHandler := admissionctrl.NewJobHandler(
+				[]admissionctrl.JobMutator{&testutil.HelloMutator{}},
+				[]admissionctrl.JobValidator{tt.validator},
+				hclog.NewNullLogger(),
+			)
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			tt.request.Job = &api.Job{ID: pointer.Of("example")}
+			req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/nacp/check?namespace=team-a", strings.NewReader(toJson(t, tt.request)))
+			require.NoError(t, err)
+			req.Header.Set("X-Nomad-Token", "secret")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantPlanned, planned)
+			require.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, "Permission denied", readClosterToString(t, res.Body))
+				return
+			}
+
+			resp := &CheckResponse{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+			assert.Equal(t, "world", resp.Job.Meta["hello"])
+			assert.Equal(t, tt.wantErrors, resp.ValidationErrors)
+			assert.Contains(t, resp.Warnings, tt.wantWarnings)
+			if tt.wantPlanned {
+				require.NotNil(t, resp.Plan)
+				assert.Equal(t, uint64(42), resp.Plan.JobModifyIndex)
+				assert.Equal(t, "Added", resp.Plan.Diff.Type)
+			} else {
+				assert.Nil(t, resp.Plan)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mxab/nacp/version"
+)
+
+const nacpVersionPath = "/nacp/version"
+
+func isNacpVersion(r *http.Request) bool {
+	return r.Method == "GET" && r.URL.Path == nacpVersionPath
+}
+
+func serveVersion(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
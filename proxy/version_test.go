@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mxab/nacp/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeVersion(t *testing.T) {
+	server := newValidateAPIServer(t)
+
+	res, err := http.Get(server.URL + "/nacp/version")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	info := version.Info{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&info))
+	assert.Equal(t, version.Get(), info)
+}
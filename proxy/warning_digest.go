@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// otherWarnings is the category of warnings not originating from a rule.
+const otherWarnings = "other"
+
+// WithWarningDigest starts the warnings returned to clients with a summary
+// counting them by the rule they originate from, e.g. "5 warnings: 3 images, 2 resources".
+// If collapse is set only the summary is returned.
+func WithWarningDigest(collapse bool) HandlerOption {
+	return func(o *handlerOptions) {
+		o.warningDigest = true
+		o.collapseWarnings = collapse
+	}
+}
+
+// WithoutWarningInjection returns Nomad's register, plan and validate responses untouched
+// instead of decoding them to add the warnings of the admission controllers.
+// The warnings are still logged and audited, validation errors are still returned.
+func WithoutWarningInjection() HandlerOption {
+	return func(o *handlerOptions) {
+		o.skipWarningInjection = true
+	}
+}
+
+// keepsResponse reports if Nomad's response is passed through without injecting the warnings.
+func (o *handlerOptions) keepsResponse(r *http.Request, appLogger hclog.Logger) bool {
+	if !o.skipWarningInjection || !(isRegister(r) || isRevert(r) || isPlan(r) || isValidate(r)) {
+		return false
+	}
+	if validationErr, ok := r.Context().Value(ctxValidationError).(error); ok && validationErr != nil {
+		return false
+	}
+	if warnings, ok := r.Context().Value(ctxWarnings).([]error); ok && len(warnings) > 0 {
+		appLogger.Info("Warnings not returned to the client", "warnings", warnings)
+	}
+	return true
+}
+
+// mergeWarnings merges Nomad's warnings with the ones of the admission controllers.
+func (o *handlerOptions) mergeWarnings(upstreamResponseWarnings string, warnings []error) string {
+	if !o.warningDigest {
+		return buildFullWarningMsg(upstreamResponseWarnings, warnings)
+	}
+	return warningDigest(upstreamResponseWarnings, warnings, o.collapseWarnings)
+}
+
+func warningDigest(upstreamResponseWarnings string, warnings []error, collapse bool) string {
+	var all []error
+	for _, w := range warnings {
+		all = append(all, flattenErrors(w)...)
+	}
+	counts := map[string]int{}
+	for _, w := range all {
+		counts[warningCategory(w)]++
+	}
+	total := len(all)
+	if upstreamResponseWarnings != "" {
+		counts["nomad"]++
+		total++
+	}
+	if total == 0 {
+		return ""
+	}
+
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	summary := make([]string, 0, len(categories))
+	for _, category := range categories {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[category], category))
+	}
+
+	sb := strings.Builder{}
+	noun := "warnings"
+	if total == 1 {
+		noun = "warning"
+	}
+	fmt.Fprintf(&sb, "%d %s: %s", total, noun, strings.Join(summary, ", "))
+	if collapse {
+		return sb.String()
+	}
+	sb.WriteString("\n")
+	if upstreamResponseWarnings != "" {
+		fmt.Fprintf(&sb, "\n* %s", upstreamResponseWarnings)
+	}
+	for _, w := range all {
+		fmt.Fprintf(&sb, "\n* %s", w)
+	}
+	return sb.String()
+}
+
+func warningCategory(err error) string {
+	var ruleMessage *admissionctrl.RuleMessage
+	if errors.As(err, &ruleMessage) && ruleMessage.Rule != "" {
+		return ruleMessage.Rule
+	}
+	return otherWarnings
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningDigest(t *testing.T) {
+	image := func(msg string) error { return &admissionctrl.RuleMessage{Msg: msg, Rule: "image_policy"} }
+	warnings := []error{
+		image("Image nginx:latest is not pinned"),
+		&admissionctrl.RuleMessage{Msg: "Task web has no memory_max", Rule: "resources"},
+		multierror.Append(nil, image("Image redis is not pinned"), image("Image redis is not from the registry")),
+		errors.New("Job has no datacenters"),
+	}
+	tests := []struct {
+		name     string
+		upstream string
+		warnings []error
+		collapse bool
+		want     string
+	}{
+		{
+			name:     "summary with details",
+			warnings: warnings,
+			want: "5 warnings: 3 image_policy, 1 other, 1 resources\n" +
+				"\n* Image nginx:latest is not pinned (image_policy)" +
+				"\n* Task web has no memory_max (resources)" +
+				"\n* Image redis is not pinned (image_policy)" +
+				"\n* Image redis is not from the registry (image_policy)" +
+				"\n* Job has no datacenters",
+		},
+		{
+			name:     "collapsed",
+			warnings: warnings,
+			collapse: true,
+			want:     "5 warnings: 3 image_policy, 1 other, 1 resources",
+		},
+		{
+			name:     "nomad warnings are counted",
+			upstream: "1 warning:\n\n* Group web has no update block",
+			warnings: warnings[:1],
+			want: "2 warnings: 1 image_policy, 1 nomad\n" +
+				"\n* 1 warning:\n\n* Group web has no update block" +
+				"\n* Image nginx:latest is not pinned (image_policy)",
+		},
+		{
+			name:     "single warning",
+			warnings: warnings[:1],
+			collapse: true,
+			want:     "1 warning: 1 image_policy",
+		},
+		{
+			name: "no warnings",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, warningDigest(tt.upstream, tt.warnings, tt.collapse))
+		})
+	}
+}
+
+func TestWarningDigestInRegisterResponse(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(toJson(t, &api.JobRegisterResponse{})))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler(
+		[]admissionctrl.JobMutator{},
+		[]admissionctrl.JobValidator{mockValidatorReturningWarnings("some warning"), mockValidatorReturningWarnings("another warning")},
+		hclog.NewNullLogger(),
+	)
+	proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithWarningDigest(true))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+	require.NoError(t, err)
+	response := &api.JobRegisterResponse{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(response))
+	assert.Equal(t, "2 warnings: 2 other", response.Warnings)
+}
+
+func TestWithoutWarningInjection(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		validator admissionctrl.JobValidator
+		upstream  string
+		want      string
+	}{
+		{
+			name:      "register response is passed through",
+			path:      "/v1/jobs",
+			body:      registerRequestJson(t, &api.Job{ID: pointer.Of("example")}),
+			validator: mockValidatorReturningWarnings("some warning"),
+			upstream:  `{"EvalID":"abc",  "Warnings":""}`,
+			want:      `{"EvalID":"abc",  "Warnings":""}`,
+		},
+		{
+			name:      "validation errors are still returned",
+			path:      "/v1/validate/job",
+			body:      validateRequestJson(t, &api.Job{ID: pointer.Of("example")}),
+			validator: mockValidatorReturningError("some error"),
+			upstream:  toJson(t, &api.JobValidateResponse{}),
+			want:      toJson(t, &api.JobValidateResponse{ValidationErrors: []string{"some error"}, Error: "1 error occurred:\n\t* some error\n\n"}),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Write([]byte(tc.upstream))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{tc.validator}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithoutWarningInjection())
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, proxyServer.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, strings.TrimSpace(readClosterToString(t, res.Body)))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WarningTrailer is the response trailer holding a warning of the admission controllers, one value per warning.
+const WarningTrailer = "X-Nacp-Warning"
+
+// WithWarningTrailers sends the warnings of the admission controllers as response trailers too,
+// for clients processing them apart from the body. The body is sent chunked then.
+func WithWarningTrailers() HandlerOption {
+	return func(o *handlerOptions) {
+		o.warningTrailers = true
+	}
+}
+
+// setWarningTrailers adds the warnings of the request as trailers of the response.
+// It has to run after the body is rewritten, trailers require dropping its length.
+func (o *handlerOptions) setWarningTrailers(resp *http.Response) {
+	if !o.warningTrailers {
+		return
+	}
+	warnings, _ := resp.Request.Context().Value(ctxWarnings).([]error)
+	if len(warnings) == 0 {
+		return
+	}
+	if resp.Trailer == nil {
+		resp.Trailer = http.Header{}
+	}
+	for _, w := range warnings {
+		for _, e := range flattenErrors(w) {
+			// header values can't span lines
+			resp.Trailer.Add(WarningTrailer, strings.Join(strings.Fields(e.Error()), " "))
+		}
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
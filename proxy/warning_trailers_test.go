@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningTrailers(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []HandlerOption
+		wantTrailers []string
+		wantWarnings string
+	}{
+		{
+			name:         "disabled",
+			wantWarnings: "1 warning:\n\n* some warning",
+		},
+		{
+			name:         "trailers and body",
+			opts:         []HandlerOption{WithWarningTrailers()},
+			wantTrailers: []string{"some warning"},
+			wantWarnings: "1 warning:\n\n* some warning",
+		},
+		{
+			name:         "trailers only",
+			opts:         []HandlerOption{WithWarningTrailers(), WithoutWarningInjection()},
+			wantTrailers: []string{"some warning"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Write([]byte(toJson(t, &api.JobRegisterResponse{EvalID: "abc"})))
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{}, []admissionctrl.JobValidator{mockValidatorReturningWarnings("some warning")}, hclog.NewNullLogger())
+			proxy := NewHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, tc.opts...)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			res, err := sendPut(t, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, &api.Job{ID: pointer.Of("example")})))
+			require.NoError(t, err)
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			res.Body.Close()
+
+			response := &api.JobRegisterResponse{}
+			require.NoError(t, json.Unmarshal(body, response))
+			assert.Equal(t, "abc", response.EvalID)
+			assert.Equal(t, tc.wantWarnings, response.Warnings)
+			assert.Equal(t, tc.wantTrailers, res.Trailer.Values(WarningTrailer))
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package lib.helpers
+
+import future.keywords.if
+
+owner(job) := job.Meta.owner
+
+known_team(name) if {
+	data.teams.known[_] == name
+}
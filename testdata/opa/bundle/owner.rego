@@ -0,0 +1,16 @@
+package bundle.owner
+
+import data.lib.helpers
+import future.keywords.contains
+import future.keywords.if
+
+errors contains msg if {
+	not helpers.owner(input)
+	msg := "Job has no owner"
+}
+
+errors contains msg if {
+	owner := helpers.owner(input)
+	not helpers.known_team(owner)
+	msg := sprintf("Owner %s is not a known team", [owner])
+}
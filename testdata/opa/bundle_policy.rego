@@ -0,0 +1,10 @@
+package bundle_policy
+
+import data.lib.helpers
+import future.keywords.contains
+import future.keywords.if
+
+warnings contains msg if {
+	helpers.owner(input) == "platform"
+	msg := "Job is owned by the platform team"
+}
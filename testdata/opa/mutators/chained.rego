@@ -0,0 +1,11 @@
+package chained
+
+patch[operation] {
+
+    input.Meta.hello
+    operation := {
+        "op": "add",
+        "path": "/Meta/greeting",
+        "value": sprintf("hello %s", [input.Meta.hello])
+    }
+}
@@ -0,0 +1,9 @@
+package replace_job
+
+# the submitted job with a team meta and every group at least twice
+job := object.union(input, {
+    "Meta": object.union(object.get(input, "Meta", {}), {"team": "platform"}),
+    "TaskGroups": [object.union(group, {"Count": max([group.Count, 2])}) | group := input.TaskGroups[_]],
+})
+
+patch := [{"op": "add", "path": "/Meta", "value": {}}]
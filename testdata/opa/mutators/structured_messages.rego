@@ -0,0 +1,11 @@
+package structured_mutator
+
+import future.keywords
+
+patch contains {"op": "add", "path": "/Meta", "value": {"patched": "true"}}
+
+warnings contains {"msg": "Meta was replaced", "level": "warn", "code": "META001"}
+
+warnings contains {"msg": "Patched by nacp", "level": "info"}
+
+errors contains {"msg": "Job without namespace", "level": "error", "code": "NS001"} if input.Namespace == null
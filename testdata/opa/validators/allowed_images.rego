@@ -0,0 +1,11 @@
+package allowed_images
+
+import future.keywords
+
+errors contains msg if {
+	some group in input.TaskGroups
+	some task in group.Tasks
+	image := task.Config.image
+	not image in data.images.allowed
+	msg := sprintf("Image %s of task %s is not allowed", [image, task.Name])
+}
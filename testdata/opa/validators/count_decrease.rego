@@ -0,0 +1,10 @@
+package count_decrease
+
+# Groups must not shrink by more than half in one submission.
+errors[msg] {
+    group := input.TaskGroups[_]
+    current := input.current_job.TaskGroups[_]
+    current.Name == group.Name
+    group.Count * 2 < current.Count
+    msg := sprintf("Group %s must not decrease its count by more than 50%% (%d to %d)", [group.Name, current.Count, group.Count])
+}
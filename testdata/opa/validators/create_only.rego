@@ -0,0 +1,12 @@
+package create_only
+
+errors[msg] {
+    input.nacp.request.is_create
+    not input.Meta.owner
+    msg := "New jobs must have an owner"
+}
+
+warnings[msg] {
+    input.nacp.request.is_update
+    msg := sprintf("Updating job %s", [input.ID])
+}
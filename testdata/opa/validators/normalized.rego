@@ -0,0 +1,32 @@
+package normalized
+
+# Images must come from the internal registry, whatever the driver.
+errors[msg] {
+    task := input.normalized.tasks[_]
+    task.image != ""
+    not startswith(task.image, "registry.example.com/")
+    msg := sprintf("Task %s/%s uses image %s from an external registry", [task.group, task.name, task.image])
+}
+
+# Secrets must be read from Vault or Nomad variables, not hardcoded in the env.
+errors[msg] {
+    task := input.normalized.tasks[_]
+    value := task.env[key]
+    contains(lower(key), "password")
+    value != ""
+    msg := sprintf("Task %s/%s must not hardcode %s in its env", [task.group, task.name, key])
+}
+
+# Inline templates must not contain credentials.
+errors[msg] {
+    task := input.job.TaskGroups[_].Tasks[_]
+    template := task.Templates[_]
+    contains(template.EmbeddedTmpl, "AKIA")
+    msg := sprintf("Task %s must not embed an AWS access key in %s", [task.Name, template.DestPath])
+}
+
+warnings[msg] {
+    task := input.normalized.tasks[_]
+    task.privileged
+    msg := sprintf("Task %s/%s runs privileged", [task.group, task.name])
+}
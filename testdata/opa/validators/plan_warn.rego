@@ -0,0 +1,17 @@
+package plan_warn
+
+import future.keywords.contains
+import future.keywords.if
+
+# reject jobs without owner on submission, only warn when planning
+errors contains msg if {
+	input.operation == "register"
+	not input.Meta.owner
+	msg := "Job must have an owner"
+}
+
+warnings contains msg if {
+	input.operation == "plan"
+	not input.Meta.owner
+	msg := "Job must have an owner, it will be rejected on submission"
+}
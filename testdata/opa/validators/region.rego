@@ -0,0 +1,8 @@
+package region
+
+# Jobs in the EU must declare how they process personal data.
+errors[msg] {
+    input.region == "eu"
+    not input.Meta.gdpr
+    msg := "Jobs in the eu region must set the gdpr meta"
+}
@@ -0,0 +1,11 @@
+package structured_messages
+
+import future.keywords
+
+warnings contains {"msg": "Job has no owner", "level": "warn", "code": "OWN001"}
+
+warnings contains {"msg": "Job uses the default namespace", "level": "info"}
+
+errors contains {"msg": "Job has no costcenter", "level": "error", "code": "COST001"}
+
+errors contains {"msg": "Job has no description", "level": "warn"}
@@ -1,12 +1,16 @@
 package testutil
 
-import "github.com/hashicorp/nomad/api"
+import (
+	"context"
+
+	"github.com/hashicorp/nomad/api"
+)
 
 type HelloMutator struct {
 	MutatorName string
 }
 
-func (h *HelloMutator) Mutate(job *api.Job) (out *api.Job, warnings []error, err error) {
+func (h *HelloMutator) Mutate(ctx context.Context, job *api.Job) (out *api.Job, warnings []error, err error) {
 
 	if job.Meta == nil {
 		job.Meta = make(map[string]string)
@@ -0,0 +1,155 @@
+// Package proxytest runs a NACP proxy against a fake Nomad for end-to-end tests.
+// It lives next to testutil as the proxy's own tests use testutil.
+package proxytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/proxy"
+)
+
+// Request is a request received by the fake Nomad.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Job decodes the job of a register, plan or validate request.
+func (r Request) Job(t *testing.T) *api.Job {
+	t.Helper()
+	request := &api.JobRegisterRequest{}
+	if err := json.Unmarshal(r.Body, request); err != nil {
+		t.Fatalf("failed to decode the job of %s %s: %v", r.Method, r.Path, err)
+	}
+	return request.Job
+}
+
+// FakeNomad records the requests it receives and answers them with empty
+// register, plan and validate responses, or with the handlers set by Handle.
+type FakeNomad struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []Request
+	handlers map[string]http.HandlerFunc
+}
+
+// NewFakeNomad starts a fake Nomad, it is closed at the end of the test.
+func NewFakeNomad(t *testing.T) *FakeNomad {
+	t.Helper()
+	n := &FakeNomad{handlers: map[string]http.HandlerFunc{}}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(n.Close)
+	return n
+}
+
+// Handle answers the requests of the path with the handler instead of the default response.
+func (n *FakeNomad) Handle(path string, handler http.HandlerFunc) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[path] = handler
+}
+
+// Requests returns the requests received so far, in order.
+func (n *FakeNomad) Requests() []Request {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Request{}, n.requests...)
+}
+
+// LastRequest returns the last received request, it fails the test if there is none.
+func (n *FakeNomad) LastRequest(t *testing.T) Request {
+	t.Helper()
+	requests := n.Requests()
+	if len(requests) == 0 {
+		t.Fatal("nomad did not receive a request")
+	}
+	return requests[len(requests)-1]
+}
+
+func (n *FakeNomad) serveHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	n.mu.Lock()
+	n.requests = append(n.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	handler, ok := n.handlers[req.URL.Path]
+	n.mu.Unlock()
+
+	if ok {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		handler(rw, req)
+		return
+	}
+	var response interface{} = struct{}{}
+	switch {
+	case req.URL.Path == "/v1/validate/job":
+		response = &api.JobValidateResponse{}
+	case strings.HasSuffix(req.URL.Path, "/plan"):
+		response = &api.JobPlanResponse{}
+	case req.URL.Path == "/v1/jobs" || strings.HasPrefix(req.URL.Path, "/v1/job/"):
+		response = &api.JobRegisterResponse{EvalID: "fake-eval"}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// TestProxy is a NACP proxy in front of a fake Nomad.
+type TestProxy struct {
+	*httptest.Server
+	Nomad *FakeNomad
+}
+
+// NewTestProxy starts the proxy of the config in front of a fake Nomad,
+// both are closed at the end of the test. The Nomad address of the config is replaced.
+func NewTestProxy(t *testing.T, c *config.Config, opts ...proxy.Option) *TestProxy {
+	t.Helper()
+	nomad := NewFakeNomad(t)
+
+	cfg := *c
+	nomadServer := &config.NomadServer{}
+	if c.Nomad != nil {
+		*nomadServer = *c.Nomad
+	}
+	nomadServer.Address = nomad.URL
+	cfg.Nomad = nomadServer
+
+	server, err := proxy.New(&cfg, hclog.NewNullLogger(), opts...)
+	if err != nil {
+		t.Fatalf("failed to create the proxy: %v", err)
+	}
+	p := &TestProxy{
+		Server: httptest.NewServer(server.Handler),
+		Nomad:  nomad,
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// NomadClient returns a Nomad api client sending its requests to the proxy.
+func (p *TestProxy) NomadClient(t *testing.T) *api.Client {
+	t.Helper()
+	client, err := api.NewClient(&api.Config{Address: p.URL, HttpClient: p.Client()})
+	if err != nil {
+		t.Fatalf("failed to create the nomad client: %v", err)
+	}
+	return client
+}
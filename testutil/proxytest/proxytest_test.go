@@ -0,0 +1,37 @@
+package proxytest_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterThroughProxy(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Mutators = []config.Mutator{
+		{Type: "meta_defaults", Name: "team", MetaDefaults: &config.MetaDefaults{Meta: map[string]string{"team": "platform"}}},
+	}
+	c.Validators = []config.Validator{
+		{Type: "required_fields", Name: "datacenters", RequiredFields: &config.RequiredFields{Datacenters: true}},
+	}
+	p := proxytest.NewTestProxy(t, c)
+	client := p.NomadClient(t)
+
+	job := &api.Job{ID: pointer.Of("example"), Name: pointer.Of("example"), Datacenters: []string{"dc1"}, Meta: map[string]string{"owner": "alice"}}
+	response, _, err := client.Jobs().Register(job, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fake-eval", response.EvalID)
+
+	received := p.Nomad.LastRequest(t)
+	assert.Equal(t, "/v1/jobs", received.Path)
+	assert.Equal(t, map[string]string{"owner": "alice", "team": "platform"}, received.Job(t).Meta)
+
+	_, _, err = client.Jobs().Register(&api.Job{ID: pointer.Of("anywhere"), Name: pointer.Of("anywhere")}, nil)
+	assert.Error(t, err)
+	assert.Len(t, p.Nomad.Requests(), 1, "rejected jobs are not sent to nomad")
+}
@@ -1,6 +1,7 @@
 package testutil
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"os"
@@ -54,7 +55,7 @@ type MockMutator struct {
 	mock.Mock
 }
 
-func (m *MockMutator) Mutate(job *api.Job) (out *api.Job, warnings []error, err error) {
+func (m *MockMutator) Mutate(ctx context.Context, job *api.Job) (out *api.Job, warnings []error, err error) {
 	args := m.Called(job)
 	return args.Get(0).(*api.Job), args.Get(1).([]error), args.Error(2)
 }
@@ -66,7 +67,7 @@ type MockValidator struct {
 	mock.Mock
 }
 
-func (m *MockValidator) Validate(job *api.Job) (warnings []error, err error) {
+func (m *MockValidator) Validate(ctx context.Context, job *api.Job) (warnings []error, err error) {
 	args := m.Called(job)
 	return args.Get(0).([]error), args.Error(1)
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSetupTracing(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	shutdown, err := setupTracing(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Same(t, previous, otel.GetTracerProvider(), "unconfigured tracing keeps the no-op provider")
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = setupTracing(context.Background(), &config.Tracing{Endpoint: "localhost:4318", Insecure: true})
+	require.NoError(t, err)
+	assert.IsType(t, &sdktrace.TracerProvider{}, otel.GetTracerProvider())
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/jobspec"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/proxy"
+)
+
+// runValidate applies the admission controllers of the config to a job file
+// without starting the server or contacting Nomad. The mutated job is written
+// to stdout, warnings and errors to stderr. It returns the exit code.
+func runValidate(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", "", "point to a nacp config file or a directory of config files")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: nacp validate [-config nacp.hcl] <job file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "nacp",
+		Level:  hclog.Warn,
+		Output: stderr,
+	})
+	c, err := loadConfig(*configFile, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	jobHandler, err := proxy.NewJobHandler(c, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating admission controllers: %s\n", err)
+		return 1
+	}
+	job, err := readJobFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading job: %s\n", err)
+		return 1
+	}
+
+	namespace := api.DefaultNamespace
+	if job.Namespace != nil && *job.Namespace != "" {
+		namespace = *job.Namespace
+	}
+	ctx := admissionctrl.WithRequest(context.Background(), &admissionctrl.Request{
+		Namespace: namespace,
+		Operation: admissionctrl.OperationValidate,
+	})
+	job, warnings, validationErr, err := jobHandler.MutateAndValidate(ctx, job)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error applying mutators: %s\n", err)
+		return 1
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(stderr, "Warning: %s\n", w)
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(struct{ Job *api.Job }{job}); err != nil {
+		fmt.Fprintf(stderr, "Error writing job: %s\n", err)
+		return 1
+	}
+	if validationErr != nil {
+		if merr, ok := validationErr.(*multierror.Error); ok {
+			for _, e := range merr.Errors {
+				fmt.Fprintf(stderr, "Error: %s\n", e)
+			}
+		} else {
+			fmt.Fprintf(stderr, "Error: %s\n", validationErr)
+		}
+		return 1
+	}
+	return 0
+}
+
+// readJobFile reads a job as JSON, either plain or wrapped like `nomad job run -output`,
+// or as HCL using Nomad's HCL1 parser.
+func readJobFile(filename string) (*api.Job, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(filename), ".json") {
+		return jobspec.Parse(strings.NewReader(string(data)))
+	}
+	wrapped := &api.JobRegisterRequest{}
+	if err := json.Unmarshal(data, wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Job != nil {
+		return wrapped.Job, nil
+	}
+	job := &api.Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
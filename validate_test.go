@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+		wantJob    bool
+	}{
+		{
+			name:     "valid hcl job",
+			args:     []string{"-config", "config/testdata/with_admission.hcl", "testdata/example.nomad"},
+			wantCode: 0,
+			wantJob:  true,
+		},
+		{
+			name:       "invalid json job",
+			args:       []string{"-config", "config/testdata/with_admission.hcl", "testdata/job.json"},
+			wantCode:   1,
+			wantStderr: "Error: Every job must have a costcenter metadata label (some_opa_validator)\n",
+			wantJob:    true,
+		},
+		{
+			name:     "default config",
+			args:     []string{"testdata/job.json"},
+			wantCode: 0,
+			wantJob:  true,
+		},
+		{
+			name:     "missing job file",
+			args:     []string{"-config", "config/testdata/with_admission.hcl"},
+			wantCode: 2,
+		},
+		{
+			name:       "unreadable job file",
+			args:       []string{"testdata/doesnotexist.json"},
+			wantCode:   1,
+			wantStderr: "Error reading job: open testdata/doesnotexist.json: no such file or directory\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := runValidate(tt.args, stdout, stderr)
+			assert.Equal(t, tt.wantCode, code, stderr.String())
+			if tt.wantStderr != "" {
+				assert.Equal(t, tt.wantStderr, stderr.String())
+			}
+			if tt.wantJob {
+				out := struct{ Job *api.Job }{}
+				require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+				assert.Equal(t, "example", *out.Job.ID)
+			}
+		})
+	}
+}
+
+func TestRunValidatePrintsMutatedJob(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nacp.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+mutator "meta_defaults" "owner" {
+  meta_defaults {
+    meta = { owner = "platform" }
+  }
+}
+`), 0600))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runValidate([]string{"-config", configFile, "testdata/job.json"}, stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	out := struct{ Job *api.Job }{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	assert.Equal(t, "platform", out.Job.Meta["owner"])
+}
@@ -0,0 +1,36 @@
+// Package version holds the build information of NACP, set at build time with
+//
+//	go build -ldflags "-X github.com/mxab/nacp/version.Version=v1.0.0 -X github.com/mxab/nacp/version.Commit=$(git rev-parse HEAD) -X github.com/mxab/nacp/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "runtime/debug"
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Get returns the build information. Without ldflags the commit and
+// build date fall back to the vcs settings embedded by the go tool.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,17 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	defer func(version, commit, buildDate string) {
+		Version, Commit, BuildDate = version, commit, buildDate
+	}(Version, Commit, BuildDate)
+
+	Version, Commit, BuildDate = "v1.2.3", "abc123", "2023-06-01T12:00:00Z"
+
+	assert.Equal(t, Info{Version: "v1.2.3", Commit: "abc123", BuildDate: "2023-06-01T12:00:00Z"}, Get())
+}